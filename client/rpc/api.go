@@ -258,6 +258,10 @@ func (api *HttpApi) Routing() iface.RoutingAPI {
 	return (*RoutingAPI)(api)
 }
 
+func (api *HttpApi) Files() iface.FilesAPI {
+	return (*FilesAPI)(api)
+}
+
 func (api *HttpApi) loadRemoteVersion() (*semver.Version, error) {
 	api.versionMu.Lock()
 	defer api.versionMu.Unlock()
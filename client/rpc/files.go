@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	caopts "github.com/ipfs/kubo/core/coreiface/options"
+)
+
+type FilesAPI HttpApi
+
+func (api *FilesAPI) Batch(ctx context.Context, ops []iface.FilesOp, opts ...caopts.FilesBatchOption) (path.ImmutablePath, error) {
+	options, err := caopts.FilesBatchOptions(opts...)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			return path.ImmutablePath{}, err
+		}
+	}
+
+	var out struct {
+		Root string
+	}
+	err = api.core().Request("files/batch").
+		Option("dry-run", options.DryRun).
+		FileBody(&body).
+		Exec(ctx, &out)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+
+	c, err := cid.Decode(out.Root)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	return path.FromCid(c), nil
+}
+
+func (api *FilesAPI) core() *HttpApi {
+	return (*HttpApi)(api)
+}
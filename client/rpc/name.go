@@ -3,8 +3,10 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/ipfs/boxo/ipns"
 	"github.com/ipfs/boxo/namesys"
@@ -60,6 +62,9 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 		Option("dht-record-count", ropts.DhtRecordCount).
 		Option("dht-timeout", ropts.DhtTimeout).
 		Option("stream", true)
+	if options.Trace != nil {
+		req.Option("trace", true)
+	}
 	resp, err := req.Send(ctx)
 	if err != nil {
 		return nil, err
@@ -77,11 +82,22 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 		dec := json.NewDecoder(resp.Output)
 
 		for {
-			var out struct{ Path string }
+			var out struct {
+				Path  string
+				Trace *traceEvent
+			}
 			err := dec.Decode(&out)
 			if err == io.EOF {
 				return
 			}
+			if err == nil && out.Trace != nil {
+				select {
+				case options.Trace <- out.Trace.toIface():
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
 			var ires iface.IpnsResult
 			if err == nil {
 				p, err := path.NewPath(out.Path)
@@ -115,6 +131,20 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 		return nil, fmt.Errorf("Name.Resolve: depth other than 1 or %d not supported", namesys.DefaultDepthLimit)
 	}
 
+	if options.Trace != nil {
+		// traces are streamed before the resolved path
+		results, err := api.Search(ctx, name, opts...)
+		if err != nil {
+			return nil, err
+		}
+		err = iface.ErrResolveFailed
+		var p path.Path
+		for res := range results {
+			p, err = res.Path, res.Err
+		}
+		return p, err
+	}
+
 	req := api.core().Request("name/resolve", name).
 		Option("nocache", !options.Cache).
 		Option("recursive", ropts.Depth != 1).
@@ -129,6 +159,52 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 	return path.NewPath(out.Path)
 }
 
+// traceEvent is the JSON form of a traced resolution step, as emitted by
+// 'ipfs name resolve --trace'.
+type traceEvent struct {
+	Type     iface.NameTraceEventType
+	Name     string
+	Source   string
+	Duration time.Duration
+	Records  []struct {
+		Source   string
+		Value    string
+		Sequence uint64
+		Validity time.Time
+		TTL      time.Duration
+		Error    string
+	}
+	Reason string
+	Error  string
+}
+
+func (ev *traceEvent) toIface() *iface.NameTraceEvent {
+	out := &iface.NameTraceEvent{
+		Type:     ev.Type,
+		Name:     ev.Name,
+		Source:   ev.Source,
+		Duration: ev.Duration,
+		Reason:   ev.Reason,
+	}
+	if ev.Error != "" {
+		out.Err = errors.New(ev.Error)
+	}
+	for _, r := range ev.Records {
+		rec := iface.NameTraceRecord{
+			Source:   r.Source,
+			Sequence: r.Sequence,
+			Validity: r.Validity,
+			TTL:      r.TTL,
+		}
+		rec.Value, _ = path.NewPath(r.Value)
+		if r.Error != "" {
+			rec.Err = errors.New(r.Error)
+		}
+		out.Records = append(out.Records, rec)
+	}
+	return out
+}
+
 func (api *NameAPI) core() *HttpApi {
 	return (*HttpApi)(api)
 }
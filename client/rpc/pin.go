@@ -57,6 +57,9 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 	if options.Name != "" {
 		req = req.Option("name", options.Name)
 	}
+	if options.Provide != "" {
+		req = req.Option("provide", options.Provide)
+	}
 	return req.Exec(ctx, nil)
 }
 
@@ -698,6 +698,11 @@ take effect.
 	// start MFS pinning thread
 	startPinMFS(cctx, daemonConfigPollInterval, &ipfsPinMFSNode{node})
 
+	// start MFS auto-publishing thread
+	if err := startMFSAutoPublish(cctx, node); err != nil {
+		return err
+	}
+
 	// The daemon is *finally* ready.
 	fmt.Printf("Daemon is ready\n")
 	notifyReady()
@@ -1111,6 +1116,7 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 
 	opts := []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
+		corehttp.GatewayAccessLogOption(),
 		corehttp.HostnameOption(),
 		corehttp.GatewayOption("/ipfs", "/ipns"),
 		corehttp.VersionOption(),
@@ -0,0 +1,59 @@
+package kubo
+
+import (
+	"context"
+
+	bservice "github.com/ipfs/boxo/blockservice"
+	offline "github.com/ipfs/boxo/exchange/offline"
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/path"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coremfs"
+	"github.com/ipfs/kubo/core/node"
+)
+
+// startMFSAutoPublish publishes MFS subtrees listed in MFS.AutoPublish
+// whenever a flush changes them.
+func startMFSAutoPublish(cctx pinMFSContext, nd *core.IpfsNode) error {
+	cfg, err := cctx.GetConfig()
+	if err != nil {
+		return err
+	}
+	if err := coremfs.ValidateAutoPublishRules(cfg.MFS.AutoPublish); err != nil {
+		return err
+	}
+
+	api, err := coreapi.NewCoreAPI(nd)
+	if err != nil {
+		return err
+	}
+
+	ap := &coremfs.AutoPublisher{
+		Datastore: nd.Repo.Datastore(),
+		// flushed MFS content is local, never go to the network for it
+		DAG: dag.NewDAGService(bservice.New(nd.Blockstore, offline.Exchange(nd.Blockstore))),
+		// The root persisted by the MFS republisher only changes on flush,
+		// and reading it does not sync the MFS directory cache.
+		Root: func(ctx context.Context) (cid.Cid, error) {
+			val, err := nd.Repo.Datastore().Get(ctx, node.FilesRootDatastoreKey)
+			if err != nil {
+				return cid.Undef, err
+			}
+			return cid.Cast(val)
+		},
+		Flushes: nd.FilesRootFlushes.Subscribe(cctx.Context()),
+		Config:  cctx.GetConfig,
+		Publish: func(ctx context.Context, keyName string, c cid.Cid) error {
+			_, err := api.Name().Publish(ctx, path.FromCid(c),
+				options.Name.Key(keyName),
+				options.Name.AllowOffline(true),
+			)
+			return err
+		},
+	}
+	go ap.Run(cctx.Context())
+	return nil
+}
@@ -7,9 +7,55 @@ type Bitswap struct {
 	Libp2pEnabled Flag `json:",omitempty"`
 	// ServerEnabled controls if the node responds to WANTs (depends on Libp2pEnabled, enabled by default)
 	ServerEnabled Flag `json:",omitempty"`
+	// Server restricts which peers the Bitswap server responds to, and how
+	// much it serves them (only applies when ServerEnabled)
+	Server BitswapServer
+}
+
+// BitswapServer configures access control and per-peer quotas of the
+// Bitswap server. Requests that are denied are answered with DONT_HAVE.
+type BitswapServer struct {
+	// Allowlist is the list of peer IDs the server responds to. Empty means
+	// all peers not in Denylist.
+	Allowlist []string `json:",omitempty"`
+	// Denylist is the list of peer IDs the server never responds to.
+	Denylist []string `json:",omitempty"`
+	// MaxBytesPerSecondPerPeer caps the rate of the blocks served to each
+	// peer, e.g. "1MiB". 0 means unlimited.
+	// Default: DefaultBitswapServerMaxBytesPerSecondPerPeer
+	MaxBytesPerSecondPerPeer *OptionalBytes `json:",omitempty"`
+	// MaxDailyBytesPerPeer caps the bytes of the blocks served to each peer
+	// per day of local time, e.g. "10GiB". 0 means unlimited.
+	// Default: DefaultBitswapServerMaxDailyBytesPerPeer
+	MaxDailyBytesPerPeer *OptionalBytes `json:",omitempty"`
+	// ServeOnlyPinned restricts serving to pinned blocks, directly or as
+	// part of a recursively pinned DAG.
+	// Default: DefaultBitswapServerServeOnlyPinned
+	ServeOnlyPinned Flag `json:",omitempty"`
+	// Strategy decides which peers are served first when several are
+	// waiting: "fair", "reciprocity" or "peered".
+	// Default: DefaultBitswapServerStrategy
+	Strategy *OptionalString `json:",omitempty"`
 }
 
 const (
 	DefaultBitswapLibp2pEnabled = true
 	DefaultBitswapServerEnabled = true
+
+	DefaultBitswapServerMaxBytesPerSecondPerPeer = 0 // unlimited
+	DefaultBitswapServerMaxDailyBytesPerPeer     = 0 // unlimited
+	DefaultBitswapServerServeOnlyPinned          = false
+	DefaultBitswapServerStrategy                 = BitswapStrategyFair
+)
+
+const (
+	// BitswapStrategyFair is the default scheduling of the Bitswap server,
+	// which balances the work between the peers waiting.
+	BitswapStrategyFair = "fair"
+	// BitswapStrategyReciprocity serves first the peers that sent the most
+	// to this node relative to what it sent them, according to the ledgers
+	// kept by the node, after the peers in Peering.Peers.
+	BitswapStrategyReciprocity = "reciprocity"
+	// BitswapStrategyPeered serves first the peers in Peering.Peers.
+	BitswapStrategyPeered = "peered"
 )
@@ -43,6 +43,7 @@ type Config struct {
 	Plugins       Plugins
 	Pinning       Pinning
 	Import        Import
+	MFS           MFS
 	Version       Version
 
 	Internal Internal // experimental/unstable options
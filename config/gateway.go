@@ -11,12 +11,23 @@ const (
 	DefaultExposeRoutingAPI      = true
 	DefaultDiagnosticServiceURL  = "https://check.ipfs.network"
 	DefaultAllowCodecConversion  = false
+	DefaultGatewayRetrievalTrace = false
 
 	// Gateway limit defaults from boxo
 	DefaultRetrievalTimeout        = gateway.DefaultRetrievalTimeout
 	DefaultMaxRequestDuration      = gateway.DefaultMaxRequestDuration
 	DefaultMaxConcurrentRequests   = gateway.DefaultMaxConcurrentRequests
 	DefaultMaxRangeRequestFileSize = 0 // 0 means no limit
+
+	DefaultGatewayAccessLogFormat     = GatewayAccessLogFormatJSON
+	DefaultGatewayAccessLogMaxSize    = 100 << 20 // 100 MiB
+	DefaultGatewayAccessLogMaxBackups = 5
+)
+
+// Gateway.AccessLog.Format values.
+const (
+	GatewayAccessLogFormatJSON   = "json"
+	GatewayAccessLogFormatCommon = "common"
 )
 
 type GatewaySpec struct {
@@ -47,6 +58,44 @@ type GatewaySpec struct {
 	// responses. Disabling this option enables a Trustless Gateway, as per:
 	// https://specs.ipfs.tech/http-gateways/trustless-gateway/.
 	DeserializedResponses Flag
+
+	// Limits caps what all the clients of this gateway, together, can
+	// request from it. Clients are still limited individually by
+	// Gateway.ClientLimits.
+	Limits GatewayLimits
+}
+
+// GatewayLimits caps the requests of a gateway client, or of all the clients
+// of a public gateway hostname. Unset or zero limits are disabled.
+type GatewayLimits struct {
+	// RequestsPerSecond is the average number of requests per second, with
+	// bursts of up to one second of requests.
+	RequestsPerSecond *OptionalInteger `json:",omitempty"`
+
+	// MaxConcurrentRequests is the number of requests served at once.
+	MaxConcurrentRequests *OptionalInteger `json:",omitempty"`
+
+	// MaxDailyBytes is the number of response bytes served per day, local
+	// time.
+	MaxDailyBytes *OptionalBytes `json:",omitempty"`
+}
+
+// GatewayAccessLog configures the log of the requests served by the gateway.
+type GatewayAccessLog struct {
+	// Path is the file the log is written to, relative to the repo
+	// directory when not absolute. Unset or empty disables the log.
+	Path *OptionalString `json:",omitempty"`
+
+	// Format is "json" for one JSON object per line, or "common" for the
+	// Common Log Format extended with the fields it lacks.
+	Format *OptionalString `json:",omitempty"`
+
+	// MaxSize is the size after which the file is rotated. A value of 0
+	// disables rotation.
+	MaxSize *OptionalBytes `json:",omitempty"`
+
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups *OptionalInteger `json:",omitempty"`
 }
 
 // Gateway contains options for the HTTP gateway server.
@@ -117,12 +166,30 @@ type Gateway struct {
 	// A value of 0 disables the limit.
 	MaxConcurrentRequests *OptionalInteger `json:",omitempty"`
 
+	// ClientLimits caps the requests of each client, identified by its IP
+	// address (its /64 prefix for IPv6). Clients over a limit receive 429 Too
+	// Many Requests with Retry-After header.
+	ClientLimits GatewayLimits
+
+	// TrustedProxies lists the addresses, or CIDR ranges, of the reverse
+	// proxies in front of the gateway. Requests coming from them are
+	// attributed to the client in their X-Forwarded-For header.
+	TrustedProxies []string `json:",omitempty"`
+
+	// AccessLog configures the log of the requests served by the gateway.
+	AccessLog GatewayAccessLog
+
 	// MaxRangeRequestFileSize limits the maximum file size for HTTP range requests.
 	// Range requests for files larger than this limit return 501 Not Implemented.
 	// This protects against CDN issues with large file range requests and prevents
 	// excessive bandwidth consumption. A value of 0 disables the limit.
 	MaxRangeRequestFileSize *OptionalBytes `json:",omitempty"`
 
+	// RetrievalTrace lets gateway clients trace the retrieval of their
+	// requests with the X-Ipfs-Retrieval-Trace header. Traces reveal the
+	// peers content was fetched from.
+	RetrievalTrace Flag `json:",omitempty"`
+
 	// DiagnosticServiceURL is the URL for a service to diagnose CID retrievability issues.
 	// When the gateway returns a 504 Gateway Timeout error, an "Inspect retrievability of CID"
 	// button will be shown that links to this service with the CID appended as ?cid=<CID-to-diagnose>.
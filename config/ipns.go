@@ -7,6 +7,7 @@ import (
 
 const (
 	DefaultIpnsMaxCacheTTL = time.Duration(math.MaxInt64)
+	DefaultIpnsArchiveKeep = 100
 )
 
 type Ipns struct {
@@ -23,4 +24,21 @@ type Ipns struct {
 
 	// Simplified configuration for delegated IPNS publishers
 	DelegatedPublishers []string
+
+	// Keys overrides RepublishPeriod and RecordLifetime for the records of
+	// individual keys, by keystore key name ("self" for the node identity).
+	Keys map[string]IpnsKey `json:",omitempty"`
+
+	// ArchiveKeep is the number of records kept in the archive of each name,
+	// the records with the lowest sequence numbers being removed first.
+	ArchiveKeep *OptionalInteger `json:",omitempty"`
+}
+
+// IpnsKey holds the republisher settings of a single key.
+type IpnsKey struct {
+	// RepublishPeriod is how often the record of the key is republished.
+	RepublishPeriod *OptionalDuration `json:",omitempty"`
+
+	// RecordLifetime is how long republished records of the key are valid.
+	RecordLifetime *OptionalDuration `json:",omitempty"`
 }
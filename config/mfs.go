@@ -0,0 +1,49 @@
+package config
+
+import "time"
+
+// MFS is the configuration object for the Mutable File System
+// (the 'ipfs files' API). Implicit defaults can be found in core/coremfs.
+type MFS struct {
+	// AutoSnapshot records a snapshot of the MFS root before destructive
+	// operations ('files rm -r', 'files chroot', 'files snapshot restore'),
+	// so they can be undone with 'ipfs files snapshot restore'.
+	AutoSnapshot Flag `json:",omitempty"`
+
+	// AutoSnapshotKeep is the number of automatic snapshots to retain.
+	// Older automatic snapshots are removed when a new one is taken. Named
+	// snapshots created with 'ipfs files snapshot create' are never pruned.
+	AutoSnapshotKeep *OptionalInteger `json:",omitempty"`
+
+	// AutoPublish lists MFS paths that the daemon publishes to IPNS
+	// whenever their CID changes. See 'ipfs name autopublish ls'.
+	AutoPublish []MFSAutoPublishRule `json:",omitempty"`
+
+	// Journal records unflushed MFS changes in the datastore so they can be
+	// replayed on the next start if the daemon stops without flushing them.
+	Journal Flag `json:",omitempty"`
+}
+
+// MFSAutoPublishRule maps an MFS path to the keystore key its CID is
+// published under.
+type MFSAutoPublishRule struct {
+	// Path is the MFS path to follow, e.g. "/www/example.com".
+	Path string
+
+	// Key is the name of the keystore key to publish with, "self" being the
+	// node identity. Each key can be used by a single rule.
+	Key string
+
+	// Debounce is how long Path must stay unchanged before a new CID is
+	// published, so that a burst of writes results in a single record.
+	Debounce *OptionalDuration `json:",omitempty"`
+}
+
+const (
+	DefaultMFSAutoSnapshot     = false
+	DefaultMFSAutoSnapshotKeep = 10
+
+	DefaultMFSAutoPublishDebounce = 10 * time.Second
+
+	DefaultMFSJournal = false
+)
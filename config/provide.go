@@ -39,6 +39,9 @@ const (
 	DefaultProvideDHTKeystoreBatchSize         = 1 << 14 // ~544 KiB per batch (1 multihash = 34 bytes)
 	DefaultProvideDHTOfflineDelay              = 2 * time.Hour
 	DefaultProvideDHTSendProviderRecordTimeout = 10 * time.Second
+	DefaultProvideDHTMaxMessagesPerSecond      = 0  // unlimited
+	DefaultProvideDHTMaxBytesPerSecond         = 0  // unlimited
+	DefaultProvideDHTActiveHours               = "" // always active
 
 	// DefaultFastProvideTimeout is the maximum time allowed for fast-provide operations.
 	// Prevents hanging on network issues when providing root CID.
@@ -129,6 +132,22 @@ type ProvideDHT struct {
 	// Default: DefaultProvideDHTSendProviderRecordTimeout
 	SendProviderRecordTimeout *OptionalDuration `json:",omitempty"`
 
+	// MaxMessagesPerSecond caps the messages the provider sends to DHT servers
+	// per second. 0 means unlimited (sweep mode only).
+	// Default: DefaultProvideDHTMaxMessagesPerSecond
+	MaxMessagesPerSecond *OptionalInteger `json:",omitempty"`
+
+	// MaxBytesPerSecond caps the bytes of the messages the provider sends to
+	// DHT servers per second, e.g. "256KiB". 0 means unlimited (sweep mode only).
+	// Default: DefaultProvideDHTMaxBytesPerSecond
+	MaxBytesPerSecond *OptionalBytes `json:",omitempty"`
+
+	// ActiveHours restricts sending provider records to a daily window of
+	// local time, as "HH:MM-HH:MM". The window may span midnight, e.g.
+	// "22:00-06:00". Empty means always active (sweep mode only).
+	// Default: DefaultProvideDHTActiveHours
+	ActiveHours *OptionalString `json:",omitempty"`
+
 	// ResumeEnabled controls whether the provider resumes from its previous state on restart.
 	// When enabled, the provider persists its reprovide cycle state and provide queue to the datastore,
 	// and restores them on restart. When disabled, the provider starts fresh on each restart.
@@ -288,9 +307,53 @@ func ValidateProvideConfig(cfg *Provide) error {
 		}
 	}
 
+	// Validate MaxMessagesPerSecond
+	if !cfg.DHT.MaxMessagesPerSecond.IsDefault() {
+		rate := cfg.DHT.MaxMessagesPerSecond.WithDefault(DefaultProvideDHTMaxMessagesPerSecond)
+		if rate < 0 {
+			return fmt.Errorf("Provide.DHT.MaxMessagesPerSecond must be non-negative, got %d", rate)
+		}
+	}
+
+	// Validate ActiveHours
+	if _, _, _, err := ParseActiveHours(cfg.DHT.ActiveHours.WithDefault(DefaultProvideDHTActiveHours)); err != nil {
+		return fmt.Errorf("Provide.DHT.ActiveHours: %w", err)
+	}
+
 	return nil
 }
 
+// ParseActiveHours parses a daily window of local time given as
+// "HH:MM-HH:MM" and returns its start and end as offsets from midnight. ok is
+// false when s is empty, meaning always active. The end may be before the
+// start, for a window spanning midnight.
+func ParseActiveHours(s string) (start, end time.Duration, ok bool, err error) {
+	if s == "" {
+		return 0, 0, false, nil
+	}
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", s)
+	}
+	parse := func(hm string) (time.Duration, error) {
+		t, err := time.Parse("15:04", strings.TrimSpace(hm))
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q in window %q, expected HH:MM", hm, s)
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+	if start, err = parse(from); err != nil {
+		return 0, 0, false, err
+	}
+	if end, err = parse(to); err != nil {
+		return 0, 0, false, err
+	}
+	if start == end {
+		return 0, 0, false, fmt.Errorf("empty window %q", s)
+	}
+	return start, end, true, nil
+}
+
 // ShouldProvideForStrategy determines if content should be provided based on the provide strategy
 // and content characteristics (pinned status, root status, MFS status).
 func ShouldProvideForStrategy(strategy ProvideStrategy, isPinned bool, isPinnedRoot bool, isMFS bool) bool {
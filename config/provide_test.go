@@ -355,3 +355,25 @@ func TestShouldProvideForStrategy(t *testing.T) {
 		assert.False(t, ShouldProvideForStrategy(ProvideStrategy(0), true, true, true))
 	})
 }
+
+func TestParseActiveHours(t *testing.T) {
+	start, end, ok, err := ParseActiveHours("22:00-06:30")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 22*time.Hour, start)
+	assert.Equal(t, 6*time.Hour+30*time.Minute, end)
+
+	_, _, ok, err = ParseActiveHours("")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, s := range []string{"22:00", "25:00-06:00", "08:00-08:00", "8h-9h"} {
+		_, _, _, err := ParseActiveHours(s)
+		assert.Error(t, err, s)
+	}
+
+	err = ValidateProvideConfig(&Provide{DHT: ProvideDHT{ActiveHours: NewOptionalString("9-17")}})
+	assert.ErrorContains(t, err, "Provide.DHT.ActiveHours")
+	err = ValidateProvideConfig(&Provide{DHT: ProvideDHT{MaxMessagesPerSecond: NewOptionalInteger(-1)}})
+	assert.ErrorContains(t, err, "must be non-negative")
+}
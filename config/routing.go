@@ -7,6 +7,7 @@ import (
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,6 +18,12 @@ const (
 	PublicGoodDelegatedRoutingURL    = "https://delegated-ipfs.dev" // cid.contact + amino dht (incl. IPNS PUTs)
 	EnvHTTPRouters                   = "IPFS_HTTP_ROUTERS"
 	EnvHTTPRoutersFilterProtocols    = "IPFS_HTTP_ROUTERS_FILTER_PROTOCOLS"
+
+	DefaultCachingRouterStore        = CachingRouterStoreMemory
+	DefaultCachingRouterProvidersTTL = 5 * time.Minute
+	DefaultCachingRouterPeersTTL     = 5 * time.Minute
+	DefaultCachingRouterNegativeTTL  = time.Minute
+	DefaultCachingRouterMaxEntries   = 10000
 )
 
 var (
@@ -113,6 +120,8 @@ func (r *RouterParser) UnmarshalJSON(b []byte) error {
 		p = &ComposableRouterParams{}
 	case RouterTypeParallel:
 		p = &ComposableRouterParams{}
+	case RouterTypeCaching:
+		p = &CachingRouterParams{}
 	}
 
 	if err := json.Unmarshal(*raw, &p); err != nil {
@@ -134,6 +143,7 @@ const (
 	RouterTypeDHT        RouterType = "dht"        // DHT router.
 	RouterTypeSequential RouterType = "sequential" // Router helper to execute several routers sequentially.
 	RouterTypeParallel   RouterType = "parallel"   // Router helper to execute several routers in parallel.
+	RouterTypeCaching    RouterType = "caching"    // Router helper caching the provider and peer lookups of another router.
 )
 
 type DHTMode string
@@ -189,6 +199,35 @@ type ComposableRouterParams struct {
 	Timeout *OptionalDuration `json:",omitempty"`
 }
 
+// Stores of the caching router.
+const (
+	CachingRouterStoreMemory    = "memory"
+	CachingRouterStoreDatastore = "datastore"
+)
+
+type CachingRouterParams struct {
+	// RouterName is the router whose results are cached. Every method is
+	// forwarded to it; only provider and peer lookups are cached.
+	RouterName string
+
+	// Store is where results are kept: "memory" (default), or "datastore"
+	// to keep them across restarts.
+	Store string `json:",omitempty"`
+
+	// ProvidersTTL is how long the providers found for a CID are reused.
+	ProvidersTTL *OptionalDuration `json:",omitempty"`
+
+	// PeersTTL is how long the addresses found for a peer are reused.
+	PeersTTL *OptionalDuration `json:",omitempty"`
+
+	// NegativeTTL is how long lookups that found nothing are remembered.
+	// Zero disables negative caching.
+	NegativeTTL *OptionalDuration `json:",omitempty"`
+
+	// MaxEntries bounds the number of results kept in memory.
+	MaxEntries *OptionalInteger `json:",omitempty"`
+}
+
 type ConfigRouter struct {
 	RouterName   string
 	Timeout      Duration
@@ -260,6 +299,11 @@ func (c *Config) routerSupportsHTTPProviding(routerName string) bool {
 				}
 			}
 		}
+	case RouterTypeCaching:
+		// Provides go through to the cached router
+		if params, ok := rp.Parameters.(*CachingRouterParams); ok {
+			return c.routerSupportsHTTPProviding(params.RouterName)
+		}
 	}
 	return false
 }
@@ -104,6 +104,40 @@ func TestRouterParameters(t *testing.T) {
 	require.IsType(&ComposableRouterParams{}, pp)
 }
 
+func TestCachingRouterParameters(t *testing.T) {
+	require := require.New(t)
+	min := time.Minute
+	r := Routing{
+		Type: NewOptionalString("custom"),
+		Routers: map[string]RouterParser{
+			"router-dht": {Router{
+				Type:       RouterTypeDHT,
+				Parameters: DHTRouterParams{Mode: "auto"},
+			}},
+			"router-caching": {Router{
+				Type: RouterTypeCaching,
+				Parameters: CachingRouterParams{
+					RouterName:   "router-dht",
+					Store:        CachingRouterStoreDatastore,
+					ProvidersTTL: &OptionalDuration{&min},
+				},
+			}},
+		},
+	}
+
+	out, err := json.Marshal(r)
+	require.NoError(err)
+
+	r2 := &Routing{}
+	require.NoError(json.Unmarshal(out, r2))
+
+	cp := r2.Routers["router-caching"].Parameters
+	require.IsType(&CachingRouterParams{}, cp)
+	require.Equal("router-dht", cp.(*CachingRouterParams).RouterName)
+	require.Equal(CachingRouterStoreDatastore, cp.(*CachingRouterParams).Store)
+	require.Equal(time.Minute, cp.(*CachingRouterParams).ProvidersTTL.WithDefault(0))
+}
+
 func TestMethods(t *testing.T) {
 	require := require.New(t)
 
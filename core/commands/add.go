@@ -12,6 +12,7 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/corepin"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/ipfs/boxo/files"
@@ -51,6 +52,7 @@ const (
 	onlyHashOptionName          = "only-hash"
 	chunkerOptionName           = "chunker"
 	pinOptionName               = "pin"
+	provideOptionName           = "provide"
 	rawLeavesOptionName         = "raw-leaves"
 	maxFileLinksOptionName      = "max-file-links"
 	maxDirectoryLinksOptionName = "max-directory-links"
@@ -263,6 +265,7 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 		cmds.BoolOption(wrapOptionName, "w", "Wrap files with a directory object."),
 		cmds.BoolOption(pinOptionName, "Pin locally to protect added files from garbage collection.").WithDefault(true),
 		cmds.StringOption(pinNameOptionName, "Name to use for the pin. Requires explicit value (e.g., --pin-name=myname)."),
+		cmds.StringOption(provideOptionName, "Provide policy of the pin: \"all\", \"roots\" or \"none\". See 'ipfs pin add --help'. Default: Provide.Strategy"),
 		// MFS Integration
 		cmds.StringOption(toFilesOptionName, "Add reference to Files API (MFS) at the provided path."),
 		// CID & Hashing
@@ -330,6 +333,7 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 		chunker, _ := req.Options[chunkerOptionName].(string)
 		dopin, _ := req.Options[pinOptionName].(bool)
 		pinName, pinNameSet := req.Options[pinNameOptionName].(string)
+		provideStr, _ := req.Options[provideOptionName].(string)
 		rawblks, rbset := req.Options[rawLeavesOptionName].(bool)
 		maxFileLinks, maxFileLinksSet := req.Options[maxFileLinksOptionName].(int)
 		maxDirectoryLinks, maxDirectoryLinksSet := req.Options[maxDirectoryLinksOptionName].(int)
@@ -444,6 +448,18 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 		if !dopin && pinNameSet {
 			return fmt.Errorf("%s option requires %s to be set", pinNameOptionName, pinOptionName)
 		}
+		providePolicy, err := corepin.ParseProvidePolicy(provideStr)
+		if err != nil {
+			return err
+		}
+		if providePolicy != corepin.ProvideDefault {
+			if !dopin {
+				return fmt.Errorf("%s option requires %s to be set", provideOptionName, pinOptionName)
+			}
+			if err := corepin.CheckProvidePolicy(nd.ProvidingStrategy, providePolicy); err != nil {
+				return err
+			}
+		}
 		if wrap && toFilesSet {
 			return fmt.Errorf("%s and %s options are not compatible", wrapOptionName, toFilesOptionName)
 		}
@@ -565,6 +581,13 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 				// Store the root CID for potential fast-provide operation
 				lastRootCid = pathAdded
 
+				if dopin && providePolicy != corepin.ProvideDefault {
+					if err := corepin.SetProvidePolicy(req.Context, ipfsNode.Repo.Datastore(), pathAdded.RootCid(), providePolicy); err != nil {
+						errCh <- err
+						return
+					}
+				}
+
 				// creating MFS pointers when optional --to-files is set
 				if toFilesSet {
 					// The link creates new MFS directory nodes that are not
@@ -695,6 +718,7 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 		}
 
 		hasRoot := lastRootCid != path.ImmutablePath{}
+		provideStrategy, fastProvideRoot, fastProvideDAG := providePolicy.FastProvide(ipfsNode.ProvidingStrategy, fastProvideRoot, fastProvideDAG)
 
 		if fastProvideDAG && hasRoot {
 			// DAG walk includes the root CID (DFS pre-order emits it
@@ -703,7 +727,7 @@ https://github.com/ipfs/kubo/blob/master/docs/config.md#import
 				req.Context,
 				ipfsNode.Context(),
 				[]cid.Cid{lastRootCid.RootCid()},
-				ipfsNode.ProvidingStrategy,
+				provideStrategy,
 				ipfsNode.Blockstore,
 				ipfsNode.Provider,
 				fastProvideWait,
@@ -3,8 +3,10 @@ package commands
 import (
 	"fmt"
 	"io"
+	"time"
 
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/node"
 
 	humanize "github.com/dustin/go-humanize"
 	bitswap "github.com/ipfs/boxo/bitswap"
@@ -24,6 +26,8 @@ var BitswapCmd = &cmds.Command{
 		"stat":      bitswapStatCmd,
 		"wantlist":  showWantlistCmd,
 		"ledger":    ledgerCmd,
+		"fetch":     bitswapFetchCmd,
+		"trace":     bitswapTraceCmd,
 		"reprovide": deprecatedBitswapReprovideCmd,
 	},
 }
@@ -168,6 +172,16 @@ var bitswapStatCmd = &cmds.Command{
 	},
 }
 
+// bitswapLedger is the ledger of a peer, with what the server served it today
+// when Bitswap.Server restricts serving.
+type bitswapLedger struct {
+	server.Receipt
+	Server *node.BitswapPeerStat `json:",omitempty"`
+	// Total is the persisted ledger, covering the exchanges before the last
+	// restart.
+	Total *node.BitswapLedgerStat `json:",omitempty"`
+}
+
 var ledgerCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the current ledger for a peer.",
@@ -175,12 +189,24 @@ var ledgerCmd = &cmds.Command{
 The Bitswap decision engine tracks the number of bytes exchanged between IPFS
 nodes, and stores this information as a collection of ledgers. This command
 prints the ledger associated with a given peer.
+
+The ledger of the decision engine starts over when the node restarts. The
+totals of the blocks exchanged with the peer are kept in the datastore, see
+'ipfs bitswap ledger ls' and 'ipfs bitswap ledger reset'.
+
+When Bitswap.Server restricts serving, the ledger also shows whether the peer
+is allowed, the block bytes served to it and the requests denied to it today,
+and its quotas.
 `,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    bitswapLedgerLsCmd,
+		"reset": bitswapLedgerResetCmd,
+	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("peer", true, false, "The PeerID (B58) of the ledger to inspect."),
 	},
-	Type: server.Receipt{},
+	Type: bitswapLedger{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -196,17 +222,48 @@ prints the ledger associated with a given peer.
 			return err
 		}
 
-		return cmds.EmitOnce(res, nd.Bitswap.LedgerForPeer(partner))
+		out := &bitswapLedger{Receipt: *nd.Bitswap.LedgerForPeer(partner)}
+		if nd.BitswapServerPolicy != nil {
+			st := nd.BitswapServerPolicy.PeerStat(partner)
+			out.Server = &st
+		}
+		if nd.BitswapLedgers != nil {
+			if st, ok := nd.BitswapLedgers.Ledger(partner); ok {
+				out.Total = &st
+			}
+		}
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *server.Receipt) error {
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *bitswapLedger) error {
 			fmt.Fprintf(w, "Ledger for %s\n"+
 				"Debt ratio:\t%f\n"+
 				"Exchanges:\t%d\n"+
 				"Bytes sent:\t%d\n"+
-				"Bytes received:\t%d\n\n",
+				"Bytes received:\t%d\n",
 				out.Peer, out.Value, out.Exchanged,
 				out.Sent, out.Recv)
+			if st := out.Server; st != nil {
+				fmt.Fprintf(w, "Allowed:\t%t\n"+
+					"Served today:\t%d\n"+
+					"Denied today:\t%d\n",
+					st.Allowed, st.ServedToday, st.DeniedToday)
+				if st.DailyQuota > 0 {
+					fmt.Fprintf(w, "Daily quota:\t%d\n", st.DailyQuota)
+				}
+				if st.BytesPerSecond > 0 {
+					fmt.Fprintf(w, "Rate quota:\t%d/s\n", st.BytesPerSecond)
+				}
+			}
+			if t := out.Total; t != nil {
+				fmt.Fprintf(w, "Total bytes sent:\t%d\n"+
+					"Total bytes received:\t%d\n"+
+					"Reciprocity:\t%.2f\n"+
+					"Last exchange:\t%s\n",
+					t.BytesSent, t.BytesReceived, t.Ratio(),
+					t.LastExchange.Format(time.RFC3339))
+			}
+			fmt.Fprintln(w)
 			return nil
 		}),
 	},
@@ -0,0 +1,364 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	merkledag "github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/path"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/commands/e"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/corerepo"
+)
+
+const (
+	bitswapFetchMaxDepthOptionName     = "max-depth"
+	bitswapFetchConcurrencyOptionName  = "concurrency"
+	bitswapFetchBlockTimeoutOptionName = "block-timeout"
+	bitswapFetchRetriesOptionName      = "retries"
+	bitswapFetchPinOptionName          = "pin"
+	bitswapFetchPinNameOptionName      = "pin-name"
+	bitswapFetchProtectOptionName      = "protect"
+	bitswapFetchProgressOptionName     = "progress"
+
+	bitswapFetchDefaultConcurrency  = 16
+	bitswapFetchDefaultBlockTimeout = 30 * time.Second
+	bitswapFetchDefaultRetries      = 3
+)
+
+// BitswapFetchOutput reports the progress of 'ipfs bitswap fetch'. Roots is
+// only set once the fetch is complete.
+type BitswapFetchOutput struct {
+	Roots   []string `json:",omitempty"`
+	Blocks  int64
+	Bytes   uint64
+	Retries int64
+	Failed  int64
+}
+
+var bitswapFetchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Fetch DAGs into the local repository.",
+		ShortDescription: `
+'ipfs bitswap fetch' fetches the blocks of the given DAGs through Bitswap and,
+when enabled, HTTP retrieval, to warm the local repository before the content
+is requested. It is like 'ipfs refs -r' with concurrency control and progress.
+`,
+		LongDescription: `
+'ipfs bitswap fetch' fetches the blocks of the given DAGs through Bitswap and,
+when enabled, HTTP retrieval, to warm the local repository before the content
+is requested.
+
+Up to --concurrency blocks are fetched at a time. A block that is not received
+within --block-timeout is requested again, up to --retries times, before it
+is reported as failed. Use --max-depth to fetch only the top of the DAGs: 0
+fetches the roots only, 1 their direct children, and so on.
+
+Fetched blocks are not pinned and can be removed by garbage collection. Use
+--pin to pin the DAGs recursively once they are fetched, or --protect to keep
+them from automatic garbage collection until 'ipfs repo gc' is run explicitly.
+The DAGs are protected before they are fetched, so blocks are kept as they
+arrive, even if the fetch fails or is interrupted.
+
+Pass --progress to track the blocks and bytes fetched.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, true, "Path or CID of the DAGs to fetch.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(bitswapFetchMaxDepthOptionName, "Only fetch blocks up to the given depth, -1 for the full DAGs.").WithDefault(-1),
+		cmds.IntOption(bitswapFetchConcurrencyOptionName, "Number of blocks fetched at a time.").WithDefault(bitswapFetchDefaultConcurrency),
+		cmds.StringOption(bitswapFetchBlockTimeoutOptionName, "Time to wait for a block before requesting it again.").WithDefault(bitswapFetchDefaultBlockTimeout.String()),
+		cmds.IntOption(bitswapFetchRetriesOptionName, "Number of times a block is requested again before failing.").WithDefault(bitswapFetchDefaultRetries),
+		cmds.BoolOption(bitswapFetchPinOptionName, "Pin the fetched DAGs recursively."),
+		cmds.StringOption(bitswapFetchPinNameOptionName, "Name of the pins created with --pin."),
+		cmds.BoolOption(bitswapFetchProtectOptionName, "Keep the fetched DAGs from automatic garbage collection until 'ipfs repo gc' is run."),
+		cmds.BoolOption(bitswapFetchProgressOptionName, "Show progress."),
+	},
+	Type: BitswapFetchOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		if err := req.ParseBodyArgs(); err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		maxDepth, _ := req.Options[bitswapFetchMaxDepthOptionName].(int)
+		concurrency, _ := req.Options[bitswapFetchConcurrencyOptionName].(int)
+		blockTimeoutStr, _ := req.Options[bitswapFetchBlockTimeoutOptionName].(string)
+		retries, _ := req.Options[bitswapFetchRetriesOptionName].(int)
+		pin, _ := req.Options[bitswapFetchPinOptionName].(bool)
+		pinName, pinNameSet := req.Options[bitswapFetchPinNameOptionName].(string)
+		protect, _ := req.Options[bitswapFetchProtectOptionName].(bool)
+		showProgress, _ := req.Options[bitswapFetchProgressOptionName].(bool)
+
+		blockTimeout, err := time.ParseDuration(blockTimeoutStr)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %w", bitswapFetchBlockTimeoutOptionName, err)
+		}
+		if blockTimeout <= 0 {
+			return fmt.Errorf("--%s must be positive", bitswapFetchBlockTimeoutOptionName)
+		}
+		if concurrency < 1 {
+			return fmt.Errorf("--%s must be at least 1", bitswapFetchConcurrencyOptionName)
+		}
+		if retries < 0 {
+			return fmt.Errorf("--%s must not be negative", bitswapFetchRetriesOptionName)
+		}
+		if pin && maxDepth >= 0 {
+			return fmt.Errorf("--%s cannot pin DAGs fetched with --%s", bitswapFetchPinOptionName, bitswapFetchMaxDepthOptionName)
+		}
+		if pinNameSet && !pin {
+			return fmt.Errorf("--%s requires --%s", bitswapFetchPinNameOptionName, bitswapFetchPinOptionName)
+		}
+		if err := cmdutils.ValidatePinName(pinName); err != nil {
+			return err
+		}
+
+		roots, err := objectsForPaths(req.Context, api, req.Arguments)
+		if err != nil {
+			return err
+		}
+
+		f := &dagPrefetcher{
+			dag:          merkledag.NewSession(req.Context, api.Dag()),
+			concurrency:  concurrency,
+			maxDepth:     maxDepth,
+			blockTimeout: blockTimeout,
+			retries:      retries,
+		}
+
+		if protect {
+			// automatic garbage collection walks protected roots best-effort,
+			// keeping the blocks fetched so far
+			if err := corerepo.Protect(req.Context, nd.Repo.Datastore(), roots...); err != nil {
+				return err
+			}
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- f.fetch(req.Context, roots)
+		}()
+		if showProgress {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+		progress:
+			for {
+				select {
+				case err = <-done:
+					break progress
+				case <-ticker.C:
+					if err := res.Emit(f.output()); err != nil {
+						return err
+					}
+				}
+			}
+		} else {
+			err = <-done
+		}
+		if err != nil {
+			return err
+		}
+
+		if pin {
+			for _, c := range roots {
+				if err := api.Pin().Add(req.Context, path.FromCid(c), options.Pin.Recursive(true), options.Pin.Name(pinName)); err != nil {
+					return err
+				}
+			}
+		}
+		out := f.output()
+		for _, c := range roots {
+			out.Roots = append(out.Roots, enc.Encode(c))
+		}
+		return res.Emit(out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BitswapFetchOutput) error {
+			if out.Roots == nil {
+				return nil
+			}
+			for _, r := range out.Roots {
+				fmt.Fprintf(w, "fetched %s\n", r)
+			}
+			fmt.Fprintf(w, "%d blocks (%s), %d retries\n", out.Blocks, humanize.Bytes(out.Bytes), out.Retries)
+			return nil
+		}),
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+				out, ok := v.(*BitswapFetchOutput)
+				if !ok {
+					return e.TypeErr(out, v)
+				}
+				if out.Roots == nil {
+					// this can only happen if the progress option is set
+					fmt.Fprintf(os.Stderr, "Fetched %d blocks (%s), %d retries\r", out.Blocks, humanize.Bytes(out.Bytes), out.Retries)
+					continue
+				}
+				if err := re.Emit(out); err != nil {
+					return err
+				}
+			}
+		},
+	},
+}
+
+// dagPrefetcher fetches the blocks of DAGs concurrently, requesting stuck
+// blocks again.
+type dagPrefetcher struct {
+	dag          ipld.NodeGetter
+	concurrency  int
+	maxDepth     int // -1 for unlimited
+	blockTimeout time.Duration
+	retries      int
+
+	blocks  atomic.Int64
+	bytes   atomic.Uint64
+	retried atomic.Int64
+	failed  atomic.Int64
+}
+
+func (f *dagPrefetcher) output() *BitswapFetchOutput {
+	return &BitswapFetchOutput{
+		Blocks:  f.blocks.Load(),
+		Bytes:   f.bytes.Load(),
+		Retries: f.retried.Load(),
+		Failed:  f.failed.Load(),
+	}
+}
+
+// fetch fetches the DAGs under roots, breadth-first up to maxDepth. Blocks
+// that fail are skipped with their children, and reported in the returned
+// error once all other blocks are fetched.
+func (f *dagPrefetcher) fetch(ctx context.Context, roots []cid.Cid) error {
+	type task struct {
+		c     cid.Cid
+		depth int
+	}
+
+	var (
+		mu       sync.Mutex
+		cond     = sync.NewCond(&mu)
+		queue    []task
+		active   int
+		visited  = cid.NewSet()
+		firstErr error
+	)
+	for _, c := range roots {
+		if visited.Visit(c) {
+			queue = append(queue, task{c: c})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range f.concurrency {
+		wg.Go(func() {
+			for {
+				mu.Lock()
+				for len(queue) == 0 && active > 0 {
+					cond.Wait()
+				}
+				if len(queue) == 0 {
+					mu.Unlock()
+					return
+				}
+				t := queue[0]
+				queue = queue[1:]
+				active++
+				mu.Unlock()
+
+				links, err := f.fetchBlock(ctx, t.c)
+
+				mu.Lock()
+				active--
+				if err != nil && firstErr == nil && ctx.Err() == nil {
+					firstErr = fmt.Errorf("%s: %w", t.c, err)
+				}
+				if f.maxDepth < 0 || t.depth < f.maxDepth {
+					for _, l := range links {
+						if visited.Visit(l.Cid) {
+							queue = append(queue, task{c: l.Cid, depth: t.depth + 1})
+						}
+					}
+				}
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n := f.failed.Load(); n > 0 {
+		return fmt.Errorf("could not fetch %d blocks, first failure: %w", n, firstErr)
+	}
+	return nil
+}
+
+// fetchBlock fetches c, requesting it again when it is not received within
+// the block timeout, and returns its links.
+func (f *dagPrefetcher) fetchBlock(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+	var err error
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt > 0 {
+			f.retried.Add(1)
+		}
+		blockCtx, cancel := context.WithTimeout(ctx, f.blockTimeout)
+		var nd ipld.Node
+		nd, err = f.dag.Get(blockCtx, c)
+		cancel()
+		if err == nil {
+			f.blocks.Add(1)
+			f.bytes.Add(uint64(len(nd.RawData())))
+			return nd.Links(), nil
+		}
+		if !errors.Is(err, context.DeadlineExceeded) && !ipld.IsNotFound(err) {
+			break // not worth retrying, e.g. the block cannot be decoded
+		}
+	}
+	if ctx.Err() == nil {
+		f.failed.Add(1)
+	}
+	return nil, err
+}
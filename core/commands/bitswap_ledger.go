@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/node"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+const bitswapLedgerResetAllOptionName = "all"
+
+type bitswapLedgerList struct {
+	Ledgers []node.BitswapLedgerStat
+}
+
+var bitswapLedgerLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the persisted ledgers.",
+		ShortDescription: `
+'ipfs bitswap ledger ls' lists the totals of the blocks exchanged with each
+peer, the peers exchanged with most first. Unlike the ledgers of the decision
+engine, these are kept in the datastore across restarts, and are used by the
+"reciprocity" Bitswap.Server.Strategy.
+
+The reciprocity of a peer is above 1 when it sent more to this node than this
+node sent to it. Ledgers of peers no blocks were exchanged with for 30 days
+are removed.
+`,
+	},
+	Type: bitswapLedgerList{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.BitswapLedgers == nil {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, &bitswapLedgerList{Ledgers: nd.BitswapLedgers.Ledgers()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *bitswapLedgerList) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "PEER\tSENT\tRECEIVED\tRECIPROCITY\tLAST EXCHANGE")
+			for _, l := range out.Ledgers {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%s\n", l.Peer,
+					humanize.Bytes(l.BytesSent), humanize.Bytes(l.BytesReceived),
+					l.Ratio(), l.LastExchange.Format(time.RFC3339))
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var bitswapLedgerResetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove persisted ledgers.",
+		ShortDescription: `
+'ipfs bitswap ledger reset' removes the persisted ledgers of the given peers,
+or of all peers with --all, as if no blocks were ever exchanged with them.
+The ledgers of the decision engine are not affected.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", false, true, "Peer ID of the ledgers to remove."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(bitswapLedgerResetAllOptionName, "Remove all the ledgers."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.BitswapLedgers == nil {
+			return ErrNotOnline
+		}
+
+		all, _ := req.Options[bitswapLedgerResetAllOptionName].(bool)
+		if all == (len(req.Arguments) > 0) {
+			return errors.New("specify either peer IDs or --all")
+		}
+		peers := make([]peer.ID, 0, len(req.Arguments))
+		for _, arg := range req.Arguments {
+			p, err := peer.Decode(arg)
+			if err != nil {
+				return fmt.Errorf("invalid peer ID %q: %w", arg, err)
+			}
+			peers = append(peers, p)
+		}
+		_, err = nd.BitswapLedgers.Reset(req.Context, peers...)
+		return err
+	},
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/node"
+)
+
+const bitswapTraceBlocksOptionName = "blocks"
+
+var bitswapTraceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show which peers served the blocks of a traced request.",
+		ShortDescription: `
+'ipfs bitswap trace' shows the retrieval trace recorded for a request started
+with '--trace <request-id>' ('ipfs cat', 'ipfs get' and 'ipfs dag export'),
+or for a gateway request sent with the 'X-Ipfs-Retrieval-Trace: <request-id>'
+header.
+
+A trace covers the blocks that were not found locally: the Bitswap peers and
+HTTP providers asked for each block, the one that delivered it first and how
+long it took, and the duplicates received from others. The time to first
+block is measured from the start of the request.
+
+Only the most recent traces are kept, in memory.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("request-id", true, false, "ID of the traced request."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(bitswapTraceBlocksOptionName, "b", "Show each block fetched."),
+	},
+	Type: node.RetrievalTraceStat{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.RetrievalTracer == nil {
+			return ErrNotOnline
+		}
+		st, ok := nd.RetrievalTracer.Trace(req.Arguments[0])
+		if !ok {
+			return fmt.Errorf("no retrieval trace for request %q", req.Arguments[0])
+		}
+		return cmds.EmitOnce(res, &st)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *node.RetrievalTraceStat) error {
+			enc, err := cmdenv.GetCidEncoder(req)
+			if err != nil {
+				return err
+			}
+			showBlocks, _ := req.Options[bitswapTraceBlocksOptionName].(bool)
+
+			state := "complete"
+			if st.Running {
+				state = "running"
+			}
+			fmt.Fprintf(w, "Request %s (%s, %s)\n", st.ID, state, st.Duration.Round(time.Millisecond))
+			if st.TimeToFirstBlock > 0 {
+				fmt.Fprintf(w, "Time to first block: %s\n", st.TimeToFirstBlock.Round(time.Millisecond))
+			}
+			fmt.Fprintf(w, "Blocks requested: %d\n", st.Requested)
+			fmt.Fprintf(w, "Blocks received: %d (%s)\n", st.Received, humanize.Bytes(st.Bytes))
+			fmt.Fprintf(w, "Duplicate blocks: %d (%s)\n", st.Duplicates, humanize.Bytes(st.DuplicateBytes))
+			if st.Truncated {
+				fmt.Fprintf(w, "WARNING: more blocks were fetched than a trace records\n")
+			}
+
+			if len(st.Peers) > 0 {
+				fmt.Fprintln(w, "Peers:")
+				tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "\tPEER\tASKED\tDELIVERED\tBYTES\tDUPLICATES")
+				for _, p := range st.Peers {
+					fmt.Fprintf(tw, "\t%s\t%d\t%d\t%s\t%d\n", p.Peer, p.Asked, p.Delivered, humanize.Bytes(p.Bytes), p.Duplicates)
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+			}
+
+			if showBlocks && len(st.Blocks) > 0 {
+				fmt.Fprintln(w, "Blocks:")
+				tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "\tCID\tFROM\tLATENCY\tASKED\tDUPLICATES")
+				for _, b := range st.Blocks {
+					from, latency := "-", "-"
+					if b.From != "" {
+						from = b.From.String()
+					}
+					if b.Latency > 0 {
+						latency = b.Latency.Round(time.Millisecond).String()
+					}
+					fmt.Fprintf(tw, "\t%s\t%s\t%s\t%d\t%d\n", enc.Encode(b.Cid), from, latency, len(b.Asked), len(b.Duplicates))
+				}
+				if err := tw.Flush(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	},
+}
@@ -35,6 +35,7 @@ var CatCmd = &cmds.Command{
 		cmds.Int64Option(offsetOptionName, "o", "Byte offset to begin reading from."),
 		cmds.Int64Option(lengthOptionName, "l", "Maximum number of bytes to read."),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data. Defaults to true when stderr is a terminal."),
+		cmdenv.OptionRetrievalTrace,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -61,6 +62,12 @@ var CatCmd = &cmds.Command{
 			return err
 		}
 
+		finishTrace, err := cmdenv.TraceRetrieval(req, env)
+		if err != nil {
+			return err
+		}
+		defer finishTrace()
+
 		readers, length, err := cat(req.Context, api, req.Arguments, int64(offset), int64(max))
 		if err != nil {
 			return err
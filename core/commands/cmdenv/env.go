@@ -230,6 +230,7 @@ func ExecuteFastProvideDAG(
 		return
 	}
 
+	prov = node.ProvideSource(prov, node.ProvideSourceFastProvide)
 	do := func(ctx context.Context) {
 		expectedItems := max(uint(walker.DefaultBloomInitialCapacity), blockCount)
 		tracker, err := walker.NewBloomTracker(expectedItems, fpRate)
@@ -0,0 +1,34 @@
+package cmdenv
+
+import (
+	"errors"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// OptionRetrievalTrace enables the retrieval trace of commands fetching
+// content, reported by 'ipfs bitswap trace'.
+var OptionRetrievalTrace = cmds.StringOption("trace", "Record which peers were asked for and delivered the blocks fetched, under the given request ID. See 'ipfs bitswap trace'.")
+
+// TraceRetrieval starts the retrieval trace requested with --trace, if any,
+// replacing req.Context so that the blocks fetched by the command are
+// traced. The returned function finishes the trace.
+func TraceRetrieval(req *cmds.Request, env cmds.Environment) (func(), error) {
+	id, _ := req.Options[OptionRetrievalTrace.Name()].(string)
+	if id == "" {
+		return func() {}, nil
+	}
+	nd, err := GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if nd.RetrievalTracer == nil {
+		return nil, errors.New("retrieval traces are only recorded by online nodes")
+	}
+	ctx, t, err := nd.RetrievalTracer.Start(req.Context, id)
+	if err != nil {
+		return nil, err
+	}
+	req.Context = ctx
+	return t.Finish, nil
+}
@@ -19,9 +19,13 @@ func TestCommands(t *testing.T) {
 	list := []string{
 		"/add",
 		"/bitswap",
+		"/bitswap/fetch",
 		"/bitswap/ledger",
+		"/bitswap/ledger/ls",
+		"/bitswap/ledger/reset",
 		"/bitswap/reprovide",
 		"/bitswap/stat",
+		"/bitswap/trace",
 		"/bitswap/wantlist",
 		"/block",
 		"/block/get",
@@ -73,6 +77,7 @@ func TestCommands(t *testing.T) {
 		"/routing/findprovs",
 		"/routing/provide",
 		"/routing/reprovide",
+		"/routing/stat",
 		"/diag",
 		"/diag/cmds",
 		"/diag/cmds/clear",
@@ -95,8 +100,17 @@ func TestCommands(t *testing.T) {
 		"/files/rm",
 		"/files/stat",
 		"/files/write",
+		"/files/batch",
 		"/files/chmod",
+		"/files/du",
+		"/files/find",
 		"/files/chroot",
+		"/files/snapshot",
+		"/files/snapshot/create",
+		"/files/snapshot/ls",
+		"/files/snapshot/restore",
+		"/files/snapshot/rm",
+		"/files/sync",
 		"/files/touch",
 		"/filestore",
 		"/filestore/dups",
@@ -135,6 +149,18 @@ func TestCommands(t *testing.T) {
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
 		"/name/put",
+		"/name/autopublish",
+		"/name/autopublish/ls",
+		"/name/dnslink",
+		"/name/dnslink/check",
+		"/name/history",
+		"/name/pending",
+		"/name/republish",
+		"/name/republish/ls",
+		"/name/republish/now",
+		"/name/republish/pause",
+		"/name/republish/resume",
+		"/name/rollback",
 		"/name/resolve",
 		"/object",
 		"/object/data",
@@ -175,6 +201,10 @@ func TestCommands(t *testing.T) {
 		"/provide",
 		"/provide/clear",
 		"/provide/once",
+		"/provide/queue",
+		"/provide/queue/drop",
+		"/provide/queue/ls",
+		"/provide/queue/prioritize",
 		"/provide/stat",
 		"/pubsub",
 		"/pubsub/ls",
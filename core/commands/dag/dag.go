@@ -18,6 +18,7 @@ import (
 
 const (
 	pinRootsOptionName        = "pin-roots"
+	provideOptionName         = "provide"
 	progressOptionName        = "progress"
 	silentOptionName          = "silent"
 	statsOptionName           = "stats"
@@ -219,6 +220,7 @@ Specification of CAR formats: https://ipld.io/specs/transport/car/
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRootsOptionName, "Pin optional roots listed in the .car headers after importing. Default: true."),
+		cmds.StringOption(provideOptionName, "Provide policy of the pinned roots: \"all\", \"roots\" or \"none\". See 'ipfs pin add --help'. Default: Provide.Strategy"),
 		cmds.BoolOption(localOnlyOptionName, "Import a partial CAR (e.g. from 'dag export --local-only'). Implies --pin-roots=false."),
 		cmds.BoolOption(silentOptionName, "No output."),
 		cmds.BoolOption(statsOptionName, "Output stats."),
@@ -298,6 +300,7 @@ the resulting CAR is partial. --local-only implies --offline.
 	Options: []cmds.Option{
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data. Defaults to true when stderr is a terminal."),
 		cmds.BoolOption(localOnlyOptionName, "Best-effort export of locally-available blocks; missing or unreadable blocks (and their subtrees) are skipped. Implies --offline."),
+		cmdenv.OptionRetrievalTrace,
 	},
 	Run: dagExport,
 	PostRun: cmds.PostRunMap{
@@ -50,6 +50,11 @@ func dagExport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 	if err != nil {
 		return err
 	}
+	finishTrace, err := cmdenv.TraceRetrieval(req, env)
+	if err != nil {
+		return err
+	}
+	defer finishTrace()
 	if localOnly {
 		// --local-only implies --offline so api.Block().Stat below cannot
 		// reach out for path resolution. The DAG walk itself uses the raw
@@ -18,6 +18,7 @@ import (
 
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/corepin"
 )
 
 var log = logging.Logger("core/commands")
@@ -66,6 +67,21 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 		// --local-only implies --pin-roots=false: a partial CAR has no full DAG to pin.
 		doPinRoots = false
 	}
+
+	provideStr, _ := req.Options[provideOptionName].(string)
+	providePolicy, err := corepin.ParseProvidePolicy(provideStr)
+	if err != nil {
+		return err
+	}
+	if providePolicy != corepin.ProvideDefault {
+		if !doPinRoots {
+			return fmt.Errorf("--%s requires --%s", provideOptionName, pinRootsOptionName)
+		}
+		if err := corepin.CheckProvidePolicy(node.ProvidingStrategy, providePolicy); err != nil {
+			return err
+		}
+	}
+
 	fastProvideRoot, fastProvideRootSet := req.Options[fastProvideRootOptionName].(bool)
 	fastProvideDAG, fastProvideDAGSet := req.Options[fastProvideDAGOptionName].(bool)
 	fastProvideWait, fastProvideWaitSet := req.Options[fastProvideWaitOptionName].(bool)
@@ -73,6 +89,7 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 	fastProvideRoot = config.ResolveBoolFromConfig(fastProvideRoot, fastProvideRootSet, cfg.Import.FastProvideRoot, config.DefaultFastProvideRoot)
 	fastProvideDAG = config.ResolveBoolFromConfig(fastProvideDAG, fastProvideDAGSet, cfg.Import.FastProvideDAG, config.DefaultFastProvideDAG)
 	fastProvideWait = config.ResolveBoolFromConfig(fastProvideWait, fastProvideWaitSet, cfg.Import.FastProvideWait, config.DefaultFastProvideWait)
+	provideStrategy, fastProvideRoot, fastProvideDAG := providePolicy.FastProvide(node.ProvidingStrategy, fastProvideRoot, fastProvideDAG)
 
 	// grab a pinlock ( which doubles as a GC lock ) so that regardless of the
 	// size of the streamed-in cars nothing will disappear on us before we had
@@ -206,6 +223,8 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 				ret.PinErrorMsg = err.Error()
 			} else if err := node.Pinning.Flush(req.Context); err != nil {
 				ret.PinErrorMsg = err.Error()
+			} else if err := corepin.SetProvidePolicy(req.Context, node.Repo.Datastore(), c, providePolicy); err != nil {
+				ret.PinErrorMsg = err.Error()
 			}
 
 			return res.Emit(&CarImportOutput{Root: &ret})
@@ -240,7 +259,7 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 			req.Context,
 			node.Context(),
 			rootCIDs,
-			node.ProvidingStrategy,
+			provideStrategy,
 			node.Blockstore,
 			node.Provider,
 			fastProvideWait,
@@ -21,6 +21,7 @@ import (
 	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/coremfs"
 	"github.com/ipfs/kubo/core/node"
 	fsrepo "github.com/ipfs/kubo/repo/fsrepo"
 
@@ -29,6 +30,7 @@ import (
 	offline "github.com/ipfs/boxo/exchange/offline"
 	dag "github.com/ipfs/boxo/ipld/merkledag"
 	ft "github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
 	mfs "github.com/ipfs/boxo/mfs"
 	"github.com/ipfs/boxo/path"
 	cid "github.com/ipfs/go-cid"
@@ -80,6 +82,19 @@ func updateNoFlushCounter(nd *core.IpfsNode, flush bool) error {
 	return nil
 }
 
+// journalUnflushed records the state of paths changed by an operation that
+// did not flush in the MFS journal, so the change is not lost if the daemon
+// stops before the next flush.
+func journalUnflushed(ctx context.Context, nd *core.IpfsNode, flush bool, paths ...string) error {
+	if flush {
+		return nil
+	}
+	if err := nd.FilesJournal.Record(ctx, nd.FilesRoot, paths...); err != nil {
+		return fmt.Errorf("recording unflushed change in MFS journal: %w", err)
+	}
+	return nil
+}
+
 // mfsPinLock takes the pin lock, a shared read-lock on the blockstore GC
 // locker. A concurrent "ipfs repo gc" holds the exclusive GC lock, so while
 // this lock is held GC cannot run, and GC waits for it to be released. Hold it
@@ -136,19 +151,24 @@ performance.`,
 		cmds.BoolOption(filesFlushOptionName, "f", "Flush target and ancestors after write.").WithDefault(true),
 	},
 	Subcommands: map[string]*cmds.Command{
-		"read":   filesReadCmd,
-		"write":  filesWriteCmd,
-		"mv":     filesMvCmd,
-		"cp":     filesCpCmd,
-		"ls":     filesLsCmd,
-		"mkdir":  filesMkdirCmd,
-		"stat":   filesStatCmd,
-		"rm":     filesRmCmd,
-		"flush":  filesFlushCmd,
-		"chcid":  filesChcidCmd,
-		"chmod":  filesChmodCmd,
-		"chroot": filesChrootCmd,
-		"touch":  filesTouchCmd,
+		"read":     filesReadCmd,
+		"write":    filesWriteCmd,
+		"mv":       filesMvCmd,
+		"cp":       filesCpCmd,
+		"ls":       filesLsCmd,
+		"mkdir":    filesMkdirCmd,
+		"stat":     filesStatCmd,
+		"rm":       filesRmCmd,
+		"flush":    filesFlushCmd,
+		"chcid":    filesChcidCmd,
+		"chmod":    filesChmodCmd,
+		"chroot":   filesChrootCmd,
+		"touch":    filesTouchCmd,
+		"snapshot": filesSnapshotCmd,
+		"sync":     filesSyncCmd,
+		"batch":    filesBatchCmd,
+		"du":       filesDuCmd,
+		"find":     filesFindCmd,
 	},
 }
 
@@ -176,6 +196,17 @@ type statOutput struct {
 	Mode           uint32 `json:",omitempty"`
 	Mtime          int64  `json:",omitempty"`
 	MtimeNsecs     int    `json:",omitempty"`
+
+	// Recovered is set on the MFS root when unflushed changes were replayed
+	// from the MFS journal after an unclean shutdown.
+	Recovered *filesRecovery `json:",omitempty"`
+}
+
+type filesRecovery struct {
+	Time    time.Time
+	Entries int
+	Failed  int `json:",omitempty"`
+	Root    string
 }
 
 func (s *statOutput) MarshalJSON() ([]byte, error) {
@@ -291,6 +322,21 @@ var filesStatCmd = &cmds.Command{
 			return err
 		}
 
+		if path == "/" {
+			rec, err := coremfs.GetRecovery(req.Context, node.Repo.Datastore())
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				o.Recovered = &filesRecovery{
+					Time:    rec.Time,
+					Entries: rec.Entries,
+					Failed:  rec.Failed,
+					Root:    enc.Encode(rec.Root),
+				}
+			}
+		}
+
 		if !withLocal {
 			return cmds.EmitOnce(res, o)
 		}
@@ -321,6 +367,7 @@ var filesStatCmd = &cmds.Command{
 			}
 
 			s, _ := statGetFormatOptions(req)
+			defaultFormat := s == defaultStatFormat
 			s = strings.Replace(s, "<hash>", out.Hash, -1)
 			s = strings.Replace(s, "<size>", fmt.Sprintf("%d", out.Size), -1)
 			s = strings.Replace(s, "<cumulsize>", fmt.Sprintf("%d", out.CumulativeSize), -1)
@@ -342,6 +389,15 @@ var filesStatCmd = &cmds.Command{
 				)
 			}
 
+			if rec := out.Recovered; rec != nil && defaultFormat {
+				fmt.Fprintf(w, "Recovered: %d unflushed changes replayed from the MFS journal on %s",
+					rec.Entries, rec.Time.Format("2 Jan 2006, 15:04:05 MST"))
+				if rec.Failed > 0 {
+					fmt.Fprintf(w, " (%d failed, see the daemon log)", rec.Failed)
+				}
+				fmt.Fprintln(w)
+			}
+
 			return nil
 		}),
 	},
@@ -463,6 +519,405 @@ func walkBlock(ctx context.Context, dagserv ipld.DAGService, nd ipld.Node) (bool
 	return local, sizeLocal, nil
 }
 
+const (
+	filesMaxDepthOptionName = "max-depth"
+	filesNameOptionName     = "name"
+	filesTypeOptionName     = "type"
+	filesMinSizeOptionName  = "min-size"
+)
+
+type filesDuOutput struct {
+	Path string
+	Size uint64
+}
+
+var filesDuCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Summarize the size of MFS directories.",
+		ShortDescription: `
+Prints the cumulative size in bytes of each directory under the given MFS
+path (default: '/'), deepest directories first and the path itself last,
+like 'du'. Sizes are the DAG sizes recorded in the directory links, so only
+directory nodes are read.
+
+    $ ipfs files du -d 1 /
+    1048576	/photos
+    2310	/docs
+    1050940	/
+
+Use '--max-depth' to only print directories up to that many levels below the
+path; deeper directories are still counted in the totals.
+
+With the global '--offline' option, only blocks present in the local
+repository are counted and nothing is fetched from the network, which shows
+how much of an MFS tree is actually stored on this node:
+
+    $ ipfs files du --offline /photos
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", false, false, "Path to summarize. Defaults to '/'."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(filesMaxDepthOptionName, "d", "Only print directories up to this depth below path. -1 means no limit.").WithDefault(-1),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		arg := "/"
+		if len(req.Arguments) > 0 {
+			arg = req.Arguments[0]
+		}
+		path, err := checkPath(arg)
+		if err != nil {
+			return err
+		}
+
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		root, err := mfsTreeRoot(nd, path)
+		if err != nil {
+			return err
+		}
+
+		maxDepth, _ := req.Options[filesMaxDepthOptionName].(int)
+		local, _ := req.Options[OfflineOption].(bool)
+		if !local {
+			// deprecated alias of --offline
+			local, _ = req.Options[LocalOption].(bool)
+		}
+
+		du := &mfsDu{
+			ctx:      req.Context,
+			dagserv:  nd.DAG,
+			local:    local,
+			maxDepth: maxDepth,
+			emit: func(p string, size uint64) error {
+				return res.Emit(&filesDuOutput{Path: p, Size: size})
+			},
+		}
+		if local {
+			// an offline DAGService will not fetch from the network
+			du.dagserv = dag.NewDAGService(bservice.New(
+				nd.Blockstore,
+				offline.Exchange(nd.Blockstore),
+			))
+			du.localSizes = make(map[cid.Cid]uint64)
+		}
+
+		if !isUnixFSDir(root) {
+			size, err := du.size(root)
+			if err != nil {
+				return err
+			}
+			return du.emit(path, size)
+		}
+		return du.dir(root, path, 0)
+	},
+	Type: filesDuOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesDuOutput) error {
+			_, err := fmt.Fprintf(w, "%d\t%s\n", out.Size, out.Path)
+			return err
+		}),
+	},
+}
+
+// mfsTreeRoot returns the node at path in MFS, to be walked as a plain DAG.
+// Walking the DAG rather than mfs.Directory entries keeps large trees from
+// being loaded into the MFS cache.
+func mfsTreeRoot(nd *core.IpfsNode, path string) (ipld.Node, error) {
+	fsn, err := mfs.Lookup(nd.FilesRoot, path)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.GetNode()
+}
+
+func isUnixFSDir(nd ipld.Node) bool {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return false
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return false
+	}
+	return fsn.Type() == ft.TDirectory || fsn.Type() == ft.THAMTShard
+}
+
+type mfsDu struct {
+	ctx      context.Context
+	dagserv  ipld.DAGService
+	local    bool
+	maxDepth int
+	emit     func(path string, size uint64) error
+
+	// localSizes memoizes the local size of directories, so that printing
+	// nested directories does not walk their subtrees more than once.
+	localSizes map[cid.Cid]uint64
+}
+
+func (du *mfsDu) size(nd ipld.Node) (uint64, error) {
+	if du.local {
+		return du.localSize(nd)
+	}
+	return nd.Size()
+}
+
+// localSize is like walkBlock, memoizing directories.
+func (du *mfsDu) localSize(nd ipld.Node) (uint64, error) {
+	if size, ok := du.localSizes[nd.Cid()]; ok {
+		return size, nil
+	}
+
+	size := uint64(len(nd.RawData()))
+	for _, link := range nd.Links() {
+		child, err := du.dagserv.Get(du.ctx, link.Cid)
+		if ipld.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		childSize, err := du.localSize(child)
+		if err != nil {
+			return 0, err
+		}
+		size += childSize
+	}
+
+	if isUnixFSDir(nd) {
+		du.localSizes[nd.Cid()] = size
+	}
+	return size, nil
+}
+
+func (du *mfsDu) dir(nd ipld.Node, path string, depth int) error {
+	size, err := du.size(nd)
+	if err != nil {
+		return err
+	}
+
+	if du.maxDepth < 0 || depth < du.maxDepth {
+		err := forEachDirEntry(du.ctx, du.dagserv, nd, du.local, func(link *ipld.Link) error {
+			// raw blocks are always file content
+			if link.Cid.Prefix().Codec == cid.Raw {
+				return nil
+			}
+			child, err := du.dagserv.Get(du.ctx, link.Cid)
+			if du.local && ipld.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !isUnixFSDir(child) {
+				return nil
+			}
+			return du.dir(child, gopath.Join(path, link.Name), depth+1)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return du.emit(path, size)
+}
+
+// forEachDirEntry calls fn for each entry of the UnixFS directory nd. Shards
+// of HAMT-sharded directories are fetched concurrently. With skipMissing,
+// entries in shards that are not available are silently skipped.
+func forEachDirEntry(ctx context.Context, dagserv ipld.DAGService, nd ipld.Node, skipMissing bool, fn func(*ipld.Link) error) error {
+	dir, err := uio.NewDirectoryFromNode(dagserv, nd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for l := range dir.EnumLinksAsync(ctx) {
+		if l.Err != nil {
+			if skipMissing && ipld.IsNotFound(l.Err) {
+				continue
+			}
+			return l.Err
+		}
+		if err := fn(l.Link); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+type filesFindOutput struct {
+	Path string
+	Type string
+	Size uint64
+	Hash string
+}
+
+var filesFindCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Search for files and directories in MFS.",
+		ShortDescription: `
+Walks the MFS tree under <path> and prints the path of every entry that
+matches all of the given criteria, as soon as it is found.
+
+    $ ipfs files find / --name '*.mp4' --min-size 104857600
+    /videos/talk.mp4
+
+'--name' is a shell pattern matched against the entry name, as in
+'find -name'. '--type' is 'f' for files or 'd' for directories. '--min-size'
+only matches files of at least that many bytes.
+
+The JSON output also includes the type, size and CID of each entry.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path to search under."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(filesNameOptionName, "Only match entries whose name matches this pattern."),
+		cmds.StringOption(filesTypeOptionName, "Only match entries of this type: 'f' (file) or 'd' (directory)."),
+		cmds.Int64Option(filesMinSizeOptionName, "Only match files of at least this many bytes."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		path, err := checkPath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		f := &mfsFind{ctx: req.Context}
+		f.name, _ = req.Options[filesNameOptionName].(string)
+		if _, err := gopath.Match(f.name, ""); err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid --%s pattern: %s", filesNameOptionName, err)
+		}
+		switch typ, _ := req.Options[filesTypeOptionName].(string); typ {
+		case "":
+		case "f":
+			f.typ = "file"
+		case "d":
+			f.typ = "directory"
+		default:
+			return cmds.Errorf(cmds.ErrClient, "--%s must be 'f' or 'd'", filesTypeOptionName)
+		}
+		minSize, hasMinSize := req.Options[filesMinSizeOptionName].(int64)
+		if hasMinSize {
+			if minSize < 0 {
+				return cmds.Errorf(cmds.ErrClient, "--%s must not be negative", filesMinSizeOptionName)
+			}
+			f.minSize = uint64(minSize)
+			f.sizeFilter = true
+		}
+
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		f.dagserv = nd.DAG
+		f.emit = func(out *filesFindOutput, c cid.Cid) error {
+			out.Hash = enc.Encode(c)
+			return res.Emit(out)
+		}
+
+		root, err := mfsTreeRoot(nd, path)
+		if err != nil {
+			return err
+		}
+		return f.visit(root, path)
+	},
+	Type: filesFindOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesFindOutput) error {
+			_, err := fmt.Fprintln(w, out.Path)
+			return err
+		}),
+	},
+}
+
+type mfsFind struct {
+	ctx        context.Context
+	dagserv    ipld.DAGService
+	name       string
+	typ        string
+	minSize    uint64
+	sizeFilter bool
+	emit       func(out *filesFindOutput, c cid.Cid) error
+}
+
+func (f *mfsFind) match(out *filesFindOutput) bool {
+	if f.typ != "" && out.Type != f.typ {
+		return false
+	}
+	if f.sizeFilter && (out.Type != "file" || out.Size < f.minSize) {
+		return false
+	}
+	if f.name != "" {
+		if ok, _ := gopath.Match(f.name, gopath.Base(out.Path)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *mfsFind) visit(nd ipld.Node, path string) error {
+	out := &filesFindOutput{Path: path}
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		out.Type = "file"
+		out.Size = uint64(len(nd.RawData()))
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		switch fsn.Type() {
+		case ft.TDirectory, ft.THAMTShard:
+			out.Type = "directory"
+		case ft.TFile, ft.TRaw:
+			out.Type = "file"
+			out.Size = fsn.FileSize()
+		case ft.TSymlink:
+			out.Type = "symlink"
+		}
+	}
+
+	if f.match(out) {
+		if err := f.emit(out, nd.Cid()); err != nil {
+			return err
+		}
+	}
+	if out.Type != "directory" {
+		return nil
+	}
+
+	return forEachDirEntry(f.ctx, f.dagserv, nd, false, func(link *ipld.Link) error {
+		childPath := gopath.Join(path, link.Name)
+		// A raw leaf is a file whose size is known from the link, so
+		// there is no need to fetch it.
+		if link.Cid.Prefix().Codec == cid.Raw {
+			out := &filesFindOutput{Path: childPath, Type: "file", Size: link.Size}
+			if f.match(out) {
+				return f.emit(out, link.Cid)
+			}
+			return nil
+		}
+		child, err := f.dagserv.Get(f.ctx, link.Cid)
+		if err != nil {
+			return err
+		}
+		return f.visit(child, childPath)
+	})
+}
+
 var errFilesCpInvalidUnixFS = errors.New("cp: source must be a valid UnixFS (dag-pb or raw codec)")
 var filesCpCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
@@ -596,6 +1051,9 @@ being GC'ed.
 		if err != nil {
 			return fmt.Errorf("cp: cannot put node in path %s: %s", dst, err)
 		}
+		if err := journalUnflushed(req.Context, nd, flush, dst); err != nil {
+			return err
+		}
 		if flush {
 			if _, err := mfs.FlushPath(req.Context, nd.FilesRoot, dst); err != nil {
 				return fmt.Errorf("cp: cannot flush the created file %s: %s", dst, err)
@@ -945,6 +1403,9 @@ Example:
 		if err != nil {
 			return err
 		}
+		if err := journalUnflushed(req.Context, nd, flush, src, dst); err != nil {
+			return err
+		}
 		if flush {
 			parentSrc := gopath.Dir(src)
 			parentDst := gopath.Dir(dst)
@@ -1128,6 +1589,9 @@ See '--to-files' in 'ipfs add --help' for more information.
 					flog.Error("files: error closing file mfs file descriptor", err)
 				}
 			}
+			if retErr == nil {
+				retErr = journalUnflushed(req.Context, nd, flush, path)
+			}
 			if flush {
 				// Flush parent to clear directory cache and free memory.
 				parent := gopath.Dir(path)
@@ -1236,8 +1700,10 @@ Examples:
 			mfs.WithMaxLinks(maxDirLinks),
 			mfs.WithSizeEstimationMode(sizeEstimationMode),
 		)
-
-		return err
+		if err != nil {
+			return err
+		}
+		return journalUnflushed(req.Context, n, flush, dirtomake)
 	},
 }
 
@@ -1330,6 +1796,9 @@ on subdirectories of the MFS root.
 		if err := updatePath(nd.FilesRoot, path, prefix); err != nil {
 			return err
 		}
+		if err := journalUnflushed(req.Context, nd, flush, path); err != nil {
+			return err
+		}
 		if flush {
 			if _, err = mfs.FlushPath(req.Context, nd.FilesRoot, path); err != nil {
 				return err
@@ -1403,6 +1872,19 @@ Remove files or directories.
 		// including file, directory, corrupted node, etc
 		force, _ := req.Options[forceOptionName].(bool)
 		dashr, _ := req.Options[recursiveOptionName].(bool)
+		if (dashr || force) && removesDirectory(nd.FilesRoot, req.Arguments) {
+			flag := "-r"
+			if !dashr {
+				flag = "--force"
+			}
+			snap, err := autoSnapshotMFS(req.Context, nd, "before 'files rm "+flag+" "+strings.Join(req.Arguments, " ")+"'")
+			if err != nil {
+				return fmt.Errorf("taking automatic snapshot: %w", err)
+			}
+			if snap != nil {
+				flog.Infof("saved MFS snapshot %s before recursive removal", snap.Name)
+			}
+		}
 		var errs []error
 		for _, arg := range req.Arguments {
 			path, err := checkPath(arg)
@@ -1428,6 +1910,29 @@ Remove files or directories.
 	},
 }
 
+// removesDirectory reports whether one of the paths given to files rm may be
+// a directory. A path that cannot be looked up, such as a corrupted node
+// removed with --force, may be one too.
+func removesDirectory(filesRoot *mfs.Root, paths []string) bool {
+	for _, arg := range paths {
+		path, err := checkPath(arg)
+		if err != nil || path == "/" {
+			continue
+		}
+		nd, err := mfs.Lookup(filesRoot, strings.TrimSuffix(path, "/"))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return true
+			}
+			continue
+		}
+		if _, ok := nd.(*mfs.Directory); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func removePath(filesRoot *mfs.Root, path string, force bool, dashr bool) error {
 	if path == "/" {
 		return fmt.Errorf("cannot delete root")
@@ -1705,7 +2210,8 @@ daemon from starting.
 When run without a CID argument, resets MFS to an empty directory.
 
 WARNING: The old MFS root and its unpinned children will be removed during
-the next garbage collection. Pin the old root first if you want to preserve.
+the next garbage collection. Pin the old root first if you want to preserve,
+or enable MFS.AutoSnapshot to record it as a snapshot automatically.
 
 This command can only run when the daemon is not running.
 
@@ -1808,18 +2314,44 @@ Examples:
 			return fmt.Errorf("reading current MFS root: %w", err)
 		}
 
+		// Record the old root before replacing it, if requested
+		var autoSnap *coremfs.Snapshot
+		if oldRootStr != "" {
+			cfg, err := repo.Config()
+			if err != nil {
+				return err
+			}
+			if cfg.MFS.AutoSnapshot.WithDefault(config.DefaultMFSAutoSnapshot) {
+				oldRootCid, _ := cid.Cast(oldRootBytes)
+				keep := cfg.MFS.AutoSnapshotKeep.WithDefault(config.DefaultMFSAutoSnapshotKeep)
+				autoSnap, err = coremfs.AutoSnapshot(req.Context, localDS, oldRootCid, "before 'files chroot'", int(keep))
+				if err != nil {
+					return fmt.Errorf("taking automatic snapshot: %w", err)
+				}
+			}
+		}
+
 		// Write new root
 		err = localDS.Put(req.Context, node.FilesRootDatastoreKey, newRootCid.Bytes())
 		if err != nil {
 			return fmt.Errorf("writing new MFS root: %w", err)
 		}
+		// Unflushed changes recorded against the old root must not be
+		// replayed onto the new one.
+		if err := coremfs.ClearJournal(req.Context, localDS); err != nil {
+			return fmt.Errorf("clearing MFS journal: %w", err)
+		}
 
 		// Build output message
 		newRootStr := enc.Encode(newRootCid)
 		var msg string
 		if oldRootStr != "" {
 			msg = fmt.Sprintf("MFS root changed from %s to %s\n", oldRootStr, newRootStr)
-			msg += fmt.Sprintf("The old root %s will be garbage collected unless pinned.\n", oldRootStr)
+			if autoSnap != nil {
+				msg += fmt.Sprintf("The old root was saved as snapshot %s.\n", autoSnap.Name)
+			} else {
+				msg += fmt.Sprintf("The old root %s will be garbage collected unless pinned.\n", oldRootStr)
+			}
 		} else {
 			msg = fmt.Sprintf("MFS root set to %s\n", newRootStr)
 		}
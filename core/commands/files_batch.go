@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+const filesBatchDryRunOptionName = "dry-run"
+
+type FilesBatchOutput struct {
+	Root string
+}
+
+var filesBatchCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Apply several MFS operations atomically.",
+		ShortDescription: `
+Reads a list of operations, one JSON object per line, applies them in order
+to a private copy of the MFS root and, only if all of them succeed, replaces
+the MFS root with the result in a single update. Intermediate states are never
+visible: they are not published, provided, or pinned by
+Pinning.RemoteServices MFS policies. If an operation fails, MFS is left
+untouched and the failing operation is reported.
+
+On success, the CID of the new MFS root is printed.
+
+Operations:
+
+    {"op": "mkdir", "path": "/a/b", "parents": true}
+    {"op": "cp", "src": "/ipfs/<cid>", "dst": "/a/b/file"}
+    {"op": "mv", "src": "/a/b/file", "dst": "/c/", "parents": true}
+    {"op": "rm", "path": "/old", "recursive": true, "force": true}
+    {"op": "write", "path": "/a/VERSION", "data": "1.2.3\n"}
+
+'cp' accepts MFS paths and /ipfs/ or /ipns/ paths as source. 'write'
+replaces the whole file. 'parents' creates missing parent directories,
+'recursive' is needed to remove directories and 'force' ignores missing
+entries. A destination ending with '/' means "into this directory".
+
+    $ ipfs files batch < ops.jsonl
+
+Use '--dry-run' to check that a batch applies cleanly and print the MFS root
+it would produce, without changing MFS.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("ops", true, false, "Operations, one JSON object per line.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(filesBatchDryRunOptionName, "n", "Apply the operations to a copy of MFS and print the resulting root, without committing it."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		fapi, ok := api.(iface.FilesCoreAPI)
+		if !ok {
+			return errors.New("the Files API is not available")
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		var ops []iface.FilesOp
+		dec := json.NewDecoder(file)
+		dec.DisallowUnknownFields()
+		for {
+			var op iface.FilesOp
+			if err := dec.Decode(&op); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("decoding op %d: %w", len(ops)+1, err)
+			}
+			ops = append(ops, op)
+		}
+
+		dryRun, _ := req.Options[filesBatchDryRunOptionName].(bool)
+		p, err := fapi.Files().Batch(req.Context, ops, options.Files.DryRun(dryRun))
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &FilesBatchOutput{Root: enc.Encode(p.RootCid())})
+	},
+	Type: FilesBatchOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesBatchOutput) error {
+			_, err := fmt.Fprintln(w, out.Root)
+			return err
+		}),
+	},
+}
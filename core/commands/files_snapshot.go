@@ -0,0 +1,269 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/mfs"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/coremfs"
+)
+
+const snapshotMessageOptionName = "message"
+
+var filesSnapshotCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Manage named snapshots of the MFS root.",
+		ShortDescription: `
+A snapshot records the CID of the MFS root under a name, together with a
+timestamp and an optional message. 'ipfs files snapshot restore' brings MFS
+back to the recorded state while the daemon keeps running.
+
+Snapshot roots are protected from garbage collection like MFS itself: any
+block of a snapshot that is stored locally is kept until the snapshot is
+removed with 'ipfs files snapshot rm'.
+
+When MFS.AutoSnapshot is enabled, a snapshot named 'auto-<timestamp>' is
+taken before 'ipfs files rm -r' or 'ipfs files rm --force' of a directory,
+'ipfs files chroot' and 'ipfs files snapshot restore'. Only the newest
+MFS.AutoSnapshotKeep automatic snapshots are retained.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create":  filesSnapshotCreateCmd,
+		"ls":      filesSnapshotLsCmd,
+		"rm":      filesSnapshotRmCmd,
+		"restore": filesSnapshotRestoreCmd,
+	},
+}
+
+type SnapshotOutput struct {
+	Name    string
+	Cid     string
+	Created time.Time
+	Message string `json:",omitempty"`
+	Auto    bool   `json:",omitempty"`
+}
+
+type SnapshotListOutput struct {
+	Snapshots []SnapshotOutput
+}
+
+func snapshotOutput(req *cmds.Request, s *coremfs.Snapshot) (SnapshotOutput, error) {
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return SnapshotOutput{}, err
+	}
+	return SnapshotOutput{
+		Name:    s.Name,
+		Cid:     enc.Encode(s.Cid),
+		Created: s.Created,
+		Message: s.Message,
+		Auto:    s.Auto,
+	}, nil
+}
+
+var filesSnapshotCreateCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Record the current MFS root under a name.",
+		ShortDescription: `
+Flushes MFS and records the resulting root CID under the given name.
+
+    $ ipfs files snapshot create before-cleanup -m "pre cleanup of /archive"
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the snapshot."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(snapshotMessageOptionName, "m", "Message to store with the snapshot."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		defer mfsPinLock(nd, req.Context).Unlock(req.Context)
+
+		root, err := mfs.FlushPath(req.Context, nd.FilesRoot, "/")
+		if err != nil {
+			return err
+		}
+
+		msg, _ := req.Options[snapshotMessageOptionName].(string)
+		snap, err := coremfs.SaveSnapshot(req.Context, nd.Repo.Datastore(), req.Arguments[0], root.Cid(), msg)
+		if err != nil {
+			return err
+		}
+
+		out, err := snapshotOutput(req, snap)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: SnapshotOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SnapshotOutput) error {
+			_, err := fmt.Fprintf(w, "created snapshot %s of %s\n", out.Name, out.Cid)
+			return err
+		}),
+	},
+}
+
+var filesSnapshotLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List MFS snapshots.",
+		ShortDescription: `
+Lists recorded snapshots, oldest first, with their root CID, creation time
+(UTC) and message.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		snaps, err := coremfs.ListSnapshots(req.Context, nd.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+
+		list := make([]SnapshotOutput, 0, len(snaps))
+		for _, s := range snaps {
+			out, err := snapshotOutput(req, s)
+			if err != nil {
+				return err
+			}
+			list = append(list, out)
+		}
+		return cmds.EmitOnce(res, &SnapshotListOutput{list})
+	},
+	Type: SnapshotListOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SnapshotListOutput) error {
+			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			for _, s := range out.Snapshots {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Cid, s.Created.Format(time.RFC3339), s.Message)
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var filesSnapshotRmCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Remove MFS snapshots.",
+		ShortDescription: `
+Removes the named snapshots. Blocks only reachable from a removed snapshot
+are collected by the next 'ipfs repo gc'.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "Name of the snapshot to remove."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, name := range req.Arguments {
+			if err := coremfs.RemoveSnapshot(req.Context, nd.Repo.Datastore(), name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	},
+}
+
+var filesSnapshotRestoreCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Restore MFS to a snapshot.",
+		ShortDescription: `
+Replaces the contents of the MFS root with the tree recorded in the named
+snapshot. Unlike 'ipfs files chroot', this works while the daemon is
+running. The snapshot itself is kept.
+
+When MFS.AutoSnapshot is enabled, the current state is recorded as an
+automatic snapshot first, so a restore can itself be undone.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the snapshot to restore."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		defer mfsPinLock(nd, req.Context).Unlock(req.Context)
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		snap, err := coremfs.GetSnapshot(req.Context, nd.Repo.Datastore(), req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		auto, err := autoSnapshotMFS(req.Context, nd, "before 'files snapshot restore "+snap.Name+"'")
+		if err != nil {
+			return fmt.Errorf("taking automatic snapshot: %w", err)
+		}
+
+		if err := coremfs.RestoreSnapshot(req.Context, nd.FilesRoot, nd.DAG, snap.Cid); err != nil {
+			return err
+		}
+		noFlushOperationCounter.Store(0)
+
+		msg := fmt.Sprintf("MFS restored to snapshot %s (%s)\n", snap.Name, enc.Encode(snap.Cid))
+		if auto != nil {
+			msg += fmt.Sprintf("Previous state saved as snapshot %s\n", auto.Name)
+		}
+		return cmds.EmitOnce(res, &MessageOutput{Message: msg})
+	},
+	Type: MessageOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
+			_, err := fmt.Fprint(w, out.Message)
+			return err
+		}),
+	},
+}
+
+// autoSnapshotMFS records the current MFS root as an automatic snapshot
+// when MFS.AutoSnapshot is enabled. It returns a nil snapshot when the
+// feature is disabled. The caller should hold the MFS pin lock.
+func autoSnapshotMFS(ctx context.Context, nd *core.IpfsNode, reason string) (*coremfs.Snapshot, error) {
+	cfg, err := nd.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.MFS.AutoSnapshot.WithDefault(config.DefaultMFSAutoSnapshot) {
+		return nil, nil
+	}
+
+	root, err := nd.FilesRoot.GetDirectory().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	keep := cfg.MFS.AutoSnapshotKeep.WithDefault(config.DefaultMFSAutoSnapshotKeep)
+	return coremfs.AutoSnapshot(ctx, nd.Repo.Datastore(), root.Cid(), reason, int(keep))
+}
@@ -0,0 +1,787 @@
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/boxo/files"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	"github.com/ipfs/boxo/mfs"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	syncDeleteOptionName  = "delete"
+	syncDryRunOptionName  = "dry-run"
+	syncReverseOptionName = "reverse"
+
+	syncActionAdd    = "add"
+	syncActionUpdate = "update"
+	syncActionDelete = "delete"
+
+	// syncTarRoot is the name of the root entry in the TAR stream sent to
+	// the client in --reverse mode.
+	syncTarRoot = "mfs"
+)
+
+type SyncOutput struct {
+	Action string
+	Path   string
+}
+
+var filesSyncCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Synchronize a local directory with an MFS directory.",
+		ShortDescription: `
+'ipfs files sync' makes <mfs-path> match the contents of <local-path>, in the
+spirit of rsync. Files that are new or whose content changed are imported
+with the settings from the Import config section and linked into MFS;
+unchanged files are left alone. Missing parent directories in MFS are
+created.
+
+    $ ipfs files sync ./site /www/example.com
+    add index.html
+    update css/main.css
+
+Entries present in the destination but not in the source are kept unless
+'--delete' is passed. Hidden files and files matching '--ignore' or
+'--ignore-rules-path' rules are skipped, and they are never deleted from the
+destination. Rules use the .gitignore syntax and are matched against paths
+relative to <local-path>, e.g. 'build/*.o'.
+
+Use '--dry-run' to print the changes without applying them.
+
+With '--reverse', the direction is flipped: <local-path> is updated to match
+<mfs-path>, which is useful to materialize an MFS tree on disk. Files are
+compared by content, and only changed files are written.
+
+Over the HTTP RPC API, send the local directory as a multipart body, the same
+way as for 'ipfs add'. In '--reverse' mode the response is a TAR stream of
+<mfs-path>, and applying it to disk is left to the client.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("local-path", true, false, "Local directory."),
+		cmds.StringArg("mfs-path", true, false, "MFS directory."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(syncDeleteOptionName, "Delete destination entries that do not exist in the source."),
+		cmds.BoolOption(syncDryRunOptionName, "n", "Print the changes that would be made, without applying them."),
+		cmds.BoolOption(syncReverseOptionName, "Update <local-path> to match <mfs-path> instead."),
+		cmds.OptionHidden,
+		cmds.OptionIgnore,
+		cmds.OptionIgnoreRules,
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		// Ignore rules are read here, in the client process, and passed on as
+		// plain rules: the rules file is a local path, and the daemon needs
+		// them to keep ignored entries from being deleted.
+		if rulesFile, _ := req.Options[cmds.IgnoreRules].(string); rulesFile != "" {
+			data, err := os.ReadFile(rulesFile)
+			if err != nil {
+				return err
+			}
+			rules, _ := req.Options[cmds.Ignore].([]string)
+			for line := range strings.Lines(string(data)) {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					rules = append(rules, line)
+				}
+			}
+			req.SetOption(cmds.Ignore, rules)
+			delete(req.Options, cmds.IgnoreRules)
+		}
+
+		// In forward mode the local directory is uploaded like 'ipfs add'
+		// does. PreRun may run twice when falling back to an offline node,
+		// and req.Files is already set on the second run.
+		reverse, _ := req.Options[syncReverseOptionName].(bool)
+		if reverse || req.Files != nil {
+			return nil
+		}
+		filter, err := syncFilter(req)
+		if err != nil {
+			return err
+		}
+		localPath := filepath.Clean(req.Arguments[0])
+		stat, err := os.Stat(localPath)
+		if err != nil {
+			return err
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("%s is not a directory", localPath)
+		}
+		// hidden and ignored entries are filtered by path below, the
+		// serial file only filters by name
+		dir, err := files.NewSerialFile(localPath, true, stat)
+		if err != nil {
+			return err
+		}
+		filtered := &syncFilteredDir{Directory: dir.(files.Directory), filter: filter}
+		req.Files = files.NewSliceDirectory([]files.DirEntry{files.FileEntry(filepath.Base(localPath), filtered)})
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		dst, err := checkPath(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		reverse, _ := req.Options[syncReverseOptionName].(bool)
+		if reverse {
+			fsn, err := mfs.Lookup(nd.FilesRoot, dst)
+			if err != nil {
+				return fmt.Errorf("%s: %w", dst, err)
+			}
+			if _, ok := fsn.(*mfs.Directory); !ok {
+				return fmt.Errorf("%s is not a directory", dst)
+			}
+			dagnd, err := fsn.GetNode()
+			if err != nil {
+				return err
+			}
+			f, err := unixfile.NewUnixfsFile(req.Context, nd.DAG, dagnd)
+			if err != nil {
+				return err
+			}
+			reader, err := fileArchive(f, syncTarRoot, false, gzip.NoCompression)
+			if err != nil {
+				return err
+			}
+			go func() {
+				<-req.Context.Done()
+				reader.Close()
+			}()
+			res.SetEncodingType(cmds.OctetStream)
+			res.SetContentType("application/x-tar")
+			return res.Emit(reader)
+		}
+
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		if req.Files == nil {
+			return errors.New("no local directory was received")
+		}
+		it := req.Files.Entries()
+		if !it.Next() {
+			if it.Err() != nil {
+				return it.Err()
+			}
+			return errors.New("no local directory was received")
+		}
+		src, ok := it.Node().(files.Directory)
+		if !ok {
+			return errors.New("local path must be a directory")
+		}
+
+		dryRun, _ := req.Options[syncDryRunOptionName].(bool)
+		filter, err := syncFilter(req)
+		if err != nil {
+			return err
+		}
+		addOpts, err := syncAddOptions(cfg, dryRun)
+		if err != nil {
+			return err
+		}
+
+		defer mfsPinLock(nd, req.Context).Unlock(req.Context)
+
+		s := &mfsSyncer{
+			ctx:    req.Context,
+			root:   nd.FilesRoot,
+			api:    api,
+			opts:   addOpts,
+			dryRun: dryRun,
+			filter: filter,
+			emit: func(action, path string) error {
+				return res.Emit(&SyncOutput{Action: action, Path: path})
+			},
+		}
+		s.delete, _ = req.Options[syncDeleteOptionName].(bool)
+
+		if !dryRun {
+			prefix, err := getPrefix(req, &cfg.Import)
+			if err != nil {
+				return err
+			}
+			err = mfs.Mkdir(nd.FilesRoot, dst, mfs.MkdirOpts{Mkparents: true}, mfs.WithCidBuilder(prefix))
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.syncDir(src, dst, ""); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+
+		if _, err := mfs.FlushPath(req.Context, nd.FilesRoot, dst); err != nil {
+			return fmt.Errorf("flushing %s: %w", dst, err)
+		}
+		noFlushOperationCounter.Store(0)
+		return nil
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			req := res.Request()
+			if reverse, _ := req.Options[syncReverseOptionName].(bool); !reverse {
+				return cmds.Copy(re, res)
+			}
+
+			v, err := res.Next()
+			if err != nil {
+				return err
+			}
+			r, ok := v.(io.Reader)
+			if !ok {
+				return fmt.Errorf("unexpected response type %T", v)
+			}
+
+			filter, err := syncFilter(req)
+			if err != nil {
+				return err
+			}
+			s := &localSyncer{
+				root:   filepath.Clean(req.Arguments[0]),
+				filter: filter,
+				seen:   make(map[string]struct{}),
+				emit: func(action, path string) error {
+					return re.Emit(&SyncOutput{Action: action, Path: path})
+				},
+			}
+			s.dryRun, _ = req.Options[syncDryRunOptionName].(bool)
+			s.delete, _ = req.Options[syncDeleteOptionName].(bool)
+			return s.apply(r)
+		},
+	},
+	Type: SyncOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SyncOutput) error {
+			_, err := fmt.Fprintf(w, "%s %s\n", out.Action, out.Path)
+			return err
+		}),
+	},
+}
+
+func syncFilter(req *cmds.Request) (*files.Filter, error) {
+	hidden, _ := req.Options[cmds.Hidden].(bool)
+	rules, _ := req.Options[cmds.Ignore].([]string)
+	return files.NewFilter("", rules, hidden)
+}
+
+// syncAddOptions returns the options used to import changed files, derived
+// from the Import config section like 'ipfs add' does.
+func syncAddOptions(cfg *config.Config, hashOnly bool) ([]options.UnixfsAddOption, error) {
+	hashFunStr := cfg.Import.HashFunction.WithDefault(config.DefaultHashFunction)
+	hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized hash function: %q", strings.ToLower(hashFunStr))
+	}
+
+	opts := []options.UnixfsAddOption{
+		options.Unixfs.Hash(hashFunCode),
+		options.Unixfs.Chunker(cfg.Import.UnixFSChunker.WithDefault(config.DefaultUnixFSChunker)),
+		options.Unixfs.Pin(false, ""),
+		options.Unixfs.HashOnly(hashOnly),
+		options.Unixfs.Silent(true),
+		options.Unixfs.SizeEstimationMode(cfg.Import.HAMTSizeEstimationMode()),
+	}
+	if !cfg.Import.CidVersion.IsDefault() {
+		opts = append(opts, options.Unixfs.CidVersion(int(cfg.Import.CidVersion.WithDefault(config.DefaultCidVersion))))
+	}
+	if cfg.Import.UnixFSRawLeaves != config.Default {
+		opts = append(opts, options.Unixfs.RawLeaves(cfg.Import.UnixFSRawLeaves.WithDefault(config.DefaultUnixFSRawLeaves)))
+	}
+	if !cfg.Import.UnixFSFileMaxLinks.IsDefault() {
+		opts = append(opts, options.Unixfs.MaxFileLinks(int(cfg.Import.UnixFSFileMaxLinks.WithDefault(config.DefaultUnixFSFileMaxLinks))))
+	}
+	if cfg.Import.UnixFSDAGLayout.WithDefault(config.DefaultUnixFSDAGLayout) == config.DAGLayoutTrickle {
+		opts = append(opts, options.Unixfs.Layout(options.TrickleLayout))
+	}
+	return opts, nil
+}
+
+// syncExcluded reports whether the entry at rel, the slash-separated path
+// relative to the synchronized directory, is hidden or ignored. Unlike
+// files.Filter, which only looks at names, rules are matched against the
+// whole path, so that rules like 'build/*.o' apply.
+func syncExcluded(filter *files.Filter, rel string, dir bool) bool {
+	name := gopath.Base(rel)
+	if !filter.IncludeHidden && name != "." && name != ".." && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if dir {
+		rel += "/"
+	}
+	return filter.Rules.MatchesPath(rel)
+}
+
+// syncFilteredDir skips the entries of a local directory excluded by the
+// sync filter. rel is the path of the directory relative to the synchronized
+// one.
+type syncFilteredDir struct {
+	files.Directory
+	filter *files.Filter
+	rel    string
+}
+
+func (d *syncFilteredDir) Entries() files.DirIterator {
+	return &syncFilteredIterator{DirIterator: d.Directory.Entries(), dir: d}
+}
+
+type syncFilteredIterator struct {
+	files.DirIterator
+	dir *syncFilteredDir
+}
+
+func (it *syncFilteredIterator) Next() bool {
+	for it.DirIterator.Next() {
+		nd := it.DirIterator.Node()
+		_, isDir := nd.(files.Directory)
+		if !syncExcluded(it.dir.filter, gopath.Join(it.dir.rel, it.Name()), isDir) {
+			return true
+		}
+		nd.Close()
+	}
+	return false
+}
+
+func (it *syncFilteredIterator) Node() files.Node {
+	nd := it.DirIterator.Node()
+	if sub, ok := nd.(files.Directory); ok {
+		return &syncFilteredDir{Directory: sub, filter: it.dir.filter, rel: gopath.Join(it.dir.rel, it.Name())}
+	}
+	return nd
+}
+
+// mfsSyncer applies a local directory tree received from the client onto
+// an MFS directory.
+type mfsSyncer struct {
+	ctx    context.Context
+	root   *mfs.Root
+	api    iface.CoreAPI
+	opts   []options.UnixfsAddOption
+	filter *files.Filter
+	dryRun bool
+	delete bool
+	emit   func(action, path string) error
+}
+
+func (s *mfsSyncer) syncDir(src files.Directory, mfsPath, rel string) error {
+	var dir *mfs.Directory
+	fsn, err := mfs.Lookup(s.root, mfsPath)
+	switch {
+	case err == nil:
+		var ok bool
+		if dir, ok = fsn.(*mfs.Directory); !ok {
+			return fmt.Errorf("%s is not a directory", mfsPath)
+		}
+	case errors.Is(err, os.ErrNotExist) && s.dryRun:
+		// will be created, every entry is new
+	default:
+		return err
+	}
+
+	seen := make(map[string]struct{})
+	it := src.Entries()
+	for it.Next() {
+		name := it.Name()
+		seen[name] = struct{}{}
+		childRel := gopath.Join(rel, name)
+
+		var cur mfs.FSNode
+		if dir != nil {
+			cur, err = dir.Child(name)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("%s: %w", gopath.Join(mfsPath, name), err)
+			}
+		}
+
+		if srcDir, ok := it.Node().(files.Directory); ok {
+			if err := s.syncChildDir(dir, cur, name, childRel); err != nil {
+				return err
+			}
+			if err := s.syncDir(srcDir, gopath.Join(mfsPath, name), childRel); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.syncChildFile(dir, cur, name, childRel, it.Node()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if !s.delete || dir == nil {
+		return nil
+	}
+	names, err := dir.ListNames(s.ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		child, err := dir.Child(name)
+		if err != nil {
+			return err
+		}
+		isDir := child.Type() == mfs.TDir
+		childRel := gopath.Join(rel, name)
+		if syncExcluded(s.filter, childRel, isDir) {
+			continue
+		}
+		if isDir {
+			childRel += "/"
+		}
+		if err := s.emit(syncActionDelete, childRel); err != nil {
+			return err
+		}
+		if !s.dryRun {
+			if err := dir.Unlink(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncChildDir makes sure name is a directory in parent, replacing a file of
+// the same name.
+func (s *mfsSyncer) syncChildDir(parent *mfs.Directory, cur mfs.FSNode, name, rel string) error {
+	if cur != nil && cur.Type() == mfs.TDir {
+		return nil
+	}
+	action := syncActionAdd
+	if cur != nil {
+		action = syncActionUpdate
+	}
+	if err := s.emit(action, rel+"/"); err != nil {
+		return err
+	}
+	if s.dryRun {
+		return nil
+	}
+	if cur != nil {
+		if err := parent.Unlink(name); err != nil {
+			return err
+		}
+	}
+	_, err := parent.Mkdir(name)
+	return err
+}
+
+// syncChildFile imports a file or symlink and links it into parent, unless
+// the entry already there has the same CID.
+func (s *mfsSyncer) syncChildFile(parent *mfs.Directory, cur mfs.FSNode, name, rel string, f files.Node) error {
+	p, err := s.api.Unixfs().Add(s.ctx, f, s.opts...)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", rel, err)
+	}
+
+	action := syncActionAdd
+	if cur != nil {
+		curNd, err := cur.GetNode()
+		if err != nil {
+			return err
+		}
+		if cur.Type() != mfs.TDir && curNd.Cid().Equals(p.RootCid()) {
+			return nil
+		}
+		action = syncActionUpdate
+	}
+
+	if err := s.emit(action, rel); err != nil {
+		return err
+	}
+	if s.dryRun {
+		return nil
+	}
+
+	newNd, err := s.api.Dag().Get(s.ctx, p.RootCid())
+	if err != nil {
+		return err
+	}
+	if cur != nil {
+		if err := parent.Unlink(name); err != nil {
+			return err
+		}
+	}
+	return parent.AddChild(name, newNd)
+}
+
+// localSyncer applies a TAR stream of an MFS directory onto a local
+// directory, writing only what changed.
+type localSyncer struct {
+	root   string
+	filter *files.Filter
+	dryRun bool
+	delete bool
+	seen   map[string]struct{}
+	emit   func(action, path string) error
+}
+
+func (s *localSyncer) apply(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := syncTarRelPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		s.seen[rel] = struct{}{}
+		local := filepath.Join(s.root, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = s.syncDir(local, rel)
+		case tar.TypeReg:
+			err = s.syncFile(local, rel, hdr, tr)
+		case tar.TypeSymlink:
+			err = s.syncSymlink(local, rel, hdr.Linkname)
+		default:
+			err = fmt.Errorf("%s: unsupported entry type %d", rel, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !s.delete {
+		return nil
+	}
+	return s.deleteUnseen()
+}
+
+// syncTarRelPath returns the slash-separated path of a TAR entry relative to
+// the synchronized directory, refusing anything outside of it.
+func syncTarRelPath(name string) (string, error) {
+	name = gopath.Clean(name)
+	if name == syncTarRoot {
+		return "", nil
+	}
+	rel, ok := strings.CutPrefix(name, syncTarRoot+"/")
+	if !ok || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("invalid entry %q in sync stream", name)
+	}
+	return rel, nil
+}
+
+func (s *localSyncer) syncDir(local, rel string) error {
+	fi, err := os.Lstat(local)
+	switch {
+	case err == nil && fi.IsDir():
+		return nil
+	case err == nil:
+		if err := s.emit(syncActionUpdate, rel+"/"); err != nil {
+			return err
+		}
+		if s.dryRun {
+			return nil
+		}
+		if err := os.Remove(local); err != nil {
+			return err
+		}
+	case os.IsNotExist(err):
+		if rel != "" {
+			if err := s.emit(syncActionAdd, rel+"/"); err != nil {
+				return err
+			}
+		}
+		if s.dryRun {
+			return nil
+		}
+	default:
+		return err
+	}
+	return os.MkdirAll(local, 0o755)
+}
+
+func (s *localSyncer) syncFile(local, rel string, hdr *tar.Header, r io.Reader) error {
+	fi, err := os.Lstat(local)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+
+	// Only a regular file of the same size can be unchanged, and only
+	// then is it worth hashing the local copy.
+	var localSum []byte
+	if exists && fi.Mode().IsRegular() && fi.Size() == hdr.Size {
+		if localSum, err = fileSHA256(local); err != nil {
+			return err
+		}
+	}
+
+	h := sha256.New()
+	var tmp *os.File
+	w := io.Writer(h)
+	if !s.dryRun {
+		if tmp, err = os.CreateTemp(filepath.Dir(local), ".ipfs-sync-*"); err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		w = io.MultiWriter(h, tmp)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+
+	if localSum != nil && bytes.Equal(localSum, h.Sum(nil)) {
+		return nil
+	}
+	action := syncActionAdd
+	if exists {
+		action = syncActionUpdate
+	}
+	if err := s.emit(action, rel); err != nil {
+		return err
+	}
+	if s.dryRun {
+		return nil
+	}
+
+	if err := tmp.Chmod(hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if exists && fi.IsDir() {
+		if err := os.RemoveAll(local); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), local)
+}
+
+func (s *localSyncer) syncSymlink(local, rel, target string) error {
+	fi, err := os.Lstat(local)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && fi.Mode()&os.ModeSymlink != 0 {
+		if cur, err := os.Readlink(local); err == nil && cur == target {
+			return nil
+		}
+	}
+
+	action := syncActionAdd
+	if exists {
+		action = syncActionUpdate
+	}
+	if err := s.emit(action, rel); err != nil {
+		return err
+	}
+	if s.dryRun {
+		return nil
+	}
+	if exists {
+		if err := os.RemoveAll(local); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, local)
+}
+
+// deleteUnseen removes local entries that were not part of the MFS tree,
+// leaving hidden and ignored entries alone.
+func (s *localSyncer) deleteUnseen() error {
+	return filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && s.dryRun {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if _, ok := s.seen[rel]; ok {
+			return nil
+		}
+
+		if syncExcluded(s.filter, rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		out := rel
+		if d.IsDir() {
+			out += "/"
+		}
+		if err := s.emit(syncActionDelete, out); err != nil {
+			return err
+		}
+		if !s.dryRun {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func fileSHA256(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
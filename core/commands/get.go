@@ -2,7 +2,9 @@ package commands
 
 import (
 	gotar "archive/tar"
+	"archive/zip"
 	"bufio"
+	"compress/flate"
 	"compress/gzip"
 	"errors"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	gopath "path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
@@ -22,13 +25,23 @@ import (
 	cmds "github.com/ipfs/go-ipfs-cmds"
 )
 
-var ErrInvalidCompressionLevel = errors.New("compression level must be between 1 and 9")
+var (
+	ErrInvalidCompressionLevel = errors.New("compression level must be between 1 and 9")
+	ErrInvalidArchiveFormat    = errors.New("archive format must be 'tar' or 'zip'")
+)
 
 const (
 	outputOptionName           = "output"
 	archiveOptionName          = "archive"
 	compressOptionName         = "compress"
 	compressionLevelOptionName = "compression-level"
+	preserveMetadataOptionName = "preserve-metadata"
+	getFormatOptionName        = "format"
+)
+
+const (
+	archiveFormatTar = "tar"
+	archiveFormatZip = "zip"
 )
 
 var GetCmd = &cmds.Command{
@@ -44,9 +57,20 @@ To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
 may also specify the level of compression by specifying '-l=<1-9>'.
+
+To output a ZIP archive, use '--format=zip'. The archive is streamed as the
+UnixFS tree is read, so it is never buffered in full. Entries are compressed
+with Deflate; '--compress' and '-l' select the Deflate level instead of
+adding a GZIP layer. '--format=tar' is equivalent to '--archive'.
+
+UnixFS mode and modification time stored with 'ipfs add --preserve-mode',
+'--preserve-mtime', or 'ipfs files chmod' and 'ipfs files touch' are applied
+to extracted files and directories, and written to TAR headers when using
+'--archive'. Use '--preserve-metadata=false' to ignore the stored metadata:
+files are then written with default permissions and the current time.
 `,
 		HTTP: &cmds.HTTPHelpText{
-			ResponseContentType: "application/x-tar, or application/gzip when compress=true",
+			ResponseContentType: "application/x-tar, application/gzip when compress=true, or application/zip when format=zip",
 		},
 	},
 
@@ -56,20 +80,36 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 	Options: []cmds.Option{
 		cmds.StringOption(outputOptionName, "o", "The path where the output should be stored."),
 		cmds.BoolOption(archiveOptionName, "a", "Output a TAR archive."),
+		cmds.StringOption(getFormatOptionName, "Archive format to output: 'tar' or 'zip'. Implies --archive."),
 		cmds.BoolOption(compressOptionName, "C", "Compress the output with GZIP compression."),
 		cmds.IntOption(compressionLevelOptionName, "l", "The level of compression (1-9)."),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data. Defaults to true when stderr is a terminal."),
+		cmds.BoolOption(preserveMetadataOptionName, "Apply UnixFS mode and mtime to the output, if present.").WithDefault(true),
+		cmdenv.OptionRetrievalTrace,
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
-		_, err := getCompressOptions(req)
+		if _, err := getCompressOptions(req); err != nil {
+			return err
+		}
+		_, err := getArchiveFormat(req)
 		return err
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		finishTrace, err := cmdenv.TraceRetrieval(req, env)
+		if err != nil {
+			return err
+		}
+		defer finishTrace()
+
 		ctx := req.Context
 		cmplvl, err := getCompressOptions(req)
 		if err != nil {
 			return err
 		}
+		format, err := getArchiveFormat(req)
+		if err != nil {
+			return err
+		}
 
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
@@ -93,8 +133,16 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 
 		res.SetLength(uint64(size))
 
-		archive, _ := req.Options[archiveOptionName].(bool)
-		reader, err := fileArchive(file, p.String(), archive, cmplvl)
+		if preserve, _ := req.Options[preserveMetadataOptionName].(bool); !preserve {
+			file = stripMetadata(file)
+		}
+
+		var reader io.ReadCloser
+		if format == archiveFormatZip {
+			reader, err = fileZipArchive(file, p.String(), cmplvl)
+		} else {
+			reader, err = fileArchive(file, p.String(), format == archiveFormatTar, cmplvl)
+		}
 		if err != nil {
 			return err
 		}
@@ -107,12 +155,16 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		}()
 
 		// Set Content-Type based on output format.
-		// When compression is enabled, output is gzip (or tar.gz for directories).
-		// Otherwise, tar is used as the transport format.
+		// Zip carries its own compression. Otherwise, when compression is
+		// enabled, output is gzip (or tar.gz for directories), and tar is
+		// used as the transport format.
 		res.SetEncodingType(cmds.OctetStream)
-		if cmplvl != gzip.NoCompression {
+		switch {
+		case format == archiveFormatZip:
+			res.SetContentType("application/zip")
+		case cmplvl != gzip.NoCompression:
 			res.SetContentType("application/gzip")
-		} else {
+		default:
 			res.SetContentType("application/x-tar")
 		}
 
@@ -139,13 +191,18 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 				return err
 			}
 
-			archive, _ := req.Options[archiveOptionName].(bool)
+			format, err := getArchiveFormat(req)
+			if err != nil {
+				return err
+			}
+
 			showProgress := cmdenv.ShouldShowProgress(req, progressOptionName)
 
 			gw := getWriter{
 				Out:         os.Stdout,
 				Err:         os.Stderr,
-				Archive:     archive,
+				Archive:     format == archiveFormatTar,
+				Zip:         format == archiveFormatZip,
 				Compression: cmplvl,
 				Size:        int64(res.Length()),
 				Progress:    showProgress,
@@ -195,30 +252,39 @@ type getWriter struct {
 	Err io.Writer // for progress bar output
 
 	Archive     bool
+	Zip         bool
 	Compression int
 	Size        int64
 	Progress    bool
 }
 
 func (gw *getWriter) Write(r io.Reader, fpath string) error {
-	if gw.Archive || gw.Compression != gzip.NoCompression {
+	if gw.Archive || gw.Zip || gw.Compression != gzip.NoCompression {
 		return gw.writeArchive(r, fpath)
 	}
 	return gw.writeExtracted(r, fpath)
 }
 
 func (gw *getWriter) writeArchive(r io.Reader, fpath string) error {
-	// adjust file name if tar
-	if gw.Archive {
-		if !strings.HasSuffix(fpath, ".tar") && !strings.HasSuffix(fpath, ".tar.gz") {
-			fpath += ".tar"
+	switch {
+	case gw.Zip:
+		// zip compresses its entries, so no extra suffix for compression
+		if !strings.HasSuffix(fpath, ".zip") {
+			fpath += ".zip"
+		}
+	default:
+		// adjust file name if tar
+		if gw.Archive {
+			if !strings.HasSuffix(fpath, ".tar") && !strings.HasSuffix(fpath, ".tar.gz") {
+				fpath += ".tar"
+			}
 		}
-	}
 
-	// adjust file name if gz
-	if gw.Compression != gzip.NoCompression {
-		if !strings.HasSuffix(fpath, ".gz") {
-			fpath += ".gz"
+		// adjust file name if gz
+		if gw.Compression != gzip.NoCompression {
+			if !strings.HasSuffix(fpath, ".gz") {
+				fpath += ".gz"
+			}
 		}
 	}
 
@@ -270,6 +336,30 @@ func getCompressOptions(req *cmds.Request) (int, error) {
 	return cmplvl, nil
 }
 
+// getArchiveFormat returns the archive format requested with --format, or
+// with the older --archive flag. An empty string means the output is
+// extracted rather than archived.
+func getArchiveFormat(req *cmds.Request) (string, error) {
+	format, _ := req.Options[getFormatOptionName].(string)
+	archive, _ := req.Options[archiveOptionName].(bool)
+	switch strings.ToLower(format) {
+	case "":
+		if archive {
+			return archiveFormatTar, nil
+		}
+		return "", nil
+	case archiveFormatTar:
+		return archiveFormatTar, nil
+	case archiveFormatZip:
+		if archive {
+			return "", errors.New("--archive cannot be combined with --format=zip")
+		}
+		return archiveFormatZip, nil
+	default:
+		return "", ErrInvalidArchiveFormat
+	}
+}
+
 // DefaultBufSize is the buffer size for gets. for now, 1MiB, which is ~4 blocks.
 // TODO: does this need to be configurable?
 var DefaultBufSize = 1048576
@@ -366,3 +456,134 @@ func newMaybeGzWriter(w io.Writer, compression int) (io.WriteCloser, error) {
 	}
 	return &identityWriteCloser{w}, nil
 }
+
+// stripMetadata wraps a UnixFS node so that it and all of its descendants
+// report no mode and no modification time. The TAR writer then falls back to
+// default permissions and the current time, exactly as for content imported
+// without metadata.
+func stripMetadata(nd files.Node) files.Node {
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return files.NewSymlinkFile(nd.Target, time.Time{})
+	case files.File:
+		return &noMetaFile{nd}
+	case files.Directory:
+		return &noMetaDir{nd}
+	default:
+		return nd
+	}
+}
+
+type noMetaFile struct {
+	files.File
+}
+
+func (f *noMetaFile) Mode() os.FileMode  { return 0 }
+func (f *noMetaFile) ModTime() time.Time { return time.Time{} }
+
+type noMetaDir struct {
+	files.Directory
+}
+
+func (d *noMetaDir) Mode() os.FileMode  { return 0 }
+func (d *noMetaDir) ModTime() time.Time { return time.Time{} }
+
+func (d *noMetaDir) Entries() files.DirIterator {
+	return &noMetaIterator{d.Directory.Entries()}
+}
+
+type noMetaIterator struct {
+	files.DirIterator
+}
+
+func (it *noMetaIterator) Node() files.Node {
+	return stripMetadata(it.DirIterator.Node())
+}
+
+// fileZipArchive streams a ZIP archive of the given node. Entries are
+// written as the UnixFS tree is traversed, using data descriptors so that
+// nothing has to be buffered to compute sizes or checksums up front.
+func fileZipArchive(f files.Node, name string, compression int) (io.ReadCloser, error) {
+	cleaned := gopath.Clean(name)
+	_, filename := gopath.Split(cleaned)
+
+	piper, pipew := io.Pipe()
+	bufw := bufio.NewWriterSize(pipew, DefaultBufSize)
+
+	zw := zip.NewWriter(bufw)
+	if compression != gzip.NoCompression {
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, compression)
+		})
+	}
+
+	go func() {
+		err := writeZipNode(zw, f, filename)
+		if err == nil {
+			err = zw.Close()
+		}
+		if err == nil {
+			err = bufw.Flush()
+		}
+		if err != nil {
+			_ = pipew.CloseWithError(err)
+			return
+		}
+		pipew.Close() // everything seems to be ok.
+	}()
+
+	return piper, nil
+}
+
+func writeZipNode(zw *zip.Writer, nd files.Node, fpath string) error {
+	hdr := &zip.FileHeader{
+		Name:     fpath,
+		Method:   zip.Deflate,
+		Modified: nd.ModTime(),
+	}
+	if hdr.Modified.IsZero() {
+		hdr.Modified = time.Now()
+	}
+	perms := files.UnixPermsToModePerms(files.UnixPermsOrDefault(nd))
+
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		hdr.SetMode(os.ModeSymlink | perms)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, nd.Target)
+		return err
+	case files.File:
+		hdr.SetMode(perms)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, nd)
+		return err
+	case files.Directory:
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+		hdr.SetMode(os.ModeDir | perms)
+		if _, err := zw.CreateHeader(hdr); err != nil {
+			return err
+		}
+		it := nd.Entries()
+		for it.Next() {
+			// refuse entries that would escape the archive root, as the
+			// TAR writer does
+			child := gopath.Join(fpath, it.Name())
+			if !strings.HasPrefix(child, fpath+"/") {
+				return files.ErrUnixFSPathOutsideRoot
+			}
+			if err := writeZipNode(zw, it.Node(), child); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	default:
+		return fmt.Errorf("file type %T is not supported", nd)
+	}
+}
@@ -0,0 +1,147 @@
+package name
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	ke "github.com/ipfs/kubo/core/commands/keyencode"
+	"github.com/ipfs/kubo/core/coremfs"
+)
+
+type AutopublishEntry struct {
+	Key       string
+	Name      string `json:",omitempty"`
+	Path      string
+	Cid       string    `json:",omitempty"`
+	Published time.Time `json:",omitzero"`
+	Pending   string    `json:",omitempty"`
+	Error     string    `json:",omitempty"`
+}
+
+type AutopublishList struct {
+	Rules []AutopublishEntry
+}
+
+var AutopublishCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect automatic IPNS publishing of MFS paths.",
+		ShortDescription: `
+The daemon publishes the CID of each MFS path listed in MFS.AutoPublish
+under the associated key whenever a flush changes it, once the path has been
+stable for the rule's debounce period:
+
+  > ipfs key gen site
+  > ipfs config --json MFS.AutoPublish '[{"Path": "/www/site", "Key": "site"}]'
+
+Restart the daemon after adding the first rule. Rules can then be changed
+without a restart.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls": autopublishLsCmd,
+	},
+}
+
+var autopublishLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List MFS.AutoPublish rules and their state.",
+		ShortDescription: `
+Lists each MFS.AutoPublish rule with the IPNS name it publishes to, the last
+published CID and when it was published, a CID waiting for the debounce
+period to pass, and the last error, if any.
+`,
+	},
+	Options: []cmds.Option{
+		ke.OptionIPNSBase,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		keyEnc, err := ke.KeyEncoderFromString(req.Options[ke.OptionIPNSBase.Name()].(string))
+		if err != nil {
+			return err
+		}
+
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+		statuses, err := coremfs.ListAutoPublishStatus(req.Context, nd.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+		keys, err := api.Key().List(req.Context)
+		if err != nil {
+			return fmt.Errorf("listing keys failed: %w", err)
+		}
+		names := make(map[string]string, len(keys))
+		for _, k := range keys {
+			names[k.Name()] = keyEnc.FormatID(k.ID())
+		}
+
+		list := make([]AutopublishEntry, 0, len(cfg.MFS.AutoPublish))
+		for _, rule := range cfg.MFS.AutoPublish {
+			e := AutopublishEntry{
+				Key:  rule.Key,
+				Name: names[rule.Key],
+				Path: rule.Path,
+			}
+			if e.Name == "" {
+				e.Error = fmt.Sprintf("no key named %q", rule.Key)
+			}
+			// state recorded for a previous path of the key does not apply
+			if st := statuses[rule.Key]; st != nil && st.Path == rule.Path {
+				if st.Cid.Defined() {
+					e.Cid = enc.Encode(st.Cid)
+					e.Published = st.Published
+				}
+				if st.Pending.Defined() {
+					e.Pending = enc.Encode(st.Pending)
+				}
+				if st.Error != "" {
+					e.Error = st.Error
+				}
+			}
+			list = append(list, e)
+		}
+		return cmds.EmitOnce(res, &AutopublishList{list})
+	},
+	Type: AutopublishList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AutopublishList) error {
+			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			for _, e := range out.Rules {
+				cid, state := "-", "not published yet"
+				if e.Cid != "" {
+					cid = e.Cid
+					state = "published " + e.Published.Format(time.RFC3339)
+				}
+				if e.Pending != "" {
+					state += ", pending " + e.Pending
+				}
+				if e.Error != "" {
+					state += ", error: " + e.Error
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Path, e.Key, ipns.NamespacePrefix+e.Name, cid, state)
+			}
+			return tw.Flush()
+		}),
+	},
+}
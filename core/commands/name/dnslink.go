@@ -0,0 +1,306 @@
+package name
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coreipns"
+)
+
+const (
+	dnslinkWatchOptionName    = "watch"
+	dnslinkIntervalOptionName = "interval"
+	dnslinkTimeoutOptionName  = "provider-timeout"
+)
+
+type DNSLinkTXT struct {
+	Text    string
+	Path    string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+	Warning string `json:",omitempty"`
+	Ignored bool   `json:",omitempty"`
+}
+
+type DNSLinkTarget struct {
+	// Path is the immutable path the DNSLink value resolves to.
+	Path  string `json:",omitempty"`
+	Local bool
+	// Providers is the number of providers found, -1 when not looked up.
+	Providers    int
+	SelfProvides bool
+	// ProvidersError is why providers could not be looked up on an online
+	// node.
+	ProvidersError string `json:",omitempty"`
+	Error          string `json:",omitempty"`
+}
+
+type DNSLinkCheckOutput struct {
+	Domain string
+	Lookup string
+	// Resolver is the DNS.Resolvers URL queried, empty for the system
+	// resolver, and ResolverDomain the domain it is set for.
+	Resolver       string `json:",omitempty"`
+	ResolverDomain string `json:",omitempty"`
+	Records        []DNSLinkTXT
+	TTL            time.Duration
+	Value          string         `json:",omitempty"`
+	Error          string         `json:",omitempty"`
+	Hints          []string       `json:",omitempty"`
+	Target         *DNSLinkTarget `json:",omitempty"`
+	Time           time.Time
+	// Changed is set in --watch mode on checks that differ from the
+	// previous one.
+	Changed bool `json:",omitempty"`
+}
+
+var DNSLinkCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect DNSLink records.",
+		ShortDescription: `
+DNSLink maps a DNS name to a content path with a TXT record on the _dnslink
+subdomain of the name:
+
+  _dnslink.example.com. TXT "dnslink=/ipfs/bafy..."
+
+'ipfs name resolve /ipns/example.com' follows these records.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"check": dnslinkCheckCmd,
+	},
+}
+
+var dnslinkCheckCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Check the DNSLink setup of a domain.",
+		ShortDescription: `
+Queries the TXT records of _dnslink.<domain> through the resolver the node
+uses for the domain, as set in DNS.Resolvers, and reports:
+
+  - every TXT record returned, and why records are rejected or ignored
+  - the DNSLink value, or why the domain does not resolve
+  - the TTL of the records, when the resolver reports it (DNS over HTTPS
+    resolvers do, the system resolver does not)
+  - whether the value resolves with local data only, whether its root block
+    is stored locally and, when the node is online, how many providers
+    announce it
+
+  > ipfs name dnslink check example.com
+
+With --watch, the check is repeated every --interval and printed again each
+time the records change, until interrupted.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("domain", true, false, "Domain name to check."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(dnslinkWatchOptionName, "w", "Keep checking, and report each change of the records."),
+		cmds.StringOption(dnslinkIntervalOptionName, "Time between two checks with --watch.").WithDefault("1m"),
+		cmds.StringOption(dnslinkTimeoutOptionName, "Time spent looking for providers of the value.").WithDefault("10s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		watch, _ := req.Options[dnslinkWatchOptionName].(bool)
+		interval, err := time.ParseDuration(req.Options[dnslinkIntervalOptionName].(string))
+		if err != nil {
+			return fmt.Errorf("error parsing interval option: %w", err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("interval must be greater than zero")
+		}
+		timeout, err := time.ParseDuration(req.Options[dnslinkTimeoutOptionName].(string))
+		if err != nil {
+			return fmt.Errorf("error parsing timeout option: %w", err)
+		}
+
+		domain := req.Arguments[0]
+		check := func() (*coreipns.DNSLinkCheck, *DNSLinkCheckOutput) {
+			c := coreipns.CheckDNSLink(req.Context, nd.DNSResolver, domain)
+			out := newDNSLinkCheckOutput(c)
+			out.Resolver, out.ResolverDomain = coreipns.DNSResolverFor(cfg.DNSResolversWithAutoConf(), c.Lookup)
+			if c.Value != nil {
+				out.Target = checkDNSLinkTarget(req.Context, nd, api, c, timeout)
+			}
+			return c, out
+		}
+
+		prev, out := check()
+		if err := res.Emit(out); err != nil || !watch {
+			return err
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-req.Context.Done():
+				return nil
+			}
+			c, out := check()
+			if !c.Changed(prev) {
+				continue
+			}
+			prev = c
+			out.Changed = true
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+	},
+	Type: DNSLinkCheckOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *DNSLinkCheckOutput) error {
+			if out.Changed {
+				fmt.Fprintf(w, "\nchanged at %s:\n", out.Time.Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "Domain:    %s\n", out.Domain)
+			resolver := "system resolver"
+			if out.Resolver != "" {
+				resolver = fmt.Sprintf("%s (DNS.Resolvers %q)", out.Resolver, out.ResolverDomain)
+			}
+			fmt.Fprintf(w, "Lookup:    TXT %s via %s\n", out.Lookup, resolver)
+			for _, r := range out.Records {
+				status := "ok"
+				switch {
+				case r.Error != "":
+					status = "error: " + r.Error
+				case r.Ignored:
+					status = "ignored: not a DNSLink record"
+				case r.Warning != "":
+					status = "warning: " + r.Warning
+				}
+				fmt.Fprintf(w, "Record:    %q %s\n", r.Text, status)
+			}
+			if len(out.Records) > 0 {
+				ttl := "unknown, the resolver does not report it"
+				if out.TTL > 0 {
+					ttl = out.TTL.String()
+				}
+				fmt.Fprintf(w, "TTL:       %s\n", ttl)
+			}
+			if out.Error != "" {
+				fmt.Fprintf(w, "Error:     %s\n", out.Error)
+			}
+			for _, h := range out.Hints {
+				fmt.Fprintf(w, "Hint:      %s\n", h)
+			}
+			if out.Value != "" {
+				fmt.Fprintf(w, "Value:     %s\n", out.Value)
+			}
+			if t := out.Target; t != nil {
+				if t.Error != "" {
+					fmt.Fprintf(w, "Resolved:  no, %s\n", t.Error)
+					return nil
+				}
+				fmt.Fprintf(w, "Resolved:  %s\n", t.Path)
+				fmt.Fprintf(w, "Local:     %s\n", yesNo(t.Local))
+				switch {
+				case t.ProvidersError != "":
+					fmt.Fprintf(w, "Providers: lookup failed, %s\n", t.ProvidersError)
+				case t.Providers < 0:
+					fmt.Fprintln(w, "Providers: not looked up, node is offline")
+				case t.SelfProvides:
+					fmt.Fprintf(w, "Providers: %d, including this node\n", t.Providers)
+				default:
+					fmt.Fprintf(w, "Providers: %d\n", t.Providers)
+				}
+			}
+			return nil
+		}),
+	},
+}
+
+func newDNSLinkCheckOutput(c *coreipns.DNSLinkCheck) *DNSLinkCheckOutput {
+	out := &DNSLinkCheckOutput{
+		Domain:  c.Domain,
+		Lookup:  c.Lookup,
+		Records: make([]DNSLinkTXT, 0, len(c.Records)),
+		TTL:     c.TTL,
+		Hints:   c.Hints,
+		Time:    time.Now(),
+	}
+	for _, r := range c.Records {
+		txt := DNSLinkTXT{Text: r.Text, Warning: r.Warning, Ignored: r.Ignored}
+		if r.Path != nil {
+			txt.Path = r.Path.String()
+		}
+		if r.Err != nil {
+			txt.Error = r.Err.Error()
+		}
+		out.Records = append(out.Records, txt)
+	}
+	if c.Value != nil {
+		out.Value = c.Value.String()
+	}
+	if c.Err != nil {
+		out.Error = c.Err.Error()
+	}
+	return out
+}
+
+// checkDNSLinkTarget reports whether the value of a DNSLink resolves with
+// local data, and who provides it.
+func checkDNSLinkTarget(ctx context.Context, nd *core.IpfsNode, api iface.CoreAPI, c *coreipns.DNSLinkCheck, timeout time.Duration) *DNSLinkTarget {
+	t := &DNSLinkTarget{Providers: -1}
+	offline, err := api.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	p, _, err := offline.ResolvePath(ctx, c.Value)
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	t.Path = p.String()
+	t.Local, _ = nd.Blockstore.Has(ctx, p.RootCid())
+
+	if !nd.IsOnline {
+		return t
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	provs, err := api.Routing().FindProviders(ctx, p)
+	if err != nil {
+		t.ProvidersError = err.Error()
+		return t
+	}
+	t.Providers = 0
+	for prov := range provs {
+		t.Providers++
+		if prov.ID == nd.Identity {
+			t.SelfProvides = true
+		}
+	}
+	return t
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,247 @@
+package name
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coreipns"
+)
+
+type HistoryEntry struct {
+	Sequence uint64
+	Value    string
+	Validity time.Time
+	TTL      time.Duration
+	Origin   string
+	Archived time.Time
+	// Current is set on the record with the highest sequence number, the
+	// one resolvers select.
+	Current bool `json:",omitempty"`
+}
+
+type HistoryList struct {
+	Name    string
+	Records []HistoryEntry
+}
+
+type RollbackEntry struct {
+	Name     string
+	Value    string
+	Sequence uint64
+}
+
+var HistoryCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the IPNS records of a name kept by this node.",
+		ShortDescription: `
+Every IPNS record this node publishes, with 'ipfs name publish', MFS
+auto-publishing or 'ipfs name rollback', and every valid record stored with
+'ipfs name put' is kept in a local archive. This command lists the archived
+records of a name, oldest first, with their sequence number, value, validity
+and where they came from. Republishing a record does not add a new entry.
+
+The name can be a key name, as listed by 'ipfs key list', or an IPNS name.
+
+  > ipfs name history site
+  SEQ  VALUE                  VALID UNTIL           ARCHIVED              ORIGIN
+  0    /ipfs/bafy...aaaa      2026-10-21T10:02:11Z  2026-10-19T10:02:11Z  publish
+  1    /ipfs/bafy...bbbb      2026-10-21T11:40:36Z  2026-10-19T11:40:36Z  publish *
+
+The record marked with * has the highest sequence number: it is the one
+resolvers select. Use 'ipfs name rollback' to publish the value of an older
+record again.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Key name or IPNS name."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		name, _, err := lookupName(req.Context, api, req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		history, err := coreipns.History(req.Context, nd.Repo.Datastore(), name)
+		if err != nil {
+			return err
+		}
+		list := HistoryList{Name: name.String(), Records: make([]HistoryEntry, 0, len(history))}
+		for _, ar := range history {
+			list.Records = append(list.Records, HistoryEntry{
+				Sequence: ar.Sequence,
+				Value:    ar.Value.String(),
+				Validity: ar.Validity,
+				TTL:      ar.TTL,
+				Origin:   ar.Origin,
+				Archived: ar.Archived,
+				Current:  ar.Sequence == history[len(history)-1].Sequence,
+			})
+		}
+		return cmds.EmitOnce(res, &list)
+	},
+	Type: HistoryList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *HistoryList) error {
+			tw := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+			fmt.Fprintln(tw, "SEQ\tVALUE\tVALID UNTIL\tARCHIVED\tORIGIN")
+			for _, e := range out.Records {
+				origin := e.Origin
+				if e.Current {
+					origin += " *"
+				}
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", e.Sequence, e.Value, e.Validity.UTC().Format(time.RFC3339), e.Archived.UTC().Format(time.RFC3339), origin)
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var RollbackCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Publish the value of an archived IPNS record again.",
+		ShortDescription: `
+Publishes the value of the record of the given key with the given sequence
+number, as listed by 'ipfs name history', under a new record signed with the
+next sequence number, so that it replaces the current record everywhere. This
+reverts a bad publish:
+
+  > ipfs name history site
+  > ipfs name rollback site 3
+  Rolled back k51... to /ipfs/bafy... (sequence 5)
+
+The new record has the TTL of the archived one, and is valid for --lifetime.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, false, "Name of the key, as listed by 'ipfs key list', or its IPNS name."),
+		cmds.StringArg("sequence", true, false, "Sequence number of the archived record to publish again."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(lifeTimeOptionName, "t", `Time duration the signed record will be valid for. Default: `+ipns.DefaultRecordLifetime.String()),
+		cmds.BoolOption(allowOfflineOptionName, "Allow publishing when offline - publishes to local datastore without requiring network connectivity."),
+		cmds.BoolOption(allowDelegatedOptionName, "Allow publishing without DHT connectivity - uses local datastore and HTTP delegated publishers only."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		seq, err := strconv.ParseUint(req.Arguments[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid sequence number: %w", err)
+		}
+		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
+		allowDelegated, _ := req.Options[allowDelegatedOptionName].(bool)
+		if allowOffline && allowDelegated {
+			return errors.New("cannot use both --allow-offline and --allow-delegated flags")
+		}
+		validTime := ipns.DefaultRecordLifetime
+		if validTimeOpt, found := req.Options[lifeTimeOptionName].(string); found {
+			d, err := time.ParseDuration(validTimeOpt)
+			if err != nil {
+				return fmt.Errorf("error parsing lifetime option: %s", err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("lifetime must be greater than zero, got %s", validTimeOpt)
+			}
+			validTime = d
+		}
+
+		name, key, err := lookupName(req.Context, api, req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return fmt.Errorf("no key named %q: only names of local keys can be rolled back", req.Arguments[0])
+		}
+
+		ds := nd.Repo.Datastore()
+		ar, err := coreipns.GetArchived(req.Context, ds, name, seq)
+		if err != nil {
+			return err
+		}
+		next, err := coreipns.NextSequence(req.Context, ds, name)
+		if err != nil {
+			return err
+		}
+
+		_, err = api.Name().Publish(req.Context, ar.Value,
+			options.Name.Key(key),
+			options.Name.Sequence(next),
+			options.Name.ValidTime(validTime),
+			options.Name.TTL(min(ar.TTL, validTime)),
+			options.Name.AllowOffline(allowOffline),
+			options.Name.AllowDelegated(allowDelegated),
+		)
+		if err != nil {
+			if err == iface.ErrOffline {
+				err = errAllowOffline
+			}
+			return err
+		}
+
+		return cmds.EmitOnce(res, &RollbackEntry{
+			Name:     name.String(),
+			Value:    ar.Value.String(),
+			Sequence: next,
+		})
+	},
+	Type: RollbackEntry{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RollbackEntry) error {
+			_, err := fmt.Fprintf(w, "Rolled back %s to %s (sequence %d)\n", out.Name, out.Value, out.Sequence)
+			return err
+		}),
+	},
+}
+
+// lookupName returns the IPNS name of arg, a key name or an IPNS name, and
+// the name of the local key it belongs to, if any.
+func lookupName(ctx context.Context, api iface.CoreAPI, arg string) (ipns.Name, string, error) {
+	keys, err := api.Key().List(ctx)
+	if err != nil {
+		return ipns.Name{}, "", fmt.Errorf("listing keys failed: %w", err)
+	}
+	for _, k := range keys {
+		if k.Name() == arg {
+			return ipns.NameFromPeer(k.ID()), k.Name(), nil
+		}
+	}
+
+	name, err := ipns.NameFromString(strings.TrimPrefix(arg, ipns.NamespacePrefix))
+	if err != nil {
+		return ipns.Name{}, "", fmt.Errorf("%q is neither a key name nor an IPNS name", arg)
+	}
+	for _, k := range keys {
+		if k.ID() == name.Peer() {
+			return name, k.Name(), nil
+		}
+	}
+	return name, "", nil
+}
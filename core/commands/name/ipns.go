@@ -11,6 +11,7 @@ import (
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	logging "github.com/ipfs/go-log/v2"
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	iface "github.com/ipfs/kubo/core/coreiface"
 	options "github.com/ipfs/kubo/core/coreiface/options"
 )
 
@@ -18,6 +19,58 @@ var log = logging.Logger("core/commands/ipns")
 
 type ResolvedPath struct {
 	Path string
+	// Trace is set instead of Path for the steps of a traced resolution.
+	Trace *TraceEvent `json:",omitempty"`
+}
+
+// TraceEvent is the JSON form of a coreiface.NameTraceEvent.
+type TraceEvent struct {
+	Type     iface.NameTraceEventType
+	Name     string
+	Source   string        `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"`
+	Records  []TraceRecord `json:",omitempty"`
+	Reason   string        `json:",omitempty"`
+	Error    string        `json:",omitempty"`
+}
+
+// TraceRecord is the JSON form of a coreiface.NameTraceRecord.
+type TraceRecord struct {
+	Source   string
+	Value    string
+	Sequence uint64        `json:",omitempty"`
+	Validity time.Time     `json:",omitzero"`
+	TTL      time.Duration `json:",omitempty"`
+	Error    string        `json:",omitempty"`
+}
+
+func newTraceEvent(ev *iface.NameTraceEvent) *TraceEvent {
+	out := &TraceEvent{
+		Type:     ev.Type,
+		Name:     ev.Name,
+		Source:   ev.Source,
+		Duration: ev.Duration,
+		Reason:   ev.Reason,
+	}
+	if ev.Err != nil {
+		out.Error = ev.Err.Error()
+	}
+	for _, r := range ev.Records {
+		tr := TraceRecord{
+			Source:   r.Source,
+			Sequence: r.Sequence,
+			Validity: r.Validity,
+			TTL:      r.TTL,
+		}
+		if r.Value != nil {
+			tr.Value = r.Value.String()
+		}
+		if r.Err != nil {
+			tr.Error = r.Err.Error()
+		}
+		out.Records = append(out.Records, tr)
+	}
+	return out
 }
 
 const (
@@ -26,6 +79,7 @@ const (
 	dhtRecordCountOptionName = "dht-record-count"
 	dhtTimeoutOptionName     = "dht-timeout"
 	streamOptionName         = "stream"
+	traceOptionName          = "trace"
 )
 
 var IpnsCmd = &cmds.Command{
@@ -63,6 +117,21 @@ Resolve the value of a dnslink:
   > ipfs name resolve ipfs.io
   /ipfs/QmaBvfZooxWkrv7D3r8LS9moNjzD2o525XMZze69hhoxf5
 
+Find out where a value comes from:
+
+  > ipfs name resolve --trace k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8
+  lookup cache (14µs): not cached
+  lookup dht (2.31s): /ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi seq=4 valid until 2026-10-19T09:12:44Z
+  lookup pubsub (16ms): routing: not found
+  result k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8: dht, only valid record returned
+  /ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi
+
+With --trace, the namesys cache and each router of the node (the DHT,
+IPNS over PubSub, HTTP routers, the local datastore) are queried for the
+record of every name along the way, and their answers are streamed with the
+sequence number and validity of the records they returned, followed by the
+record that won and why. A cached entry always wins until it expires; use
+--nocache to see what a fresh resolution would return.
 `,
 	},
 
@@ -75,6 +144,7 @@ Resolve the value of a dnslink:
 		cmds.UintOption(dhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution.").WithDefault(uint(namesys.DefaultResolverDhtRecordCount)),
 		cmds.StringOption(dhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution e.g. \"30s\". Pass 0 for no timeout.").WithDefault(namesys.DefaultResolverDhtTimeout.String()),
 		cmds.BoolOption(streamOptionName, "s", "Stream entries as they are found."),
+		cmds.BoolOption(traceOptionName, "Stream the sources consulted, the records they returned and the record that won."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -121,6 +191,27 @@ Resolve the value of a dnslink:
 			opts = append(opts, options.Name.ResolveOption(namesys.ResolveWithDhtTimeout(d)))
 		}
 
+		if trace, _ := req.Options[traceOptionName].(bool); trace {
+			events := make(chan any)
+			var (
+				output path.Path
+				rerr   error
+			)
+			go func() {
+				defer close(events)
+				output, rerr = api.Name().Resolve(req.Context, name, append(opts, options.Name.Trace(events))...)
+			}()
+			for ev := range events {
+				if err := res.Emit(&ResolvedPath{Trace: newTraceEvent(ev.(*iface.NameTraceEvent))}); err != nil {
+					return err
+				}
+			}
+			if rerr != nil && (recursive || rerr != namesys.ErrResolveRecursion) {
+				return rerr
+			}
+			return res.Emit(&ResolvedPath{Path: output.String()})
+		}
+
 		if !stream {
 			output, err := api.Name().Resolve(req.Context, name, opts...)
 			if err != nil && (recursive || err != namesys.ErrResolveRecursion) {
@@ -132,7 +223,7 @@ Resolve the value of a dnslink:
 				return err
 			}
 
-			return cmds.EmitOnce(res, &ResolvedPath{pth.String()})
+			return cmds.EmitOnce(res, &ResolvedPath{Path: pth.String()})
 		}
 
 		output, err := api.Name().Search(req.Context, name, opts...)
@@ -144,7 +235,7 @@ Resolve the value of a dnslink:
 			if v.Err != nil && (recursive || v.Err != namesys.ErrResolveRecursion) {
 				return v.Err
 			}
-			if err := res.Emit(&ResolvedPath{v.Path.String()}); err != nil {
+			if err := res.Emit(&ResolvedPath{Path: v.Path.String()}); err != nil {
 				return err
 			}
 
@@ -154,9 +245,48 @@ Resolve the value of a dnslink:
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, rp *ResolvedPath) error {
+			if rp.Trace != nil {
+				return writeTraceEvent(w, rp.Trace)
+			}
 			_, err := fmt.Fprintln(w, rp.Path)
 			return err
 		}),
 	},
 	Type: ResolvedPath{},
 }
+
+func writeTraceEvent(w io.Writer, ev *TraceEvent) error {
+	if ev.Type == iface.NameTraceResult {
+		if ev.Error != "" {
+			_, err := fmt.Fprintf(w, "result %s: %s\n", ev.Name, ev.Error)
+			return err
+		}
+		_, err := fmt.Fprintf(w, "result %s: %s, %s\n", ev.Name, ev.Source, ev.Reason)
+		return err
+	}
+
+	source := ev.Source
+	if d := ev.Duration; d != 0 {
+		if d >= time.Millisecond {
+			d = d.Round(time.Millisecond)
+		}
+		source += " (" + d.String() + ")"
+	}
+	if ev.Error != "" {
+		_, err := fmt.Fprintf(w, "lookup %s: %s\n", source, ev.Error)
+		return err
+	}
+	for _, r := range ev.Records {
+		line := r.Value
+		if r.Sequence != 0 || !r.Validity.IsZero() {
+			line += fmt.Sprintf(" seq=%d valid until %s", r.Sequence, r.Validity.UTC().Format(time.RFC3339))
+		}
+		if r.Error != "" {
+			line += " rejected: " + r.Error
+		}
+		if _, err := fmt.Fprintf(w, "lookup %s: %s\n", source, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
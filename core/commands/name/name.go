@@ -13,14 +13,19 @@ import (
 	"github.com/ipfs/boxo/ipns"
 	ipns_pb "github.com/ipfs/boxo/ipns/pb"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coreipns"
 	"google.golang.org/protobuf/proto"
 )
 
 type IpnsEntry struct {
 	Name  string
 	Value string
+	// Pending lists the deliveries to delegated publishers waiting to be
+	// retried.
+	Pending []PendingDelivery `json:",omitempty"`
 }
 
 var NameCmd = &cmds.Command{
@@ -74,12 +79,18 @@ Resolve the value of a dnslink:
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"publish": PublishCmd,
-		"resolve": IpnsCmd,
-		"pubsub":  IpnsPubsubCmd,
-		"inspect": IpnsInspectCmd,
-		"get":     IpnsGetCmd,
-		"put":     IpnsPutCmd,
+		"publish":     PublishCmd,
+		"resolve":     IpnsCmd,
+		"pubsub":      IpnsPubsubCmd,
+		"inspect":     IpnsInspectCmd,
+		"get":         IpnsGetCmd,
+		"put":         IpnsPutCmd,
+		"autopublish": AutopublishCmd,
+		"republish":   RepublishCmd,
+		"history":     HistoryCmd,
+		"rollback":    RollbackCmd,
+		"dnslink":     DNSLinkCmd,
+		"pending":     PendingCmd,
 	},
 }
 
@@ -540,6 +551,17 @@ Force store a record to test routing validation:
 			return err
 		}
 
+		// Keep the record in the history of the name; records stored with
+		// --force that are not valid are left out
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+		keep := int(cfg.Ipns.ArchiveKeep.WithDefault(config.DefaultIpnsArchiveKeep))
+		if err := coreipns.ArchiveRecord(req.Context, nd.Repo.Datastore(), name, data, coreipns.ArchiveOriginPut, keep); err != nil {
+			log.Infof("record of %s not archived: %s", name, err)
+		}
+
 		// Extract value from the record for the response
 		value := ""
 		if rec, err := ipns.UnmarshalRecord(data); err == nil {
@@ -0,0 +1,131 @@
+package name
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/go-datastore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	irouting "github.com/ipfs/kubo/routing"
+)
+
+const retryOptionName = "retry"
+
+type PendingDelivery struct {
+	Endpoint    string
+	Name        string
+	Value       string
+	Sequence    uint64
+	Queued      time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+type PendingList struct {
+	Pending []PendingDelivery
+}
+
+var PendingCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List IPNS records waiting to be delivered to delegated publishers.",
+		ShortDescription: `
+Records that a delegated publisher fails to accept, for instance because it
+is down, are kept in the datastore and sent again with exponential backoff
+until they are accepted, replaced by a newer record, or expire. This lists
+them per endpoint, with the number of attempts, the next retry and the last
+error, like 'ipfs name publish --status':
+
+  > ipfs name pending
+  ENDPOINT                    NAME    SEQ  ATTEMPTS  NEXT RETRY            LAST ERROR
+  https://delegated-ipfs.dev  k51...  4    3         2026-10-19T10:12:00Z  ...
+
+With --retry, every pending record is sent again right away, and the records
+still pending afterwards are listed. Retrying requires a running daemon.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(retryOptionName, "Deliver the pending records right away instead of waiting for their next retry."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if retry, _ := req.Options[retryOptionName].(bool); retry {
+			if !nd.IsOnline || nd.PublishQueue == nil {
+				return errors.New("retrying pending deliveries requires a running daemon")
+			}
+			if _, err := nd.PublishQueue.RetryNow(req.Context); err != nil {
+				return err
+			}
+		}
+
+		pending, err := pendingDeliveries(req.Context, nd.Repo.Datastore(), nil)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &PendingList{Pending: pending})
+	},
+	Type: PendingList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PendingList) error {
+			return writePendingDeliveries(w, out.Pending)
+		}),
+	},
+}
+
+// writePendingDeliveries prints pending deliveries as a table, one line per
+// endpoint and name.
+func writePendingDeliveries(w io.Writer, pending []PendingDelivery) error {
+	if len(pending) == 0 {
+		_, err := fmt.Fprintln(w, "No pending deliveries to delegated publishers")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tNAME\tSEQ\tATTEMPTS\tNEXT RETRY\tLAST ERROR")
+	for _, d := range pending {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", d.Endpoint, d.Name, d.Sequence, d.Attempts, d.NextAttempt.UTC().Format(time.RFC3339), d.LastError)
+	}
+	return tw.Flush()
+}
+
+// pendingDeliveries lists the records of name, or of every name when name is
+// nil, waiting to be delivered to delegated publishers.
+func pendingDeliveries(ctx context.Context, ds datastore.Datastore, name *ipns.Name) ([]PendingDelivery, error) {
+	pending, err := irouting.PendingPublishes(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	var out []PendingDelivery
+	for _, p := range pending {
+		n, err := ipns.NameFromRoutingKey(p.Key)
+		if err != nil || (name != nil && !n.Equal(*name)) {
+			continue
+		}
+		d := PendingDelivery{
+			Endpoint:    p.Endpoint,
+			Name:        n.String(),
+			Queued:      p.Queued,
+			Attempts:    p.Attempts,
+			NextAttempt: p.NextAttempt,
+			LastError:   p.LastError,
+		}
+		if rec, err := ipns.UnmarshalRecord(p.Record); err == nil {
+			d.Sequence, _ = rec.Sequence()
+			if v, err := rec.Value(); err == nil {
+				d.Value = v.String()
+			}
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
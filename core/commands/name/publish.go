@@ -29,6 +29,7 @@ const (
 	quieterOptionName        = "quieter"
 	v1compatOptionName       = "v1compat"
 	sequenceOptionName       = "sequence"
+	statusOptionName         = "status"
 )
 
 var PublishCmd = &cmds.Command{
@@ -87,6 +88,16 @@ current record's sequence). This is useful for manually coordinating
 updates across multiple writers. If not specified, the sequence number
 increments automatically.
 
+Records that a delegated publisher fails to accept, for instance because
+it is down, are kept in the datastore and sent again with exponential
+backoff until they are accepted, replaced by a newer record, or expire.
+Deliveries still pending are listed after publishing, and for all names
+with --status (or 'ipfs name pending'):
+
+  > ipfs name publish --status
+  ENDPOINT                    NAME    SEQ  ATTEMPTS  NEXT RETRY            LAST ERROR
+  https://delegated-ipfs.dev  k51...  4    3         2026-10-19T10:12:00Z  ...
+
 For faster IPNS updates, consider:
 - Using a lower --ttl value (e.g., '1m' for quick updates)
 - Enabling PubSub via Ipns.UsePubsub in the config
@@ -95,7 +106,7 @@ For faster IPNS updates, consider:
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg(ipfsPathOptionName, true, false, "ipfs path of the object to be published.").EnableStdin(),
+		cmds.StringArg(ipfsPathOptionName, false, false, "ipfs path of the object to be published.").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.StringOption(keyOptionName, "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'.").WithDefault("self"),
@@ -107,14 +118,30 @@ For faster IPNS updates, consider:
 		cmds.BoolOption(allowOfflineOptionName, "Allow publishing when offline - publishes to local datastore without requiring network connectivity."),
 		cmds.BoolOption(allowDelegatedOptionName, "Allow publishing without DHT connectivity - uses local datastore and HTTP delegated publishers only."),
 		cmds.Uint64Option(sequenceOptionName, "Set a custom sequence number for the IPNS record (must be higher than current)."),
+		cmds.BoolOption(statusOptionName, "List the deliveries to delegated publishers waiting to be retried instead of publishing."),
 		ke.OptionIPNSBase,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
 
+		if status, _ := req.Options[statusOptionName].(bool); status {
+			pending, err := pendingDeliveries(req.Context, nd.Repo.Datastore(), nil)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &IpnsEntry{Pending: pending})
+		}
+		if len(req.Arguments) == 0 {
+			return errors.New("argument \"ipfs-path\" is required")
+		}
+
 		allowOffline, _ := req.Options[allowOfflineOptionName].(bool)
 		allowDelegated, _ := req.Options[allowDelegatedOptionName].(bool)
 		compatibleWithV1, _ := req.Options[v1compatOptionName].(bool)
@@ -191,19 +218,32 @@ For faster IPNS updates, consider:
 			return err
 		}
 
+		pending, err := pendingDeliveries(req.Context, nd.Repo.Datastore(), &name)
+		if err != nil {
+			return err
+		}
+
 		return cmds.EmitOnce(res, &IpnsEntry{
-			Name:  name.String(),
-			Value: p.String(),
+			Name:    name.String(),
+			Value:   p.String(),
+			Pending: pending,
 		})
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ie *IpnsEntry) error {
+			if status, _ := req.Options[statusOptionName].(bool); status {
+				return writePendingDeliveries(w, ie.Pending)
+			}
+
 			var err error
 			quieter, _ := req.Options[quieterOptionName].(bool)
 			if quieter {
 				_, err = fmt.Fprintln(w, cmdenv.EscNonPrint(ie.Name))
 			} else {
 				_, err = fmt.Fprintf(w, "Published to %s: %s\n", cmdenv.EscNonPrint(ie.Name), cmdenv.EscNonPrint(ie.Value))
+				for _, d := range ie.Pending {
+					fmt.Fprintf(w, "Delivery to %s failed, retrying at %s: %s\n", d.Endpoint, d.NextAttempt.UTC().Format(time.RFC3339), d.LastError)
+				}
 			}
 			return err
 		}),
@@ -0,0 +1,222 @@
+package name
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	ke "github.com/ipfs/kubo/core/commands/keyencode"
+	"github.com/ipfs/kubo/core/coreipns"
+)
+
+type RepublishKey struct {
+	Key             string
+	Name            string
+	Paused          bool `json:",omitempty"`
+	Interval        string
+	RecordLifetime  string
+	Value           string    `json:",omitempty"`
+	Sequence        uint64    `json:",omitempty"`
+	Expiry          time.Time `json:",omitzero"`
+	LastRepublished time.Time `json:",omitzero"`
+	Next            time.Time `json:",omitzero"`
+	Error           string    `json:",omitempty"`
+}
+
+type RepublishList struct {
+	Keys []RepublishKey
+}
+
+var RepublishCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the republishing of IPNS records.",
+		ShortDescription: `
+The daemon periodically republishes the last IPNS record published with each
+key, so that it does not expire in the routing system. Records are
+republished every Ipns.RepublishPeriod and valid for Ipns.RecordLifetime;
+both can be set for individual keys in Ipns.Keys:
+
+  > ipfs config --json Ipns.Keys '{"site": {"RepublishPeriod": "30m"}}'
+
+The republishing of a key can be paused and resumed, and survives restarts.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     republishLsCmd,
+		"pause":  republishPauseCmd,
+		"resume": republishResumeCmd,
+		"now":    republishNowCmd,
+	},
+}
+
+var republishLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the republisher state of each key.",
+		ShortDescription: `
+Lists each key with its republish period and record lifetime, the value,
+sequence number and expiry of the record last published with it, when it was
+last republished and when it is due next. Keys nothing was published with
+are not republished.
+`,
+	},
+	Options: []cmds.Option{
+		ke.OptionIPNSBase,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		keyEnc, err := ke.KeyEncoderFromString(req.Options[ke.OptionIPNSBase.Name()].(string))
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+		settings, err := coreipns.RepublishSettingsFromConfig(&cfg.Ipns)
+		if err != nil {
+			return err
+		}
+
+		statuses, err := coreipns.ListRepublishStatus(req.Context, nd.Repo.Datastore(), nd.PrivateKey, nd.Repo.Keystore(), settings)
+		if err != nil {
+			return err
+		}
+		list := make([]RepublishKey, 0, len(statuses))
+		for _, st := range statuses {
+			k := RepublishKey{
+				Key:             st.Key,
+				Name:            keyEnc.FormatID(st.ID),
+				Paused:          st.Paused,
+				Interval:        st.Interval.String(),
+				RecordLifetime:  st.RecordLifetime.String(),
+				LastRepublished: st.LastRepublished,
+				Next:            st.Next,
+				Error:           st.Error,
+			}
+			if st.HasRecord {
+				k.Value = st.Value.String()
+				k.Sequence = st.Sequence
+				k.Expiry = st.Expiry
+			}
+			list = append(list, k)
+		}
+		return cmds.EmitOnce(res, &RepublishList{list})
+	},
+	Type: RepublishList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RepublishList) error {
+			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			for _, k := range out.Keys {
+				value, state := "-", "nothing published"
+				if k.Value != "" {
+					value = k.Value
+					switch {
+					case k.Paused:
+						state = "paused"
+					case k.Next.IsZero() || !k.Next.After(time.Now()):
+						state = "due"
+					default:
+						state = "next " + k.Next.Format(time.RFC3339)
+					}
+					state += ", expires " + k.Expiry.Format(time.RFC3339)
+				} else if k.Paused {
+					state = "paused, " + state
+				}
+				if k.Error != "" {
+					state += ", error: " + k.Error
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s/%s\t%s\t%s\n", k.Key, ipns.NamespacePrefix+k.Name, k.Interval, k.RecordLifetime, value, state)
+			}
+			return tw.Flush()
+		}),
+	},
+}
+
+var republishPauseCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Stop republishing the IPNS record of a key.",
+		ShortDescription: `
+Stops the daemon from republishing the record of the given key until
+'ipfs name republish resume' is run. The record expires once its lifetime
+has passed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "Name of the key. 'self' is the node identity."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return setRepublishPaused(req, env, true)
+	},
+}
+
+var republishResumeCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Resume republishing the IPNS record of a key.",
+		ShortDescription: `
+Resumes the republishing of the record of the given key stopped by
+'ipfs name republish pause'. The record is republished right away if it is
+due.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "Name of the key. 'self' is the node identity."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return setRepublishPaused(req, env, false)
+	},
+}
+
+func setRepublishPaused(req *cmds.Request, env cmds.Environment, paused bool) error {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	for _, name := range req.Arguments {
+		if err := coreipns.SetPaused(req.Context, nd.Repo.Datastore(), nd.Repo.Keystore(), name, paused); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var republishNowCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Republish the IPNS record of a key right away.",
+		ShortDescription: `
+Republishes the last record published with the given key, with the same value
+and sequence number and a renewed lifetime, whether or not it is paused.
+Requires a running daemon.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "Name of the key. 'self' is the node identity."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline || nd.IpnsRepub == nil {
+			return errors.New("republishing requires a running daemon")
+		}
+		for _, name := range req.Arguments {
+			if err := nd.IpnsRepub.RepublishNow(req.Context, name); err != nil {
+				return fmt.Errorf("republishing key %q failed: %w", name, err)
+			}
+		}
+		return nil
+	},
+}
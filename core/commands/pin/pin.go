@@ -25,6 +25,7 @@ import (
 	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
 	e "github.com/ipfs/kubo/core/commands/e"
+	"github.com/ipfs/kubo/core/corepin"
 )
 
 var PinCmd = &cmds.Command{
@@ -55,6 +56,7 @@ type AddPinOutput struct {
 const (
 	pinRecursiveOptionName    = "recursive"
 	pinProgressOptionName     = "progress"
+	pinProvideOptionName      = "provide"
 	fastProvideRootOptionName = "fast-provide-root"
 	fastProvideDAGOptionName  = "fast-provide-dag"
 	fastProvideWaitOptionName = "fast-provide-wait"
@@ -81,6 +83,13 @@ Default pin name is empty. Pass '--name' to 'pin add' to set one
 and use 'pin ls --names' to see it. Pinning a second time with a different
 name will update the name of the pin.
 
+Default provide policy follows Provide.Strategy. Pass '--provide' to
+announce all blocks of the pin ("all"), only its root ("roots") or nothing
+("none") regardless of the strategy, for instance to only announce the roots
+of huge archives. The policy is kept with the pin, shown by 'pin ls' and
+honored by reprovides. Policies other than "all" cannot be used with
+Provide.Strategy "all".
+
 If daemon is running, any missing blocks will be retrieved from the network.
 It may take some time. Pass '--progress' to track the progress.
 `,
@@ -93,6 +102,7 @@ It may take some time. Pass '--progress' to track the progress.
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.StringOption(pinNameOptionName, "n", "An optional name for created pin(s)."),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinProvideOptionName, "Provide policy of the pin: \"all\", \"roots\" or \"none\". Default: Provide.Strategy"),
 		cmds.BoolOption(fastProvideRootOptionName, "Immediately provide root CID to DHT after pinning. Default: Import.FastProvideRoot"),
 		cmds.BoolOption(fastProvideDAGOptionName, "Walk and provide the full DAG according to Provide.Strategy after pinning. Default: Import.FastProvideDAG"),
 		cmds.BoolOption(fastProvideWaitOptionName, "Block until the immediate provide completes. Default: Import.FastProvideWait"),
@@ -125,13 +135,19 @@ It may take some time. Pass '--progress' to track the progress.
 
 		nd, fpRoot, fpDAG, fpWait := resolveFastProvideFlags(req, env)
 
+		provideStr, _ := req.Options[pinProvideOptionName].(string)
+		policy, err := parseProvidePolicy(nd, provideStr)
+		if err != nil {
+			return err
+		}
+
 		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive, name)
+			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive, name, policy)
 			if err != nil {
 				return err
 			}
 
-			fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, added)
+			fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, policy, added)
 			return cmds.EmitOnce(res, &AddPinOutput{Pins: added})
 		}
 
@@ -145,7 +161,7 @@ It may take some time. Pass '--progress' to track the progress.
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive, name)
+			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive, name, policy)
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -159,7 +175,7 @@ It may take some time. Pass '--progress' to track the progress.
 					return val.err
 				}
 
-				fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, val.pins)
+				fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, policy, val.pins)
 
 				if ps := v.ProgressStat(); ps.Nodes != 0 {
 					if err := res.Emit(&AddPinOutput{Progress: ps.Nodes, Bytes: ps.Bytes}); err != nil {
@@ -224,7 +240,7 @@ It may take some time. Pass '--progress' to track the progress.
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool, name string) ([]string, error) {
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool, name string, policy corepin.ProvidePolicy) ([]string, error) {
 	added := make([]string, len(paths))
 	for i, b := range paths {
 		p, err := cmdutils.PathOrCidPath(b)
@@ -237,7 +253,7 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 			return nil, err
 		}
 
-		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive), options.Pin.Name(name)); err != nil {
+		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive), options.Pin.Name(name), options.Pin.Provide(string(policy))); err != nil {
 			return nil, err
 		}
 		added[i] = enc.Encode(rp.RootCid())
@@ -267,10 +283,26 @@ func resolveFastProvideFlags(req *cmds.Request, env cmds.Environment) (nd *core.
 	return nd, root, dag, wait
 }
 
+// parseProvidePolicy parses the value of --provide and checks that the
+// provide strategy of nd can honor it.
+func parseProvidePolicy(nd *core.IpfsNode, s string) (corepin.ProvidePolicy, error) {
+	policy, err := corepin.ParseProvidePolicy(s)
+	if err != nil {
+		return policy, err
+	}
+	if nd != nil {
+		if err := corepin.CheckProvidePolicy(nd.ProvidingStrategy, policy); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
 // fastProvideAfterPin handles both root and DAG providing after a
-// successful pin operation. Best-effort: errors are logged but do not
-// fail the pin command.
-func fastProvideAfterPin(req *cmds.Request, nd *core.IpfsNode, fpRoot, fpDAG, fpWait bool, encodedCIDs []string) {
+// successful pin operation, following the provide policy of the pins.
+// Best-effort: errors are logged but do not fail the pin command.
+func fastProvideAfterPin(req *cmds.Request, nd *core.IpfsNode, fpRoot, fpDAG, fpWait bool, policy corepin.ProvidePolicy, encodedCIDs []string) {
+	strategy, fpRoot, fpDAG := policy.FastProvide(nd.ProvidingStrategy, fpRoot, fpDAG)
 	if !fpRoot && !fpDAG {
 		return
 	}
@@ -295,7 +327,7 @@ func fastProvideAfterPin(req *cmds.Request, nd *core.IpfsNode, fpRoot, fpDAG, fp
 			req.Context,
 			nd.Context(),
 			cidList,
-			nd.ProvidingStrategy,
+			strategy,
 			nd.Blockstore,
 			nd.Provider,
 			fpWait,
@@ -425,6 +457,9 @@ Valid values are:
 By default, pin names are not included (returned as empty).
 Pass '--names' flag to return pin names (set with '--name' from 'pin add').
 
+Pins with a provide policy (set with '--provide' from 'pin add') are listed
+with it, as 'provide=<policy>' after the type and name.
+
 With arguments, the command fails if any of the arguments is not a pinned
 object. And if --type=<type> is additionally used, the command will also fail
 if any of the arguments is not of the specified type.
@@ -486,12 +521,17 @@ Example:
 			return fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
 		}
 
+		policies, err := corepin.ProvidePolicies(req.Context, n.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+
 		// For backward compatibility, we accumulate the pins in the same output type as before.
 		var emit func(PinLsOutputWrapper) error
 		lgcList := map[string]PinLsType{}
 		if !stream {
 			emit = func(v PinLsOutputWrapper) error {
-				lgcList[v.PinLsObject.Cid] = PinLsType{Type: v.PinLsObject.Type, Name: v.PinLsObject.Name}
+				lgcList[v.PinLsObject.Cid] = PinLsType{Type: v.PinLsObject.Type, Name: v.PinLsObject.Name, Provide: v.PinLsObject.Provide}
 				return nil
 			}
 		} else {
@@ -501,9 +541,9 @@ Example:
 		}
 
 		if len(req.Arguments) > 0 {
-			err = pinLsKeys(req, mode, displayNames || name != "", n.Pinning, api, emit)
+			err = pinLsKeys(req, mode, displayNames || name != "", n.Pinning, api, policies, emit)
 		} else {
-			err = pinLsAll(req, typeStr, displayNames || name != "", name, api, emit)
+			err = pinLsAll(req, typeStr, displayNames || name != "", name, api, policies, emit)
 		}
 		if err != nil {
 			return err
@@ -537,10 +577,8 @@ Example:
 			if stream {
 				if quiet {
 					fmt.Fprintf(w, "%s\n", out.PinLsObject.Cid)
-				} else if out.PinLsObject.Name == "" {
-					fmt.Fprintf(w, "%s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type)
 				} else {
-					fmt.Fprintf(w, "%s %s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type, out.PinLsObject.Name)
+					writePinLsLine(w, out.PinLsObject.Cid, out.PinLsObject.Type, out.PinLsObject.Name, out.PinLsObject.Provide)
 				}
 				return nil
 			}
@@ -548,10 +586,8 @@ Example:
 			for k, v := range out.PinLsList.Keys {
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
-				} else if v.Name == "" {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
 				} else {
-					fmt.Fprintf(w, "%s %s %s\n", k, v.Type, v.Name)
+					writePinLsLine(w, k, v.Type, v.Name, v.Provide)
 				}
 			}
 
@@ -575,18 +611,31 @@ type PinLsList struct {
 
 // PinLsType contains the type of a pin
 type PinLsType struct {
-	Type string
-	Name string
+	Type    string
+	Name    string
+	Provide string `json:",omitempty"`
 }
 
 // PinLsObject contains the description of a pin
 type PinLsObject struct {
-	Cid  string `json:",omitempty"`
-	Name string `json:",omitempty"`
-	Type string `json:",omitempty"`
+	Cid     string `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	Type    string `json:",omitempty"`
+	Provide string `json:",omitempty"`
+}
+
+func writePinLsLine(w io.Writer, c, typ, name, provide string) {
+	line := c + " " + typ
+	if name != "" {
+		line += " " + name
+	}
+	if provide != "" {
+		line += " provide=" + provide
+	}
+	fmt.Fprintln(w, line)
 }
 
-func pinLsKeys(req *cmds.Request, mode pin.Mode, displayNames bool, pinner pin.Pinner, api coreiface.CoreAPI, emit func(value PinLsOutputWrapper) error) error {
+func pinLsKeys(req *cmds.Request, mode pin.Mode, displayNames bool, pinner pin.Pinner, api coreiface.CoreAPI, policies map[cid.Cid]corepin.ProvidePolicy, emit func(value PinLsOutputWrapper) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -625,11 +674,16 @@ func pinLsKeys(req *cmds.Request, mode pin.Mode, displayNames bool, pinner pin.P
 			pinType = "indirect through " + enc.Encode(p.Via)
 		}
 
+		var provide corepin.ProvidePolicy
+		if p.Mode != pin.Indirect {
+			provide = policies[cids[i]]
+		}
 		err = emit(PinLsOutputWrapper{
 			PinLsObject: PinLsObject{
-				Type: pinType,
-				Cid:  enc.Encode(cids[i]),
-				Name: p.Name,
+				Type:    pinType,
+				Cid:     enc.Encode(cids[i]),
+				Name:    p.Name,
+				Provide: string(provide),
 			},
 		})
 		if err != nil {
@@ -640,7 +694,7 @@ func pinLsKeys(req *cmds.Request, mode pin.Mode, displayNames bool, pinner pin.P
 	return nil
 }
 
-func pinLsAll(req *cmds.Request, typeStr string, detailed bool, name string, api coreiface.CoreAPI, emit func(value PinLsOutputWrapper) error) error {
+func pinLsAll(req *cmds.Request, typeStr string, detailed bool, name string, api coreiface.CoreAPI, policies map[cid.Cid]corepin.ProvidePolicy, emit func(value PinLsOutputWrapper) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
@@ -666,11 +720,16 @@ func pinLsAll(req *cmds.Request, typeStr string, detailed bool, name string, api
 	}()
 
 	for p := range pins {
+		var provide corepin.ProvidePolicy
+		if p.Type() != "indirect" {
+			provide = policies[p.Path().RootCid()]
+		}
 		err = emit(PinLsOutputWrapper{
 			PinLsObject: PinLsObject{
-				Type: p.Type(),
-				Name: p.Name(),
-				Cid:  enc.Encode(p.Path().RootCid()),
+				Type:    p.Type(),
+				Name:    p.Name(),
+				Cid:     enc.Encode(p.Path().RootCid()),
+				Provide: string(provide),
 			},
 		})
 		if err != nil {
@@ -749,7 +808,11 @@ pin.
 		}
 
 		nd, fpRoot, fpDAG, fpWait := resolveFastProvideFlags(req, env)
-		fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, []string{enc.Encode(to.RootCid())})
+		policy, err := corepin.GetProvidePolicy(req.Context, nd.Repo.Datastore(), to.RootCid())
+		if err != nil {
+			return err
+		}
+		fastProvideAfterPin(req, nd, fpRoot, fpDAG, fpWait, policy, []string{enc.Encode(to.RootCid())})
 
 		return cmds.EmitOnce(res, &PinOutput{Pins: []string{enc.Encode(from.RootCid()), enc.Encode(to.RootCid())}})
 	},
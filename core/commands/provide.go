@@ -20,6 +20,8 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core/commands/cmdenv"
 	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/node"
+	"github.com/libp2p/go-libp2p-kad-dht/amino"
 	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
 	"github.com/libp2p/go-libp2p-kad-dht/provider"
 	"github.com/libp2p/go-libp2p-kad-dht/provider/buffered"
@@ -44,6 +46,7 @@ const (
 	provideStatScheduleOptionName     = "schedule"
 	provideStatQueuesOptionName       = "queues"
 	provideStatWorkersOptionName      = "workers"
+	provideStatPinNameOptionName      = "pin-name"
 
 	// lowWorkerThreshold is the threshold below which worker availability warnings are shown
 	lowWorkerThreshold = 2
@@ -75,6 +78,7 @@ For ad-hoc immediate announcements, see 'ipfs provide once'.
 	Subcommands: map[string]*cmds.Command{
 		"clear": provideClearCmd,
 		"once":  provideOnceCmd,
+		"queue": provideQueueCmd,
 		"stat":  provideStatCmd,
 	},
 }
@@ -215,8 +219,9 @@ a final count is printed at the end.
 		// being added to the keystore: the periodic reprovide schedule
 		// (driven by Provide.Strategy) is unaffected. Errors propagate to
 		// the caller.
+		prov := node.ProvideSource(nd.Provider, node.ProvideSourceProvideOnce)
 		announce := func(c cid.Cid) error {
-			if err := nd.Provider.ProvideOnce(c.Hash()); err != nil {
+			if err := prov.ProvideOnce(c.Hash()); err != nil {
 				return err
 			}
 			return res.Emit(&ProvideOnceEvent{Queued: c.String()})
@@ -338,7 +343,9 @@ a final count is printed at the end.
 type provideStats struct {
 	Sweep  *stats.Stats
 	Legacy *boxoprovider.ReproviderStats
-	FullRT bool // only used for legacy stats
+	FullRT bool                    // only used for legacy stats
+	Keys   []ProvideKeyStat        `json:",omitempty"` // only set when CIDs or a pin name are given
+	Budget *node.ProvideBudgetStat `json:",omitempty"` // only set when Provide.DHT sets a rate budget
 }
 
 // extractSweepingProvider extracts a SweepingProvider from the given provider interface.
@@ -356,6 +363,8 @@ func extractSweepingProvider(prov any, useLAN bool) *provider.SweepingProvider {
 	case *buffered.SweepingProvider:
 		// Recursively extract from the inner provider
 		return extractSweepingProvider(p.Provider, useLAN)
+	case *node.ProvideQueue:
+		return extractSweepingProvider(p.DHTProvider, useLAN)
 	default:
 		return nil
 	}
@@ -404,6 +413,16 @@ can be combined.
 
 Use --compact for monitoring-friendly 2-column output (requires --all).
 
+PER-CID STATUS:
+
+Pass CIDs or paths, or --pin-name to select pins by name, to show whether
+each one is scheduled for reprovides, when it was last announced, when it
+is expected to be announced next, how many DHT servers accepted the record
+and the last error. Only tracked by the Sweep provider.
+
+  ipfs provide stat bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi
+  ipfs provide stat --pin-name=dataset --enc=json
+
 EXAMPLES:
 
 Monitor provider statistics in real-time with 2-column layout:
@@ -422,9 +441,12 @@ NOTES:
 - For Dual DHT: use --lan for LAN provider stats (default is WAN)
 `,
 	},
-	Arguments: []cmds.Argument{},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", false, true, "CIDs or paths to show the provide status of (Sweep provider only)."),
+	},
 	Options: []cmds.Option{
 		cmds.BoolOption(provideLanOptionName, "Show stats for LAN DHT only (for Sweep+Dual DHT only)"),
+		cmds.StringOption(provideStatPinNameOptionName, "Show the provide status of the pins with this name (Sweep provider only)."),
 		cmds.BoolOption(provideStatAllOptionName, "a", "Display all provide sweep stats"),
 		cmds.BoolOption(provideStatCompactOptionName, "Display stats in 2-column layout (requires --all)"),
 		cmds.BoolOption(provideStatConnectivityOptionName, "Display DHT connectivity status"),
@@ -447,6 +469,14 @@ NOTES:
 
 		lanStats, _ := req.Options[provideLanOptionName].(bool)
 
+		if pinName, _ := req.Options[provideStatPinNameOptionName].(string); len(req.Arguments) > 0 || pinName != "" {
+			keys, err := provideKeyStats(req, env, nd, pinName, lanStats)
+			if err != nil {
+				return err
+			}
+			return res.Emit(provideStats{Keys: keys})
+		}
+
 		// Handle legacy provider
 		if legacySys, ok := nd.Provider.(boxoprovider.System); ok {
 			if lanStats {
@@ -473,7 +503,16 @@ NOTES:
 		if err != nil {
 			return err
 		}
-		return res.Emit(provideStats{Sweep: &s})
+		out := provideStats{Sweep: &s}
+		if nd.ProvideBudget != nil {
+			replication := s.Network.ReplicationFactor
+			if replication <= 0 {
+				replication = amino.DefaultBucketSize
+			}
+			budget := nd.ProvideBudget.Stat(int(s.Schedule.Keys), replication)
+			out.Budget = &budget
+		}
+		return res.Emit(out)
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s provideStats) error {
@@ -497,6 +536,14 @@ NOTES:
 				}
 			}
 
+			if s.Keys != nil {
+				if flagCount > 0 || compact {
+					return errors.New("cannot use section flags with per-CID provide status")
+				}
+				writeProvideKeyStats(wtr, s.Keys)
+				return nil
+			}
+
 			if s.Legacy != nil {
 				if flagCount > 0 {
 					return errors.New("cannot use flags with legacy provide stats")
@@ -602,6 +649,16 @@ NOTES:
 						nextReprovideAt = "N/A"
 					}
 					formatLine(0, "%sNext region reprovide: %s", indent, nextReprovideAt)
+					if s.Budget != nil {
+						formatLine(0, "%sRate budget: %s", indent, humanBudget(s.Budget))
+					}
+				}
+				if s.Budget != nil && s.Budget.CycleDuration > 0 {
+					cycle := humanDuration(s.Budget.CycleDuration.Round(time.Second))
+					if s.Budget.Interval > 0 && s.Budget.CycleDuration > s.Budget.Interval {
+						cycle += fmt.Sprintf(" (WARNING: exceeds Provide.DHT.Interval of %s)", s.Budget.Interval)
+					}
+					formatLine(0, "%sBudget cycle: %s", indent, cycle)
 				}
 				addBlankLine(0)
 			}
@@ -721,6 +778,21 @@ NOTES:
 	Type: provideStats{},
 }
 
+// humanBudget describes the limits of the provide rate budget.
+func humanBudget(b *node.ProvideBudgetStat) string {
+	var limits []string
+	if b.MessagesPerSecond > 0 {
+		limits = append(limits, fmt.Sprintf("%s msgs/s", humanInt(b.MessagesPerSecond)))
+	}
+	if b.BytesPerSecond > 0 {
+		limits = append(limits, humanize.Bytes(b.BytesPerSecond)+"/s")
+	}
+	if b.ActiveHours != "" {
+		limits = append(limits, "active "+b.ActiveHours)
+	}
+	return strings.Join(limits, ", ")
+}
+
 func humanDuration(val time.Duration) string {
 	if val > time.Second {
 		return val.Truncate(100 * time.Millisecond).String()
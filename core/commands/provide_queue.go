@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/node"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const provideQueueDropAllOptionName = "all"
+
+var errNoProvideQueue = errors.New("provide queue is only tracked by the sweep provider (Provide.DHT.SweepEnabled=true)")
+
+// ProvideQueueKey is a key waiting in the provide queue, as listed by
+// 'ipfs provide queue ls'.
+type ProvideQueueKey struct {
+	Key    string
+	Queued time.Time
+	Source string
+}
+
+// ProvideQueueList is the output of 'ipfs provide queue ls'.
+type ProvideQueueList struct {
+	Keys []ProvideQueueKey
+	// Untracked counts keys queued while too many keys were tracked, whose
+	// age and source are unknown.
+	Untracked int `json:",omitempty"`
+}
+
+// ProvideQueuePrioritized is emitted once per key handed over by
+// 'ipfs provide queue prioritize'.
+type ProvideQueuePrioritized struct {
+	Key string
+}
+
+var provideQueueCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect and manage the provide queue.",
+		ShortDescription: `
+The provide queue holds keys waiting to be advertised to the DHT for the
+first time, such as content added with fast-provide or a large 'dag import'.
+
+Only available with the sweep provider (Provide.DHT.SweepEnabled=true).
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":         provideQueueLsCmd,
+		"prioritize": provideQueuePrioritizeCmd,
+		"drop":       provideQueueDropCmd,
+	},
+}
+
+var provideQueueLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List keys waiting in the provide queue.",
+		ShortDescription: `
+Lists the multihashes waiting in the provide queue, oldest first, with how
+long they have been queued and what queued them:
+
+  blockstore       a block was written (Provide.Strategy "all")
+  pin              content was pinned
+  mfs              content was added to MFS
+  fast-provide     'ipfs add', 'ipfs pin add' or 'ipfs dag import'
+  routing-provide  'ipfs routing provide'
+  provide-once     'ipfs provide once'
+
+A key leaves the list once the first provider record is sent for it, or
+once the provider finds it already scheduled for reproviding and does not
+queue it again. At most 65536 keys are tracked; keys queued past that limit
+are only counted.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(provideQuietOptionName, "q", "Write just the multihashes."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		q, err := provideQueue(env)
+		if err != nil {
+			return err
+		}
+		entries, untracked := q.Entries()
+		out := ProvideQueueList{
+			Keys:      make([]ProvideQueueKey, len(entries)),
+			Untracked: untracked,
+		}
+		for i, e := range entries {
+			out.Keys[i] = ProvideQueueKey{Key: e.Key.B58String(), Queued: e.Queued, Source: e.Source}
+		}
+		return cmds.EmitOnce(res, &out)
+	},
+	Type: ProvideQueueList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ProvideQueueList) error {
+			quiet, _ := req.Options[provideQuietOptionName].(bool)
+			for _, k := range out.Keys {
+				if quiet {
+					fmt.Fprintln(w, k.Key)
+					continue
+				}
+				fmt.Fprintf(w, "%s %s %s\n", k.Key, time.Since(k.Queued).Truncate(time.Second), k.Source)
+			}
+			if out.Untracked > 0 && !quiet {
+				fmt.Fprintf(w, "(%d more keys queued, not tracked)\n", out.Untracked)
+			}
+			return nil
+		}),
+	},
+}
+
+var provideQueuePrioritizeCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Hand keys to the provide burst workers right away.",
+		ShortDescription: `
+Hands the given keys to the sweep provider right away, skipping the buffer
+that keys written to the blockstore wait in before joining the provide
+queue. They are announced by the workers reserved for bursts
+(Provide.DHT.DedicatedBurstWorkers), together with the other queued keys of
+their keyspace region. Keys are CIDs or multihashes, as listed by
+'ipfs provide queue ls'.
+
+The command returns once the keys are handed over; they leave
+'ipfs provide queue ls' once announced.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "CIDs or multihashes to announce first."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		q, err := provideQueue(env)
+		if err != nil {
+			return err
+		}
+		keys, err := parseProvideQueueKeys(req.Arguments)
+		if err != nil {
+			return err
+		}
+		if err := q.Prioritize(keys...); err != nil {
+			return err
+		}
+		for _, h := range keys {
+			if err := res.Emit(&ProvideQueuePrioritized{Key: h.B58String()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: ProvideQueuePrioritized{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ProvideQueuePrioritized) error {
+			_, err := fmt.Fprintf(w, "prioritized %s\n", out.Key)
+			return err
+		}),
+	},
+}
+
+var provideQueueDropCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Remove keys from the provide queue.",
+		ShortDescription: `
+Removes the given keys from the provide queue without announcing them. Keys
+are CIDs or multihashes, as listed by 'ipfs provide queue ls'. Keys scheduled
+for reproviding stay scheduled, and are announced with their keyspace region
+in the next reprovide cycle.
+
+With --all, the whole queue is dropped, as with 'ipfs provide clear'.
+
+Keys still buffered on their way to the provide queue, right after being
+added, are not affected.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", false, true, "CIDs or multihashes to drop."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(provideQueueDropAllOptionName, "Drop all keys from the provide queue."),
+		cmds.BoolOption(provideQuietOptionName, "q", "Do not write output."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		q, err := provideQueue(env)
+		if err != nil {
+			return err
+		}
+		all, _ := req.Options[provideQueueDropAllOptionName].(bool)
+		switch {
+		case all && len(req.Arguments) > 0:
+			return fmt.Errorf("cannot use --%s with keys", provideQueueDropAllOptionName)
+		case all:
+			return cmds.EmitOnce(res, q.Clear())
+		case len(req.Arguments) == 0:
+			return fmt.Errorf("no keys given, use --%s to drop the whole queue", provideQueueDropAllOptionName)
+		}
+
+		keys, err := parseProvideQueueKeys(req.Arguments)
+		if err != nil {
+			return err
+		}
+		dropped, err := q.Drop(req.Context, keys...)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, dropped)
+	},
+	Type: int(0),
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, dropped int) error {
+			quiet, _ := req.Options[provideQuietOptionName].(bool)
+			if quiet {
+				return nil
+			}
+			_, err := fmt.Fprintf(w, "removed %d items from provide queue\n", dropped)
+			return err
+		}),
+	},
+}
+
+func provideQueue(env cmds.Environment) (*node.ProvideQueue, error) {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := nd.Provider.(*node.ProvideQueue)
+	if !ok {
+		return nil, errNoProvideQueue
+	}
+	return q, nil
+}
+
+// parseProvideQueueKeys parses CIDs and base58 multihashes into multihashes.
+func parseProvideQueueKeys(args []string) ([]mh.Multihash, error) {
+	keys := make([]mh.Multihash, 0, len(args))
+	for _, arg := range args {
+		if c, err := cid.Decode(arg); err == nil {
+			keys = append(keys, c.Hash())
+			continue
+		}
+		h, err := mh.FromB58String(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: not a CID or multihash", arg)
+		}
+		keys = append(keys, h)
+	}
+	return keys, nil
+}
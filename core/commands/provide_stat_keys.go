@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/commands/cmdenv"
+	"github.com/ipfs/kubo/core/commands/cmdutils"
+	"github.com/ipfs/kubo/core/node"
+)
+
+// ProvideKeyStat is the provide status of a CID, as reported by
+// 'ipfs provide stat <cid>'.
+type ProvideKeyStat struct {
+	Cid     string
+	PinName string `json:",omitempty"`
+	// Tracked is false when no provider record was sent for the CID since
+	// its outcomes are tracked.
+	Tracked bool
+	node.ProvideKeyStatus
+}
+
+// provideKeyStats returns the provide status of the CIDs given as arguments
+// and of the pins named pinName.
+func provideKeyStats(req *cmds.Request, env cmds.Environment, nd *core.IpfsNode, pinName string, lan bool) ([]ProvideKeyStat, error) {
+	if nd.ProvideRecords == nil {
+		return nil, errors.New("per-CID provide status is only tracked by the sweep provider with a DHT (Provide.DHT.SweepEnabled=true)")
+	}
+	dht := node.ProvideRecordsWAN
+	if lan {
+		if nd.DHT == nil {
+			return nil, errors.New("LAN stats only available for Sweep provider with Dual DHT")
+		}
+		dht = node.ProvideRecordsLAN
+	}
+
+	type target struct {
+		c       cid.Cid
+		pinName string
+	}
+	var targets []target
+
+	if len(req.Arguments) > 0 {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, arg := range req.Arguments {
+			p, err := cmdutils.PathOrCidPath(arg)
+			if err != nil {
+				return nil, err
+			}
+			rp, _, err := api.ResolvePath(req.Context, p)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target{c: rp.RootCid()})
+		}
+	}
+
+	if pinName != "" {
+		named, err := pinsNamed(req.Context, nd.Pinning, pinName)
+		if err != nil {
+			return nil, err
+		}
+		if len(named) == 0 {
+			return nil, fmt.Errorf("no pin named %q", pinName)
+		}
+		for _, c := range named {
+			targets = append(targets, target{c: c, pinName: pinName})
+		}
+	}
+
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ProvideKeyStat, 0, len(targets))
+	for _, t := range targets {
+		status, tracked, err := nd.ProvideRecords.Status(req.Context, dht, t.c.Hash())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ProvideKeyStat{
+			Cid:              enc.Encode(t.c),
+			PinName:          t.pinName,
+			Tracked:          tracked,
+			ProvideKeyStatus: status,
+		})
+	}
+	return out, nil
+}
+
+// pinsNamed returns the recursive and direct pins named name.
+func pinsNamed(ctx context.Context, pinner pin.Pinner, name string) ([]cid.Cid, error) {
+	var out []cid.Cid
+	for _, keys := range []func(context.Context, bool) <-chan pin.StreamedPin{pinner.RecursiveKeys, pinner.DirectKeys} {
+		for sp := range keys(ctx, true) {
+			if sp.Err != nil {
+				return nil, sp.Err
+			}
+			if sp.Pin.Name == name {
+				out = append(out, sp.Pin.Key)
+			}
+		}
+	}
+	return out, nil
+}
+
+func writeProvideKeyStats(w io.Writer, keys []ProvideKeyStat) {
+	for i, k := range keys {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", k.Cid)
+		if k.PinName != "" {
+			fmt.Fprintf(w, "  Pin name:\t%s\n", k.PinName)
+		}
+		fmt.Fprintf(w, "  Scheduled:\t%t\n", k.Scheduled)
+		if !k.Tracked {
+			fmt.Fprintf(w, "  Last provide:\tnever\n")
+			continue
+		}
+		fmt.Fprintf(w, "  Last provide:\t%s\n", humanTimeOrNever(k.LastProvide))
+		if !k.NextReprovide.IsZero() {
+			fmt.Fprintf(w, "  Next reprovide:\t%s (estimated)\n", humanTime(k.NextReprovide))
+		}
+		fmt.Fprintf(w, "  Stored on:\t%d peers\n", len(k.Peers))
+		if k.LastError != "" {
+			fmt.Fprintf(w, "  Last error:\t%s (%s)\n", k.LastError, humanTime(k.LastErrorTime))
+		}
+	}
+}
+
+func humanTimeOrNever(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return humanTime(t)
+}
@@ -40,6 +40,7 @@ const (
 	refsUniqueOptionName    = "unique"
 	refsRecursiveOptionName = "recursive"
 	refsMaxDepthOptionName  = "max-depth"
+	refsPrefetchOptionName  = "prefetch"
 )
 
 // RefsCmd is the `ipfs refs` command
@@ -54,6 +55,9 @@ with the following format:
 
 List all references recursively by using the flag '-r'.
 
+Use '--prefetch' to fetch the blocks to list concurrently before listing
+them, like 'ipfs bitswap fetch' does.
+
 NOTE: Like most other commands, Kubo will try to fetch the blocks of the passed path if they can't be found in the local store if it is running in online mode.
 `,
 	},
@@ -69,6 +73,7 @@ NOTE: Like most other commands, Kubo will try to fetch the blocks of the passed
 		cmds.BoolOption(refsUniqueOptionName, "u", "Omit duplicate refs from output."),
 		cmds.BoolOption(refsRecursiveOptionName, "r", "Recursively list links of child nodes."),
 		cmds.IntOption(refsMaxDepthOptionName, "Only for recursive refs, limits fetch and listing to the given depth").WithDefault(-1),
+		cmds.BoolOption(refsPrefetchOptionName, "Fetch the blocks to list concurrently before listing them."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		err := req.ParseBodyArgs()
@@ -92,6 +97,7 @@ NOTE: Like most other commands, Kubo will try to fetch the blocks of the passed
 		maxDepth, _ := req.Options[refsMaxDepthOptionName].(int)
 		edges, _ := req.Options[refsEdgesOptionName].(bool)
 		format, _ := req.Options[refsFormatOptionName].(string)
+		prefetch, _ := req.Options[refsPrefetchOptionName].(bool)
 
 		if !recursive {
 			maxDepth = 1 // write only direct refs
@@ -111,9 +117,30 @@ NOTE: Like most other commands, Kubo will try to fetch the blocks of the passed
 			return err
 		}
 
+		dag := merkledag.NewSession(ctx, api.Dag())
+
+		if prefetch && maxDepth != 0 {
+			fetchDepth := maxDepth
+			if fetchDepth > 0 {
+				// the refs at maxDepth are listed from their parents, so
+				// they need not be fetched
+				fetchDepth--
+			}
+			f := &dagPrefetcher{
+				dag:          dag,
+				concurrency:  bitswapFetchDefaultConcurrency,
+				maxDepth:     fetchDepth,
+				blockTimeout: bitswapFetchDefaultBlockTimeout,
+				retries:      bitswapFetchDefaultRetries,
+			}
+			if err := f.fetch(ctx, objs); err != nil {
+				return err
+			}
+		}
+
 		rw := RefWriter{
 			res:      res,
-			DAG:      merkledag.NewSession(ctx, api.Dag()),
+			DAG:      dag,
 			Ctx:      ctx,
 			Unique:   unique,
 			PrintFmt: format,
@@ -68,6 +68,9 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+Content protected from automatic garbage collection with
+'ipfs bitswap fetch --protect' is released and removed too.
 `,
 	},
 	Options: []cmds.Option{
@@ -84,6 +87,11 @@ order to reclaim hard disk space.
 		silent, _ := req.Options[repoSilentOptionName].(bool)
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
 
+		// an explicit gc releases what was protected from automatic ones
+		if _, err := corerepo.ReleaseProtected(req.Context, n.Repo.Datastore()); err != nil {
+			return err
+		}
+
 		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
 
 		if streamErrors {
@@ -48,6 +48,7 @@ var RoutingCmd = &cmds.Command{
 		"put":       putValueRoutingCmd,
 		"provide":   provideRefRoutingCmd,
 		"reprovide": reprovideRoutingCmd,
+		"stat":      routingStatCmd,
 	},
 }
 
@@ -237,10 +238,11 @@ Prefer 'ipfs provide once' for new scripts and any large input.
 		// with a single (optimistic) provide, and skip StartProviding call.
 		go func() {
 			defer cancel()
+			prov := node.ProvideSource(nd.Provider, node.ProvideSourceRouting)
 			if rec {
-				provideErr = provideCidsRec(ctx, nd.Provider, nd.DAG, cids)
+				provideErr = provideCidsRec(ctx, prov, nd.DAG, cids)
 			} else {
-				provideErr = provideCids(nd.Provider, cids)
+				provideErr = provideCids(prov, cids)
 			}
 			if provideErr != nil {
 				routing.PublishQueryEvent(ctx, &routing.QueryEvent{
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdenv "github.com/ipfs/kubo/core/commands/cmdenv"
+	irouting "github.com/ipfs/kubo/routing"
+)
+
+type routingStatOutput struct {
+	Routers []irouting.RouterStats
+}
+
+var routingStatCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Show request statistics of the routers of Routing.Routers.",
+		ShortDescription: `
+Shows, for each router configured in Routing.Routers and each routing method,
+the number of requests, how many found nothing and how many failed, and
+their latency. Composed routers count the requests they received, their
+children the requests forwarded to them. Caching routers also report cache
+hits and misses.
+
+Statistics start with the daemon. They are only collected with
+Routing.Type=custom. The same data is exported as the Prometheus metric
+ipfs_routing_router_request_duration_seconds.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("router", false, true, "Names of the routers to show. Defaults to all."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+
+		routers := irouting.InstrumentedRouters(nd.Routing)
+		if len(routers) == 0 {
+			return errors.New("no router statistics: they are only collected for the routers of Routing.Routers, with Routing.Type=custom")
+		}
+
+		out := &routingStatOutput{Routers: []irouting.RouterStats{}}
+		for _, name := range req.Arguments {
+			if !slices.ContainsFunc(routers, func(r *irouting.InstrumentedRouter) bool { return r.Name() == name }) {
+				return fmt.Errorf("router %q not found in Routing.Routers", name)
+			}
+		}
+		for _, r := range routers {
+			if len(req.Arguments) == 0 || slices.Contains(req.Arguments, r.Name()) {
+				out.Routers = append(out.Routers, r.Stats())
+			}
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: routingStatOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *routingStatOutput) error {
+			tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "ROUTER\tTYPE\tMETHOD\tREQUESTS\tNOT FOUND\tERRORS\tAVG\tP50\tP95")
+			for _, r := range out.Routers {
+				for _, m := range r.Methods {
+					if m.Requests == 0 {
+						continue
+					}
+					avg := m.TotalLatency / time.Duration(m.Requests)
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n", r.Name, r.Type, m.Method,
+						m.Requests, m.NotFound, m.Errors, avg.Round(time.Millisecond),
+						formatLatencyBound(m.Quantile(0.5)), formatLatencyBound(m.Quantile(0.95)))
+				}
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			var notes []string
+			for _, r := range out.Routers {
+				for _, m := range r.Methods {
+					if m.LastError != "" {
+						notes = append(notes, fmt.Sprintf("%s %s last failed at %s: %s", r.Name, m.Method, m.LastErrorTime.Format(time.RFC3339), m.LastError))
+					}
+				}
+				if c := r.Cache; c != nil {
+					notes = append(notes, fmt.Sprintf("%s cache: providers %d hits, %d negative hits, %d misses; peers %d hits, %d negative hits, %d misses",
+						r.Name, c.ProviderHits, c.ProviderNegativeHits, c.ProviderMisses, c.PeerHits, c.PeerNegativeHits, c.PeerMisses))
+				}
+			}
+			if len(notes) > 0 {
+				fmt.Fprintln(w)
+			}
+			for _, n := range notes {
+				fmt.Fprintln(w, n)
+			}
+			return nil
+		}),
+	},
+}
+
+// formatLatencyBound renders the upper bound of a latency bucket.
+func formatLatencyBound(d time.Duration) string {
+	if d == math.MaxInt64 {
+		return ">" + irouting.LatencyBuckets[len(irouting.LatencyBuckets)-1].String()
+	}
+	return "≤" + d.String()
+}
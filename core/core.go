@@ -51,9 +51,10 @@ import (
 
 	"github.com/ipfs/boxo/bootstrap"
 	"github.com/ipfs/boxo/namesys"
-	ipnsrp "github.com/ipfs/boxo/namesys/republisher"
 	"github.com/ipfs/boxo/peering"
 	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/coreipns"
+	"github.com/ipfs/kubo/core/coremfs"
 	"github.com/ipfs/kubo/core/node"
 	"github.com/ipfs/kubo/core/node/libp2p"
 	"github.com/ipfs/kubo/fuse/mount"
@@ -92,26 +93,34 @@ type IpfsNode struct {
 	Reporter                    *metrics.BandwidthCounter `optional:"true"`
 	Discovery                   mdns.Service              `optional:"true"`
 	FilesRoot                   *mfs.Root
+	FilesJournal                *coremfs.Journal     // records unflushed FilesRoot changes
+	FilesRootFlushes            *coremfs.RootFlushes // notifies FilesRoot flushes
 	RecordValidator             record.Validator
 
 	// Online
-	PeerHost                  p2phost.Host             `optional:"true"` // the network host (server+client)
-	Peering                   *peering.PeeringService  `optional:"true"`
-	Filters                   *ma.Filters              `optional:"true"`
-	Bootstrapper              io.Closer                `optional:"true"` // the periodic bootstrapper
-	ContentDiscovery          routing.ContentDiscovery `optional:"true"` // the discovery part of the routing system
-	DNSResolver               *madns.Resolver          // the DNS resolver
-	IPLDPathResolver          pathresolver.Resolver    `name:"ipldPathResolver"`          // The IPLD path resolver
-	UnixFSPathResolver        pathresolver.Resolver    `name:"unixFSPathResolver"`        // The UnixFS path resolver
-	OfflineIPLDPathResolver   pathresolver.Resolver    `name:"offlineIpldPathResolver"`   // The IPLD path resolver that uses only locally available blocks
-	OfflineUnixFSPathResolver pathresolver.Resolver    `name:"offlineUnixFSPathResolver"` // The UnixFS path resolver that uses only locally available blocks
-	Exchange                  exchange.Interface       // the block exchange + strategy
-	Bitswap                   *bitswap.Bitswap         `optional:"true"` // The Bitswap instance
-	Namesys                   namesys.NameSystem       // the name system, resolves paths to hashes
-	ProvidingStrategy         config.ProvideStrategy   `optional:"true"`
-	ProvidingKeyChanFunc      provider.KeyChanFunc     `optional:"true"`
-	IpnsRepub                 *ipnsrp.Republisher      `optional:"true"`
-	ResourceManager           network.ResourceManager  `optional:"true"`
+	PeerHost                  p2phost.Host              `optional:"true"` // the network host (server+client)
+	Peering                   *peering.PeeringService   `optional:"true"`
+	Filters                   *ma.Filters               `optional:"true"`
+	Bootstrapper              io.Closer                 `optional:"true"` // the periodic bootstrapper
+	ContentDiscovery          routing.ContentDiscovery  `optional:"true"` // the discovery part of the routing system
+	DNSResolver               *madns.Resolver           // the DNS resolver
+	IPLDPathResolver          pathresolver.Resolver     `name:"ipldPathResolver"`          // The IPLD path resolver
+	UnixFSPathResolver        pathresolver.Resolver     `name:"unixFSPathResolver"`        // The UnixFS path resolver
+	OfflineIPLDPathResolver   pathresolver.Resolver     `name:"offlineIpldPathResolver"`   // The IPLD path resolver that uses only locally available blocks
+	OfflineUnixFSPathResolver pathresolver.Resolver     `name:"offlineUnixFSPathResolver"` // The UnixFS path resolver that uses only locally available blocks
+	Exchange                  exchange.Interface        // the block exchange + strategy
+	Bitswap                   *bitswap.Bitswap          `optional:"true"` // The Bitswap instance
+	BitswapServerPolicy       *node.BitswapServerPolicy `optional:"true"` // Bitswap.Server access control and quotas
+	RetrievalTracer           *node.RetrievalTracer     `optional:"true"` // per-request retrieval traces
+	BitswapLedgers            *node.BitswapLedgers      `optional:"true"` // persisted bitswap ledgers
+	Namesys                   namesys.NameSystem        // the name system, resolves paths to hashes
+	ProvidingStrategy         config.ProvideStrategy    `optional:"true"`
+	ProvidingKeyChanFunc      provider.KeyChanFunc      `optional:"true"`
+	ProvideRecords            *node.ProvideRecords      `optional:"true"` // per-key outcomes of the sweeping provider
+	ProvideBudget             *node.ProvideBudget       `optional:"true"` // rate budget of the sweeping provider
+	IpnsRepub                 *coreipns.Republisher     `optional:"true"`
+	PublishQueue              *irouting.PublishQueue    `optional:"true"` // retries failed delegated IPNS publishes
+	ResourceManager           network.ResourceManager   `optional:"true"`
 
 	PubSub   *pubsub.PubSub             `optional:"true"`
 	PSRouter *psrouter.PubsubValueStore `optional:"true"`
@@ -28,6 +28,7 @@ import (
 	"github.com/ipfs/kubo/config"
 	coreiface "github.com/ipfs/kubo/core/coreiface"
 	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coreipns"
 	"github.com/ipfs/kubo/internal/fusemount"
 	irouting "github.com/ipfs/kubo/routing"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -146,6 +147,11 @@ func (api *CoreAPI) Routing() coreiface.RoutingAPI {
 	return (*RoutingAPI)(api)
 }
 
+// Files returns the FilesAPI interface implementation backed by the kubo node
+func (api *CoreAPI) Files() coreiface.FilesAPI {
+	return (*FilesAPI)(api)
+}
+
 // WithOptions returns api with global options applied
 func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, error) {
 	settings := api.parentOpts // make sure to copy
@@ -234,10 +240,11 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 		subAPI.routing = offlineroute.NewOfflineRouter(irouting.DHTValueDatastore(subAPI.repo.Datastore()), subAPI.recordValidator)
 
-		subAPI.namesys, err = namesys.NewNameSystem(subAPI.routing, nsOptions...)
+		ns, err := namesys.NewNameSystem(coreipns.NamesysValueStore(subAPI.routing), nsOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("error constructing namesys: %w", err)
 		}
+		subAPI.namesys = coreipns.ArchivingNameSystem(ns, subAPI.repo.Datastore(), int(cfg.Ipns.ArchiveKeep.WithDefault(config.DefaultIpnsArchiveKeep)))
 
 		subAPI.peerstore = nil
 		subAPI.peerHost = nil
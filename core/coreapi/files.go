@@ -0,0 +1,281 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	gopath "path"
+	"strings"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/boxo/path"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/config"
+	coreiface "github.com/ipfs/kubo/core/coreiface"
+	caopts "github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coremfs"
+	"github.com/ipfs/kubo/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type FilesAPI CoreAPI
+
+func (api *FilesAPI) Batch(ctx context.Context, ops []coreiface.FilesOp, opts ...caopts.FilesBatchOption) (path.ImmutablePath, error) {
+	ctx, span := tracing.Span(ctx, "CoreAPI.FilesAPI", "Batch", trace.WithAttributes(attribute.Int("ops", len(ops))))
+	defer span.End()
+
+	settings, err := caopts.FilesBatchOptions(opts...)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	span.SetAttributes(attribute.Bool("dryrun", settings.DryRun))
+
+	live := api.nd.FilesRoot
+	if live == nil {
+		return path.ImmutablePath{}, errors.New("MFS is not available on this node")
+	}
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	mfsOpts, err := cfg.Import.MFSRootOptions()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+
+	defer api.blockstore.PinLock(ctx).Unlock(ctx)
+
+	base, err := mfs.FlushPath(ctx, live, "/")
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	basePb, ok := base.(*dag.ProtoNode)
+	if !ok {
+		return path.ImmutablePath{}, dag.ErrNotProtobuf
+	}
+
+	// The private root has neither a republisher nor a provider, so nothing
+	// done to it is visible outside of this call until it is committed.
+	txn, err := mfs.NewRoot(ctx, api.dag, basePb, nil, nil, mfsOpts...)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	for i, op := range ops {
+		if err := api.applyOp(ctx, txn, cfg, op); err != nil {
+			return path.ImmutablePath{}, fmt.Errorf("op %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+	// mfs.FlushPath needs a republisher; getting the node syncs and stores
+	// the tree all the same.
+	result, err := txn.GetDirectory().GetNode()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	if settings.DryRun {
+		return path.FromCid(result.Cid()), nil
+	}
+
+	// Only the pin lock is held, and some 'ipfs files' commands do not take
+	// it. Refuse to silently drop their changes.
+	cur, err := live.GetDirectory().GetNode()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	if !cur.Cid().Equals(base.Cid()) {
+		return path.ImmutablePath{}, coreiface.ErrFilesConflict
+	}
+	if err := coremfs.ReplaceRoot(ctx, live, api.dag, result.Cid()); err != nil {
+		return path.ImmutablePath{}, fmt.Errorf("committing batch: %w", err)
+	}
+	return path.FromCid(result.Cid()), nil
+}
+
+func (api *FilesAPI) applyOp(ctx context.Context, root *mfs.Root, cfg *config.Config, op coreiface.FilesOp) error {
+	switch op.Op {
+	case coreiface.FilesOpMkdir:
+		p, err := checkMFSPath(op.Path)
+		if err != nil {
+			return err
+		}
+		return mfs.Mkdir(root, p, mfs.MkdirOpts{Mkparents: op.Parents})
+
+	case coreiface.FilesOpCp:
+		dst, err := checkMFSPath(op.Dst)
+		if err != nil {
+			return err
+		}
+		nd, err := api.resolveSource(ctx, root, op.Src)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(op.Dst, "/") {
+			dst = gopath.Join(dst, gopath.Base(op.Src))
+		}
+		if err := ensureParent(root, dst, op.Parents); err != nil {
+			return err
+		}
+		return mfs.PutNode(root, dst, nd)
+
+	case coreiface.FilesOpMv:
+		src, err := checkMFSPath(op.Src)
+		if err != nil {
+			return err
+		}
+		dst, err := checkMFSPath(op.Dst)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(op.Dst, "/") {
+			dst += "/"
+		}
+		if err := ensureParent(root, dst, op.Parents); err != nil {
+			return err
+		}
+		return mfs.Mv(root, src, dst)
+
+	case coreiface.FilesOpRm:
+		p, err := checkMFSPath(op.Path)
+		if err != nil {
+			return err
+		}
+		if p == "/" {
+			return errors.New("cannot remove the MFS root")
+		}
+		dir, name := gopath.Split(p)
+		parent, err := lookupDir(root, dir)
+		if err != nil {
+			if op.Force && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		child, err := parent.Child(name)
+		if err != nil {
+			if op.Force && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if child.Type() == mfs.TDir && !op.Recursive {
+			return fmt.Errorf("%s is a directory, set Recursive to remove it", p)
+		}
+		return parent.Unlink(name)
+
+	case coreiface.FilesOpWrite:
+		p, err := checkMFSPath(op.Path)
+		if err != nil {
+			return err
+		}
+		if err := ensureParent(root, p, op.Parents); err != nil {
+			return err
+		}
+		return writeMFSFile(ctx, root, cfg, p, []byte(op.Data))
+
+	case "":
+		return errors.New("missing operation")
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// resolveSource returns the node at src, which is either an MFS path of the
+// batch root or an IPFS path.
+func (api *FilesAPI) resolveSource(ctx context.Context, root *mfs.Root, src string) (ipld.Node, error) {
+	if strings.HasPrefix(src, "/ipfs/") || strings.HasPrefix(src, "/ipns/") {
+		p, err := path.NewPath(src)
+		if err != nil {
+			return nil, err
+		}
+		return (*CoreAPI)(api).ResolveNode(ctx, p)
+	}
+	p, err := checkMFSPath(src)
+	if err != nil {
+		return nil, err
+	}
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return fsn.GetNode()
+}
+
+func checkMFSPath(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("paths must not be empty")
+	}
+	if p[0] != '/' {
+		return "", fmt.Errorf("path %q must start with a leading slash", p)
+	}
+	return gopath.Clean(p), nil
+}
+
+func lookupDir(root *mfs.Root, p string) (*mfs.Directory, error) {
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	return dir, nil
+}
+
+func ensureParent(root *mfs.Root, p string, parents bool) error {
+	dir := gopath.Dir(strings.TrimSuffix(p, "/"))
+	if !parents || dir == "/" {
+		return nil
+	}
+	return mfs.Mkdir(root, dir, mfs.MkdirOpts{Mkparents: true})
+}
+
+// writeMFSFile replaces the content of the file at p, creating it if needed,
+// with the same settings 'ipfs files write' uses by default.
+func writeMFSFile(ctx context.Context, root *mfs.Root, cfg *config.Config, p string, data []byte) error {
+	fsn, err := mfs.Lookup(root, p)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, name := gopath.Split(p)
+		parent, err := lookupDir(root, dir)
+		if err != nil {
+			return err
+		}
+		nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+		if err := nd.SetCidBuilder(parent.GetCidBuilder()); err != nil {
+			return err
+		}
+		if err := parent.AddChild(name, nd); err != nil {
+			return err
+		}
+		fsn, err = parent.Child(name)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	fi, ok := fsn.(*mfs.File)
+	if !ok {
+		return fmt.Errorf("%s is not a file", p)
+	}
+
+	if cfg.Import.UnixFSRawLeaves != config.Default {
+		fi.RawLeaves = cfg.Import.UnixFSRawLeaves.WithDefault(config.DefaultUnixFSRawLeaves)
+	}
+	wfd, err := fi.Open(ctx, mfs.Flags{Write: true, Sync: true})
+	if err != nil {
+		return err
+	}
+	if err := wfd.Truncate(0); err != nil {
+		wfd.Close()
+		return err
+	}
+	if _, err := wfd.Write(data); err != nil {
+		wfd.Close()
+		return err
+	}
+	return wfd.Close()
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/ipfs/boxo/path"
 	coreiface "github.com/ipfs/kubo/core/coreiface"
 	caopts "github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/coreipns"
 	ci "github.com/libp2p/go-libp2p/core/crypto"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 )
@@ -108,7 +109,7 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 		return nil, err
 	}
 
-	span.SetAttributes(attribute.Bool("cache", options.Cache))
+	span.SetAttributes(attribute.Bool("cache", options.Cache), attribute.Bool("trace", options.Trace != nil))
 
 	err = api.checkOnline(true)
 	if err != nil {
@@ -117,7 +118,7 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 
 	var resolver namesys.Resolver = api.namesys
 	if !options.Cache {
-		resolver, err = namesys.NewNameSystem(api.routing,
+		resolver, err = namesys.NewNameSystem(coreipns.NamesysValueStore(api.routing),
 			namesys.WithDatastore(api.repo.Datastore()),
 			namesys.WithDNSResolver(api.dnsResolver))
 		if err != nil {
@@ -146,6 +147,24 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 	}
 
 	out := make(chan coreiface.IpnsResult)
+	if options.Trace != nil {
+		go func() {
+			defer close(out)
+			emit := func(ev *coreiface.NameTraceEvent) {
+				select {
+				case options.Trace <- ev:
+				case <-ctx.Done():
+				}
+			}
+			res, err := coreipns.Trace(ctx, resolver, api.routing, p, options.Cache, emit, options.ResolveOpts...)
+			select {
+			case out <- coreiface.IpnsResult{Path: res, Err: err}:
+			case <-ctx.Done():
+			}
+		}()
+		return out, nil
+	}
+
 	go func() {
 		defer close(out)
 		for res := range resolver.ResolveAsync(ctx, p, options.ResolveOpts...) {
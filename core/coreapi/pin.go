@@ -13,6 +13,7 @@ import (
 	"github.com/ipfs/go-cid"
 	coreiface "github.com/ipfs/kubo/core/coreiface"
 	caopts "github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/core/corepin"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
@@ -35,6 +36,11 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 		return err
 	}
 
+	policy, err := corepin.ParseProvidePolicy(settings.Provide)
+	if err != nil {
+		return err
+	}
+
 	span.SetAttributes(attribute.Bool("recursive", settings.Recursive))
 
 	defer api.blockstore.PinLock(ctx).Unlock(ctx)
@@ -44,6 +50,13 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 		return fmt.Errorf("pin: %s", err)
 	}
 
+	// pinning again without a policy keeps the one set before
+	if policy != corepin.ProvideDefault {
+		if err := corepin.SetProvidePolicy(ctx, api.repo.Datastore(), dagNode.Cid(), policy); err != nil {
+			return fmt.Errorf("pin: %w", err)
+		}
+	}
+
 	return api.pinning.Flush(ctx)
 }
 
@@ -118,6 +131,10 @@ func (api *PinAPI) Rm(ctx context.Context, p path.Path, opts ...caopts.PinRmOpti
 		return err
 	}
 
+	if err := corepin.SetProvidePolicy(ctx, api.repo.Datastore(), rp.RootCid(), corepin.ProvideDefault); err != nil {
+		return err
+	}
+
 	return api.pinning.Flush(ctx)
 }
 
@@ -152,6 +169,21 @@ func (api *PinAPI) Update(ctx context.Context, from path.Path, to path.Path, opt
 		return err
 	}
 
+	// the new pin keeps the provide policy of the one it updates
+	ds := api.repo.Datastore()
+	policy, err := corepin.GetProvidePolicy(ctx, ds, fp.RootCid())
+	if err != nil {
+		return err
+	}
+	if err := corepin.SetProvidePolicy(ctx, ds, tp.RootCid(), policy); err != nil {
+		return err
+	}
+	if settings.Unpin && !fp.RootCid().Equals(tp.RootCid()) {
+		if err := corepin.SetProvidePolicy(ctx, ds, fp.RootCid(), corepin.ProvideDefault); err != nil {
+			return err
+		}
+	}
+
 	return api.pinning.Flush(ctx)
 }
 
@@ -148,10 +148,11 @@ func (api *RoutingAPI) Provide(ctx context.Context, path path.Path, opts ...caop
 		return fmt.Errorf("block %s not found locally, cannot provide", c)
 	}
 
+	prov := node.ProvideSource(api.provider, node.ProvideSourceRouting)
 	if settings.Recursive {
-		err = provideKeysRec(ctx, api.provider, api.blockstore, []cid.Cid{c})
+		err = provideKeysRec(ctx, prov, api.blockstore, []cid.Cid{c})
 	} else {
-		err = api.provider.StartProviding(false, c.Hash())
+		err = prov.StartProviding(false, c.Hash())
 	}
 	if err != nil {
 		return err
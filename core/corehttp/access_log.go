@@ -0,0 +1,294 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/node"
+)
+
+// GatewayAccessLogOption writes the requests handled by the options after it
+// to the log configured by Gateway.AccessLog. It should come first, so the
+// requests denied by the gateway limits are logged too.
+//
+// The log file is shared by all the listeners the returned option is served
+// on, and closed when the node is.
+func GatewayAccessLogOption() ServeOption {
+	var (
+		once   sync.Once
+		logger *gatewayAccessLog
+		err    error
+	)
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		once.Do(func() {
+			var cfg *config.Config
+			if cfg, err = n.Repo.Config(); err != nil {
+				return
+			}
+			logger, err = newGatewayAccessLog(cfg.Gateway, n.Repo.Path())
+			if err != nil || logger == nil {
+				return
+			}
+			go func() {
+				<-n.Context().Done()
+				logger.Close()
+			}()
+		})
+		if err != nil {
+			return nil, err
+		}
+		if logger == nil {
+			return mux, nil
+		}
+
+		childMux := http.NewServeMux()
+		mux.Handle("/", logger.wrap(childMux))
+		return childMux, nil
+	}
+}
+
+// gatewayAccessLogEntry is a line of the access log in the JSON format.
+type gatewayAccessLogEntry struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client"`
+	Method string    `json:"method"`
+	Host   string    `json:"host"`
+	Path   string    `json:"path"`
+	Proto  string    `json:"proto"`
+	// Cid is the CID the path resolved to, empty when the request did not
+	// resolve one.
+	Cid    string `json:"cid,omitempty"`
+	Status int    `json:"status"`
+	Bytes  uint64 `json:"bytes"`
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+	// Cache is "miss" when blocks were fetched from the network to answer
+	// the request, "hit" otherwise.
+	Cache string `json:"cache"`
+	// Format is the media type of the response.
+	Format string `json:"format,omitempty"`
+}
+
+type gatewayAccessLog struct {
+	w       io.WriteCloser
+	format  string
+	trusted trustedProxies
+	now     func() time.Time
+}
+
+// newGatewayAccessLog returns nil when gw.AccessLog disables the log.
+func newGatewayAccessLog(gw config.Gateway, repoPath string) (*gatewayAccessLog, error) {
+	cfg := gw.AccessLog
+	path := cfg.Path.WithDefault("")
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoPath, path)
+	}
+	format := cfg.Format.WithDefault(config.DefaultGatewayAccessLogFormat)
+	if format != config.GatewayAccessLogFormatJSON && format != config.GatewayAccessLogFormatCommon {
+		return nil, fmt.Errorf("invalid Gateway.AccessLog.Format %q, must be %q or %q",
+			format, config.GatewayAccessLogFormatJSON, config.GatewayAccessLogFormatCommon)
+	}
+	maxBackups := cfg.MaxBackups.WithDefault(config.DefaultGatewayAccessLogMaxBackups)
+	if maxBackups < 0 {
+		return nil, fmt.Errorf("invalid Gateway.AccessLog.MaxBackups %d, must not be negative", maxBackups)
+	}
+
+	trusted, err := parseTrustedProxies(gw.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openRotatingFile(path, cfg.MaxSize.WithDefault(config.DefaultGatewayAccessLogMaxSize), int(maxBackups))
+	if err != nil {
+		return nil, fmt.Errorf("opening gateway access log: %w", err)
+	}
+	return &gatewayAccessLog{w: f, format: format, trusted: trusted, now: time.Now}, nil
+}
+
+func (l *gatewayAccessLog) Close() error {
+	return l.w.Close()
+}
+
+func (l *gatewayAccessLog) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := l.now()
+		ctx, fetches := node.CountExchangeFetches(r.Context())
+		cw := &countingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+
+		client := l.trusted.clientAddr(r)
+		if h, _, err := net.SplitHostPort(client); err == nil {
+			client = h
+		}
+		e := gatewayAccessLogEntry{
+			Time:     start,
+			Client:   client,
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.RequestURI(),
+			Proto:    r.Proto,
+			Cid:      resolvedCid(w.Header()),
+			Status:   cw.Status(),
+			Bytes:    cw.written,
+			Duration: l.now().Sub(start).Seconds(),
+			Cache:    "hit",
+		}
+		if fetches.Load() > 0 {
+			e.Cache = "miss"
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "" {
+			if mt, _, err := mime.ParseMediaType(ct); err == nil {
+				e.Format = mt
+			}
+		}
+		if err := l.write(e); err != nil {
+			log.Errorw("writing gateway access log", "err", err)
+		}
+	})
+}
+
+// resolvedCid returns the last of the X-Ipfs-Roots of a gateway response,
+// which is the CID its content path resolved to.
+func resolvedCid(h http.Header) string {
+	roots := h.Get("X-Ipfs-Roots")
+	return roots[strings.LastIndexByte(roots, ',')+1:]
+}
+
+func (l *gatewayAccessLog) write(e gatewayAccessLogEntry) error {
+	var line []byte
+	switch l.format {
+	case config.GatewayAccessLogFormatJSON:
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	case config.GatewayAccessLogFormatCommon:
+		line = fmt.Appendf(nil, "%s - - [%s] %q %d %d %q %s %s %q %.3f\n",
+			e.Client, e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.Method+" "+e.Path+" "+e.Proto,
+			e.Status, e.Bytes, e.Host, orDash(e.Cid), e.Cache, orDash(e.Format), e.Duration)
+	}
+	_, err := l.w.Write(line)
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// rotatingFile is a file renamed to path.1 once it reaches its maximum size,
+// the previous path.1 being renamed to path.2 and so on, up to the number of
+// backups kept.
+type rotatingFile struct {
+	path       string
+	maxSize    int64 // 0 when never rotated
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize uint64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: int64(maxSize), maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, st.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	var rerr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if rerr = r.rotate(); r.f == nil {
+			return 0, rerr
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil && rerr != nil {
+		err = fmt.Errorf("rotating %s: %w", r.path, rerr)
+	}
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	// the file is reopened even when it could not be renamed, so logging goes
+	// on in the same file
+	err := r.renameBackups()
+	if oerr := r.open(); oerr != nil {
+		return oerr
+	}
+	return err
+}
+
+func (r *rotatingFile) renameBackups() error {
+	backup := func(i int) string { return fmt.Sprintf("%s.%d", r.path, i) }
+	if r.maxBackups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(r.path, backup(1))
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,167 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayAccessLog(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Ipfs-Roots", "bafyroot,bafyleaf")
+		w.Header().Set("Content-Type", "application/vnd.ipld.car; version=1")
+		w.Write([]byte("hello"))
+	})
+	serve := func(t *testing.T, format string) string {
+		dir := t.TempDir()
+		l, err := newGatewayAccessLog(config.Gateway{AccessLog: config.GatewayAccessLog{
+			Path:   config.NewOptionalString("access.log"),
+			Format: config.NewOptionalString(format),
+		}}, dir)
+		require.NoError(t, err)
+		now := start
+		l.now = func() time.Time {
+			defer func() { now = now.Add(250 * time.Millisecond) }()
+			return now
+		}
+		h := l.wrap(handler)
+		for _, p := range []string{"/ipfs/bafyroot/leaf?format=car", "/missing"} {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+p, nil)
+			r.RemoteAddr = "1.2.3.4:1000"
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		require.NoError(t, l.Close())
+		b, err := os.ReadFile(filepath.Join(dir, "access.log"))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	l, err := newGatewayAccessLog(config.Gateway{}, t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, l)
+	_, err = newGatewayAccessLog(config.Gateway{AccessLog: config.GatewayAccessLog{
+		Path:   config.NewOptionalString("access.log"),
+		Format: config.NewOptionalString("xml"),
+	}}, t.TempDir())
+	require.Error(t, err)
+	_, err = newGatewayAccessLog(config.Gateway{
+		AccessLog:      config.GatewayAccessLog{Path: config.NewOptionalString("access.log")},
+		TrustedProxies: []string{"not-an-ip"},
+	}, t.TempDir())
+	require.Error(t, err)
+
+	t.Run("json", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(serve(t, config.GatewayAccessLogFormatJSON)), "\n")
+		require.Len(t, lines, 2)
+		var e gatewayAccessLogEntry
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &e))
+		assert.Equal(t, gatewayAccessLogEntry{
+			Time:     start,
+			Client:   "1.2.3.4",
+			Method:   http.MethodGet,
+			Host:     "example.com",
+			Path:     "/ipfs/bafyroot/leaf?format=car",
+			Proto:    "HTTP/1.1",
+			Cid:      "bafyleaf",
+			Status:   http.StatusOK,
+			Bytes:    5,
+			Duration: 0.25,
+			Cache:    "hit",
+			Format:   "application/vnd.ipld.car",
+		}, e)
+		var notFound gatewayAccessLogEntry
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &notFound))
+		assert.Equal(t, http.StatusNotFound, notFound.Status)
+		assert.Empty(t, notFound.Cid)
+	})
+
+	t.Run("common", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(serve(t, config.GatewayAccessLogFormatCommon)), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, `1.2.3.4 - - [01/Mar/2026:12:00:00 +0000] "GET /ipfs/bafyroot/leaf?format=car HTTP/1.1" 200 5 "example.com" bafyleaf hit "application/vnd.ipld.car" 0.250`, lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], `1.2.3.4 - - [01/Mar/2026:12:00:00 +0000] "GET /missing HTTP/1.1" 404 19 "example.com" - hit "text/plain" `), lines[1])
+	})
+
+	t.Run("clients behind trusted proxies", func(t *testing.T) {
+		dir := t.TempDir()
+		l, err := newGatewayAccessLog(config.Gateway{
+			AccessLog: config.GatewayAccessLog{
+				Path:   config.NewOptionalString("access.log"),
+				Format: config.NewOptionalString(config.GatewayAccessLogFormatJSON),
+			},
+			TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8"},
+		}, dir)
+		require.NoError(t, err)
+		h := l.wrap(handler)
+		for _, req := range []struct{ remote, forwarded string }{
+			{"127.0.0.1:1000", "9.9.9.9, 5.6.7.8, 10.1.1.1"},
+			{"2.2.2.2:1000", "3.3.3.3"},
+			{"127.0.0.1:1000", ""},
+		} {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.RemoteAddr = req.remote
+			if req.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", req.forwarded)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		require.NoError(t, l.Close())
+
+		b, err := os.ReadFile(filepath.Join(dir, "access.log"))
+		require.NoError(t, err)
+		var clients []string
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var e gatewayAccessLogEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &e))
+			clients = append(clients, e.Client)
+		}
+		// the client forwarded by the proxies, not the addresses it set
+		// itself, nor those set by untrusted peers
+		assert.Equal(t, []string{"5.6.7.8", "2.2.2.2", "127.0.0.1"}, clients)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	f, err := openRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err := f.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("closed\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(b)
+	}
+	assert.Equal(t, "dddddd\n", read(path))
+	assert.Equal(t, "cccccc\n", read(path+".1"))
+	assert.Equal(t, "bbbbbb\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+
+	// writes are appended to the existing file
+	f, err = openRotatingFile(path, 0, 2)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("eeeeee\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "dddddd\neeeeee\n", read(path))
+}
@@ -48,7 +48,13 @@ func GatewayOption(paths ...string) ServeOption {
 		if fn := newServerDomainAttrFn(n); fn != nil {
 			handler = withMetricLabels(handler, fn)
 		}
+		if handler, err = withRetrievalTrace(n, handler); err != nil {
+			return nil, err
+		}
 		handler = otelhttp.NewHandler(handler, "Gateway")
+		if handler, err = withGatewayLimits(n, handler); err != nil {
+			return nil, err
+		}
 
 		for _, p := range paths {
 			mux.Handle(p+"/", handler)
@@ -78,7 +84,13 @@ func HostnameOption() ServeOption {
 		if fn := newServerDomainAttrFn(n); fn != nil {
 			handler = withMetricLabels(handler, fn)
 		}
+		if handler, err = withRetrievalTrace(n, handler); err != nil {
+			return nil, err
+		}
 		handler = otelhttp.NewHandler(handler, "HostnameGateway")
+		if handler, err = withGatewayLimits(n, handler); err != nil {
+			return nil, err
+		}
 
 		mux.Handle("/", handler)
 		return childMux, nil
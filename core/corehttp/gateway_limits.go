@@ -0,0 +1,416 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// gatewayClientSweepInterval is how often the state of idle clients is
+// dropped.
+const gatewayClientSweepInterval = time.Minute
+
+var (
+	gatewayLimitedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_limited_requests_total",
+			Help:      "Gateway requests rejected with 429 by Gateway.ClientLimits (scope=client) or PublicGateways limits (scope=host).",
+		},
+		[]string{"scope", "limit"},
+	)
+	gatewayLimitedClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_limited_clients",
+			Help:      "Gateway clients tracked by Gateway.ClientLimits.",
+		},
+	)
+	gatewayHostBytesToday = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_host_bytes_today",
+			Help:      "Response bytes served today by the PublicGateways hostnames with limits.",
+		},
+		[]string{"host"},
+	)
+)
+
+// gatewayLimiters are the limiters of the nodes serving gateways, shared by
+// the GatewayOption and HostnameOption handlers of all their listeners.
+var gatewayLimiters = struct {
+	sync.Mutex
+	byNode map[*core.IpfsNode]*gatewayLimiter
+}{byNode: make(map[*core.IpfsNode]*gatewayLimiter)}
+
+type gatewayLimitedKey struct{}
+
+// withGatewayLimits enforces Gateway.ClientLimits and the Limits of
+// Gateway.PublicGateways on the requests to next. Requests are limited once,
+// by the first handler they go through: the hostname gateway, then the path
+// gateway it rewrites them to.
+func withGatewayLimits(n *core.IpfsNode, next http.Handler) (http.Handler, error) {
+	gatewayLimiters.Lock()
+	defer gatewayLimiters.Unlock()
+	l, ok := gatewayLimiters.byNode[n]
+	if !ok {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		if l, err = newGatewayLimiter(cfg.Gateway); err != nil {
+			return nil, err
+		}
+		if l != nil {
+			if err := registerGatewayLimitsMetrics(); err != nil {
+				return nil, err
+			}
+		}
+		gatewayLimiters.byNode[n] = l
+		context.AfterFunc(n.Context(), func() {
+			gatewayLimiters.Lock()
+			defer gatewayLimiters.Unlock()
+			delete(gatewayLimiters.byNode, n)
+		})
+	}
+	if l == nil {
+		return next, nil
+	}
+	return l.wrap(next), nil
+}
+
+// gatewayLimits are the enabled config.GatewayLimits, 0 when unlimited.
+type gatewayLimits struct {
+	requestsPerSec int64
+	concurrent     int64
+	dailyBytes     uint64
+}
+
+func newGatewayLimits(cfg config.GatewayLimits) gatewayLimits {
+	return gatewayLimits{
+		requestsPerSec: max(cfg.RequestsPerSecond.WithDefault(0), 0),
+		concurrent:     max(cfg.MaxConcurrentRequests.WithDefault(0), 0),
+		dailyBytes:     cfg.MaxDailyBytes.WithDefault(0),
+	}
+}
+
+func (l gatewayLimits) enabled() bool {
+	return l.requestsPerSec > 0 || l.concurrent > 0 || l.dailyBytes > 0
+}
+
+// limitedUsage is what a client, or all the clients of a hostname, are
+// currently using of their limits.
+type limitedUsage struct {
+	limits gatewayLimits
+	rate   *rate.Limiter // nil when unlimited
+	active int64
+	served uint64 // response bytes today
+	last   time.Time
+}
+
+func newLimitedUsage(limits gatewayLimits) *limitedUsage {
+	u := &limitedUsage{limits: limits}
+	if limits.requestsPerSec > 0 {
+		u.rate = rate.NewLimiter(rate.Limit(limits.requestsPerSec), int(limits.requestsPerSec))
+	}
+	return u
+}
+
+// limitedHost is a PublicGateways hostname with limits, which also covers
+// its subdomains.
+type limitedHost struct {
+	name  string
+	usage *limitedUsage
+}
+
+// gatewayLimiter answers 429 Too Many Requests with a Retry-After header to
+// the requests over Gateway.ClientLimits or over the limits of the
+// PublicGateways hostname they are made to.
+//
+// The daily bytes are charged when responses complete: responses in progress
+// are not cut, the next requests are denied until the next day.
+type gatewayLimiter struct {
+	client  gatewayLimits
+	hosts   []limitedHost // longest first
+	trusted trustedProxies
+	now     func() time.Time
+
+	mu        sync.Mutex
+	day       int // year*1000 + day of the year
+	clients   map[string]*limitedUsage
+	lastSweep time.Time
+}
+
+// newGatewayLimiter returns nil when cfg limits nothing.
+func newGatewayLimiter(cfg config.Gateway) (*gatewayLimiter, error) {
+	l := &gatewayLimiter{
+		client:  newGatewayLimits(cfg.ClientLimits),
+		now:     time.Now,
+		clients: make(map[string]*limitedUsage),
+	}
+	for hostname, gw := range cfg.PublicGateways {
+		if gw == nil {
+			continue
+		}
+		limits := newGatewayLimits(gw.Limits)
+		if !limits.enabled() {
+			continue
+		}
+		if h, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = h
+		}
+		l.hosts = append(l.hosts, limitedHost{name: hostname, usage: newLimitedUsage(limits)})
+	}
+	if !l.client.enabled() && len(l.hosts) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(l.hosts, func(a, b limitedHost) int {
+		return len(b.name) - len(a.name)
+	})
+	trusted, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	l.trusted = trusted
+	return l, nil
+}
+
+func registerGatewayLimitsMetrics() error {
+	for _, c := range []prometheus.Collector{gatewayLimitedRequests, gatewayLimitedClients, gatewayHostBytesToday} {
+		if err := prometheus.Register(c); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *gatewayLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(gatewayLimitedKey{}) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client, host, retryAfter, denied := l.acquire(gatewayClientKey(l.trusted.clientAddr(r)), r.Host)
+		if denied != "" {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusTooManyRequests), denied), http.StatusTooManyRequests)
+			return
+		}
+		cw := &countingResponseWriter{ResponseWriter: w}
+		defer func() { l.release(client, host, cw.written) }()
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), gatewayLimitedKey{}, true)))
+	})
+}
+
+// acquire counts a request of client to hostname against the limits. When a
+// limit is reached, it returns which one and when to retry instead.
+func (l *gatewayLimiter) acquire(client, hostname string) (*limitedUsage, *limitedHost, time.Duration, string) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	l.sweep(now)
+
+	var cu *limitedUsage
+	if l.client.enabled() {
+		cu = l.clients[client]
+		if cu == nil {
+			cu = newLimitedUsage(l.client)
+			l.clients[client] = cu
+			gatewayLimitedClients.Set(float64(len(l.clients)))
+		}
+		cu.last = now
+	}
+	host := l.host(hostname)
+
+	type scoped struct {
+		scope string
+		usage *limitedUsage
+	}
+	var usages []scoped
+	if cu != nil {
+		usages = append(usages, scoped{"client", cu})
+	}
+	if host != nil {
+		usages = append(usages, scoped{"host", host.usage})
+	}
+
+	deny := func(scope, limit string, retryAfter time.Duration) (*limitedUsage, *limitedHost, time.Duration, string) {
+		gatewayLimitedRequests.WithLabelValues(scope, limit).Inc()
+		what := "client"
+		if scope == "host" {
+			what = host.name
+		}
+		return nil, nil, max(retryAfter, time.Second), fmt.Sprintf("%s over %s limit", what, limit)
+	}
+	for _, u := range usages {
+		if u.usage.limits.concurrent > 0 && u.usage.active >= u.usage.limits.concurrent {
+			return deny(u.scope, "MaxConcurrentRequests", time.Second)
+		}
+		if u.usage.limits.dailyBytes > 0 && u.usage.served >= u.usage.limits.dailyBytes {
+			y, m, d := now.Date()
+			return deny(u.scope, "MaxDailyBytes", time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Sub(now))
+		}
+	}
+	var reserved []*rate.Reservation
+	for _, u := range usages {
+		if u.usage.rate == nil {
+			continue
+		}
+		res := u.usage.rate.ReserveN(now, 1)
+		if delay := res.DelayFrom(now); delay > 0 {
+			res.CancelAt(now)
+			for _, r := range reserved {
+				r.CancelAt(now)
+			}
+			return deny(u.scope, "RequestsPerSecond", delay)
+		}
+		reserved = append(reserved, res)
+	}
+
+	for _, u := range usages {
+		u.usage.active++
+	}
+	return cu, host, 0, ""
+}
+
+// release ends a request acquired for client and host, which wrote n
+// response bytes.
+func (l *gatewayLimiter) release(client *limitedUsage, host *limitedHost, n uint64) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	if client != nil {
+		client.active--
+		client.served += n
+		client.last = now
+	}
+	if host != nil {
+		host.usage.active--
+		host.usage.served += n
+		gatewayHostBytesToday.WithLabelValues(host.name).Set(float64(host.usage.served))
+	}
+}
+
+// host returns the limited hostname matching the Host header of a request,
+// or nil.
+func (l *gatewayLimiter) host(hostname string) *limitedHost {
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	for i := range l.hosts {
+		name := l.hosts[i].name
+		if hostname == name || strings.HasSuffix(hostname, "."+name) {
+			return &l.hosts[i]
+		}
+	}
+	return nil
+}
+
+// rollover resets the daily bytes on a new day.
+func (l *gatewayLimiter) rollover(now time.Time) {
+	day := now.Year()*1000 + now.YearDay()
+	if day == l.day {
+		return
+	}
+	l.day = day
+	for _, u := range l.clients {
+		u.served = 0
+	}
+	for _, h := range l.hosts {
+		h.usage.served = 0
+		gatewayHostBytesToday.WithLabelValues(h.name).Set(0)
+	}
+}
+
+// sweep drops the clients idle for a while, unless they are still under a
+// daily limit.
+func (l *gatewayLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < gatewayClientSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, u := range l.clients {
+		if u.active == 0 && now.Sub(u.last) >= gatewayClientSweepInterval && (u.limits.dailyBytes == 0 || u.served == 0) {
+			delete(l.clients, key)
+		}
+	}
+	gatewayLimitedClients.Set(float64(len(l.clients)))
+}
+
+// gatewayClientKey identifies the client at addr by its IP address, or by
+// its /64 prefix for IPv6 since a single host commonly has a whole /64.
+func gatewayClientKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = strings.Trim(addr, "[]")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// countingResponseWriter counts the response bytes written and records the
+// status of the response.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written uint64
+}
+
+func (w *countingResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Status returns the status of the response, 200 when none was written.
+func (w *countingResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += uint64(n)
+	return n, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
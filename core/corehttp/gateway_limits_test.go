@@ -0,0 +1,152 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayLimiter(t *testing.T) {
+	var now time.Time
+	newLimiter := func(cfg config.Gateway) (*gatewayLimiter, http.Handler, chan struct{}) {
+		now = time.Date(2026, 3, 1, 23, 59, 0, 0, time.Local)
+		l, err := newGatewayLimiter(cfg)
+		require.NoError(t, err)
+		require.NotNil(t, l)
+		l.now = func() time.Time { return now }
+		block := make(chan struct{})
+		return l, l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/block" {
+				<-block
+			}
+			w.Write([]byte(strings.Repeat("x", 100)))
+		})), block
+	}
+	get := func(h http.Handler, client, host, path string, forwardedFor ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+		r.RemoteAddr = client
+		for _, f := range forwardedFor {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	l, err := newGatewayLimiter(config.Gateway{})
+	require.NoError(t, err)
+	require.Nil(t, l)
+	_, err = newGatewayLimiter(config.Gateway{
+		ClientLimits:   config.GatewayLimits{RequestsPerSecond: config.NewOptionalInteger(1)},
+		TrustedProxies: []string{"not-an-ip"},
+	})
+	require.Error(t, err)
+
+	t.Run("requests per second", func(t *testing.T) {
+		_, h, _ := newLimiter(config.Gateway{ClientLimits: config.GatewayLimits{
+			RequestsPerSecond: config.NewOptionalInteger(2),
+		}})
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1000", "localhost", "/").Code)
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1001", "localhost", "/").Code)
+		w := get(h, "1.2.3.4:1002", "localhost", "/")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), "client over RequestsPerSecond limit")
+
+		// other clients are not affected
+		assert.Equal(t, http.StatusOK, get(h, "5.6.7.8:1000", "localhost", "/").Code)
+		// IPv6 clients are limited by /64
+		assert.Equal(t, http.StatusOK, get(h, "[2001:db8::1]:1000", "localhost", "/").Code)
+		assert.Equal(t, http.StatusOK, get(h, "[2001:db8::2]:1000", "localhost", "/").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(h, "[2001:db8::3]:1000", "localhost", "/").Code)
+
+		now = now.Add(time.Second)
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1003", "localhost", "/").Code)
+	})
+
+	t.Run("requests are limited once", func(t *testing.T) {
+		l, h, _ := newLimiter(config.Gateway{ClientLimits: config.GatewayLimits{
+			RequestsPerSecond: config.NewOptionalInteger(2),
+		}})
+		// the hostname gateway rewrites requests to the path gateway
+		h = l.wrap(h)
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1000", "localhost", "/").Code)
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1001", "localhost", "/").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(h, "1.2.3.4:1002", "localhost", "/").Code)
+	})
+
+	t.Run("clients behind trusted proxies", func(t *testing.T) {
+		_, h, _ := newLimiter(config.Gateway{
+			ClientLimits: config.GatewayLimits{
+				RequestsPerSecond: config.NewOptionalInteger(1),
+			},
+			TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8"},
+		})
+		// clients are told apart by the address the proxies forward
+		assert.Equal(t, http.StatusOK, get(h, "127.0.0.1:1000", "localhost", "/", "1.2.3.4").Code)
+		assert.Equal(t, http.StatusOK, get(h, "127.0.0.1:1000", "localhost", "/", "5.6.7.8, 10.1.1.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(h, "127.0.0.1:1000", "localhost", "/", "1.2.3.4").Code)
+		// addresses set by the client are ignored
+		assert.Equal(t, http.StatusTooManyRequests, get(h, "127.0.0.1:1000", "localhost", "/", "9.9.9.9, 5.6.7.8").Code)
+		// and untrusted peers cannot pick their address
+		assert.Equal(t, http.StatusOK, get(h, "2.2.2.2:1000", "localhost", "/", "3.3.3.3").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(h, "2.2.2.2:1000", "localhost", "/", "4.4.4.4").Code)
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		_, h, block := newLimiter(config.Gateway{ClientLimits: config.GatewayLimits{
+			MaxConcurrentRequests: config.NewOptionalInteger(1),
+		}})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			get(h, "1.2.3.4:1000", "localhost", "/block")
+		}()
+		require.Eventually(t, func() bool {
+			return get(h, "1.2.3.4:1001", "localhost", "/").Code == http.StatusTooManyRequests
+		}, 5*time.Second, 10*time.Millisecond)
+		close(block)
+		<-done
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1001", "localhost", "/").Code)
+	})
+
+	t.Run("daily bytes per hostname", func(t *testing.T) {
+		l, h, _ := newLimiter(config.Gateway{PublicGateways: map[string]*config.GatewaySpec{
+			"dweb.link": {UseSubdomains: true, Limits: config.GatewayLimits{
+				MaxDailyBytes: config.NewOptionalBytes("150B"),
+			}},
+			"example.com": {},
+		}})
+		assert.Len(t, l.hosts, 1)
+
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1000", "dweb.link", "/").Code)
+		assert.Equal(t, http.StatusOK, get(h, "5.6.7.8:1000", "cid.ipfs.dweb.link", "/").Code)
+		w := get(h, "1.2.3.4:1000", "cid.ipfs.dweb.link:8080", "/")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), "dweb.link over MaxDailyBytes limit")
+
+		// other hostnames are not limited
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1000", "example.com", "/").Code)
+
+		now = now.Add(time.Minute)
+		assert.Equal(t, http.StatusOK, get(h, "1.2.3.4:1000", "dweb.link", "/").Code)
+	})
+
+	t.Run("idle clients are dropped", func(t *testing.T) {
+		l, h, _ := newLimiter(config.Gateway{ClientLimits: config.GatewayLimits{
+			RequestsPerSecond: config.NewOptionalInteger(10),
+		}})
+		get(h, "1.2.3.4:1000", "localhost", "/")
+		now = now.Add(gatewayClientSweepInterval)
+		get(h, "5.6.7.8:1000", "localhost", "/")
+		assert.Len(t, l.clients, 1)
+		assert.Contains(t, l.clients, "5.6.7.8")
+	})
+}
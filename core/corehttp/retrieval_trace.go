@@ -0,0 +1,90 @@
+package corehttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/node"
+)
+
+// RetrievalTraceHeader is the header of gateway requests asking for a
+// retrieval trace under the request ID it holds. Responses report a summary
+// of the trace in the same header, see 'ipfs bitswap trace' for the rest.
+const RetrievalTraceHeader = "X-Ipfs-Retrieval-Trace"
+
+// withRetrievalTrace traces the retrievals of requests with the
+// X-Ipfs-Retrieval-Trace header, when Gateway.RetrievalTrace is set.
+func withRetrievalTrace(n *core.IpfsNode, next http.Handler) (http.Handler, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	if n.RetrievalTracer == nil || !cfg.Gateway.RetrievalTrace.WithDefault(config.DefaultGatewayRetrievalTrace) {
+		return next, nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RetrievalTraceHeader)
+		// requests rewritten by the hostname gateway are already traced
+		if id == "" || node.RetrievalTraceFromContext(r.Context()) != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, t, err := n.RetrievalTracer.Start(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		defer t.Finish()
+		next.ServeHTTP(&traceResponseWriter{ResponseWriter: w, trace: t}, r.WithContext(ctx))
+	}), nil
+}
+
+// traceResponseWriter reports the trace of what was retrieved before the
+// response headers are written, which covers at least the resolution of the
+// requested path.
+type traceResponseWriter struct {
+	http.ResponseWriter
+	trace       *node.RetrievalTrace
+	wroteHeader bool
+}
+
+func (w *traceResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(RetrievalTraceHeader, retrievalTraceSummary(w.trace.Stat()))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *traceResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *traceResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *traceResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func retrievalTraceSummary(st node.RetrievalTraceStat) string {
+	var from []string
+	for _, p := range st.Peers {
+		if p.Delivered > 0 {
+			from = append(from, p.Peer.String())
+		}
+	}
+	return fmt.Sprintf("id=%s; requested=%d; received=%d; bytes=%d; duplicates=%d; ttfb=%s; peers=%s",
+		st.ID, st.Requested, st.Received, st.Bytes, st.Duplicates,
+		st.TimeToFirstBlock.Round(time.Millisecond), strings.Join(from, ","))
+}
@@ -0,0 +1,74 @@
+package corehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the networks of Gateway.TrustedProxies, whose
+// X-Forwarded-For headers tell the address of the clients they forward.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses Gateway.TrustedProxies, made of IP addresses
+// and CIDR ranges.
+func parseTrustedProxies(proxies []string) (trustedProxies, error) {
+	var t trustedProxies
+	for _, proxy := range proxies {
+		_, ipnet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid Gateway.TrustedProxies entry %q: not an IP address or CIDR range", proxy)
+			}
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		t = append(t, ipnet)
+	}
+	return t, nil
+}
+
+// clientAddr returns the address of the client of r: the address of the
+// connection or, when it comes from a trusted proxy, the last address of the
+// X-Forwarded-For header that is not a trusted proxy. Addresses left of it
+// are set by the client and cannot be trusted.
+func (t trustedProxies) clientAddr(r *http.Request) string {
+	if len(t) == 0 || !t.isTrusted(r.RemoteAddr) {
+		return r.RemoteAddr
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !t.isTrusted(hop) {
+			return hop
+		}
+	}
+	return r.RemoteAddr
+}
+
+// isTrusted reports whether addr, an IP address with or without a port, is
+// in Gateway.TrustedProxies.
+func (t trustedProxies) isTrusted(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = strings.Trim(addr, "[]")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range t {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package iface
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Operations supported in a [FilesAPI.Batch].
+const (
+	// FilesOpMkdir creates the directory at Path.
+	FilesOpMkdir = "mkdir"
+	// FilesOpCp copies Src, an MFS path or an /ipfs/ path, to Dst.
+	FilesOpCp = "cp"
+	// FilesOpMv moves Src to Dst.
+	FilesOpMv = "mv"
+	// FilesOpRm removes the entry at Path.
+	FilesOpRm = "rm"
+	// FilesOpWrite replaces the file at Path with Data, creating it if needed.
+	FilesOpWrite = "write"
+)
+
+// ErrFilesConflict is returned by [FilesAPI.Batch] when MFS was modified by
+// someone else while the batch was being applied.
+var ErrFilesConflict = errors.New("MFS was modified while the batch was applied")
+
+// FilesOp is a single operation of a [FilesAPI.Batch]. Which fields are used
+// depends on Op.
+type FilesOp struct {
+	Op   string
+	Path string `json:",omitempty"`
+	Src  string `json:",omitempty"`
+	Dst  string `json:",omitempty"`
+	Data string `json:",omitempty"`
+
+	// Parents creates missing parent directories (mkdir, cp, mv, write).
+	Parents bool `json:",omitempty"`
+	// Recursive allows removing directories (rm).
+	Recursive bool `json:",omitempty"`
+	// Force ignores missing entries (rm).
+	Force bool `json:",omitempty"`
+}
+
+// FilesAPI specifies the interface to the MFS (Mutable File System) of the
+// node, as used by the 'ipfs files' commands.
+type FilesAPI interface {
+	// Batch applies ops, in order, to a private copy of the MFS root. If all
+	// of them succeed, the resulting tree replaces the MFS root in a single
+	// update and its path is returned. If any of them fails, MFS is left
+	// untouched and no intermediate root is ever published, provided or
+	// pinned.
+	Batch(ctx context.Context, ops []FilesOp, opts ...options.FilesBatchOption) (path.ImmutablePath, error)
+}
+
+// FilesCoreAPI is a CoreAPI that also provides the Files API. Files is not
+// part of CoreAPI so that existing implementations keep satisfying it, check
+// for it with a type assertion.
+type FilesCoreAPI interface {
+	CoreAPI
+
+	// Files returns an implementation of Files API
+	Files() FilesAPI
+}
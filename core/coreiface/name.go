@@ -3,6 +3,7 @@ package iface
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ipfs/boxo/ipns"
 	"github.com/ipfs/boxo/path"
@@ -16,6 +17,47 @@ type IpnsResult struct {
 	Err error
 }
 
+// NameTraceEventType is the kind of a NameTraceEvent.
+type NameTraceEventType string
+
+const (
+	// NameTraceLookup reports the answer of one source.
+	NameTraceLookup NameTraceEventType = "lookup"
+	// NameTraceResult reports which record won for a name, and why.
+	NameTraceResult NameTraceEventType = "result"
+)
+
+// NameTraceRecord is a record returned by a source during a traced
+// resolution.
+type NameTraceRecord struct {
+	Source   string
+	Value    path.Path
+	Sequence uint64
+	Validity time.Time
+	TTL      time.Duration
+	// Err is set if the record was rejected, e.g. because it is expired or
+	// its signature does not match the name.
+	Err error
+}
+
+// NameTraceEvent is emitted to the sink passed with options.Name.Trace for
+// each step of a resolution.
+type NameTraceEvent struct {
+	Type NameTraceEventType
+	// Name is the name being resolved at this step: an IPNS name, or a
+	// DNSLink domain.
+	Name string
+	// Source is what was consulted: "cache", "dnslink", or one of the
+	// routers of the node such as "dht", "pubsub" or "http <endpoint>".
+	// For result events, it is the source of the winning record.
+	Source   string
+	Duration time.Duration
+	Records  []NameTraceRecord
+	Err      error
+	// Reason explains why the first of Records won, for result events.
+	Reason string
+}
+
 // NameAPI specifies the interface to IPNS.
 //
 // IPNS is a PKI namespace, where names are the hashes of public keys, and the
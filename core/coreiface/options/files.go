@@ -0,0 +1,35 @@
+package options
+
+type FilesBatchSettings struct {
+	DryRun bool
+}
+
+type FilesBatchOption func(*FilesBatchSettings) error
+
+func FilesBatchOptions(opts ...FilesBatchOption) (*FilesBatchSettings, error) {
+	options := &FilesBatchSettings{
+		DryRun: false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type filesOpts struct{}
+
+var Files filesOpts
+
+// DryRun is an option for [Files.Batch] which applies the operations to the
+// private copy of the MFS root and returns the resulting root, without
+// committing it. Default value is false
+func (filesOpts) DryRun(dryRun bool) FilesBatchOption {
+	return func(settings *FilesBatchSettings) error {
+		settings.DryRun = dryRun
+		return nil
+	}
+}
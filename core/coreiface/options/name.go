@@ -22,6 +22,7 @@ type NamePublishSettings struct {
 
 type NameResolveSettings struct {
 	Cache bool
+	Trace chan<- any
 
 	ResolveOpts []namesys.ResolveOption
 }
@@ -145,6 +146,18 @@ func (nameOpts) Cache(cache bool) NameResolveOption {
 	}
 }
 
+// Trace is an option for Name.Resolve and Name.Search which asks for every
+// source consulted during the resolution, the records they returned and the
+// record that won to be sent to sink as *iface.NameTraceEvent. Every source
+// is queried and waited for, so a traced resolution takes as long as the
+// slowest one.
+func (nameOpts) Trace(sink chan<- any) NameResolveOption {
+	return func(settings *NameResolveSettings) error {
+		settings.Trace = sink
+		return nil
+	}
+}
+
 func (nameOpts) ResolveOption(opt namesys.ResolveOption) NameResolveOption {
 	return func(settings *NameResolveSettings) error {
 		settings.ResolveOpts = append(settings.ResolveOpts, opt)
@@ -6,6 +6,7 @@ import "fmt"
 type PinAddSettings struct {
 	Recursive bool
 	Name      string
+	Provide   string
 }
 
 // PinLsSettings represent the settings for PinAPI.Ls
@@ -282,6 +283,16 @@ func (pinOpts) Recursive(recursive bool) PinAddOption {
 	}
 }
 
+// Provide is an option for Pin.Add which sets how the pinned blocks are
+// announced: "all" blocks, only the "roots", or "none". The default, empty,
+// follows Provide.Strategy.
+func (pinOpts) Provide(policy string) PinAddOption {
+	return func(settings *PinAddSettings) error {
+		settings.Provide = policy
+		return nil
+	}
+}
+
 // Name is an option for Pin.Add which specifies an optional name to add to the pin.
 func (pinOpts) Name(name string) PinAddOption {
 	return func(settings *PinAddSettings) error {
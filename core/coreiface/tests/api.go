@@ -75,6 +75,7 @@ func TestApi(p Provider) func(t *testing.T) {
 	return func(t *testing.T) {
 		t.Run("Block", tp.TestBlock)
 		t.Run("Dag", tp.TestDag)
+		t.Run("Files", tp.TestFiles)
 		t.Run("Key", tp.TestKey)
 		t.Run("Name", tp.TestName)
 		t.Run("Object", tp.TestObject)
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	opt "github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/stretchr/testify/require"
+)
+
+func (tp *TestSuite) TestFiles(t *testing.T) {
+	tp.hasApi(t, func(api iface.CoreAPI) error {
+		if fapi, ok := api.(iface.FilesCoreAPI); !ok || fapi.Files() == nil {
+			return errAPINotImplemented
+		}
+		return nil
+	})
+
+	t.Run("TestFilesBatch", tp.TestFilesBatch)
+	t.Run("TestFilesBatchFailure", tp.TestFilesBatchFailure)
+}
+
+func filesAPI(t *testing.T, api iface.CoreAPI) iface.FilesAPI {
+	t.Helper()
+	fapi, ok := api.(iface.FilesCoreAPI)
+	require.True(t, ok, "API does not implement FilesCoreAPI")
+	return fapi.Files()
+}
+
+func readMFSFile(t *testing.T, api iface.CoreAPI, root path.ImmutablePath, name string) string {
+	t.Helper()
+	p, err := path.Join(root, name)
+	require.NoError(t, err)
+	nd, err := api.Unixfs().Get(t.Context(), p)
+	require.NoError(t, err)
+	data, err := io.ReadAll(files.ToFile(nd))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func (tp *TestSuite) TestFilesBatch(t *testing.T) {
+	ctx := t.Context()
+	api, err := tp.makeAPI(t, ctx)
+	require.NoError(t, err)
+	fapi := filesAPI(t, api)
+
+	foo, err := api.Unixfs().Add(ctx, strFile("foo")())
+	require.NoError(t, err)
+
+	root, err := fapi.Batch(ctx, []iface.FilesOp{
+		{Op: iface.FilesOpMkdir, Path: "/a/b", Parents: true},
+		{Op: iface.FilesOpCp, Src: foo.String(), Dst: "/a/b/foo"},
+		{Op: iface.FilesOpWrite, Path: "/a/bar", Data: "bar"},
+		{Op: iface.FilesOpMv, Src: "/a/bar", Dst: "/c/bar", Parents: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "foo", readMFSFile(t, api, root, "a/b/foo"))
+	require.Equal(t, "bar", readMFSFile(t, api, root, "c/bar"))
+
+	// an empty dry run returns the committed root
+	cur, err := fapi.Batch(ctx, nil, opt.Files.DryRun(true))
+	require.NoError(t, err)
+	require.Equal(t, root.RootCid(), cur.RootCid())
+
+	dry, err := fapi.Batch(ctx, []iface.FilesOp{
+		{Op: iface.FilesOpRm, Path: "/a", Recursive: true},
+	}, opt.Files.DryRun(true))
+	require.NoError(t, err)
+	require.NotEqual(t, root.RootCid(), dry.RootCid())
+
+	cur, err = fapi.Batch(ctx, nil, opt.Files.DryRun(true))
+	require.NoError(t, err)
+	require.Equal(t, root.RootCid(), cur.RootCid(), "dry run must not change MFS")
+}
+
+func (tp *TestSuite) TestFilesBatchFailure(t *testing.T) {
+	ctx := t.Context()
+	api, err := tp.makeAPI(t, ctx)
+	require.NoError(t, err)
+	fapi := filesAPI(t, api)
+
+	before, err := fapi.Batch(ctx, nil, opt.Files.DryRun(true))
+	require.NoError(t, err)
+
+	_, err = fapi.Batch(ctx, []iface.FilesOp{
+		{Op: iface.FilesOpMkdir, Path: "/keep"},
+		{Op: iface.FilesOpRm, Path: "/missing"},
+	})
+	require.ErrorContains(t, err, "op 2 (rm)")
+
+	after, err := fapi.Batch(ctx, nil, opt.Files.DryRun(true))
+	require.NoError(t, err)
+	require.Equal(t, before.RootCid(), after.RootCid(), "failed batch must not change MFS")
+
+	_, err = fapi.Batch(ctx, []iface.FilesOp{{Op: "chmod", Path: "/"}})
+	require.ErrorContains(t, err, `unknown operation "chmod"`)
+}
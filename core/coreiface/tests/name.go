@@ -26,6 +26,7 @@ func (tp *TestSuite) TestName(t *testing.T) {
 	t.Run("TestPublishResolve", tp.TestPublishResolve)
 	t.Run("TestBasicPublishResolveKey", tp.TestBasicPublishResolveKey)
 	t.Run("TestBasicPublishResolveTimeout", tp.TestBasicPublishResolveTimeout)
+	t.Run("TestBasicPublishResolveTrace", tp.TestBasicPublishResolveTrace)
 }
 
 var rnd = rand.New(rand.NewSource(0x62796532303137))
@@ -171,4 +172,54 @@ func (tp *TestSuite) TestBasicPublishResolveTimeout(t *testing.T) {
 	require.Error(t, err, "IPNS resolution should fail after ValidTime expires (non-cached)")
 }
 
+func (tp *TestSuite) TestBasicPublishResolveTrace(t *testing.T) {
+	ctx := t.Context()
+	apis, err := tp.MakeAPISwarm(t, ctx, 5)
+	require.NoError(t, err)
+	api := apis[0]
+	p, err := addTestObject(ctx, api)
+	require.NoError(t, err)
+
+	name, err := api.Name().Publish(ctx, p)
+	require.NoError(t, err)
+
+	trace := func(opts ...opt.NameResolveOption) []*coreiface.NameTraceEvent {
+		sink := make(chan any)
+		done := make(chan []*coreiface.NameTraceEvent)
+		go func() {
+			var events []*coreiface.NameTraceEvent
+			for ev := range sink {
+				events = append(events, ev.(*coreiface.NameTraceEvent))
+			}
+			done <- events
+		}()
+		resPath, err := api.Name().Resolve(ctx, name.String(), append(opts, opt.Name.Trace(sink))...)
+		close(sink)
+		require.NoError(t, err)
+		require.Equal(t, p.String(), resPath.String())
+		return <-done
+	}
+
+	// a plain resolution caches the record
+	_, err = api.Name().Resolve(ctx, name.String())
+	require.NoError(t, err)
+	events := trace()
+	require.NotEmpty(t, events)
+	require.Equal(t, "cache", events[0].Source)
+	result := events[len(events)-1]
+	require.Equal(t, coreiface.NameTraceResult, result.Type)
+	require.Equal(t, "cache", result.Source)
+
+	events = trace(opt.Name.Cache(false))
+	result = events[len(events)-1]
+	require.Equal(t, coreiface.NameTraceResult, result.Type)
+	require.NotEqual(t, "cache", result.Source)
+	require.NotEmpty(t, result.Reason)
+	require.Equal(t, p.String(), result.Records[0].Value.String())
+	for _, ev := range events[:len(events)-1] {
+		require.Equal(t, coreiface.NameTraceLookup, ev.Type)
+		require.Equal(t, name.String(), ev.Name)
+	}
+}
+
 // TODO: When swarm api is created, add multinode tests
@@ -0,0 +1,243 @@
+package coreipns
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ArchivePrefix is the datastore prefix under which every IPNS record the
+// node publishes or accepts with 'ipfs name put' is kept, by name and
+// sequence number.
+var ArchivePrefix = datastore.NewKey("/local/ipns-archive")
+
+// Origins of archived records.
+const (
+	ArchiveOriginPublish = "publish"
+	ArchiveOriginPut     = "put"
+)
+
+var ErrNotArchived = errors.New("no archived record with this sequence number")
+
+// ArchivedRecord is a record kept in the archive.
+type ArchivedRecord struct {
+	Sequence uint64
+	Value    path.Path
+	Validity time.Time
+	TTL      time.Duration
+
+	// Origin tells how the record reached the archive, Archived when.
+	Origin   string
+	Archived time.Time
+
+	// Record is the signed record, as published.
+	Record []byte
+}
+
+// archiveEntry is the stored form of an ArchivedRecord, the other fields
+// are read from the record.
+type archiveEntry struct {
+	Origin   string
+	Archived time.Time
+	Record   []byte
+}
+
+func archiveKey(name ipns.Name, seq uint64) datastore.Key {
+	return ArchivePrefix.ChildString(name.String()).ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// ArchiveRecord adds the marshaled record data of name to the archive. The
+// record must be valid for name. A record with the same sequence number that
+// is already archived is kept, so republishing does not fill the archive.
+// Only the keep records of name with the highest sequence numbers are kept.
+func ArchiveRecord(ctx context.Context, ds datastore.Datastore, name ipns.Name, data []byte, origin string, keep int) error {
+	rec, err := ipns.UnmarshalRecord(data)
+	if err != nil {
+		return err
+	}
+	if err := ipns.ValidateWithName(rec, name); err != nil {
+		return err
+	}
+	seq, err := rec.Sequence()
+	if err != nil {
+		return err
+	}
+
+	key := archiveKey(name, seq)
+	if has, err := ds.Has(ctx, key); err != nil || has {
+		return err
+	}
+	stored, err := json.Marshal(archiveEntry{
+		Origin:   origin,
+		Archived: time.Now().UTC(),
+		Record:   data,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ds.Put(ctx, key, stored); err != nil {
+		return err
+	}
+	return pruneArchive(ctx, ds, name, keep)
+}
+
+// pruneArchive removes the archived records of name but the keep ones with
+// the highest sequence numbers.
+func pruneArchive(ctx context.Context, ds datastore.Datastore, name ipns.Name, keep int) error {
+	results, err := ds.Query(ctx, query.Query{
+		Prefix:   ArchivePrefix.ChildString(name.String()).String(),
+		KeysOnly: true,
+		Orders:   []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries[:max(len(entries)-max(keep, 1), 0)] {
+		if err := ds.Delete(ctx, datastore.NewKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns the archived records of name, oldest first.
+func History(ctx context.Context, ds datastore.Datastore, name ipns.Name) ([]ArchivedRecord, error) {
+	results, err := ds.Query(ctx, query.Query{
+		Prefix: ArchivePrefix.ChildString(name.String()).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var out []ArchivedRecord
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		ar, err := decodeArchived(r.Value)
+		if err != nil {
+			log.Errorf("ignoring undecodable archived record %s: %s", r.Key, err)
+			continue
+		}
+		out = append(out, *ar)
+	}
+	slices.SortFunc(out, func(a, b ArchivedRecord) int {
+		return cmp.Compare(a.Sequence, b.Sequence)
+	})
+	return out, nil
+}
+
+// GetArchived returns the archived record of name with the given sequence
+// number.
+func GetArchived(ctx context.Context, ds datastore.Datastore, name ipns.Name, seq uint64) (*ArchivedRecord, error) {
+	data, err := ds.Get(ctx, archiveKey(name, seq))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrNotArchived, seq)
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeArchived(data)
+}
+
+// NextSequence returns the sequence number a new record of name must have to
+// replace both the record last published on this node and every archived
+// one.
+func NextSequence(ctx context.Context, ds datastore.Datastore, name ipns.Name) (uint64, error) {
+	var next uint64
+	rec, err := getLocalRecord(ctx, ds, name.Peer())
+	if err != nil {
+		return 0, err
+	}
+	if rec != nil {
+		seq, err := rec.Sequence()
+		if err != nil {
+			return 0, err
+		}
+		next = seq + 1
+	}
+	history, err := History(ctx, ds, name)
+	if err != nil {
+		return 0, err
+	}
+	if n := len(history); n > 0 && history[n-1].Sequence >= next {
+		next = history[n-1].Sequence + 1
+	}
+	return next, nil
+}
+
+func decodeArchived(data []byte) (*ArchivedRecord, error) {
+	var e archiveEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	rec, err := ipns.UnmarshalRecord(e.Record)
+	if err != nil {
+		return nil, err
+	}
+	ar := &ArchivedRecord{
+		Origin:   e.Origin,
+		Archived: e.Archived,
+		Record:   e.Record,
+	}
+	if ar.Sequence, err = rec.Sequence(); err != nil {
+		return nil, err
+	}
+	if ar.Value, err = rec.Value(); err != nil {
+		return nil, err
+	}
+	if ar.Validity, err = rec.Validity(); err != nil {
+		return nil, err
+	}
+	ar.TTL, _ = rec.TTL()
+	return ar, nil
+}
+
+// ArchivingNameSystem wraps ns so that every record it publishes is added to
+// the archive once published, which keeps keep records per name.
+func ArchivingNameSystem(ns namesys.NameSystem, ds datastore.Datastore, keep int) namesys.NameSystem {
+	return &archivingNameSystem{NameSystem: ns, ds: ds, keep: keep}
+}
+
+type archivingNameSystem struct {
+	namesys.NameSystem
+	ds   datastore.Datastore
+	keep int
+}
+
+func (ns *archivingNameSystem) Publish(ctx context.Context, sk crypto.PrivKey, value path.Path, options ...namesys.PublishOption) error {
+	if err := ns.NameSystem.Publish(ctx, sk, value, options...); err != nil {
+		return err
+	}
+
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	name := ipns.NameFromPeer(id)
+	data, err := ns.ds.Get(ctx, namesys.IpnsDsKey(name))
+	if err != nil {
+		log.Errorf("failed to archive published record of %s: %s", name, err)
+		return nil
+	}
+	if err := ArchiveRecord(ctx, ns.ds, name, data, ArchiveOriginPublish, ns.keep); err != nil {
+		log.Errorf("failed to archive published record of %s: %s", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package coreipns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	offroute "github.com/ipfs/boxo/routing/offline"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	record "github.com/libp2p/go-libp2p-record"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	rt := offroute.NewOfflineRouter(ds, record.NamespacedValidator{"ipns": ipns.Validator{}})
+	base, err := namesys.NewNameSystem(rt, namesys.WithDatastore(ds))
+	require.NoError(t, err)
+	ns := ArchivingNameSystem(base, ds, 3)
+
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(id)
+
+	first := path.FromCid(name.Cid())
+	second, err := path.Join(first, "second")
+	require.NoError(t, err)
+
+	require.NoError(t, ns.Publish(ctx, sk, first))
+	require.NoError(t, ns.Publish(ctx, sk, second))
+	// republishing the same value does not add an entry
+	require.NoError(t, ns.Publish(ctx, sk, second))
+
+	history, err := History(ctx, ds, name)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, uint64(0), history[0].Sequence)
+	assert.Equal(t, first.String(), history[0].Value.String())
+	assert.Equal(t, uint64(1), history[1].Sequence)
+	assert.Equal(t, second.String(), history[1].Value.String())
+	assert.Equal(t, ArchiveOriginPublish, history[1].Origin)
+
+	next, err := NextSequence(ctx, ds, name)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), next)
+
+	ar, err := GetArchived(ctx, ds, name, 0)
+	require.NoError(t, err)
+	assert.Equal(t, first.String(), ar.Value.String())
+	_, err = GetArchived(ctx, ds, name, 5)
+	assert.ErrorIs(t, err, ErrNotArchived)
+
+	// put records count too, and must belong to the name
+	rec, err := ipns.NewRecord(sk, first, 7, time.Now().Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	data, err := ipns.MarshalRecord(rec)
+	require.NoError(t, err)
+	other, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	otherID, err := peer.IDFromPrivateKey(other)
+	require.NoError(t, err)
+	assert.Error(t, ArchiveRecord(ctx, ds, ipns.NameFromPeer(otherID), data, ArchiveOriginPut, 3))
+	require.NoError(t, ArchiveRecord(ctx, ds, name, data, ArchiveOriginPut, 3))
+
+	next, err = NextSequence(ctx, ds, name)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8), next)
+
+	// only the records with the highest sequence numbers are kept
+	require.NoError(t, ns.Publish(ctx, sk, first))
+	history, err = History(ctx, ds, name)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, uint64(1), history[0].Sequence)
+	assert.Equal(t, uint64(7), history[2].Sequence)
+	_, err = GetArchived(ctx, ds, name, 0)
+	assert.ErrorIs(t, err, ErrNotArchived)
+}
@@ -0,0 +1,195 @@
+package coreipns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/miekg/dns"
+)
+
+// TXTResolver looks up TXT records and, when it can tell, their TTL.
+type TXTResolver interface {
+	LookupTXTWithTTL(ctx context.Context, name string) ([]string, time.Duration, error)
+}
+
+// DNSLinkRecord is a TXT record found while checking a DNSLink.
+type DNSLinkRecord struct {
+	Text string
+	// Path is set on DNSLink records resolvers accept.
+	Path path.Path
+	// Err is set on DNSLink records resolvers reject.
+	Err error
+	// Ignored is set on TXT records that are not DNSLink records.
+	Ignored bool
+	// Warning notes a record that is accepted but should be fixed.
+	Warning string
+}
+
+// DNSLinkCheck is the state of the DNSLink of a domain, as resolvers see it.
+type DNSLinkCheck struct {
+	Domain string
+	// Lookup is the name whose TXT records are queried.
+	Lookup  string
+	Records []DNSLinkRecord
+	// TTL of the TXT records, zero when the resolver does not report it.
+	TTL time.Duration
+	// Value is the DNSLink value, set when exactly one valid record exists.
+	Value path.Path
+	// Err tells why the domain does not resolve.
+	Err error
+	// Hints are problems worth fixing that do not prevent resolution.
+	Hints []string
+}
+
+// Changed reports whether the records or the value of the DNSLink differ
+// between c and prev.
+func (c *DNSLinkCheck) Changed(prev *DNSLinkCheck) bool {
+	if prev == nil || errString(c.Err) != errString(prev.Err) {
+		return true
+	}
+	if (c.Value == nil) != (prev.Value == nil) || (c.Value != nil && c.Value.String() != prev.Value.String()) {
+		return true
+	}
+	return !slices.EqualFunc(c.Records, prev.Records, func(a, b DNSLinkRecord) bool {
+		return a.Text == b.Text
+	})
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// CheckDNSLink looks up the DNSLink of domain with r the way the name system
+// does, and reports every TXT record found, why records are rejected, and
+// the value they resolve to.
+func CheckDNSLink(ctx context.Context, r TXTResolver, domain string) *DNSLinkCheck {
+	domain = strings.TrimSuffix(strings.TrimPrefix(domain, "/ipns/"), ".")
+	c := &DNSLinkCheck{
+		Domain: domain,
+		Lookup: "_dnslink." + domain,
+	}
+	if _, ok := dns.IsDomainName(domain); !ok || domain == "" {
+		c.Err = fmt.Errorf("not a valid domain name: %q", domain)
+		return c
+	}
+
+	txt, ttl, err := r.LookupTXTWithTTL(ctx, c.Lookup)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		err = nil
+	}
+	if err != nil {
+		c.Err = fmt.Errorf("TXT lookup of %s failed: %w", c.Lookup, err)
+		return c
+	}
+	c.TTL = ttl
+
+	var valid []path.Path
+	for _, t := range txt {
+		rec := parseDNSLinkRecord(t)
+		if rec.Path != nil {
+			valid = append(valid, rec.Path)
+		}
+		c.Records = append(c.Records, rec)
+	}
+
+	switch len(valid) {
+	case 1:
+		c.Value = valid[0]
+	case 0:
+		c.Err = namesys.ErrMissingDNSLinkRecord
+		// DNSLink records on the domain itself are no longer resolved
+		if txt, _, err := r.LookupTXTWithTTL(ctx, domain); err == nil {
+			for _, t := range txt {
+				if strings.HasPrefix(strings.TrimSpace(t), "dnslink=") {
+					c.Hints = append(c.Hints, fmt.Sprintf("%s has a DNSLink record, which is not used: move it to %s", domain, c.Lookup))
+					break
+				}
+			}
+		}
+	default:
+		c.Err = namesys.ErrMultipleDNSLinkRecords
+	}
+	return c
+}
+
+// parseDNSLinkRecord applies the rules of the DNSLink resolver of namesys to
+// a single TXT record, explaining rejections.
+func parseDNSLinkRecord(txt string) DNSLinkRecord {
+	rec := DNSLinkRecord{Text: txt}
+	value, ok := strings.CutPrefix(txt, "dnslink=")
+	if !ok {
+		trimmed := strings.TrimSpace(txt)
+		switch {
+		case strings.HasPrefix(trimmed, "dnslink="):
+			rec.Err = errors.New("whitespace around the record")
+		case strings.HasPrefix(strings.ToLower(trimmed), "dnslink="):
+			rec.Err = errors.New(`the "dnslink=" prefix must be lowercase`)
+		default:
+			// a bare path or CID is still accepted
+			if p, err := path.NewPath(txt); err == nil {
+				rec.Path = p
+				rec.Warning = `missing "dnslink=" prefix`
+			} else if c, err := cid.Decode(txt); err == nil {
+				rec.Path = path.FromCid(c)
+				rec.Warning = fmt.Sprintf(`legacy record, use "dnslink=%s"`, rec.Path)
+			} else {
+				rec.Ignored = true
+			}
+		}
+		if rec.Path != nil && !supportedNamespace(rec.Path) {
+			rec.Path, rec.Warning = nil, ""
+			rec.Ignored = true
+		}
+		return rec
+	}
+
+	p, err := path.NewPath(value)
+	if err != nil {
+		c, cidErr := cid.Decode(value)
+		if cidErr != nil {
+			rec.Err = fmt.Errorf("invalid value: %w", err)
+			return rec
+		}
+		p = path.FromCid(c)
+		rec.Warning = fmt.Sprintf(`legacy record, use "dnslink=%s"`, p)
+	}
+	if !supportedNamespace(p) {
+		rec.Err = fmt.Errorf("unsupported namespace %q, only /ipfs and /ipns are resolved", p.Namespace())
+		return rec
+	}
+	rec.Path = p
+	return rec
+}
+
+func supportedNamespace(p path.Path) bool {
+	return p.Namespace() == path.IPFSNamespace || p.Namespace() == path.IPNSNamespace
+}
+
+// DNSResolverFor returns the URL of the resolver of resolvers, as set in
+// DNS.Resolvers, that answers queries for name, and the domain it is set
+// for. Both are empty when name is resolved by the system resolver.
+func DNSResolverFor(resolvers map[string]string, name string) (string, string) {
+	fqdn := dns.Fqdn(name)
+	var domain string
+	for d := range resolvers {
+		if (d == "." || dns.IsSubDomain(d, fqdn)) && len(d) > len(domain) {
+			domain = d
+		}
+	}
+	if resolvers[domain] == "" {
+		return "", ""
+	}
+	return resolvers[domain], domain
+}
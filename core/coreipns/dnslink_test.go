@@ -0,0 +1,90 @@
+package coreipns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/namesys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTXTResolver map[string][]string
+
+func (r mockTXTResolver) LookupTXTWithTTL(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, ok := r[name]
+	if !ok {
+		return nil, 0, &net.DNSError{IsNotFound: true, Name: name}
+	}
+	return txt, 5 * time.Minute, nil
+}
+
+func TestCheckDNSLink(t *testing.T) {
+	const target = "/ipfs/bafkqaaa"
+	r := mockTXTResolver{
+		"_dnslink.ok.example":       {"v=spf1 -all", "dnslink=" + target},
+		"_dnslink.multiple.example": {"dnslink=" + target, "dnslink=/ipns/ok.example"},
+		"_dnslink.broken.example":   {"dnslink=/ipfs/notacid", " dnslink=" + target, "DNSLink=" + target, "dnslink=/foo/bar"},
+		"_dnslink.legacy.example":   {"bafkqaaa"},
+		"apex.example":              {"dnslink=" + target},
+	}
+	ctx := t.Context()
+
+	c := CheckDNSLink(ctx, r, "/ipns/ok.example.")
+	require.NoError(t, c.Err)
+	assert.Equal(t, "_dnslink.ok.example", c.Lookup)
+	assert.Equal(t, target, c.Value.String())
+	assert.Equal(t, 5*time.Minute, c.TTL)
+	require.Len(t, c.Records, 2)
+	assert.True(t, c.Records[0].Ignored)
+	assert.NoError(t, c.Records[1].Err)
+
+	c = CheckDNSLink(ctx, r, "multiple.example")
+	assert.ErrorIs(t, c.Err, namesys.ErrMultipleDNSLinkRecords)
+	assert.Nil(t, c.Value)
+
+	c = CheckDNSLink(ctx, r, "broken.example")
+	assert.ErrorIs(t, c.Err, namesys.ErrMissingDNSLinkRecord)
+	require.Len(t, c.Records, 4)
+	for _, rec := range c.Records {
+		assert.Error(t, rec.Err, rec.Text)
+		assert.Nil(t, rec.Path, rec.Text)
+	}
+
+	c = CheckDNSLink(ctx, r, "legacy.example")
+	require.NoError(t, c.Err)
+	assert.Equal(t, target, c.Value.String())
+	assert.Contains(t, c.Records[0].Warning, "legacy record")
+
+	c = CheckDNSLink(ctx, r, "apex.example")
+	assert.ErrorIs(t, c.Err, namesys.ErrMissingDNSLinkRecord)
+	require.Len(t, c.Hints, 1)
+	assert.Contains(t, c.Hints[0], "move it to _dnslink.apex.example")
+
+	prev := CheckDNSLink(ctx, r, "ok.example")
+	assert.False(t, CheckDNSLink(ctx, r, "ok.example").Changed(prev))
+	r["_dnslink.ok.example"] = []string{"dnslink=/ipns/ok.example"}
+	assert.True(t, CheckDNSLink(ctx, r, "ok.example").Changed(prev))
+}
+
+func TestDNSResolverFor(t *testing.T) {
+	resolvers := map[string]string{
+		".":            "https://default.example/dns-query",
+		"eth.":         "https://eth.example/dns-query",
+		"sub.example.": "",
+	}
+	url, domain := DNSResolverFor(resolvers, "_dnslink.vitalik.eth")
+	assert.Equal(t, "https://eth.example/dns-query", url)
+	assert.Equal(t, "eth.", domain)
+
+	url, domain = DNSResolverFor(resolvers, "_dnslink.example.com")
+	assert.Equal(t, "https://default.example/dns-query", url)
+	assert.Equal(t, ".", domain)
+
+	url, _ = DNSResolverFor(resolvers, "_dnslink.sub.example")
+	assert.Empty(t, url)
+	url, _ = DNSResolverFor(nil, "example.com")
+	assert.Empty(t, url)
+}
@@ -0,0 +1,489 @@
+// Package coreipns implements node-level IPNS features built on top of
+// boxo's namesys, such as the per-key republisher behind
+// 'ipfs name republish'.
+package coreipns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/namesys/republisher"
+	"github.com/ipfs/boxo/path"
+	util "github.com/ipfs/boxo/util"
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var log = logging.Logger("coreipns")
+
+// RepublisherPrefix is the datastore prefix under which the republisher
+// records the state of each key, one entry per keystore key name.
+var RepublisherPrefix = datastore.NewKey("/local/ipns-republisher")
+
+// SelfKeyName is the name of the node identity key.
+const SelfKeyName = "self"
+
+// RepublishCheckInterval is how often the republisher looks for records
+// that are due. It is shortened to the smallest republish period when that is
+// shorter.
+var RepublishCheckInterval = time.Minute
+
+var (
+	ErrKeyNotFound = errors.New("no key by the given name was found")
+	ErrNoRecord    = errors.New("no IPNS record has been published with this key yet")
+)
+
+// RepublishSettings are the republish period and record lifetime used for
+// each key.
+type RepublishSettings struct {
+	Interval       time.Duration
+	RecordLifetime time.Duration
+	// Keys holds per-key overrides, by key name. Zero fields use the
+	// defaults above.
+	Keys map[string]KeyRepublishSettings
+}
+
+// KeyRepublishSettings overrides RepublishSettings for a single key.
+type KeyRepublishSettings struct {
+	Interval       time.Duration
+	RecordLifetime time.Duration
+}
+
+// RepublishSettingsFromConfig parses and validates the republisher settings
+// of the Ipns config section.
+func RepublishSettingsFromConfig(cfg *config.Ipns) (RepublishSettings, error) {
+	s := RepublishSettings{
+		Interval:       republisher.DefaultRebroadcastInterval,
+		RecordLifetime: republisher.DefaultRecordLifetime,
+	}
+	if cfg.RepublishPeriod != "" {
+		d, err := time.ParseDuration(cfg.RepublishPeriod)
+		if err != nil {
+			return s, fmt.Errorf("failure to parse config setting IPNS.RepublishPeriod: %s", err)
+		}
+		if err := checkRepublishPeriod("IPNS.RepublishPeriod", d); err != nil {
+			return s, err
+		}
+		s.Interval = d
+	}
+	if cfg.RecordLifetime != "" {
+		d, err := time.ParseDuration(cfg.RecordLifetime)
+		if err != nil {
+			return s, fmt.Errorf("failure to parse config setting IPNS.RecordLifetime: %s", err)
+		}
+		s.RecordLifetime = d
+	}
+	if s.RecordLifetime < s.Interval {
+		return s, fmt.Errorf("config setting IPNS.RecordLifetime (%s) must be >= IPNS.RepublishPeriod (%s), otherwise records expire before they are republished", s.RecordLifetime, s.Interval)
+	}
+
+	if len(cfg.Keys) > 0 {
+		s.Keys = make(map[string]KeyRepublishSettings, len(cfg.Keys))
+	}
+	for name, k := range cfg.Keys {
+		ks := KeyRepublishSettings{
+			Interval:       k.RepublishPeriod.WithDefault(0),
+			RecordLifetime: k.RecordLifetime.WithDefault(0),
+		}
+		if ks.Interval != 0 {
+			if err := checkRepublishPeriod("IPNS.Keys."+name+".RepublishPeriod", ks.Interval); err != nil {
+				return s, err
+			}
+		}
+		s.Keys[name] = ks
+		if interval, lifetime := s.For(name); lifetime < interval {
+			return s, fmt.Errorf("record lifetime of key %q (%s) must be >= its republish period (%s), otherwise records expire before they are republished", name, lifetime, interval)
+		}
+	}
+	return s, nil
+}
+
+func checkRepublishPeriod(setting string, d time.Duration) error {
+	if !util.Debug && (d < time.Minute || d > (time.Hour*24)) {
+		return fmt.Errorf("config setting %s is not between 1min and 1day: %s", setting, d)
+	}
+	return nil
+}
+
+// For returns the republish period and record lifetime of the named key.
+func (s RepublishSettings) For(name string) (interval, lifetime time.Duration) {
+	interval, lifetime = s.Interval, s.RecordLifetime
+	if k, ok := s.Keys[name]; ok {
+		if k.Interval != 0 {
+			interval = k.Interval
+		}
+		if k.RecordLifetime != 0 {
+			lifetime = k.RecordLifetime
+		}
+	}
+	return interval, lifetime
+}
+
+// shortest returns the smallest republish period of all keys.
+func (s RepublishSettings) shortest() time.Duration {
+	d := s.Interval
+	for _, k := range s.Keys {
+		if k.Interval != 0 && k.Interval < d {
+			d = k.Interval
+		}
+	}
+	return d
+}
+
+// KeyState is the republisher state of a key, kept across restarts.
+type KeyState struct {
+	Key    string
+	Paused bool `json:",omitempty"`
+	// LastAttempt is when the record was last republished or tried to be,
+	// LastRepublished when that last succeeded.
+	LastAttempt     time.Time `json:",omitzero"`
+	LastRepublished time.Time `json:",omitzero"`
+	// Error is the reason the last attempt failed, if it did.
+	Error string `json:",omitempty"`
+}
+
+// stateMu serializes updates of key states, which happen both in the
+// republisher and in commands pausing and resuming keys.
+var stateMu sync.Mutex
+
+func stateKey(name string) datastore.Key {
+	return RepublisherPrefix.ChildString(name)
+}
+
+func getKeyState(ctx context.Context, ds datastore.Datastore, name string) (*KeyState, error) {
+	data, err := ds.Get(ctx, stateKey(name))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return &KeyState{Key: name}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var st KeyState
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Errorf("ignoring undecodable republisher state of key %q: %s", name, err)
+		return &KeyState{Key: name}, nil
+	}
+	return &st, nil
+}
+
+// updateKeyState applies fn to the state of the named key and stores it.
+func updateKeyState(ctx context.Context, ds datastore.Datastore, name string, fn func(*KeyState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st, err := getKeyState(ctx, ds, name)
+	if err != nil {
+		return err
+	}
+	fn(st)
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return ds.Put(ctx, stateKey(name), data)
+}
+
+// SetPaused pauses or resumes the republishing of the record of the named
+// key. The state is kept across restarts.
+func SetPaused(ctx context.Context, ds datastore.Datastore, ks keystore.Keystore, name string, paused bool) error {
+	if _, err := getPrivKey(ks, nil, name); err != nil && !errors.Is(err, errSelfUnknown) {
+		return err
+	}
+	return updateKeyState(ctx, ds, name, func(st *KeyState) {
+		st.Paused = paused
+	})
+}
+
+var errSelfUnknown = errors.New("self key not available")
+
+func getPrivKey(ks keystore.Keystore, self crypto.PrivKey, name string) (crypto.PrivKey, error) {
+	if name == SelfKeyName {
+		if self == nil {
+			return nil, errSelfUnknown
+		}
+		return self, nil
+	}
+	if ks == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	priv, err := ks.Get(name)
+	if errors.Is(err, keystore.ErrNoSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	return priv, err
+}
+
+// KeyStatus is the republisher state of a key along with its settings and
+// the record currently published with it.
+type KeyStatus struct {
+	KeyState
+	ID             peer.ID
+	Interval       time.Duration
+	RecordLifetime time.Duration
+
+	// HasRecord is false if nothing was published with the key yet, in
+	// which case there is nothing to republish.
+	HasRecord bool
+	Value     path.Path
+	Sequence  uint64
+	Expiry    time.Time
+
+	// Next is when the record is due to be republished, if it is not
+	// paused.
+	Next time.Time
+}
+
+// Republisher periodically republishes the IPNS records of all keys in the
+// keystore, like boxo's republisher, but with per-key settings and state:
+// keys can be paused, republished on demand, and their last attempt is
+// recorded.
+type Republisher struct {
+	ns       namesys.Publisher
+	ds       datastore.Datastore
+	self     crypto.PrivKey
+	ks       keystore.Keystore
+	settings RepublishSettings
+
+	now chan republishRequest
+}
+
+type republishRequest struct {
+	name string
+	done chan error
+}
+
+// NewRepublisher creates a Republisher. It does nothing until Run is called.
+func NewRepublisher(ns namesys.Publisher, ds datastore.Datastore, self crypto.PrivKey, ks keystore.Keystore, settings RepublishSettings) *Republisher {
+	return &Republisher{
+		ns:       ns,
+		ds:       ds,
+		self:     self,
+		ks:       ks,
+		settings: settings,
+		now:      make(chan republishRequest),
+	}
+}
+
+// Run starts the republisher. It can be stopped by calling the returned
+// function.
+func (rp *Republisher) Run() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go rp.run(ctx)
+	return func() {
+		log.Debug("stopping republisher")
+		cancel()
+	}
+}
+
+func (rp *Republisher) run(ctx context.Context) {
+	check := min(RepublishCheckInterval, rp.settings.shortest())
+	timer := time.NewTimer(min(republisher.InitialRebroadcastDelay, check))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			rp.republishDue(ctx, time.Now())
+			timer.Reset(check)
+		case req := <-rp.now:
+			req.done <- rp.republish(ctx, req.name, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// keyNames returns the names of all keys, self first.
+func (rp *Republisher) keyNames() ([]string, error) {
+	names := []string{SelfKeyName}
+	if rp.ks != nil {
+		others, err := rp.ks.List()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, others...)
+	}
+	return names, nil
+}
+
+// republishDue republishes the records that are due at now.
+func (rp *Republisher) republishDue(ctx context.Context, now time.Time) {
+	names, err := rp.keyNames()
+	if err != nil {
+		log.Errorf("republisher failed to list keys: %s", err)
+		return
+	}
+	for _, name := range names {
+		st, err := getKeyState(ctx, rp.ds, name)
+		if err != nil {
+			log.Errorf("republisher failed to read state of key %q: %s", name, err)
+			continue
+		}
+		if st.Paused || now.Before(rp.next(st)) {
+			continue
+		}
+		err = rp.republish(ctx, name, now)
+		if err != nil && !errors.Is(err, ErrNoRecord) {
+			log.Infof("republisher failed to republish key %q: %s", name, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next returns when the record of a key is due, given its state.
+func (rp *Republisher) next(st *KeyState) time.Time {
+	if st.LastAttempt.IsZero() {
+		return time.Time{}
+	}
+	interval, _ := rp.settings.For(st.Key)
+	if st.Error != "" {
+		interval = min(interval, republisher.FailureRetryInterval)
+	}
+	return st.LastAttempt.Add(interval)
+}
+
+// republish publishes the last record of the named key again, with the same
+// value and sequence number and a renewed validity.
+func (rp *Republisher) republish(ctx context.Context, name string, now time.Time) error {
+	priv, err := getPrivKey(rp.ks, rp.self, name)
+	if err != nil {
+		return err
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	rec, err := getLocalRecord(ctx, rp.ds, id)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return ErrNoRecord
+	}
+	value, err := rec.Value()
+	if err != nil {
+		return err
+	}
+	prevEol, err := rec.Validity()
+	if err != nil {
+		return err
+	}
+
+	_, lifetime := rp.settings.For(name)
+	eol := now.Add(lifetime)
+	if prevEol.After(eol) {
+		eol = prevEol
+	}
+	log.Debugf("republishing ipns entry of key %q (%s)", name, id)
+	pubErr := rp.ns.Publish(ctx, priv, value, namesys.PublishWithEOL(eol))
+	if pubErr != nil && ctx.Err() != nil {
+		return pubErr
+	}
+
+	err = updateKeyState(ctx, rp.ds, name, func(st *KeyState) {
+		st.LastAttempt = now.UTC()
+		if pubErr != nil {
+			st.Error = pubErr.Error()
+			return
+		}
+		st.LastRepublished = st.LastAttempt
+		st.Error = ""
+	})
+	if pubErr != nil {
+		return pubErr
+	}
+	return err
+}
+
+// RepublishNow republishes the record of the named key right away, even if
+// it is paused, and returns the outcome.
+func (rp *Republisher) RepublishNow(ctx context.Context, name string) error {
+	req := republishRequest{name: name, done: make(chan error, 1)}
+	select {
+	case rp.now <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the republisher status of all keys, self first.
+func (rp *Republisher) Status(ctx context.Context) ([]KeyStatus, error) {
+	return ListRepublishStatus(ctx, rp.ds, rp.self, rp.ks, rp.settings)
+}
+
+// ListRepublishStatus returns the republisher status of all keys, self
+// first, whether or not a republisher is running.
+func ListRepublishStatus(ctx context.Context, ds datastore.Datastore, self crypto.PrivKey, ks keystore.Keystore, settings RepublishSettings) ([]KeyStatus, error) {
+	rp := &Republisher{ds: ds, self: self, ks: ks, settings: settings}
+	names, err := rp.keyNames()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]KeyStatus, 0, len(names))
+	for _, name := range names {
+		priv, err := getPrivKey(rp.ks, rp.self, name)
+		if err != nil {
+			return nil, err
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		st, err := getKeyState(ctx, rp.ds, name)
+		if err != nil {
+			return nil, err
+		}
+		status := KeyStatus{KeyState: *st, ID: id}
+		status.Interval, status.RecordLifetime = rp.settings.For(name)
+
+		rec, err := getLocalRecord(ctx, rp.ds, id)
+		if err != nil {
+			return nil, err
+		}
+		if rec != nil {
+			status.HasRecord = true
+			if status.Value, err = rec.Value(); err != nil {
+				return nil, err
+			}
+			if status.Sequence, err = rec.Sequence(); err != nil {
+				return nil, err
+			}
+			if status.Expiry, err = rec.Validity(); err != nil {
+				return nil, err
+			}
+			if !st.Paused {
+				status.Next = rp.next(st)
+			}
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// getLocalRecord returns the last record published with the key id on this
+// node, or nil if there is none.
+func getLocalRecord(ctx context.Context, ds datastore.Datastore, id peer.ID) (*ipns.Record, error) {
+	val, err := ds.Get(ctx, namesys.IpnsDsKey(ipns.NameFromPeer(id)))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ipns.UnmarshalRecord(val)
+}
@@ -0,0 +1,149 @@
+package coreipns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/namesys/republisher"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher stores records in the datastore the way namesys does,
+// failing while err is set.
+type fakePublisher struct {
+	ds        datastore.Datastore
+	err       error
+	published int
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, sk crypto.PrivKey, value path.Path, options ...namesys.PublishOption) error {
+	if p.err != nil {
+		return p.err
+	}
+	opts := namesys.ProcessPublishOptions(options)
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	var seq uint64
+	if prev, err := getLocalRecord(ctx, p.ds, id); err != nil {
+		return err
+	} else if prev != nil {
+		if seq, err = prev.Sequence(); err != nil {
+			return err
+		}
+	}
+	rec, err := ipns.NewRecord(sk, value, seq, opts.EOL, opts.TTL)
+	if err != nil {
+		return err
+	}
+	data, err := ipns.MarshalRecord(rec)
+	if err != nil {
+		return err
+	}
+	p.published++
+	return p.ds.Put(ctx, namesys.IpnsDsKey(ipns.NameFromPeer(id)), data)
+}
+
+func TestRepublisher(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	ks := keystore.NewMemKeystore()
+	self, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	site, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	require.NoError(t, ks.Put("site", site))
+	unused, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	require.NoError(t, ks.Put("unused", unused))
+
+	settings, err := RepublishSettingsFromConfig(&config.Ipns{
+		Keys: map[string]config.IpnsKey{
+			"site": {RepublishPeriod: config.NewOptionalDuration(10 * time.Minute), RecordLifetime: config.NewOptionalDuration(time.Hour)},
+		},
+	})
+	require.NoError(t, err)
+	interval, lifetime := settings.For("site")
+	assert.Equal(t, 10*time.Minute, interval)
+	assert.Equal(t, time.Hour, lifetime)
+
+	pub := &fakePublisher{ds: ds}
+	siteID, err := peer.IDFromPrivateKey(site)
+	require.NoError(t, err)
+	value := path.FromCid(ipns.NameFromPeer(siteID).Cid())
+	now := time.Now()
+	require.NoError(t, pub.Publish(ctx, self, value, namesys.PublishWithEOL(now.Add(time.Minute))))
+	require.NoError(t, pub.Publish(ctx, site, value, namesys.PublishWithEOL(now.Add(time.Minute))))
+	pub.published = 0
+
+	rp := NewRepublisher(pub, ds, self, ks, settings)
+
+	// everything is due at first, keys without records are skipped
+	rp.republishDue(ctx, now)
+	assert.Equal(t, 2, pub.published)
+	statuses, err := rp.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	byKey := make(map[string]KeyStatus)
+	for _, st := range statuses {
+		byKey[st.Key] = st
+	}
+	assert.Equal(t, SelfKeyName, statuses[0].Key)
+	assert.False(t, byKey["unused"].HasRecord)
+	assert.True(t, byKey["site"].HasRecord)
+	assert.Equal(t, value.String(), byKey["site"].Value.String())
+	assert.WithinDuration(t, now.Add(time.Hour), byKey["site"].Expiry, time.Second)
+	assert.WithinDuration(t, now.Add(10*time.Minute), byKey["site"].Next, time.Second)
+	assert.WithinDuration(t, now.Add(settings.Interval), byKey[SelfKeyName].Next, time.Second)
+
+	// only the key with the shorter period is due again
+	rp.republishDue(ctx, now.Add(11*time.Minute))
+	assert.Equal(t, 3, pub.published)
+
+	// paused keys are not republished
+	require.NoError(t, SetPaused(ctx, ds, ks, "site", true))
+	rp.republishDue(ctx, now.Add(22*time.Minute))
+	assert.Equal(t, 3, pub.published)
+	require.NoError(t, SetPaused(ctx, ds, ks, "site", false))
+	assert.ErrorIs(t, SetPaused(ctx, ds, ks, "missing", true), ErrKeyNotFound)
+
+	// failures are recorded and retried sooner
+	pub.err = errors.New("no route")
+	rp.republishDue(ctx, now.Add(33*time.Minute))
+	st, err := getKeyState(ctx, ds, "site")
+	require.NoError(t, err)
+	assert.Equal(t, "no route", st.Error)
+	pub.err = nil
+	rp.republishDue(ctx, now.Add(33*time.Minute+republisher.FailureRetryInterval))
+	st, err = getKeyState(ctx, ds, "site")
+	require.NoError(t, err)
+	assert.Empty(t, st.Error)
+	assert.Equal(t, 4, pub.published)
+
+	assert.ErrorIs(t, rp.republish(ctx, "unused", now), ErrNoRecord)
+}
+
+func TestRepublishSettingsFromConfig(t *testing.T) {
+	_, err := RepublishSettingsFromConfig(&config.Ipns{RepublishPeriod: "1s"})
+	assert.ErrorContains(t, err, "IPNS.RepublishPeriod is not between 1min and 1day")
+
+	_, err = RepublishSettingsFromConfig(&config.Ipns{
+		Keys: map[string]config.IpnsKey{
+			"site": {RepublishPeriod: config.NewOptionalDuration(2 * time.Hour), RecordLifetime: config.NewOptionalDuration(time.Hour)},
+		},
+	})
+	assert.ErrorContains(t, err, `record lifetime of key "site"`)
+}
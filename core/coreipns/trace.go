@@ -0,0 +1,302 @@
+package coreipns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	irouting "github.com/ipfs/kubo/routing"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// nameTraceKey marks the context of a traced resolution, holding the
+// *routerTrace the namesys router reports to.
+type nameTraceKey struct{}
+
+// routerTrace records what the router of the name system returned during a
+// traced resolution.
+type routerTrace struct {
+	mu      sync.Mutex
+	queried bool
+	// last is the last record returned, the one the name system used.
+	last []byte
+}
+
+func (t *routerTrace) record(val []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = val
+}
+
+// NamesysValueStore wraps the router given to the name system of the node,
+// so that a traced resolution sees whether the name system queried it, and
+// the record it used: a name answered from the name system cache does not
+// reach the router.
+func NamesysValueStore(vs routing.ValueStore) routing.ValueStore {
+	return &namesysValueStore{vs}
+}
+
+type namesysValueStore struct {
+	routing.ValueStore
+}
+
+func (vs *namesysValueStore) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	t, _ := ctx.Value(nameTraceKey{}).(*routerTrace)
+	if t == nil {
+		return vs.ValueStore.GetValue(ctx, key, opts...)
+	}
+	t.mu.Lock()
+	t.queried = true
+	t.mu.Unlock()
+	val, err := vs.ValueStore.GetValue(ctx, key, opts...)
+	if err == nil {
+		t.record(val)
+	}
+	return val, err
+}
+
+func (vs *namesysValueStore) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	t, _ := ctx.Value(nameTraceKey{}).(*routerTrace)
+	if t == nil {
+		return vs.ValueStore.SearchValue(ctx, key, opts...)
+	}
+	t.mu.Lock()
+	t.queried = true
+	t.mu.Unlock()
+	vals, err := vs.ValueStore.SearchValue(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for val := range vals {
+			t.record(val)
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Trace resolves p with ns, emitting every step: the cache of ns (when cache
+// is set), DNSLink lookups, and for IPNS names the records held by each of
+// the sources rt is composed of, followed by the record ns used and why it
+// won. ns must query rt through NamesysValueStore. Sources are queried in
+// parallel with the resolution and their lookups emitted as they finish.
+func Trace(ctx context.Context, ns namesys.Resolver, rt routing.ValueStore, p path.Path, cache bool, emit func(*iface.NameTraceEvent), opts ...namesys.ResolveOption) (path.Path, error) {
+	options := namesys.ProcessResolveOptions(opts)
+	sources := irouting.ValueSources(rt)
+
+	for depth := options.Depth; p.Mutable(); depth-- {
+		if depth == 0 {
+			return p, namesys.ErrResolveRecursion
+		}
+		segments := p.Segments()
+		root, err := path.NewPathFromSegments(segments[0], segments[1])
+		if err != nil {
+			return nil, err
+		}
+
+		var value path.Path
+		if name, err := ipns.NameFromString(segments[1]); err == nil {
+			value, err = traceIPNS(ctx, ns, sources, name, cache, emit, opts)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value, err = traceDNSLink(ctx, ns, root, segments[1], emit)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		p, err = path.Join(value, segments[2:]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func traceDNSLink(ctx context.Context, ns namesys.Resolver, root path.Path, domain string, emit func(*iface.NameTraceEvent)) (path.Path, error) {
+	start := time.Now()
+	res, err := ns.Resolve(ctx, root, namesys.ResolveWithDepth(1))
+	ev := &iface.NameTraceEvent{
+		Type:     iface.NameTraceLookup,
+		Name:     domain,
+		Source:   "dnslink",
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if err == nil {
+		ev.Records = []iface.NameTraceRecord{{Source: "dnslink", Value: res.Path, TTL: res.TTL}}
+	}
+	emit(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	emit(&iface.NameTraceEvent{
+		Type:    iface.NameTraceResult,
+		Name:    domain,
+		Source:  "dnslink",
+		Records: ev.Records,
+		Reason:  "DNSLink TXT record",
+	})
+	return res.Path, nil
+}
+
+func traceIPNS(ctx context.Context, ns namesys.Resolver, sources []irouting.ValueSource, name ipns.Name, cache bool, emit func(*iface.NameTraceEvent), opts []namesys.ResolveOption) (path.Path, error) {
+	options := namesys.ProcessResolveOptions(opts)
+	results := make(chan *iface.NameTraceEvent, len(sources))
+	for _, src := range sources {
+		go func() {
+			results <- lookupRecord(ctx, src, name, options)
+		}()
+	}
+
+	t := &routerTrace{}
+	start := time.Now()
+	res, resErr := ns.Resolve(context.WithValue(ctx, nameTraceKey{}, t), name.AsPath(), append(slices.Clip(opts), namesys.ResolveWithDepth(1))...)
+	duration := time.Since(start)
+
+	var cached *iface.NameTraceRecord
+	if cache {
+		ev := &iface.NameTraceEvent{
+			Type:     iface.NameTraceLookup,
+			Name:     name.String(),
+			Source:   "cache",
+			Duration: duration,
+		}
+		if resErr == nil && !t.queried {
+			cached = &iface.NameTraceRecord{Source: "cache", Value: res.Path, TTL: res.TTL}
+			ev.Records = []iface.NameTraceRecord{*cached}
+		} else {
+			ev.Err = errors.New("not cached")
+		}
+		emit(ev)
+	}
+
+	// valid records, in the order they arrived
+	var valid []iface.NameTraceRecord
+	for range sources {
+		var ev *iface.NameTraceEvent
+		select {
+		case ev = <-results:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		emit(ev)
+		if len(ev.Records) > 0 && ev.Records[0].Err == nil {
+			valid = append(valid, ev.Records[0])
+		}
+	}
+
+	result := &iface.NameTraceEvent{
+		Type: iface.NameTraceResult,
+		Name: name.String(),
+	}
+	if resErr != nil {
+		result.Err = fmt.Errorf("%w: %w", iface.ErrResolveFailed, resErr)
+		emit(result)
+		return nil, result.Err
+	}
+	if cached != nil {
+		// the name system answers from its cache until the entry expires,
+		// whatever the sources hold now
+		result.Source = "cache"
+		result.Records = append([]iface.NameTraceRecord{*cached}, valid...)
+		result.Reason = fmt.Sprintf("cached entry has not expired (TTL %s), sources were not used; resolve with --nocache to bypass the cache", cached.TTL)
+		emit(result)
+		return cached.Value, nil
+	}
+
+	t.mu.Lock()
+	last := t.last
+	t.mu.Unlock()
+	used := iface.NameTraceRecord{Source: "routing", Value: res.Path, TTL: res.TTL}
+	if rec, err := ipns.UnmarshalRecord(last); err == nil {
+		used.Sequence, _ = rec.Sequence()
+		used.Validity, _ = rec.Validity()
+	}
+	// credit the source that holds the same record
+	others := valid
+	if i := slices.IndexFunc(valid, func(r iface.NameTraceRecord) bool {
+		return r.Sequence == used.Sequence && r.Validity.Equal(used.Validity)
+	}); i >= 0 {
+		used.Source = valid[i].Source
+		others = slices.Delete(slices.Clone(valid), i, i+1)
+	}
+	result.Source = used.Source
+	result.Records = append([]iface.NameTraceRecord{used}, others...)
+	result.Reason = winReason(used, others)
+	emit(result)
+	return res.Path, nil
+}
+
+// lookupRecord asks a single source for the record of name.
+func lookupRecord(ctx context.Context, src irouting.ValueSource, name ipns.Name, options namesys.ResolveOptions) *iface.NameTraceEvent {
+	if options.DhtTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.DhtTimeout)
+		defer cancel()
+	}
+
+	ev := &iface.NameTraceEvent{
+		Type:   iface.NameTraceLookup,
+		Name:   name.String(),
+		Source: src.Name,
+	}
+	start := time.Now()
+	data, err := src.GetValue(ctx, string(name.RoutingKey()), dht.Quorum(int(options.DhtRecordCount)))
+	ev.Duration = time.Since(start)
+	if err != nil {
+		ev.Err = err
+		return ev
+	}
+
+	rec, err := ipns.UnmarshalRecord(data)
+	if err != nil {
+		ev.Err = err
+		return ev
+	}
+	tr := iface.NameTraceRecord{Source: src.Name}
+	tr.Value, _ = rec.Value()
+	tr.Sequence, _ = rec.Sequence()
+	tr.Validity, _ = rec.Validity()
+	tr.TTL, _ = rec.TTL()
+	tr.Err = ipns.ValidateWithName(rec, name)
+	ev.Records = []iface.NameTraceRecord{tr}
+	return ev
+}
+
+// winReason explains why the name system preferred used over the other
+// valid records: the IPNS validator selects the highest sequence number,
+// then the latest validity.
+func winReason(used iface.NameTraceRecord, others []iface.NameTraceRecord) string {
+	if len(others) == 0 {
+		return "only valid record returned"
+	}
+	reason := "all sources returned the same record"
+	for _, o := range others {
+		switch {
+		case used.Sequence > o.Sequence:
+			return fmt.Sprintf("highest sequence number (%d)", used.Sequence)
+		case used.Sequence == o.Sequence && used.Validity.After(o.Validity):
+			reason = fmt.Sprintf("same sequence number (%d), latest validity (%s)", used.Sequence, used.Validity.Format(time.RFC3339))
+		}
+	}
+	return reason
+}
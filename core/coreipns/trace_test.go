@@ -0,0 +1,132 @@
+package coreipns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	offroute "github.com/ipfs/boxo/routing/offline"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	iface "github.com/ipfs/kubo/core/coreiface"
+	record "github.com/libp2p/go-libp2p-record"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	ctx := t.Context()
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(id)
+
+	validator := record.NamespacedValidator{"ipns": ipns.Validator{}}
+	newSource := func() routing.Routing {
+		return offroute.NewOfflineRouter(dssync.MutexWrap(datastore.NewMapDatastore()), validator)
+	}
+	stale, fresh := newSource(), newSource()
+	// the name system uses the first source to answer, make it the fresh one
+	rt := routinghelpers.Parallel{Routers: []routing.Routing{slowSearch{stale}, fresh, routinghelpers.Null{}}, Validator: validator}
+
+	put := func(r routing.Routing, value path.Path, seq uint64) {
+		rec, err := ipns.NewRecord(sk, value, seq, time.Now().Add(time.Hour), time.Minute)
+		require.NoError(t, err)
+		data, err := ipns.MarshalRecord(rec)
+		require.NoError(t, err)
+		require.NoError(t, r.PutValue(ctx, string(name.RoutingKey()), data))
+	}
+	oldValue := path.FromCid(name.Cid())
+	newValue, err := path.Join(oldValue, "new")
+	require.NoError(t, err)
+	put(stale, oldValue, 1)
+	put(fresh, newValue, 2)
+
+	ns, err := namesys.NewNameSystem(NamesysValueStore(rt), namesys.WithCache(8))
+	require.NoError(t, err)
+
+	trace := func() ([]*iface.NameTraceEvent, path.Path) {
+		var events []*iface.NameTraceEvent
+		p, err := Trace(ctx, ns, rt, name.AsPath(), true, func(ev *iface.NameTraceEvent) {
+			events = append(events, ev)
+		})
+		require.NoError(t, err)
+		return events, p
+	}
+
+	// nothing cached: the highest sequence number wins
+	events, p := trace()
+	assert.Equal(t, newValue.String(), p.String())
+	require.Len(t, events, 4)
+	assert.Equal(t, "cache", events[0].Source)
+	assert.Error(t, events[0].Err)
+	for _, ev := range events[1:3] {
+		assert.Equal(t, iface.NameTraceLookup, ev.Type)
+		require.Len(t, ev.Records, 1)
+	}
+	result := events[3]
+	assert.Equal(t, iface.NameTraceResult, result.Type)
+	assert.Equal(t, "local datastore", result.Source)
+	assert.Equal(t, "highest sequence number (2)", result.Reason)
+	require.Len(t, result.Records, 2)
+	assert.Equal(t, uint64(2), result.Records[0].Sequence)
+
+	// once resolved, the cache answers with whatever it holds
+	put(stale, newValue, 2)
+	res, err := ns.Resolve(ctx, name.AsPath())
+	require.NoError(t, err)
+	assert.Equal(t, newValue.String(), res.Path.String())
+	put(stale, oldValue, 3)
+	put(fresh, oldValue, 3)
+	events, p = trace()
+	assert.Equal(t, newValue.String(), p.String())
+	result = events[len(events)-1]
+	assert.Equal(t, "cache", result.Source)
+	assert.Contains(t, result.Reason, "cached entry has not expired")
+
+	// without the cache, the sources decide; the remainder of the path is kept
+	sub, err := path.Join(name.AsPath(), "sub")
+	require.NoError(t, err)
+	uncached, err := namesys.NewNameSystem(NamesysValueStore(rt))
+	require.NoError(t, err)
+	p, err = Trace(ctx, uncached, rt, sub, false, func(*iface.NameTraceEvent) {})
+	require.NoError(t, err)
+	assert.Equal(t, oldValue.String()+"/sub", p.String())
+}
+
+// slowSearch delays the records returned by SearchValue.
+type slowSearch struct {
+	routing.Routing
+}
+
+func (s slowSearch) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	vals, err := s.Routing.SearchValue(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+		for v := range vals {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,311 @@
+package coremfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/config"
+)
+
+// AutoPublishPrefix is the datastore prefix under which the state of
+// MFS.AutoPublish rules is recorded, one key per keystore key name.
+var AutoPublishPrefix = datastore.NewKey("/local/mfs-autopublish")
+
+// AutoPublishStatus is the last recorded state of an MFS.AutoPublish rule.
+type AutoPublishStatus struct {
+	Key  string
+	Path string
+
+	// Cid is the last CID published for Path, at time Published.
+	Cid       cid.Cid   `json:",omitzero"`
+	Published time.Time `json:",omitzero"`
+
+	// Pending is a new CID waiting for the debounce period to pass.
+	Pending cid.Cid `json:",omitzero"`
+
+	// Error is the reason the last attempt to publish failed, if it did.
+	Error string `json:",omitempty"`
+}
+
+func autoPublishKey(keyName string) datastore.Key {
+	return AutoPublishPrefix.ChildString(keyName)
+}
+
+func putAutoPublishStatus(ctx context.Context, ds datastore.Datastore, st *AutoPublishStatus) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return ds.Put(ctx, autoPublishKey(st.Key), data)
+}
+
+// ListAutoPublishStatus returns the recorded state of auto-publish rules,
+// by keystore key name.
+func ListAutoPublishStatus(ctx context.Context, ds datastore.Datastore) (map[string]*AutoPublishStatus, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: AutoPublishPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	out := make(map[string]*AutoPublishStatus)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var st AutoPublishStatus
+		if err := json.Unmarshal(r.Value, &st); err != nil {
+			log.Errorf("skipping undecodable auto-publish state %s: %s", r.Key, err)
+			continue
+		}
+		out[st.Key] = &st
+	}
+	return out, nil
+}
+
+// ValidateAutoPublishRules checks that rules have an absolute path and that
+// no two rules share a key.
+func ValidateAutoPublishRules(rules []config.MFSAutoPublishRule) error {
+	keys := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("MFS.AutoPublish: path %q must start with a leading slash", r.Path)
+		}
+		if r.Key == "" {
+			return fmt.Errorf("MFS.AutoPublish: rule for %q has no key", r.Path)
+		}
+		if _, ok := keys[r.Key]; ok {
+			return fmt.Errorf("MFS.AutoPublish: key %q is used by more than one rule", r.Key)
+		}
+		keys[r.Key] = struct{}{}
+	}
+	return nil
+}
+
+// RootFlushes passes the CID of the MFS root to its subscribers each time
+// the root is flushed and persisted. It is called from the MFS publish
+// function, so it never blocks: subscribers that fall behind only get the
+// latest CID.
+type RootFlushes struct {
+	mu   sync.Mutex
+	subs map[chan cid.Cid]struct{}
+}
+
+// Notify passes c to the subscribers.
+func (f *RootFlushes) Notify(c cid.Cid) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- c
+	}
+}
+
+// Subscribe returns a channel receiving the flushed roots until ctx is done.
+func (f *RootFlushes) Subscribe(ctx context.Context) <-chan cid.Cid {
+	ch := make(chan cid.Cid, 1)
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan cid.Cid]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+	})
+	return ch
+}
+
+// AutoPublisher publishes the CIDs of MFS subtrees to IPNS when they change,
+// following the MFS.AutoPublish rules.
+type AutoPublisher struct {
+	// Datastore records the state of each rule.
+	Datastore datastore.Datastore
+	// DAG is used to resolve rule paths from the MFS root. It should not
+	// fetch from the network: flushed MFS content is always local.
+	DAG ipld.DAGService
+	// Root returns the CID of the last flushed MFS root, which is checked
+	// when Run starts.
+	Root func(ctx context.Context) (cid.Cid, error)
+	// Flushes receives the CID of the MFS root each time it is flushed.
+	Flushes <-chan cid.Cid
+	// Config returns the current config, so rules can change at runtime.
+	Config func() (*config.Config, error)
+	// Publish publishes c under the named keystore key.
+	Publish func(ctx context.Context, keyName string, c cid.Cid) error
+
+	pending map[string]*pendingPublish
+}
+
+// pendingPublish tracks a subtree CID waiting for its debounce period.
+type pendingPublish struct {
+	cid   cid.Cid
+	since time.Time
+}
+
+// Run checks the rules each time the MFS root is flushed, and again when
+// the debounce period of a pending change ends, until ctx is done.
+func (ap *AutoPublisher) Run(ctx context.Context) {
+	root, err := ap.Root(ctx)
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		log.Errorf("MFS auto-publish: reading MFS root: %s", err)
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case root = <-ap.Flushes:
+		case <-timer.C:
+		}
+		if !root.Defined() {
+			continue
+		}
+		wait, err := ap.Check(ctx, root, time.Now())
+		if err != nil {
+			log.Errorf("MFS auto-publish: %s", err)
+		}
+		timer.Stop()
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+	}
+}
+
+// Check compares each rule's subtree CID in the MFS root with the last
+// published one, and publishes those that have been stable for their
+// debounce period. It returns how long until the debounce period of the
+// next pending change ends, 0 when no change is pending.
+func (ap *AutoPublisher) Check(ctx context.Context, root cid.Cid, now time.Time) (time.Duration, error) {
+	cfg, err := ap.Config()
+	if err != nil {
+		return 0, err
+	}
+	rules := cfg.MFS.AutoPublish
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	if err := ValidateAutoPublishRules(rules); err != nil {
+		return 0, err
+	}
+	if ap.pending == nil {
+		ap.pending = make(map[string]*pendingPublish)
+	}
+
+	statuses, err := ListAutoPublishStatus(ctx, ap.Datastore)
+	if err != nil {
+		return 0, err
+	}
+
+	var next time.Duration
+	for _, rule := range rules {
+		st := statuses[rule.Key]
+		if st == nil || st.Path != rule.Path {
+			st = &AutoPublishStatus{Key: rule.Key, Path: rule.Path}
+		}
+		if err := ap.checkRule(ctx, now, root, rule, st); err != nil {
+			return 0, err
+		}
+		if p := ap.pending[rule.Key]; p != nil {
+			wait := p.since.Add(rule.Debounce.WithDefault(config.DefaultMFSAutoPublishDebounce)).Sub(now)
+			if next == 0 || wait < next {
+				next = max(wait, time.Millisecond)
+			}
+		}
+	}
+	return next, nil
+}
+
+func (ap *AutoPublisher) checkRule(ctx context.Context, now time.Time, root cid.Cid, rule config.MFSAutoPublishRule, st *AutoPublishStatus) error {
+	c, err := resolveMFSPath(ctx, ap.DAG, root, rule.Path)
+	if err != nil {
+		delete(ap.pending, rule.Key)
+		msg := fmt.Sprintf("resolving %s: %s", rule.Path, err)
+		if st.Error == msg {
+			return nil
+		}
+		st.Error = msg
+		st.Pending = cid.Undef
+		return putAutoPublishStatus(ctx, ap.Datastore, st)
+	}
+	if c.Equals(st.Cid) && st.Error == "" {
+		delete(ap.pending, rule.Key)
+		return nil
+	}
+
+	p := ap.pending[rule.Key]
+	if p == nil || !p.cid.Equals(c) {
+		p = &pendingPublish{cid: c, since: now}
+		ap.pending[rule.Key] = p
+		st.Pending = c
+		if err := putAutoPublishStatus(ctx, ap.Datastore, st); err != nil {
+			return err
+		}
+	}
+	if now.Sub(p.since) < rule.Debounce.WithDefault(config.DefaultMFSAutoPublishDebounce) {
+		return nil
+	}
+
+	if err := ap.Publish(ctx, rule.Key, c); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Errorf("MFS auto-publish of %s under key %q: %s", rule.Path, rule.Key, err)
+		st.Error = err.Error()
+		// wait for another debounce period before retrying
+		p.since = now
+		return putAutoPublishStatus(ctx, ap.Datastore, st)
+	}
+
+	log.Infof("MFS auto-publish: published %s (%s) under key %q", rule.Path, c, rule.Key)
+	delete(ap.pending, rule.Key)
+	st.Cid = c
+	st.Published = now.UTC()
+	st.Pending = cid.Undef
+	st.Error = ""
+	return putAutoPublishStatus(ctx, ap.Datastore, st)
+}
+
+// resolveMFSPath returns the CID of the entry at the absolute path p in the
+// UnixFS tree rooted at root.
+func resolveMFSPath(ctx context.Context, dserv ipld.DAGService, root cid.Cid, p string) (cid.Cid, error) {
+	c := root
+	for name := range strings.SplitSeq(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			return cid.Undef, err
+		}
+		dir, err := uio.NewDirectoryFromNode(dserv, nd)
+		if err != nil {
+			if errors.Is(err, uio.ErrNotADir) {
+				return cid.Undef, fmt.Errorf("cannot look up %q: parent is not a directory", name)
+			}
+			return cid.Undef, err
+		}
+		child, err := dir.Find(ctx, name)
+		if err != nil {
+			return cid.Undef, err
+		}
+		c = child.Cid()
+	}
+	return c, nil
+}
@@ -0,0 +1,142 @@
+package coremfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoPublisher(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	dserv := mdtest.Mock()
+
+	root, err := mfs.NewEmptyRoot(ctx, dserv, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, mfs.Mkdir(root, "/www/site", mfs.MkdirOpts{Mkparents: true}))
+	putFile := func(p, data string) {
+		nd := dag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+		require.NoError(t, dserv.Add(ctx, nd))
+		require.NoError(t, mfs.PutNode(root, p, nd))
+	}
+	siteCid := func() cid.Cid {
+		fsn, err := mfs.Lookup(root, "/www/site")
+		require.NoError(t, err)
+		nd, err := fsn.GetNode()
+		require.NoError(t, err)
+		return nd.Cid()
+	}
+
+	cfg := &config.Config{}
+	cfg.MFS.AutoPublish = []config.MFSAutoPublishRule{
+		{Path: "/www/site", Key: "site", Debounce: config.NewOptionalDuration(10 * time.Second)},
+	}
+	var published []cid.Cid
+	var publishErr error
+	ap := &AutoPublisher{
+		Datastore: ds,
+		DAG:       dserv,
+		Config:    func() (*config.Config, error) { return cfg, nil },
+		Publish: func(_ context.Context, keyName string, c cid.Cid) error {
+			assert.Equal(t, "site", keyName)
+			if publishErr != nil {
+				return publishErr
+			}
+			published = append(published, c)
+			return nil
+		},
+	}
+	check := func(now time.Time) time.Duration {
+		nd, err := root.GetDirectory().GetNode()
+		require.NoError(t, err)
+		wait, err := ap.Check(ctx, nd.Cid(), now)
+		require.NoError(t, err)
+		return wait
+	}
+	status := func() *AutoPublishStatus {
+		all, err := ListAutoPublishStatus(ctx, ds)
+		require.NoError(t, err)
+		return all["site"]
+	}
+
+	start := time.Now()
+	putFile("/www/site/index.html", "v1")
+	assert.Equal(t, 10*time.Second, check(start))
+	assert.Empty(t, published, "debounced")
+	assert.Equal(t, siteCid(), status().Pending)
+
+	assert.Zero(t, check(start.Add(10*time.Second)))
+	require.Equal(t, []cid.Cid{siteCid()}, published)
+	assert.Equal(t, siteCid(), status().Cid)
+	assert.False(t, status().Pending.Defined())
+
+	// unchanged subtree, unrelated change elsewhere in MFS
+	putFile("/other", "x")
+	assert.Zero(t, check(start.Add(30*time.Second)))
+	assert.Len(t, published, 1)
+
+	// a change restarts the debounce period
+	putFile("/www/site/about.html", "about")
+	check(start.Add(40 * time.Second))
+	putFile("/www/site/contact.html", "contact")
+	assert.Equal(t, 10*time.Second, check(start.Add(45*time.Second)))
+	assert.Equal(t, 5*time.Second, check(start.Add(50*time.Second)))
+	assert.Len(t, published, 1)
+
+	publishErr = errors.New("no route")
+	assert.Equal(t, 10*time.Second, check(start.Add(55*time.Second)))
+	assert.Equal(t, "no route", status().Error)
+
+	publishErr = nil
+	check(start.Add(60 * time.Second))
+	assert.Len(t, published, 1, "retries wait for another debounce period")
+	assert.Zero(t, check(start.Add(65*time.Second)))
+	require.Len(t, published, 2)
+	assert.Equal(t, siteCid(), published[1])
+	assert.Empty(t, status().Error)
+}
+
+func TestRootFlushes(t *testing.T) {
+	var flushes RootFlushes
+	ctx, cancel := context.WithCancel(t.Context())
+	ch := flushes.Subscribe(ctx)
+
+	a, b := ft.EmptyDirNode().Cid(), dag.NodeWithData([]byte("b")).Cid()
+	flushes.Notify(a)
+	flushes.Notify(b)
+	assert.Equal(t, b, <-ch, "only the latest root is kept")
+
+	cancel()
+	require.Eventually(t, func() bool {
+		flushes.mu.Lock()
+		defer flushes.mu.Unlock()
+		return len(flushes.subs) == 0
+	}, time.Second, 10*time.Millisecond)
+	flushes.Notify(a)
+}
+
+func TestValidateAutoPublishRules(t *testing.T) {
+	assert.NoError(t, ValidateAutoPublishRules([]config.MFSAutoPublishRule{
+		{Path: "/a", Key: "a"},
+		{Path: "/b", Key: "b"},
+	}))
+	assert.ErrorContains(t, ValidateAutoPublishRules([]config.MFSAutoPublishRule{
+		{Path: "/a", Key: "k"},
+		{Path: "/b", Key: "k"},
+	}), "more than one rule")
+	assert.ErrorContains(t, ValidateAutoPublishRules([]config.MFSAutoPublishRule{
+		{Path: "a", Key: "k"},
+	}), "leading slash")
+}
@@ -0,0 +1,431 @@
+package coremfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	gopath "path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/filestore"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// JournalPrefix is the datastore prefix of the MFS journal, which records
+// changes that are not part of the persisted MFS root yet, one key per entry.
+var JournalPrefix = datastore.NewKey("/local/filesroot-journal")
+
+// RecoveryKey is the datastore key under which the last replay of the MFS
+// journal is recorded.
+var RecoveryKey = datastore.NewKey("/local/filesroot-recovery")
+
+// Journal entry operations.
+const (
+	// JournalOpPut sets the entry at Path to the node Cid, replacing any
+	// existing entry and creating missing parent directories.
+	JournalOpPut = "put"
+	// JournalOpRm removes the entry at Path, if any.
+	JournalOpRm = "rm"
+	// JournalOpWrite writes Data at Offset in the file at Path.
+	JournalOpWrite = "write"
+	// JournalOpTruncate truncates the file at Path to Size bytes.
+	JournalOpTruncate = "truncate"
+)
+
+// JournalEntry is a single change recorded in the MFS journal. Entries are
+// idempotent, so replaying one whose change was already persisted is
+// harmless.
+type JournalEntry struct {
+	Op     string
+	Path   string
+	Cid    cid.Cid `json:",omitzero"`
+	Offset int64   `json:",omitempty"`
+	Size   int64   `json:",omitempty"`
+	Data   []byte  `json:",omitempty"`
+}
+
+// Recovery describes a replay of the MFS journal at startup.
+type Recovery struct {
+	Time time.Time
+	// Entries is the number of journal entries replayed, Failed how many
+	// of them could not be applied.
+	Entries int
+	Failed  int `json:",omitempty"`
+	// Root is the MFS root after the replay.
+	Root cid.Cid
+}
+
+// Journal is a write-ahead log of MFS changes that only live in memory until
+// the MFS root is flushed and persisted: unflushed 'ipfs files' operations
+// and writes to files open through the FUSE mount. Entries are pruned once
+// the persisted root includes them, and replayed onto the persisted root by
+// Replay after a crash.
+type Journal struct {
+	ds      datastore.Datastore
+	enabled bool
+
+	mu sync.Mutex
+	// next is the sequence number of the next entry, pruned the first one
+	// that has not been pruned yet.
+	next, pruned uint64
+	// holds counts writers with changes recorded in the journal but not
+	// applied to the MFS tree yet.
+	holds int
+}
+
+// OpenJournal opens the journal stored in ds. A disabled journal does not
+// record anything, but entries left by a previous run can still be replayed.
+func OpenJournal(ctx context.Context, ds datastore.Datastore, enabled bool) (*Journal, error) {
+	j := &Journal{ds: ds, enabled: enabled}
+	first := true
+	err := j.forEach(ctx, func(seq uint64, _ *JournalEntry) error {
+		if first {
+			j.pruned = seq
+			first = false
+		}
+		j.next = seq + 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		j.pruned = j.next
+	}
+	return j, nil
+}
+
+func journalKey(seq uint64) datastore.Key {
+	// zero-padded so that entries sort in sequence order
+	return JournalPrefix.ChildString(fmt.Sprintf("%020d", seq))
+}
+
+// forEach calls fn for each journal entry, in sequence order.
+func (j *Journal) forEach(ctx context.Context, fn func(seq uint64, e *JournalEntry) error) error {
+	results, err := j.ds.Query(ctx, query.Query{
+		Prefix: JournalPrefix.String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		seq, err := strconv.ParseUint(datastore.RawKey(r.Key).BaseNamespace(), 10, 64)
+		if err != nil {
+			log.Errorf("skipping invalid MFS journal key %s", r.Key)
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			log.Errorf("skipping undecodable MFS journal entry %s: %s", r.Key, err)
+			continue
+		}
+		if err := fn(seq, &e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether the journal records changes.
+func (j *Journal) Enabled() bool {
+	return j != nil && j.enabled
+}
+
+// Append durably records e.
+func (j *Journal) Append(ctx context.Context, e *JournalEntry) error {
+	if !j.Enabled() {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := journalKey(j.next)
+	if err := j.ds.Put(ctx, key, data); err != nil {
+		return err
+	}
+	if err := j.ds.Sync(ctx, key); err != nil {
+		return err
+	}
+	j.next++
+	return nil
+}
+
+// Record appends entries with the current state of paths in root: a put of
+// the node at each path, or a removal for paths that do not exist.
+func (j *Journal) Record(ctx context.Context, root *mfs.Root, paths ...string) error {
+	if !j.Enabled() {
+		return nil
+	}
+	entries := make([]*JournalEntry, 0, len(paths))
+	for _, p := range paths {
+		fsn, err := mfs.Lookup(root, p)
+		if errors.Is(err, os.ErrNotExist) {
+			entries = append(entries, &JournalEntry{Op: JournalOpRm, Path: p})
+			continue
+		} else if err != nil {
+			return err
+		}
+		nd, err := fsn.GetNode()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &JournalEntry{Op: JournalOpPut, Path: p, Cid: nd.Cid()})
+	}
+
+	// The nodes must be on disk before the entries referencing them.
+	if err := j.ds.Sync(ctx, blockstore.BlockPrefix); err != nil {
+		return err
+	}
+	if err := j.ds.Sync(ctx, filestore.FilestorePrefix); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := j.Append(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hold prevents the journal from being pruned until the returned function
+// is called. Writers that record changes before applying them to the MFS
+// tree, such as FUSE writes buffered in an open file, hold the journal
+// until the changes reach the tree.
+func (j *Journal) Hold() func() {
+	if !j.Enabled() {
+		return func() {}
+	}
+	j.mu.Lock()
+	j.holds++
+	j.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			j.mu.Lock()
+			j.holds--
+			j.mu.Unlock()
+		})
+	}
+}
+
+// Prune removes the entries included in the persisted MFS root. It is called
+// after root has been persisted as the CID persisted, and does nothing when
+// the in-memory root has changes that are not part of it yet.
+func (j *Journal) Prune(ctx context.Context, root *mfs.Root, persisted cid.Cid) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	first, last, holds := j.pruned, j.next, j.holds
+	j.mu.Unlock()
+	if first == last || holds > 0 {
+		return nil
+	}
+
+	// Entries are appended after their change is applied, so all entries
+	// before last are in the current tree.
+	cur, err := root.GetDirectory().GetNode()
+	if err != nil {
+		return err
+	}
+	if !cur.Cid().Equals(persisted) {
+		return nil
+	}
+
+	for seq := first; seq < last; seq++ {
+		if err := j.ds.Delete(ctx, journalKey(seq)); err != nil {
+			return err
+		}
+	}
+	j.mu.Lock()
+	j.pruned = last
+	j.mu.Unlock()
+	return j.ds.Sync(ctx, JournalPrefix)
+}
+
+// ClearJournal removes all journal entries from ds. It is used when the MFS
+// root is replaced while the daemon is not running, making them meaningless.
+func ClearJournal(ctx context.Context, ds datastore.Datastore) error {
+	j := &Journal{ds: ds}
+	var keys []datastore.Key
+	err := j.forEach(ctx, func(seq uint64, _ *JournalEntry) error {
+		keys = append(keys, journalKey(seq))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := ds.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return ds.Sync(ctx, JournalPrefix)
+}
+
+// Replay applies the journal entries onto root, which must be the persisted
+// MFS root, and flushes it. Entries that cannot be applied are logged and
+// skipped. When there was something to replay, the recovery is recorded
+// under RecoveryKey and returned; otherwise Replay returns nil.
+//
+// dserv is used to load the nodes of put entries and should not fetch from
+// the network: they were stored locally when recorded.
+func (j *Journal) Replay(ctx context.Context, root *mfs.Root, dserv ipld.DAGService) (*Recovery, error) {
+	rec := &Recovery{}
+	err := j.forEach(ctx, func(seq uint64, e *JournalEntry) error {
+		rec.Entries++
+		if err := applyJournalEntry(ctx, root, dserv, e); err != nil {
+			log.Errorf("MFS journal: skipping entry %d (%s %s): %s", seq, e.Op, e.Path, err)
+			rec.Failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rec.Entries == 0 {
+		return nil, nil
+	}
+
+	nd, err := root.GetDirectory().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	// Hand the recovered root to the republisher, which persists it and
+	// prunes the journal.
+	if err := root.Flush(); err != nil {
+		return nil, err
+	}
+
+	rec.Time = time.Now().UTC()
+	rec.Root = nd.Cid()
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.ds.Put(ctx, RecoveryKey, data); err != nil {
+		return nil, err
+	}
+	log.Warnf("MFS journal: recovered %d unflushed changes (%d failed), MFS root is now %s", rec.Entries, rec.Failed, rec.Root)
+	return rec, nil
+}
+
+// GetRecovery returns the last recorded replay of the MFS journal, or nil if
+// there was none.
+func GetRecovery(ctx context.Context, ds datastore.Datastore) (*Recovery, error) {
+	data, err := ds.Get(ctx, RecoveryKey)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var rec Recovery
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("decoding MFS recovery record: %w", err)
+	}
+	return &rec, nil
+}
+
+func applyJournalEntry(ctx context.Context, root *mfs.Root, dserv ipld.DAGService, e *JournalEntry) error {
+	if e.Path == "" || e.Path[0] != '/' {
+		return fmt.Errorf("invalid path %q", e.Path)
+	}
+	p := gopath.Clean(e.Path)
+
+	switch e.Op {
+	case JournalOpPut:
+		nd, err := dserv.Get(ctx, e.Cid)
+		if err != nil {
+			return err
+		}
+		if p == "/" {
+			return ReplaceRoot(ctx, root, dserv, e.Cid)
+		}
+		dir, name := gopath.Dir(p), gopath.Base(p)
+		if dir != "/" {
+			if err := mfs.Mkdir(root, dir, mfs.MkdirOpts{Mkparents: true}); err != nil {
+				return err
+			}
+		}
+		parent, err := journalDir(root, dir)
+		if err != nil {
+			return err
+		}
+		if err := parent.Unlink(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return parent.AddChild(name, nd)
+
+	case JournalOpRm:
+		dir, name := gopath.Dir(p), gopath.Base(p)
+		parent, err := journalDir(root, dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := parent.Unlink(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+
+	case JournalOpWrite, JournalOpTruncate:
+		fsn, err := mfs.Lookup(root, p)
+		if err != nil {
+			return err
+		}
+		fi, ok := fsn.(*mfs.File)
+		if !ok {
+			return fmt.Errorf("%s is not a file", p)
+		}
+		fd, err := fi.Open(ctx, mfs.Flags{Write: true, Sync: true})
+		if err != nil {
+			return err
+		}
+		if e.Op == JournalOpTruncate {
+			err = fd.Truncate(e.Size)
+		} else {
+			_, err = fd.WriteAt(e.Data, e.Offset)
+		}
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		return fd.Close()
+
+	default:
+		return fmt.Errorf("unknown operation %q", e.Op)
+	}
+}
+
+func journalDir(root *mfs.Root, p string) (*mfs.Directory, error) {
+	fsn, err := mfs.Lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	return dir, nil
+}
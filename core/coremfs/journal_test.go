@@ -0,0 +1,112 @@
+package coremfs
+
+import (
+	"testing"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalReplay(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	dserv := mdtest.Mock()
+
+	empty := ft.EmptyDirNode()
+	require.NoError(t, dserv.Add(ctx, empty))
+	rootCid := func(root *mfs.Root) cid.Cid {
+		nd, err := root.GetDirectory().GetNode()
+		require.NoError(t, err)
+		return nd.Cid()
+	}
+
+	// changes made to the live root without flushing it
+	live, err := mfs.NewRoot(ctx, dserv, empty.Copy().(*dag.ProtoNode), nil, nil)
+	require.NoError(t, err)
+	j, err := OpenJournal(ctx, ds, true)
+	require.NoError(t, err)
+
+	require.NoError(t, mfs.Mkdir(live, "/a/b", mfs.MkdirOpts{Mkparents: true}))
+	require.NoError(t, j.Record(ctx, live, "/a/b"))
+	file := dag.NodeWithData(ft.FilePBData([]byte("hello"), 5))
+	require.NoError(t, dserv.Add(ctx, file))
+	require.NoError(t, mfs.PutNode(live, "/a/b/f", file))
+	require.NoError(t, mfs.PutNode(live, "/a/g", file))
+	require.NoError(t, j.Record(ctx, live, "/a/b/f", "/a/g"))
+	require.NoError(t, live.GetDirectory().Unlink("a"))
+	require.NoError(t, mfs.Mkdir(live, "/a", mfs.MkdirOpts{}))
+	require.NoError(t, mfs.PutNode(live, "/a/f", file))
+	require.NoError(t, j.Record(ctx, live, "/a", "/a/b/f"))
+
+	// a buffered write to an open file, as the FUSE mount journals it
+	release := j.Hold()
+	fsn, err := mfs.Lookup(live, "/a/f")
+	require.NoError(t, err)
+	fd, err := fsn.(*mfs.File).Open(ctx, mfs.Flags{Write: true, Sync: true})
+	require.NoError(t, err)
+	_, err = fd.WriteAt([]byte("ipfs!!"), 1)
+	require.NoError(t, err)
+	require.NoError(t, j.Append(ctx, &JournalEntry{Op: JournalOpWrite, Path: "/a/f", Offset: 1, Data: []byte("ipfs!!")}))
+	require.NoError(t, fd.Close())
+	want := rootCid(live)
+
+	// held or not matching the persisted root: nothing is pruned
+	require.NoError(t, j.Prune(ctx, live, want))
+	release()
+	require.NoError(t, j.Prune(ctx, live, empty.Cid()))
+
+	// crash: the persisted root is still the empty directory
+	recovered, err := mfs.NewRoot(ctx, dserv, empty.Copy().(*dag.ProtoNode), nil, nil)
+	require.NoError(t, err)
+	j, err = OpenJournal(ctx, ds, true)
+	require.NoError(t, err)
+	rec, err := j.Replay(ctx, recovered, dserv)
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	assert.Equal(t, 6, rec.Entries)
+	assert.Zero(t, rec.Failed)
+	assert.Equal(t, want, rec.Root)
+	assert.Equal(t, want, rootCid(recovered))
+
+	stored, err := GetRecovery(ctx, ds)
+	require.NoError(t, err)
+	assert.Equal(t, rec.Root, stored.Root)
+
+	// replaying entries that are already applied changes nothing
+	rec, err = j.Replay(ctx, recovered, dserv)
+	require.NoError(t, err)
+	assert.Equal(t, want, rec.Root)
+
+	// once the recovered root is persisted, the journal is empty
+	require.NoError(t, j.Prune(ctx, recovered, want))
+	j, err = OpenJournal(ctx, ds, true)
+	require.NoError(t, err)
+	rec, err = j.Replay(ctx, recovered, dserv)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+}
+
+func TestJournalDisabled(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	dserv := mdtest.Mock()
+
+	root, err := mfs.NewEmptyRoot(ctx, dserv, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, mfs.Mkdir(root, "/a", mfs.MkdirOpts{}))
+
+	j, err := OpenJournal(ctx, ds, false)
+	require.NoError(t, err)
+	require.NoError(t, j.Record(ctx, root, "/a"))
+	require.NoError(t, ClearJournal(ctx, ds))
+	rec, err := j.Replay(ctx, root, dserv)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+}
@@ -0,0 +1,369 @@
+// Package coremfs implements node-level features built on top of the MFS
+// (Mutable File System) root used by the 'ipfs files' commands.
+package coremfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("coremfs")
+
+// SnapshotPrefix is the datastore prefix under which MFS snapshots are
+// recorded, one key per snapshot name.
+var SnapshotPrefix = datastore.NewKey("/local/mfs-snapshots")
+
+// AutoSnapshotPrefix is the name prefix of snapshots taken automatically
+// before destructive operations.
+const AutoSnapshotPrefix = "auto-"
+
+var (
+	ErrSnapshotNotFound    = errors.New("snapshot not found")
+	ErrSnapshotExists      = errors.New("snapshot already exists")
+	ErrInvalidSnapshotName = errors.New("snapshot name must be 1-128 characters of letters, digits, '.', '_' or '-'")
+)
+
+var snapshotNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Snapshot is a named record of an MFS root CID.
+type Snapshot struct {
+	Name    string
+	Cid     cid.Cid
+	Created time.Time
+	Message string `json:",omitempty"`
+	Auto    bool   `json:",omitempty"`
+}
+
+// ValidateSnapshotName returns ErrInvalidSnapshotName if name cannot be used
+// as a snapshot name.
+func ValidateSnapshotName(name string) error {
+	if !snapshotNameRe.MatchString(name) || name == "." || name == ".." {
+		return ErrInvalidSnapshotName
+	}
+	return nil
+}
+
+func snapshotKey(name string) datastore.Key {
+	return SnapshotPrefix.ChildString(name)
+}
+
+// SaveSnapshot records c under the given name. It fails with
+// ErrSnapshotExists if a snapshot with that name is already recorded.
+func SaveSnapshot(ctx context.Context, ds datastore.Datastore, name string, c cid.Cid, message string) (*Snapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	return putSnapshot(ctx, ds, &Snapshot{
+		Name:    name,
+		Cid:     c,
+		Created: time.Now().UTC(),
+		Message: message,
+	})
+}
+
+func putSnapshot(ctx context.Context, ds datastore.Datastore, snap *Snapshot) (*Snapshot, error) {
+	key := snapshotKey(snap.Name)
+	exists, err := ds.Has(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotExists, snap.Name)
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.Put(ctx, key, data); err != nil {
+		return nil, err
+	}
+	if err := ds.Sync(ctx, key); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// GetSnapshot returns the snapshot recorded under name.
+func GetSnapshot(ctx context.Context, ds datastore.Datastore, name string) (*Snapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+	data, err := ds.Get(ctx, snapshotKey(name))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("decoding snapshot %q: %w", name, err)
+	}
+	return &snap, nil
+}
+
+// ListSnapshots returns all recorded snapshots, oldest first.
+func ListSnapshots(ctx context.Context, ds datastore.Datastore) ([]*Snapshot, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: SnapshotPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var snaps []*Snapshot
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(r.Value, &snap); err != nil {
+			log.Errorf("skipping undecodable snapshot %s: %s", r.Key, err)
+			continue
+		}
+		snaps = append(snaps, &snap)
+	}
+
+	slices.SortFunc(snaps, func(a, b *Snapshot) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return snaps, nil
+}
+
+// RemoveSnapshot deletes the snapshot recorded under name. The blocks it
+// referenced become eligible for garbage collection unless reachable from
+// MFS, a pin, or another snapshot.
+func RemoveSnapshot(ctx context.Context, ds datastore.Datastore, name string) error {
+	if err := ValidateSnapshotName(name); err != nil {
+		return err
+	}
+	key := snapshotKey(name)
+	exists, err := ds.Has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	if err := ds.Delete(ctx, key); err != nil {
+		return err
+	}
+	return ds.Sync(ctx, key)
+}
+
+// SnapshotRoots returns the root CIDs of all recorded snapshots. Garbage
+// collection treats them as live, like the MFS root itself.
+func SnapshotRoots(ctx context.Context, ds datastore.Datastore) ([]cid.Cid, error) {
+	snaps, err := ListSnapshots(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]cid.Cid, 0, len(snaps))
+	for _, s := range snaps {
+		roots = append(roots, s.Cid)
+	}
+	return roots, nil
+}
+
+// AutoSnapshot records c as an automatic snapshot named after the current
+// time, and prunes older automatic snapshots so that at most keep remain.
+// A keep value of zero or less disables pruning.
+func AutoSnapshot(ctx context.Context, ds datastore.Datastore, c cid.Cid, message string, keep int) (*Snapshot, error) {
+	now := time.Now().UTC()
+	base := AutoSnapshotPrefix + now.Format("20060102-150405")
+	name := base
+	var snap *Snapshot
+	var err error
+	for i := 1; ; i++ {
+		snap, err = putSnapshot(ctx, ds, &Snapshot{
+			Name:    name,
+			Cid:     c,
+			Created: now,
+			Message: message,
+			Auto:    true,
+		})
+		if !errors.Is(err, ErrSnapshotExists) {
+			break
+		}
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if keep > 0 {
+		if err := pruneAutoSnapshots(ctx, ds, keep); err != nil {
+			log.Errorf("pruning automatic MFS snapshots: %s", err)
+		}
+	}
+	return snap, nil
+}
+
+func pruneAutoSnapshots(ctx context.Context, ds datastore.Datastore, keep int) error {
+	snaps, err := ListSnapshots(ctx, ds)
+	if err != nil {
+		return err
+	}
+	auto := slices.DeleteFunc(snaps, func(s *Snapshot) bool { return !s.Auto })
+	for len(auto) > keep {
+		if err := RemoveSnapshot(ctx, ds, auto[0].Name); err != nil {
+			return err
+		}
+		auto = auto[1:]
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the contents of the MFS root with the directory
+// at c and flushes the result. The swap is done by ReplaceRoot, so MFS is
+// left as it was when the snapshot cannot be loaded, and the node keeps
+// using the same *mfs.Root and does not need to be restarted, unlike with
+// 'ipfs files chroot'.
+func RestoreSnapshot(ctx context.Context, root *mfs.Root, dserv ipld.DAGService, c cid.Cid) error {
+	if err := ReplaceRoot(ctx, root, dserv, c); err != nil {
+		return fmt.Errorf("restoring snapshot root %s: %w", c, err)
+	}
+	return nil
+}
+
+// ReplaceRoot makes the MFS root the directory at c. Everything the swap
+// needs is loaded first, so a failure or a cancellation leaves MFS as it
+// was. Only the entries that differ are then swapped, without waiting on the
+// network, and are put back if any step fails. Intermediate states are never
+// flushed: the republisher only sees the final root.
+//
+// The caller should hold the MFS pin lock. mfs.Root cannot swap its node in
+// place, so readers that do not take the lock may see a partly swapped root.
+func ReplaceRoot(ctx context.Context, root *mfs.Root, dserv ipld.DAGService, c cid.Cid) error {
+	nd, err := dserv.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return dag.ErrNotProtobuf
+	}
+	fsn, err := ft.FSNodeFromBytes(pbnd.Data())
+	if err != nil {
+		return err
+	}
+	if fsn.Type() != ft.TDirectory && fsn.Type() != ft.THAMTShard {
+		return errors.New("not a directory")
+	}
+	src, err := directoryLinks(ctx, dserv, nd)
+	if err != nil {
+		return err
+	}
+
+	dir := root.GetDirectory()
+	curNd, err := dir.GetNode()
+	if err != nil {
+		return err
+	}
+	cur, err := directoryLinks(ctx, dserv, curNd)
+	if err != nil {
+		return err
+	}
+	for name, c := range src {
+		if old, ok := cur[name]; ok && old.Equals(c) {
+			delete(src, name)
+			delete(cur, name)
+		}
+	}
+	added, err := getLinkNodes(ctx, dserv, src)
+	if err != nil {
+		return err
+	}
+	// the removed nodes are needed to put them back on failure
+	removed, err := getLinkNodes(ctx, dserv, cur)
+	if err != nil {
+		return err
+	}
+
+	if err := swapEntries(dir, removed, added); err != nil {
+		return err
+	}
+	_, err = mfs.FlushPath(ctx, root, "/")
+	return err
+}
+
+func directoryLinks(ctx context.Context, dserv ipld.DAGService, nd ipld.Node) (map[string]cid.Cid, error) {
+	d, err := uio.NewDirectoryFromNode(dserv, nd)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]cid.Cid)
+	err = d.ForEachLink(ctx, func(l *ipld.Link) error {
+		links[l.Name] = l.Cid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func getLinkNodes(ctx context.Context, dserv ipld.DAGService, links map[string]cid.Cid) (map[string]ipld.Node, error) {
+	nodes := make(map[string]ipld.Node, len(links))
+	for name, c := range links {
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("loading %q: %w", name, err)
+		}
+		nodes[name] = nd
+	}
+	return nodes, nil
+}
+
+// swapEntries unlinks the removed entries of dir and adds the added ones. If
+// a step fails, the entries already swapped are put back.
+func swapEntries(dir *mfs.Directory, removed, added map[string]ipld.Node) error {
+	var unlinked, linked []string
+	undo := func() {
+		for _, name := range linked {
+			if err := dir.Unlink(name); err != nil {
+				log.Errorf("reverting MFS root entry %q: %s", name, err)
+			}
+		}
+		for _, name := range unlinked {
+			if err := dir.AddChild(name, removed[name]); err != nil {
+				log.Errorf("reverting MFS root entry %q: %s", name, err)
+			}
+		}
+	}
+
+	for name := range removed {
+		if err := dir.Unlink(name); err != nil {
+			undo()
+			return fmt.Errorf("unlinking %q: %w", name, err)
+		}
+		unlinked = append(unlinked, name)
+	}
+	for name, nd := range added {
+		if err := dir.AddChild(name, nd); err != nil {
+			undo()
+			return fmt.Errorf("adding %q: %w", name, err)
+		}
+		linked = append(linked, name)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package coremfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dag "github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/mfs"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	root := ft.EmptyDirNode().Cid()
+
+	_, err := SaveSnapshot(ctx, ds, "release-1.0", root, "first release")
+	require.NoError(t, err)
+
+	_, err = SaveSnapshot(ctx, ds, "release-1.0", root, "")
+	assert.True(t, errors.Is(err, ErrSnapshotExists))
+
+	_, err = SaveSnapshot(ctx, ds, "../escape", root, "")
+	assert.True(t, errors.Is(err, ErrInvalidSnapshotName))
+
+	snap, err := GetSnapshot(ctx, ds, "release-1.0")
+	require.NoError(t, err)
+	assert.Equal(t, root, snap.Cid)
+	assert.Equal(t, "first release", snap.Message)
+	assert.False(t, snap.Auto)
+
+	_, err = GetSnapshot(ctx, ds, "missing")
+	assert.True(t, errors.Is(err, ErrSnapshotNotFound))
+
+	roots, err := SnapshotRoots(ctx, ds)
+	require.NoError(t, err)
+	assert.Equal(t, []cid.Cid{root}, roots)
+
+	require.NoError(t, RemoveSnapshot(ctx, ds, "release-1.0"))
+	assert.True(t, errors.Is(RemoveSnapshot(ctx, ds, "release-1.0"), ErrSnapshotNotFound))
+}
+
+func TestAutoSnapshotPrunes(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	root := ft.EmptyDirNode().Cid()
+
+	_, err := SaveSnapshot(ctx, ds, "named", root, "")
+	require.NoError(t, err)
+
+	var last *Snapshot
+	for range 5 {
+		last, err = AutoSnapshot(ctx, ds, root, "before rm", 3)
+		require.NoError(t, err)
+		assert.True(t, last.Auto)
+	}
+
+	snaps, err := ListSnapshots(ctx, ds)
+	require.NoError(t, err)
+
+	var auto int
+	var named bool
+	for _, s := range snaps {
+		if s.Auto {
+			auto++
+		} else if s.Name == "named" {
+			named = true
+		}
+	}
+	assert.Equal(t, 3, auto, "older automatic snapshots are pruned")
+	assert.True(t, named, "named snapshots are never pruned")
+	assert.Equal(t, last.Name, snaps[len(snaps)-1].Name)
+}
+
+func TestReplaceRoot(t *testing.T) {
+	ctx := t.Context()
+	dserv := mdtest.Mock()
+	file := func(data string) ipld.Node {
+		nd := dag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+		require.NoError(t, dserv.Add(ctx, nd))
+		return nd
+	}
+	dir := func(entries map[string]ipld.Node) cid.Cid {
+		nd := ft.EmptyDirNode()
+		for name, child := range entries {
+			require.NoError(t, nd.AddNodeLink(name, child))
+		}
+		require.NoError(t, dserv.Add(ctx, nd))
+		return nd.Cid()
+	}
+	keep, old := file("keep"), file("old")
+
+	root, err := mfs.NewRoot(ctx, dserv, ft.EmptyDirNode(), func(context.Context, cid.Cid) error { return nil }, nil)
+	require.NoError(t, err)
+	require.NoError(t, mfs.PutNode(root, "/keep", keep))
+	require.NoError(t, mfs.PutNode(root, "/old", old))
+	names := func() []string {
+		names, err := root.GetDirectory().ListNames(ctx)
+		require.NoError(t, err)
+		return names
+	}
+
+	target := dir(map[string]ipld.Node{"keep": keep, "new": file("new")})
+	require.NoError(t, ReplaceRoot(ctx, root, dserv, target))
+	assert.ElementsMatch(t, []string{"keep", "new"}, names())
+	nd, err := root.GetDirectory().GetNode()
+	require.NoError(t, err)
+	assert.Equal(t, target, nd.Cid())
+
+	// an entry that cannot be loaded fails the swap before MFS is touched
+	missing := dag.NodeWithData(ft.FilePBData([]byte("missing"), 7))
+	err = ReplaceRoot(ctx, root, dserv, dir(map[string]ipld.Node{"missing": missing}))
+	require.ErrorContains(t, err, `loading "missing"`)
+	assert.ElementsMatch(t, []string{"keep", "new"}, names())
+
+	require.Error(t, ReplaceRoot(ctx, root, dserv, keep.Cid()))
+}
+
+func TestRestoreSnapshotMissing(t *testing.T) {
+	ctx := t.Context()
+	dserv := mdtest.Mock()
+	root, err := mfs.NewRoot(ctx, dserv, ft.EmptyDirNode(), func(context.Context, cid.Cid) error { return nil }, nil)
+	require.NoError(t, err)
+	require.NoError(t, mfs.Mkdir(root, "/a", mfs.MkdirOpts{}))
+
+	gone := ft.EmptyDirNode()
+	require.NoError(t, gone.AddNodeLink("b", ft.EmptyDirNode()))
+	require.Error(t, RestoreSnapshot(ctx, root, dserv, gone.Cid()))
+
+	names, err := root.GetDirectory().ListNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, names)
+}
@@ -0,0 +1,178 @@
+// Package corepin keeps settings attached to pins that the pinner does not
+// store itself.
+package corepin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	dshelp "github.com/ipfs/boxo/datastore/dshelp"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/kubo/config"
+)
+
+// ProvidePolicyPrefix is the datastore prefix under which the provide
+// policies of pins are kept, by CID.
+var ProvidePolicyPrefix = datastore.NewKey("/local/pin-provide")
+
+// ProvidePolicy is how the blocks of a pin are announced to routing
+// systems.
+type ProvidePolicy string
+
+const (
+	// ProvideDefault leaves the pin to Provide.Strategy.
+	ProvideDefault ProvidePolicy = ""
+	// ProvideAll announces every block of the pin.
+	ProvideAll ProvidePolicy = "all"
+	// ProvideRoots only announces the root of the pin.
+	ProvideRoots ProvidePolicy = "roots"
+	// ProvideNone announces nothing for the pin.
+	ProvideNone ProvidePolicy = "none"
+)
+
+// ParseProvidePolicy parses the value of a --provide option. The empty
+// string is the default policy.
+func ParseProvidePolicy(s string) (ProvidePolicy, error) {
+	switch p := ProvidePolicy(s); p {
+	case ProvideDefault, ProvideAll, ProvideRoots, ProvideNone:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid provide policy %q, must be one of {all, roots, none}", s)
+	}
+}
+
+// CheckProvidePolicy returns an error when p cannot be honored with the
+// provide strategy of the node.
+func CheckProvidePolicy(strategy config.ProvideStrategy, p ProvidePolicy) error {
+	if strategy == config.ProvideStrategyAll && (p == ProvideRoots || p == ProvideNone) {
+		return fmt.Errorf("provide policy %q has no effect with Provide.Strategy \"all\", which announces every block: use \"pinned\", \"roots\" or \"mfs\"", p)
+	}
+	return nil
+}
+
+func policyKey(c cid.Cid) datastore.Key {
+	return ProvidePolicyPrefix.Child(dshelp.NewKeyFromBinary(c.Bytes()))
+}
+
+// SetProvidePolicy sets the provide policy of the pin of c. Setting the
+// default policy removes it.
+func SetProvidePolicy(ctx context.Context, ds datastore.Datastore, c cid.Cid, p ProvidePolicy) error {
+	if p == ProvideDefault {
+		err := ds.Delete(ctx, policyKey(c))
+		if errors.Is(err, datastore.ErrNotFound) {
+			err = nil
+		}
+		return err
+	}
+	return ds.Put(ctx, policyKey(c), []byte(p))
+}
+
+// GetProvidePolicy returns the provide policy of the pin of c.
+func GetProvidePolicy(ctx context.Context, ds datastore.Datastore, c cid.Cid) (ProvidePolicy, error) {
+	v, err := ds.Get(ctx, policyKey(c))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return ProvideDefault, nil
+	}
+	if err != nil {
+		return ProvideDefault, err
+	}
+	return ProvidePolicy(v), nil
+}
+
+// ProvidePolicies returns the pins that do not have the default provide
+// policy, with their policy.
+func ProvidePolicies(ctx context.Context, ds datastore.Datastore) (map[cid.Cid]ProvidePolicy, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: ProvidePolicyPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	out := make(map[cid.Cid]ProvidePolicy)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		b, err := dshelp.BinaryFromDsKey(datastore.RawKey("/" + datastore.RawKey(r.Key).BaseNamespace()))
+		if err != nil {
+			continue
+		}
+		c, err := cid.Cast(b)
+		if err != nil {
+			continue
+		}
+		out[c] = ProvidePolicy(r.Value)
+	}
+	return out, nil
+}
+
+// PinsWithPolicy returns a view of pinner whose RecursiveKeys and
+// DirectKeys only list the pins whose provide policy, as stored in ds,
+// matches. Policies are read again on each listing.
+func PinsWithPolicy(pinner pin.Pinner, ds datastore.Datastore, match func(ProvidePolicy) bool) pin.Pinner {
+	return &policyPinner{Pinner: pinner, ds: ds, match: match}
+}
+
+type policyPinner struct {
+	pin.Pinner
+	ds    datastore.Datastore
+	match func(ProvidePolicy) bool
+}
+
+func (p *policyPinner) RecursiveKeys(ctx context.Context, detailed bool) <-chan pin.StreamedPin {
+	return p.filter(ctx, p.Pinner.RecursiveKeys(ctx, detailed))
+}
+
+func (p *policyPinner) DirectKeys(ctx context.Context, detailed bool) <-chan pin.StreamedPin {
+	return p.filter(ctx, p.Pinner.DirectKeys(ctx, detailed))
+}
+
+func (p *policyPinner) filter(ctx context.Context, in <-chan pin.StreamedPin) <-chan pin.StreamedPin {
+	out := make(chan pin.StreamedPin)
+	go func() {
+		defer close(out)
+		policies, err := ProvidePolicies(ctx, p.ds)
+		for sp := range in {
+			if err != nil {
+				sp = pin.StreamedPin{Err: fmt.Errorf("reading pin provide policies: %w", err)}
+			} else if sp.Err == nil && !p.match(policies[sp.Pin.Key]) {
+				continue
+			}
+			select {
+			case out <- sp:
+			case <-ctx.Done():
+				return
+			}
+			if sp.Err != nil {
+				// drain the pinner so it is not left blocked
+				for range in {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// FastProvide adjusts the fast-provide steps run after pinning to the
+// policy p of the new pins. It returns the strategy the DAG walk should
+// follow and whether the root and the DAG should still be provided.
+func (p ProvidePolicy) FastProvide(strategy config.ProvideStrategy, root, dag bool) (config.ProvideStrategy, bool, bool) {
+	switch p {
+	case ProvideNone:
+		return strategy, false, false
+	case ProvideRoots:
+		return strategy, root || dag, false
+	case ProvideAll:
+		if strategy != config.ProvideStrategyAll {
+			strategy |= config.ProvideStrategyPinned
+		}
+		return strategy, root, dag
+	default:
+		return strategy, root, dag
+	}
+}
@@ -0,0 +1,94 @@
+package corepin
+
+import (
+	"testing"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	mdutils "github.com/ipfs/boxo/ipld/merkledag/test"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProvidePolicy(t *testing.T) {
+	for _, s := range []string{"", "all", "roots", "none"} {
+		p, err := ParseProvidePolicy(s)
+		require.NoError(t, err)
+		require.Equal(t, ProvidePolicy(s), p)
+	}
+	_, err := ParseProvidePolicy("pinned")
+	require.Error(t, err)
+
+	require.Error(t, CheckProvidePolicy(config.ProvideStrategyAll, ProvideRoots))
+	require.Error(t, CheckProvidePolicy(config.ProvideStrategyAll, ProvideNone))
+	require.NoError(t, CheckProvidePolicy(config.ProvideStrategyAll, ProvideAll))
+	require.NoError(t, CheckProvidePolicy(config.ProvideStrategyPinned, ProvideNone))
+}
+
+func TestFastProvide(t *testing.T) {
+	s, root, dag := ProvideNone.FastProvide(config.ProvideStrategyPinned, true, true)
+	require.Equal(t, config.ProvideStrategyPinned, s)
+	require.False(t, root)
+	require.False(t, dag)
+
+	_, root, dag = ProvideRoots.FastProvide(config.ProvideStrategyPinned, false, true)
+	require.True(t, root)
+	require.False(t, dag)
+
+	s, _, dag = ProvideAll.FastProvide(config.ProvideStrategyRoots, false, true)
+	require.NotZero(t, s&config.ProvideStrategyPinned)
+	require.True(t, dag)
+}
+
+func TestProvidePolicies(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	dserv := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	pinner, err := dspinner.New(ctx, ds, dserv)
+	require.NoError(t, err)
+
+	daggen := mdutils.NewDAGGenerator()
+	pins := make(map[ProvidePolicy]cid.Cid)
+	for _, p := range []ProvidePolicy{ProvideDefault, ProvideAll, ProvideRoots, ProvideNone} {
+		root, _, err := daggen.MakeDagNode(dserv.Add, 2, 2)
+		require.NoError(t, err)
+		require.NoError(t, pinner.PinWithMode(ctx, root, pin.Recursive, ""))
+		require.NoError(t, SetProvidePolicy(ctx, ds, root, p))
+		pins[p] = root
+	}
+	require.NoError(t, pinner.Flush(ctx))
+
+	policies, err := ProvidePolicies(ctx, ds)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	for p, c := range pins {
+		got, err := GetProvidePolicy(ctx, ds, c)
+		require.NoError(t, err)
+		require.Equal(t, p, got)
+		require.Equal(t, p, policies[c])
+	}
+
+	listed := func(match func(ProvidePolicy) bool) []cid.Cid {
+		var out []cid.Cid
+		for sp := range PinsWithPolicy(pinner, ds, match).RecursiveKeys(ctx, false) {
+			require.NoError(t, sp.Err)
+			out = append(out, sp.Pin.Key)
+		}
+		return out
+	}
+	require.ElementsMatch(t, []cid.Cid{pins[ProvideRoots]}, listed(func(p ProvidePolicy) bool { return p == ProvideRoots }))
+	require.ElementsMatch(t, []cid.Cid{pins[ProvideDefault]}, listed(func(p ProvidePolicy) bool { return p == ProvideDefault }))
+
+	// setting the default policy removes the entry
+	require.NoError(t, SetProvidePolicy(ctx, ds, pins[ProvideNone], ProvideDefault))
+	require.ElementsMatch(t, []cid.Cid{pins[ProvideDefault], pins[ProvideNone]}, listed(func(p ProvidePolicy) bool { return p == ProvideDefault }))
+	require.NoError(t, SetProvidePolicy(ctx, ds, pins[ProvideNone], ProvideDefault))
+}
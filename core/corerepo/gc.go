@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coremfs"
 	"github.com/ipfs/kubo/gc"
 	"github.com/ipfs/kubo/repo"
 
@@ -73,9 +75,11 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 // BestEffortRoots returns the CIDs of the live MFS roots GC must keep: the
 // node's FilesRoot plus any extra roots registered via
 // IpfsNode.RegisterMFSRoot (for example the per-key roots of a writable /ipns
-// FUSE mount). Extra roots are walked best-effort: one that cannot be read
-// (e.g. because its mount is unmounting) is logged and skipped rather than
-// failing the whole GC. FilesRoot is required.
+// FUSE mount), the roots recorded by 'ipfs files snapshot', and the roots
+// protected by 'ipfs bitswap fetch --protect'. Extra roots
+// are walked best-effort: one that cannot be read (e.g. because its mount is
+// unmounting) is logged and skipped rather than failing the whole GC.
+// FilesRoot is required.
 func BestEffortRoots(n *core.IpfsNode) ([]cid.Cid, error) {
 	rootDag, err := n.FilesRoot.GetDirectory().GetNode()
 	if err != nil {
@@ -95,6 +99,18 @@ func BestEffortRoots(n *core.IpfsNode) ([]cid.Cid, error) {
 		roots = append(roots, nd.Cid())
 	}
 
+	snapshots, err := coremfs.SnapshotRoots(n.Context(), n.Repo.Datastore())
+	if err != nil {
+		return nil, fmt.Errorf("reading MFS snapshots: %w", err)
+	}
+	roots = append(roots, snapshots...)
+
+	protected, err := ProtectedRoots(n.Context(), n.Repo.Datastore())
+	if err != nil {
+		return nil, fmt.Errorf("reading protected roots: %w", err)
+	}
+	roots = append(roots, protected...)
+
 	return roots, nil
 }
 
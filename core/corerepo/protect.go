@@ -0,0 +1,67 @@
+package corerepo
+
+import (
+	"context"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// ProtectedPrefix is the datastore prefix under which the roots protected
+// from automatic garbage collection are recorded, one key per root.
+var ProtectedPrefix = datastore.NewKey("/local/gc-protected")
+
+// Protect records roots so that automatic garbage collection (periodic, or
+// when the repo reaches its watermark) keeps the blocks reachable from them.
+// An explicit 'ipfs repo gc' releases them, see ReleaseProtected.
+func Protect(ctx context.Context, ds datastore.Datastore, roots ...cid.Cid) error {
+	for _, c := range roots {
+		key := ProtectedPrefix.ChildString(c.String())
+		if err := ds.Put(ctx, key, nil); err != nil {
+			return err
+		}
+		if err := ds.Sync(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProtectedRoots returns the roots recorded by Protect.
+func ProtectedRoots(ctx context.Context, ds datastore.Datastore) ([]cid.Cid, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: ProtectedPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var roots []cid.Cid
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			log.Errorf("skipping undecodable protected root %s: %s", r.Key, err)
+			continue
+		}
+		roots = append(roots, c)
+	}
+	return roots, nil
+}
+
+// ReleaseProtected removes all the roots recorded by Protect, so their blocks
+// can be collected, and returns how many there were.
+func ReleaseProtected(ctx context.Context, ds datastore.Datastore) (int, error) {
+	roots, err := ProtectedRoots(ctx, ds)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range roots {
+		if err := ds.Delete(ctx, ProtectedPrefix.ChildString(c.String())); err != nil {
+			return 0, err
+		}
+	}
+	return len(roots), ds.Sync(ctx, ProtectedPrefix)
+}
@@ -76,7 +76,10 @@ type bitswapIn struct {
 	Host        host.Host
 	Discovery   routing.ContentDiscovery
 	Bs          blockstore.GCBlockstore
-	BitswapOpts []bitswap.Option `group:"bitswap-options"`
+	Tracer      *RetrievalTracer
+	Ledgers     *BitswapLedgers
+	Policy      *BitswapServerPolicy `optional:"true"`
+	BitswapOpts []bitswap.Option     `group:"bitswap-options"`
 }
 
 // Bitswap creates the BitSwap server/client instance.
@@ -124,6 +127,11 @@ func Bitswap(serverEnabled, libp2pEnabled, httpEnabled bool) any {
 		} else {
 			return nil, errors.New("invalid configuration: Bitswap.Libp2pEnabled and HTTPRetrieval.Enabled are both disabled, unable to initialize Bitswap")
 		}
+		observers := []bitswapObserver{in.Tracer, in.Ledgers}
+		if in.Policy != nil {
+			observers = append(observers, in.Policy)
+		}
+		bitswapNetworks = observeBitswapNetwork(bitswapNetworks, observers...)
 
 		// Kubo uses own, customized ProviderQueryManager
 		in.BitswapOpts = append(in.BitswapOpts, bitswap.WithClientOption(client.WithDefaultProviderQueryManager(false)))
@@ -205,10 +213,10 @@ func Bitswap(serverEnabled, libp2pEnabled, httpEnabled bool) any {
 	}
 }
 
-// OnlineExchange creates new LibP2P backed block exchange.
-// Returns a no-op exchange if Bitswap is disabled.
+// OnlineExchange creates new LibP2P backed block exchange, wrapped to trace
+// retrievals. Returns a no-op exchange if Bitswap is disabled.
 func OnlineExchange(isBitswapActive bool) any {
-	return func(in *bitswap.Bitswap, lc fx.Lifecycle) exchange.Interface {
+	return func(in *bitswap.Bitswap, tracer *RetrievalTracer, lc fx.Lifecycle) exchange.Interface {
 		if !isBitswapActive {
 			return &noopExchange{closer: in}
 		}
@@ -217,7 +225,7 @@ func OnlineExchange(isBitswapActive bool) any {
 				return shutdown.CloseWithCtx(ctx, "bitswap-exchange", in.Close)
 			},
 		})
-		return in
+		return tracer.Exchange(in)
 	}
 }
 
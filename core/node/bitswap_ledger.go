@@ -0,0 +1,428 @@
+package node
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/bitswap/server"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/node/helpers"
+	"github.com/ipfs/kubo/repo"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/fx"
+)
+
+const (
+	// bitswapLedgerFlushInterval is how often updated ledgers are written to
+	// the datastore.
+	bitswapLedgerFlushInterval = time.Minute
+	// bitswapLedgerPruneInterval is how often the ledgers of peers not
+	// exchanged with for bitswapLedgerRetention are removed.
+	bitswapLedgerPruneInterval = time.Hour
+	// bitswapLedgerRetention is how long the ledger of a peer is kept after
+	// the last block exchanged with it.
+	bitswapLedgerRetention = 30 * 24 * time.Hour
+	// bitswapLedgerRatioPrior is added to both sides of the reciprocity
+	// ratio, so that a few blocks exchanged don't make much difference.
+	bitswapLedgerRatioPrior = 1 << 20
+	// bitswapStarvationTimeout is how long a peer with queued requests waits
+	// for a message before being served ahead of the peers ranked above it.
+	bitswapStarvationTimeout = 10 * time.Second
+)
+
+// bitswapLedgerPrefix is the datastore prefix of the ledgers, one key per
+// peer.
+var bitswapLedgerPrefix = datastore.NewKey("/local/bitswap/ledger")
+
+// BitswapLedgers keeps, per peer, the blocks exchanged with it since the
+// first exchange. Unlike the ledgers of the Bitswap decision engine, they
+// are persisted in the datastore and survive restarts.
+type BitswapLedgers struct {
+	ds      datastore.Datastore
+	now     func() time.Time
+	flushMu sync.Mutex // keeps Reset from racing with flush
+
+	mu      sync.Mutex
+	ledgers map[peer.ID]*BitswapLedgerStat
+	dirty   map[peer.ID]struct{}
+
+	// ranks holds the ratio of each ledger, read by the task comparator of
+	// the Bitswap server without taking mu.
+	ranks sync.Map // peer.ID -> float64
+	// served holds when a message was last sent to each peer, for the task
+	// comparator to serve the peers waiting too long.
+	served sync.Map // peer.ID -> *atomic.Int64, unix nanoseconds
+}
+
+// BitswapLedgerStat is the persisted ledger of a peer, as reported by
+// 'ipfs bitswap ledger'.
+type BitswapLedgerStat struct {
+	Peer           peer.ID
+	BytesSent      uint64
+	BytesReceived  uint64
+	BlocksSent     uint64
+	BlocksReceived uint64
+	FirstExchange  time.Time
+	LastExchange   time.Time
+}
+
+// Ratio is the reciprocity of the peer: above 1 when it sent this node more
+// than this node sent it.
+func (l BitswapLedgerStat) Ratio() float64 {
+	return float64(l.BytesReceived+bitswapLedgerRatioPrior) / float64(l.BytesSent+bitswapLedgerRatioPrior)
+}
+
+// NewBitswapLedgers loads the ledgers from the repo datastore and writes
+// them back periodically, until the node is stopped.
+func NewBitswapLedgers(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo) (*BitswapLedgers, error) {
+	l := newBitswapLedgers(r.Datastore())
+	if err := l.load(mctx); err != nil {
+		return nil, fmt.Errorf("loading bitswap ledgers: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(bitswapLedgerFlushInterval)
+				defer ticker.Stop()
+				pruneTicker := time.NewTicker(bitswapLedgerPruneInterval)
+				defer pruneTicker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := l.flush(ctx); err != nil {
+							logger.Errorw("writing bitswap ledgers", "err", err)
+						}
+					case <-pruneTicker.C:
+						if _, err := l.prune(ctx); err != nil {
+							logger.Errorw("pruning bitswap ledgers", "err", err)
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			<-done
+			return l.flush(stopCtx)
+		},
+	})
+	return l, nil
+}
+
+func newBitswapLedgers(ds datastore.Datastore) *BitswapLedgers {
+	return &BitswapLedgers{
+		ds:      ds,
+		now:     time.Now,
+		ledgers: make(map[peer.ID]*BitswapLedgerStat),
+		dirty:   make(map[peer.ID]struct{}),
+	}
+}
+
+func (l *BitswapLedgers) load(ctx context.Context) error {
+	results, err := l.ds.Query(ctx, query.Query{Prefix: bitswapLedgerPrefix.String()})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	cutoff := l.now().Add(-bitswapLedgerRetention)
+	var stale []datastore.Key
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		var st BitswapLedgerStat
+		if err := json.Unmarshal(r.Value, &st); err != nil {
+			logger.Errorw("skipping undecodable bitswap ledger", "key", r.Key, "err", err)
+			continue
+		}
+		if st.LastExchange.Before(cutoff) {
+			stale = append(stale, datastore.NewKey(r.Key))
+			continue
+		}
+		l.ledgers[st.Peer] = &st
+		l.ranks.Store(st.Peer, st.Ratio())
+	}
+	for _, k := range stale {
+		if err := l.ds.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the ledgers updated since the last flush.
+func (l *BitswapLedgers) flush(ctx context.Context) error {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
+	l.mu.Lock()
+	updated := make([]BitswapLedgerStat, 0, len(l.dirty))
+	for p := range l.dirty {
+		updated = append(updated, *l.ledgers[p])
+	}
+	clear(l.dirty)
+	l.mu.Unlock()
+
+	if len(updated) == 0 {
+		return nil
+	}
+	for _, st := range updated {
+		b, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		if err := l.ds.Put(ctx, bitswapLedgerKey(st.Peer), b); err != nil {
+			return err
+		}
+	}
+	return l.ds.Sync(ctx, bitswapLedgerPrefix)
+}
+
+// prune removes the ledgers of the peers not exchanged with for
+// bitswapLedgerRetention, and returns how many were removed.
+func (l *BitswapLedgers) prune(ctx context.Context) (int, error) {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
+	// peers not served for that long are starved with or without an entry
+	servedCutoff := l.now().Add(-bitswapStarvationTimeout).UnixNano()
+	l.served.Range(func(p, t any) bool {
+		if t.(*atomic.Int64).Load() < servedCutoff {
+			l.served.Delete(p)
+		}
+		return true
+	})
+
+	cutoff := l.now().Add(-bitswapLedgerRetention)
+	l.mu.Lock()
+	var stale []peer.ID
+	for p, st := range l.ledgers {
+		if st.LastExchange.Before(cutoff) {
+			delete(l.ledgers, p)
+			delete(l.dirty, p)
+			l.ranks.Delete(p)
+			stale = append(stale, p)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	for _, p := range stale {
+		if err := l.ds.Delete(ctx, bitswapLedgerKey(p)); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), l.ds.Sync(ctx, bitswapLedgerPrefix)
+}
+
+func bitswapLedgerKey(p peer.ID) datastore.Key {
+	return bitswapLedgerPrefix.ChildString(p.String())
+}
+
+// Ledger returns the ledger of p.
+func (l *BitswapLedgers) Ledger(p peer.ID) (BitswapLedgerStat, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.ledgers[p]
+	if !ok {
+		return BitswapLedgerStat{Peer: p}, false
+	}
+	return *st, true
+}
+
+// Ledgers returns all the ledgers, the peers exchanged with most first.
+func (l *BitswapLedgers) Ledgers() []BitswapLedgerStat {
+	l.mu.Lock()
+	all := make([]BitswapLedgerStat, 0, len(l.ledgers))
+	for _, st := range l.ledgers {
+		all = append(all, *st)
+	}
+	l.mu.Unlock()
+
+	slices.SortFunc(all, func(a, b BitswapLedgerStat) int {
+		if c := cmp.Compare(b.BytesSent+b.BytesReceived, a.BytesSent+a.BytesReceived); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Peer, b.Peer)
+	})
+	return all
+}
+
+// Reset removes the ledgers of peers, or all the ledgers when no peer is
+// given, and returns how many were removed.
+func (l *BitswapLedgers) Reset(ctx context.Context, peers ...peer.ID) (int, error) {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
+	l.mu.Lock()
+	if len(peers) == 0 {
+		for p := range l.ledgers {
+			peers = append(peers, p)
+		}
+	}
+	var removed []peer.ID
+	for _, p := range peers {
+		if _, ok := l.ledgers[p]; ok {
+			delete(l.ledgers, p)
+			delete(l.dirty, p)
+			l.ranks.Delete(p)
+			removed = append(removed, p)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, p := range removed {
+		if err := l.ds.Delete(ctx, bitswapLedgerKey(p)); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), l.ds.Sync(ctx, bitswapLedgerPrefix)
+}
+
+// ratio returns the reciprocity of p, 1 for unknown peers. It is called on
+// every comparison of the tasks of the Bitswap server, and doesn't lock.
+func (l *BitswapLedgers) ratio(p peer.ID) float64 {
+	if r, ok := l.ranks.Load(p); ok {
+		return r.(float64)
+	}
+	return 1
+}
+
+func (l *BitswapLedgers) record(p peer.ID, msg bsmsg.BitSwapMessage, sent bool) {
+	blks := msg.Blocks()
+	if len(blks) == 0 {
+		return
+	}
+	var size uint64
+	for _, b := range blks {
+		size += uint64(len(b.RawData()))
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.ledgers[p]
+	if !ok {
+		st = &BitswapLedgerStat{Peer: p, FirstExchange: now}
+		l.ledgers[p] = st
+	}
+	if sent {
+		st.BytesSent += size
+		st.BlocksSent += uint64(len(blks))
+	} else {
+		st.BytesReceived += size
+		st.BlocksReceived += uint64(len(blks))
+	}
+	st.LastExchange = now
+	l.dirty[p] = struct{}{}
+	l.ranks.Store(p, st.Ratio())
+}
+
+// starved reports whether p was not sent any message for
+// bitswapStarvationTimeout, or never was. Like ratio, it doesn't lock.
+func (l *BitswapLedgers) starved(p peer.ID) bool {
+	t, ok := l.served.Load(p)
+	if !ok {
+		return true
+	}
+	return l.now().UnixNano()-t.(*atomic.Int64).Load() > int64(bitswapStarvationTimeout)
+}
+
+func (l *BitswapLedgers) messageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	now := l.now().UnixNano()
+	if t, ok := l.served.Load(p); ok {
+		t.(*atomic.Int64).Store(now)
+	} else {
+		t := new(atomic.Int64)
+		t.Store(now)
+		if t, loaded := l.served.LoadOrStore(p, t); loaded {
+			t.(*atomic.Int64).Store(now)
+		}
+	}
+	l.record(p, msg, true)
+}
+
+func (l *BitswapLedgers) messageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	l.record(p, msg, false)
+}
+
+// BitswapServerStrategy orders the peers served by the Bitswap server
+// according to Bitswap.Server.Strategy. The default fair strategy is left to
+// Bitswap.
+func BitswapServerStrategy(cfg *config.Config) any {
+	return func(ledgers *BitswapLedgers) (bitswapOptionsOut, error) {
+		strategy := cfg.Bitswap.Server.Strategy.WithDefault(config.DefaultBitswapServerStrategy)
+		var rank func(peer.ID) float64
+		switch strategy {
+		case config.BitswapStrategyFair:
+			return bitswapOptionsOut{}, nil
+		case config.BitswapStrategyReciprocity:
+			rank = ledgers.ratio
+		case config.BitswapStrategyPeered:
+			rank = func(peer.ID) float64 { return 0 }
+		default:
+			return bitswapOptionsOut{}, fmt.Errorf("invalid Bitswap.Server.Strategy %q, must be %q, %q or %q",
+				strategy, config.BitswapStrategyFair, config.BitswapStrategyReciprocity, config.BitswapStrategyPeered)
+		}
+
+		peered := make(map[peer.ID]struct{}, len(cfg.Peering.Peers))
+		for _, ai := range cfg.Peering.Peers {
+			peered[ai.ID] = struct{}{}
+		}
+		return bitswapOptionsOut{
+			BitswapOpts: []bitswap.Option{
+				bitswap.WithTaskComparator(peerRankComparator(peered, rank, ledgers.starved)),
+			},
+		}, nil
+	}
+}
+
+// peerRankComparator serves the starved peers first, so that no peer waits
+// much longer than bitswapStarvationTimeout, then the peered peers, then the
+// peers with the highest rank.
+//
+// The tasks of a peer are ordered want-block first, then the blocks this node
+// has first, then by CID. The priority of the requests is not known to the
+// comparator.
+func peerRankComparator(peered map[peer.ID]struct{}, rank func(peer.ID) float64, starved func(peer.ID) bool) server.TaskComparator {
+	return func(ta, tb *server.TaskInfo) bool {
+		if ta.Peer == tb.Peer {
+			if ta.IsWantBlock != tb.IsWantBlock {
+				return ta.IsWantBlock
+			}
+			if ta.HaveBlock != tb.HaveBlock {
+				return ta.HaveBlock
+			}
+			return string(ta.Cid.Hash()) < string(tb.Cid.Hash())
+		}
+		if sa, sb := starved(ta.Peer), starved(tb.Peer); sa != sb {
+			return sa
+		}
+		_, pa := peered[ta.Peer]
+		_, pb := peered[tb.Peer]
+		if pa != pb {
+			return pa
+		}
+		return rank(ta.Peer) > rank(tb.Peer)
+	}
+}
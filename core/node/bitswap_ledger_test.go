@@ -0,0 +1,157 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/bitswap/server"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitswapLedgers(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	msg := bsmsg.New(false)
+	msg.AddBlock(blocks.NewBlock(make([]byte, 100)))
+
+	l := newBitswapLedgers(ds)
+	l.messageSent(p1, msg)
+	l.messageSent(p1, msg)
+	l.messageReceived(p2, msg)
+	l.messageSent(p2, bsmsg.New(false)) // no blocks, not recorded
+	require.NoError(t, l.flush(ctx))
+
+	// ledgers survive restarts
+	l = newBitswapLedgers(ds)
+	require.NoError(t, l.load(ctx))
+	st, ok := l.Ledger(p1)
+	require.True(t, ok)
+	require.Equal(t, uint64(200), st.BytesSent)
+	require.Equal(t, uint64(2), st.BlocksSent)
+	require.Less(t, st.Ratio(), 1.0)
+	st, ok = l.Ledger(p2)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), st.BytesReceived)
+	require.Zero(t, st.BytesSent)
+	require.Greater(t, st.Ratio(), 1.0)
+	require.Len(t, l.Ledgers(), 2)
+	require.Equal(t, p1, l.Ledgers()[0].Peer)
+	require.Equal(t, st.Ratio(), l.ratio(p2))
+
+	n, err := l.Reset(ctx, p1)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, ok = l.Ledger(p1)
+	require.False(t, ok)
+	require.Equal(t, 1.0, l.ratio(p1))
+
+	// stale ledgers are pruned while running
+	l.now = func() time.Time { return time.Now().Add(bitswapLedgerRetention + time.Hour) }
+	l.messageSent(p1, msg)
+	n, err = l.prune(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, ok = l.Ledger(p2)
+	require.False(t, ok)
+	require.Equal(t, 1.0, l.ratio(p2))
+	_, ok = l.Ledger(p1)
+	require.True(t, ok)
+	_, err = l.Reset(ctx, p1)
+	require.NoError(t, err)
+	l.now = time.Now
+	l.messageReceived(p2, msg)
+	require.NoError(t, l.flush(ctx))
+
+	// stale ledgers are dropped when loaded
+	l = newBitswapLedgers(ds)
+	l.now = func() time.Time { return time.Now().Add(bitswapLedgerRetention + time.Hour) }
+	require.NoError(t, l.load(ctx))
+	require.Empty(t, l.Ledgers())
+	l = newBitswapLedgers(ds)
+	require.NoError(t, l.load(ctx))
+	require.Empty(t, l.Ledgers())
+}
+
+func TestPeerRankComparator(t *testing.T) {
+	p1, p2, p3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	ranks := map[peer.ID]float64{p1: 0.5, p2: 2, p3: 1}
+	starved := map[peer.ID]bool{}
+	less := peerRankComparator(map[peer.ID]struct{}{p1: {}}, func(p peer.ID) float64 { return ranks[p] }, func(p peer.ID) bool { return starved[p] })
+	task := func(p peer.ID) *server.TaskInfo { return &server.TaskInfo{Peer: p} }
+
+	// peered peers come first, then the highest ranks
+	require.True(t, less(task(p1), task(p2)))
+	require.False(t, less(task(p2), task(p1)))
+	require.True(t, less(task(p2), task(p3)))
+	require.False(t, less(task(p3), task(p2)))
+	require.False(t, less(task(p2), task(p2)))
+
+	// unless a peer is starved
+	starved[p3] = true
+	require.True(t, less(task(p3), task(p1)))
+	require.False(t, less(task(p1), task(p3)))
+
+	// the tasks of a peer are ordered want-block first, then found blocks
+	// first, then by CID
+	c1, c2 := blocks.NewBlock([]byte("1")).Cid(), blocks.NewBlock([]byte("2")).Cid()
+	if string(c2.Hash()) < string(c1.Hash()) {
+		c1, c2 = c2, c1
+	}
+	ordered := []*server.TaskInfo{
+		{Peer: p2, Cid: c1, IsWantBlock: true, HaveBlock: true},
+		{Peer: p2, Cid: c2, IsWantBlock: true, HaveBlock: true},
+		{Peer: p2, Cid: c1, IsWantBlock: true},
+		{Peer: p2, Cid: c1, HaveBlock: true},
+		{Peer: p2, Cid: c2},
+	}
+	for i := range ordered {
+		for j := range ordered {
+			require.Equal(t, i < j, less(ordered[i], ordered[j]), "tasks %d and %d", i, j)
+		}
+	}
+}
+
+func TestPeerRankComparatorStarvation(t *testing.T) {
+	high, low := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	now := time.Now()
+	l := newBitswapLedgers(dssync.MutexWrap(datastore.NewMapDatastore()))
+	l.now = func() time.Time { return now }
+	msg := bsmsg.New(false)
+	msg.AddBlock(blocks.NewBlock(make([]byte, 1<<20)))
+	l.messageReceived(high, msg)
+	less := peerRankComparator(nil, l.ratio, l.starved)
+
+	// both peers always have requests queued, one is served every second:
+	// the peer with the lower ratio is not kept waiting forever
+	var served []time.Time
+	for range 120 {
+		winner := high
+		if less(&server.TaskInfo{Peer: low}, &server.TaskInfo{Peer: high}) {
+			winner = low
+			served = append(served, now)
+		}
+		l.messageSent(winner, bsmsg.New(false))
+		now = now.Add(time.Second)
+	}
+	require.GreaterOrEqual(t, len(served), 10)
+	for i := 1; i < len(served); i++ {
+		require.LessOrEqual(t, served[i].Sub(served[i-1]), bitswapStarvationTimeout+time.Second)
+	}
+
+	// the peers not served for long are forgotten
+	now = now.Add(bitswapStarvationTimeout + time.Second)
+	_, err := l.prune(t.Context())
+	require.NoError(t, err)
+	l.served.Range(func(any, any) bool {
+		t.Fatal("served peers are kept")
+		return false
+	})
+	require.True(t, l.starved(high))
+}
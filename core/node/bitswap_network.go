@@ -0,0 +1,84 @@
+package node
+
+import (
+	"context"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/bitswap/network"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// bitswapObserver is notified of the messages exchanged with peers, over
+// libp2p or with HTTP providers, by both the Bitswap client and server.
+//
+// Unlike bitswap.WithTracer, which only takes a single tracer, any number of
+// observers can watch the network. They are called synchronously and must
+// not block.
+type bitswapObserver interface {
+	messageSent(peer.ID, bsmsg.BitSwapMessage)
+	messageReceived(peer.ID, bsmsg.BitSwapMessage)
+}
+
+// observeBitswapNetwork wraps net to notify observers of the messages sent
+// and received.
+func observeBitswapNetwork(net network.BitSwapNetwork, observers ...bitswapObserver) network.BitSwapNetwork {
+	if len(observers) == 0 {
+		return net
+	}
+	return &observedNetwork{BitSwapNetwork: net, observers: observers}
+}
+
+type observedNetwork struct {
+	network.BitSwapNetwork
+	observers []bitswapObserver
+}
+
+func (n *observedNetwork) sent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, o := range n.observers {
+		o.messageSent(p, msg)
+	}
+}
+
+func (n *observedNetwork) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	n.sent(p, msg)
+	return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (n *observedNetwork) NewMessageSender(ctx context.Context, p peer.ID, opts *network.MessageSenderOpts) (network.MessageSender, error) {
+	s, err := n.BitSwapNetwork.NewMessageSender(ctx, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &observedSender{MessageSender: s, peer: p, net: n}, nil
+}
+
+func (n *observedNetwork) Start(receivers ...network.Receiver) {
+	wrapped := make([]network.Receiver, len(receivers))
+	for i, r := range receivers {
+		wrapped[i] = &observedReceiver{Receiver: r, observers: n.observers}
+	}
+	n.BitSwapNetwork.Start(wrapped...)
+}
+
+type observedSender struct {
+	network.MessageSender
+	peer peer.ID
+	net  *observedNetwork
+}
+
+func (s *observedSender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	s.net.sent(s.peer, msg)
+	return s.MessageSender.SendMsg(ctx, msg)
+}
+
+type observedReceiver struct {
+	network.Receiver
+	observers []bitswapObserver
+}
+
+func (r *observedReceiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, o := range r.observers {
+		o.messageReceived(p, msg)
+	}
+	r.Receiver.ReceiveMessage(ctx, p, msg)
+}
@@ -0,0 +1,425 @@
+package node
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	blockstore "github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/dag/walker"
+	"github.com/ipfs/boxo/datastore/dshelp"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/repo"
+	"go.uber.org/fx"
+)
+
+const (
+	// bitswapPinnedIndexRetry is how long to wait before rebuilding the
+	// index of pinned blocks again after a rebuild failed.
+	bitswapPinnedIndexRetry = time.Minute
+	// bitswapPinnedIndexBatch is the number of index updates written to the
+	// datastore at once.
+	bitswapPinnedIndexBatch = 1024
+)
+
+var (
+	// bitswapPinnedPrefix is the datastore prefix of the index of pinned
+	// blocks, one key per block walked from recursive pins.
+	bitswapPinnedPrefix = datastore.NewKey("/local/bitswap/pinned")
+	// bitswapPinnedReadyKey is present while the index is in sync with the
+	// pins.
+	bitswapPinnedReadyKey = datastore.NewKey("/local/bitswap/pinned-ready")
+)
+
+// pinnedIndex counts, for each block, the recursive pins whose DAG contains
+// it. It is kept in the repo datastore and updated with the pins by the
+// pinner returned by wrap, so blocks are served as soon as they are pinned.
+// Direct pins are looked up in the pinner.
+//
+// The index is rebuilt by walking all recursive pins when it is not known to
+// be in sync with them: on first use, after Bitswap.Server.ServeOnlyPinned
+// was unset, or after an update failed. Blocks of the pins not walked yet
+// are missing from the index until the rebuild is done.
+type pinnedIndex struct {
+	ds    datastore.Batching
+	fetch walker.LinksFetcher
+	// pinner is set by wrap, before the index is used.
+	pinner pin.Pinner
+
+	mu         sync.Mutex // serializes pin changes with index updates
+	ready      bool
+	rebuilding bool
+	pending    map[cid.Cid]struct{} // recursive pins the rebuild has yet to walk
+	stale      chan struct{}
+}
+
+// BitswapPinnedIndex returns the index of pinned blocks served with
+// Bitswap.Server.ServeOnlyPinned, or nil when it is not set.
+func BitswapPinnedIndex(serveOnlyPinned bool) any {
+	return func(r repo.Repo, bs blockstore.Blockstore) (*pinnedIndex, error) {
+		ctx := context.TODO()
+		ds := r.Datastore()
+		if !serveOnlyPinned {
+			// pins change without the index being updated, it must be
+			// rebuilt when used again
+			return nil, ds.Delete(ctx, bitswapPinnedReadyKey)
+		}
+		return newPinnedIndex(ctx, ds, walker.LinksFetcherFromBlockstore(bs))
+	}
+}
+
+func newPinnedIndex(ctx context.Context, ds datastore.Batching, fetch walker.LinksFetcher) (*pinnedIndex, error) {
+	ready, err := ds.Has(ctx, bitswapPinnedReadyKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pinnedIndex{
+		ds:    ds,
+		fetch: fetch,
+		ready: ready,
+		stale: make(chan struct{}, 1),
+	}, nil
+}
+
+// BitswapPinning makes the pinner keep the index of pinned blocks up to
+// date, when there is one.
+func BitswapPinning(pinning pin.Pinner, x *pinnedIndex) pin.Pinner {
+	if x == nil {
+		return pinning
+	}
+	return x.wrap(pinning)
+}
+
+// BitswapServerPinnedIndex rebuilds the index of pinned blocks in the
+// background when it is not in sync with the pins.
+func BitswapServerPinnedIndex(lc fx.Lifecycle, x *pinnedIndex) {
+	if x == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				x.run(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
+
+// Has reports whether c is pinned, directly or as part of a recursively
+// pinned DAG. It does not wait for pin changes or a rebuild to finish.
+func (x *pinnedIndex) Has(ctx context.Context, c cid.Cid) bool {
+	if has, err := x.ds.Has(ctx, pinnedIndexKey(c)); err == nil && has {
+		return true
+	}
+	if x.pinner == nil {
+		return false
+	}
+	_, pinned, err := x.pinner.IsPinnedWithType(ctx, c, pin.Direct)
+	return err == nil && pinned
+}
+
+func pinnedIndexKey(c cid.Cid) datastore.Key {
+	return bitswapPinnedPrefix.Child(dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// wrap returns pinning, updating the index when recursive pins are added
+// and removed.
+func (x *pinnedIndex) wrap(pinning pin.Pinner) pin.Pinner {
+	x.pinner = pinning
+	return &indexedPinner{Pinner: pinning, index: x}
+}
+
+func (x *pinnedIndex) run(ctx context.Context) {
+	for {
+		err := x.rebuild(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		retry := (<-chan time.Time)(nil)
+		if err != nil {
+			logger.Errorw("rebuilding index of pinned blocks served by bitswap", "error", err)
+			retry = time.After(bitswapPinnedIndexRetry)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry:
+		case <-x.stale:
+		}
+	}
+}
+
+// rebuild walks all recursive pins into an empty index, unless it is
+// already in sync with the pins. Pins can change meanwhile: the lock is only
+// held while walking one pin.
+func (x *pinnedIndex) rebuild(ctx context.Context) error {
+	x.mu.Lock()
+	if x.ready || x.pinner == nil {
+		x.mu.Unlock()
+		return nil
+	}
+	roots, err := x.reset(ctx)
+	if err != nil {
+		x.mu.Unlock()
+		return err
+	}
+	x.rebuilding = true
+	x.pending = make(map[cid.Cid]struct{}, len(roots))
+	for _, c := range roots {
+		x.pending[c] = struct{}{}
+	}
+	x.mu.Unlock()
+
+	defer func() {
+		x.mu.Lock()
+		x.rebuilding = false
+		x.pending = nil
+		x.mu.Unlock()
+	}()
+	for _, c := range roots {
+		x.mu.Lock()
+		if !x.rebuilding {
+			// an update failed, the next rebuild starts over
+			x.mu.Unlock()
+			return nil
+		}
+		_, ok := x.pending[c]
+		if ok {
+			delete(x.pending, c)
+			err = x.count(ctx, c, 1)
+		}
+		x.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.rebuilding {
+		return nil
+	}
+	if err := x.ds.Put(ctx, bitswapPinnedReadyKey, nil); err != nil {
+		return err
+	}
+	x.ready = true
+	return nil
+}
+
+// reset empties the index and returns the recursive pins. x.mu must be held.
+func (x *pinnedIndex) reset(ctx context.Context) ([]cid.Cid, error) {
+	results, err := x.ds.Query(ctx, query.Query{Prefix: bitswapPinnedPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	b, err := x.ds.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if err := b.Delete(ctx, datastore.NewKey(e.Key)); err != nil {
+			return nil, err
+		}
+		if (i+1)%bitswapPinnedIndexBatch == 0 {
+			if err := b.Commit(ctx); err != nil {
+				return nil, err
+			}
+			if b, err = x.ds.Batch(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := b.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	var roots []cid.Cid
+	for sp := range x.pinner.RecursiveKeys(ctx, false) {
+		if sp.Err != nil {
+			return nil, sp.Err
+		}
+		roots = append(roots, sp.Pin.Key)
+	}
+	return roots, nil
+}
+
+// change runs op, which adds the recursive pin add and removes the recursive
+// pin remove, either of them undefined, and updates the index accordingly.
+func (x *pinnedIndex) change(ctx context.Context, add, remove cid.Cid, op func() error) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.ready && !x.rebuilding {
+		// the next rebuild catches up
+		return op()
+	}
+
+	isRecursive := func(c cid.Cid) (bool, error) {
+		if !c.Defined() {
+			return false, nil
+		}
+		_, pinned, err := x.pinner.IsPinnedWithType(ctx, c, pin.Recursive)
+		return pinned, err
+	}
+	added, err := isRecursive(add)
+	if err != nil {
+		return err
+	}
+	added = add.Defined() && !added
+	removed, err := isRecursive(remove)
+	if err != nil {
+		return err
+	}
+
+	// the index is not in sync until updated, if the node stops meanwhile
+	if x.ready {
+		if err := x.ds.Delete(ctx, bitswapPinnedReadyKey); err != nil {
+			return err
+		}
+	}
+	if err := op(); err != nil {
+		if x.ready {
+			return errors.Join(err, x.ds.Put(ctx, bitswapPinnedReadyKey, nil))
+		}
+		return err
+	}
+
+	if added {
+		err = x.count(ctx, add, 1)
+	}
+	if removed && err == nil {
+		if _, ok := x.pending[remove]; ok {
+			delete(x.pending, remove)
+		} else {
+			err = x.count(ctx, remove, -1)
+		}
+	}
+	if err == nil && x.ready {
+		err = x.ds.Put(ctx, bitswapPinnedReadyKey, nil)
+	}
+	if err != nil {
+		// the pins changed, only the index is behind
+		logger.Errorw("updating index of pinned blocks served by bitswap, rebuilding it", "error", err)
+		x.ready = false
+		x.rebuilding = false
+		select {
+		case x.stale <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// count adds delta to the count of each block of the DAG of root. x.mu must
+// be held.
+func (x *pinnedIndex) count(ctx context.Context, root cid.Cid, delta int) error {
+	b, err := x.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		n       int
+		walkErr error
+		buf     [binary.MaxVarintLen64]byte
+	)
+	update := func(c cid.Cid) error {
+		k := pinnedIndexKey(c)
+		var count uint64
+		v, err := x.ds.Get(ctx, k)
+		switch {
+		case err == nil:
+			count, _ = binary.Uvarint(v)
+		case !errors.Is(err, datastore.ErrNotFound):
+			return err
+		}
+		if delta < 0 && count <= uint64(-delta) {
+			err = b.Delete(ctx, k)
+		} else {
+			count = uint64(int64(count) + int64(delta))
+			err = b.Put(ctx, k, buf[:binary.PutUvarint(buf[:], count)])
+		}
+		if err != nil {
+			return err
+		}
+		if n++; n%bitswapPinnedIndexBatch == 0 {
+			if err := b.Commit(ctx); err != nil {
+				return err
+			}
+			b, err = x.ds.Batch(ctx)
+		}
+		return err
+	}
+	err = walker.WalkDAG(ctx, root, x.fetch, func(c cid.Cid) bool {
+		walkErr = update(c)
+		return walkErr == nil
+	}, walker.WithVisitedTracker(walker.NewMapTracker()))
+	if err = errors.Join(err, walkErr); err != nil {
+		return err
+	}
+	return b.Commit(ctx)
+}
+
+// indexedPinner updates the index of pinned blocks with the recursive pins.
+type indexedPinner struct {
+	pin.Pinner
+	index *pinnedIndex
+}
+
+func (p *indexedPinner) Pin(ctx context.Context, node ipld.Node, recursive bool, name string) error {
+	if !recursive {
+		return p.Pinner.Pin(ctx, node, recursive, name)
+	}
+	return p.index.change(ctx, node.Cid(), cid.Undef, func() error {
+		return p.Pinner.Pin(ctx, node, recursive, name)
+	})
+}
+
+func (p *indexedPinner) PinWithMode(ctx context.Context, c cid.Cid, mode pin.Mode, name string) error {
+	if mode != pin.Recursive {
+		return p.Pinner.PinWithMode(ctx, c, mode, name)
+	}
+	return p.index.change(ctx, c, cid.Undef, func() error {
+		return p.Pinner.PinWithMode(ctx, c, mode, name)
+	})
+}
+
+func (p *indexedPinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if !recursive {
+		return p.Pinner.Unpin(ctx, c, recursive)
+	}
+	return p.index.change(ctx, cid.Undef, c, func() error {
+		return p.Pinner.Unpin(ctx, c, recursive)
+	})
+}
+
+func (p *indexedPinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	remove := cid.Undef
+	if unpin {
+		remove = from
+	}
+	return p.index.change(ctx, to, remove, func() error {
+		return p.Pinner.Update(ctx, from, to, unpin)
+	})
+}
@@ -0,0 +1,218 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"go.uber.org/fx"
+)
+
+// BitswapServerPolicy decides which requests the Bitswap server answers,
+// according to Bitswap.Server, and counts what it serves to each peer.
+//
+// Per-peer counters cover the current day of local time. The rate quota is
+// enforced when requests are received and charged when blocks are sent, so
+// blocks already requested are still sent after a peer exceeds it: the
+// peer's next requests are denied until its average rate is back under the
+// quota.
+type BitswapServerPolicy struct {
+	allow       map[peer.ID]struct{} // nil when all peers are allowed
+	deny        map[peer.ID]struct{}
+	bytesPerSec float64
+	dailyBytes  uint64
+	pinned      *pinnedIndex // nil unless serving only pinned blocks
+	now         func() time.Time
+
+	mu    sync.Mutex
+	day   int // year*1000 + day of the year
+	peers map[peer.ID]*servedLedger
+}
+
+type servedLedger struct {
+	served uint64
+	denied uint64
+	tokens float64 // bytes that can be served right away, negative in debt
+	last   time.Time
+}
+
+// BitswapPeerStat is what the Bitswap server served a peer today, as
+// reported by 'ipfs bitswap ledger'.
+type BitswapPeerStat struct {
+	// Allowed is false when Bitswap.Server.Allowlist or Denylist keep the
+	// server from answering the peer.
+	Allowed bool
+	// ServedToday is the number of block bytes served to the peer today.
+	ServedToday uint64
+	// DeniedToday is the number of requests denied to the peer today.
+	DeniedToday uint64
+	// DailyQuota is Bitswap.Server.MaxDailyBytesPerPeer, 0 when unlimited.
+	DailyQuota uint64 `json:",omitempty"`
+	// BytesPerSecond is Bitswap.Server.MaxBytesPerSecondPerPeer, 0 when
+	// unlimited.
+	BytesPerSecond uint64 `json:",omitempty"`
+}
+
+type bitswapServerOut struct {
+	fx.Out
+
+	Policy      *BitswapServerPolicy
+	BitswapOpts []bitswap.Option `group:"bitswap-options,flatten"`
+}
+
+// BitswapServer creates the policy enforcing Bitswap.Server on the Bitswap
+// server, or none when Bitswap.Server restricts nothing.
+//
+// The policy charges the blocks sent to peers as a bitswapObserver of the
+// Bitswap network.
+func BitswapServer(cfg config.BitswapServer) any {
+	return func(pinned *pinnedIndex) (bitswapServerOut, error) {
+		policy, err := newBitswapServerPolicy(cfg, pinned)
+		if err != nil || policy == nil {
+			return bitswapServerOut{}, err
+		}
+		return bitswapServerOut{
+			Policy: policy,
+			BitswapOpts: []bitswap.Option{
+				bitswap.WithPeerBlockRequestFilter(policy.allowRequest),
+			},
+		}, nil
+	}
+}
+
+// newBitswapServerPolicy returns the policy set by cfg, serving only the
+// blocks in pinned when cfg.ServeOnlyPinned is set.
+func newBitswapServerPolicy(cfg config.BitswapServer, pinned *pinnedIndex) (*BitswapServerPolicy, error) {
+	p := &BitswapServerPolicy{
+		bytesPerSec: float64(cfg.MaxBytesPerSecondPerPeer.WithDefault(config.DefaultBitswapServerMaxBytesPerSecondPerPeer)),
+		dailyBytes:  cfg.MaxDailyBytesPerPeer.WithDefault(config.DefaultBitswapServerMaxDailyBytesPerPeer),
+		now:         time.Now,
+		peers:       make(map[peer.ID]*servedLedger),
+	}
+	var err error
+	if len(cfg.Allowlist) > 0 {
+		if p.allow, err = decodePeerSet(cfg.Allowlist); err != nil {
+			return nil, err
+		}
+	}
+	if p.deny, err = decodePeerSet(cfg.Denylist); err != nil {
+		return nil, err
+	}
+	if cfg.ServeOnlyPinned.WithDefault(config.DefaultBitswapServerServeOnlyPinned) {
+		if pinned == nil {
+			return nil, errors.New("Bitswap.Server.ServeOnlyPinned needs the index of pinned blocks")
+		}
+		p.pinned = pinned
+	}
+	if p.allow == nil && len(p.deny) == 0 && p.bytesPerSec == 0 && p.dailyBytes == 0 && p.pinned == nil {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func decodePeerSet(ids []string) (map[peer.ID]struct{}, error) {
+	set := make(map[peer.ID]struct{}, len(ids))
+	for _, s := range ids {
+		pid, err := peer.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		set[pid] = struct{}{}
+	}
+	return set, nil
+}
+
+func (p *BitswapServerPolicy) allowed(pid peer.ID) bool {
+	if _, ok := p.deny[pid]; ok {
+		return false
+	}
+	if p.allow != nil {
+		_, ok := p.allow[pid]
+		return ok
+	}
+	return true
+}
+
+// allowRequest is the PeerBlockRequestFilter of the Bitswap server.
+func (p *BitswapServerPolicy) allowRequest(pid peer.ID, c cid.Cid) bool {
+	ok := p.allowed(pid) && (p.pinned == nil || p.pinned.Has(context.TODO(), c))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.ledger(pid)
+	if ok && p.dailyBytes > 0 && l.served >= p.dailyBytes {
+		ok = false
+	}
+	if ok && p.bytesPerSec > 0 {
+		p.refill(l)
+		ok = l.tokens > 0
+	}
+	if !ok {
+		l.denied++
+	}
+	return ok
+}
+
+// ledger returns the counters of pid for today. p.mu must be held.
+func (p *BitswapServerPolicy) ledger(pid peer.ID) *servedLedger {
+	now := p.now()
+	if day := now.Year()*1000 + now.YearDay(); day != p.day {
+		p.day = day
+		clear(p.peers)
+	}
+	l, ok := p.peers[pid]
+	if !ok {
+		l = &servedLedger{tokens: p.bytesPerSec, last: now}
+		p.peers[pid] = l
+	}
+	return l
+}
+
+// refill adds the bytes the rate quota allowed since the last refill, up to
+// a second worth of them. p.mu must be held.
+func (p *BitswapServerPolicy) refill(l *servedLedger) {
+	now := p.now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*p.bytesPerSec, p.bytesPerSec)
+	l.last = now
+}
+
+func (p *BitswapServerPolicy) messageReceived(peer.ID, bsmsg.BitSwapMessage) {}
+
+// messageSent charges the blocks sent to a peer to its quotas.
+func (p *BitswapServerPolicy) messageSent(pid peer.ID, msg bsmsg.BitSwapMessage) {
+	var n int
+	for _, blk := range msg.Blocks() {
+		n += len(blk.RawData())
+	}
+	if n == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.ledger(pid)
+	l.served += uint64(n)
+	if p.bytesPerSec > 0 {
+		p.refill(l)
+		l.tokens -= float64(n)
+	}
+}
+
+// PeerStat returns what the server served pid today.
+func (p *BitswapServerPolicy) PeerStat(pid peer.ID) BitswapPeerStat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.ledger(pid)
+	return BitswapPeerStat{
+		Allowed:        p.allowed(pid),
+		ServedToday:    l.served,
+		DeniedToday:    l.denied,
+		DailyQuota:     p.dailyBytes,
+		BytesPerSecond: uint64(p.bytesPerSec),
+	}
+}
@@ -0,0 +1,181 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/dag/walker"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	mdutils "github.com/ipfs/boxo/ipld/merkledag/test"
+	pin "github.com/ipfs/boxo/pinning/pinner"
+	"github.com/ipfs/boxo/pinning/pinner/dspinner"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitswapServerPolicy(t *testing.T) {
+	c := blocks.NewBlock([]byte("bitswap server policy")).Cid()
+	p1, p2, p3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+
+	t.Run("nil without restrictions", func(t *testing.T) {
+		p, err := newBitswapServerPolicy(config.BitswapServer{}, nil)
+		require.NoError(t, err)
+		require.Nil(t, p)
+
+		_, err = newBitswapServerPolicy(config.BitswapServer{Denylist: []string{"not a peer"}}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("allowlist and denylist", func(t *testing.T) {
+		p, err := newBitswapServerPolicy(config.BitswapServer{
+			Allowlist: []string{p1.String(), p2.String()},
+			Denylist:  []string{p2.String()},
+		}, nil)
+		require.NoError(t, err)
+		require.True(t, p.allowRequest(p1, c))
+		require.False(t, p.allowRequest(p2, c))
+		require.False(t, p.allowRequest(p3, c))
+
+		st := p.PeerStat(p2)
+		require.False(t, st.Allowed)
+		require.Equal(t, uint64(1), st.DeniedToday)
+	})
+
+	t.Run("quotas", func(t *testing.T) {
+		p, err := newBitswapServerPolicy(config.BitswapServer{
+			MaxBytesPerSecondPerPeer: config.NewOptionalBytes("100B"),
+			MaxDailyBytesPerPeer:     config.NewOptionalBytes("250B"),
+		}, nil)
+		require.NoError(t, err)
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+		p.now = func() time.Time { return now }
+
+		sent := func(n int) {
+			msg := bsmsg.New(false)
+			msg.AddBlock(blocks.NewBlock(make([]byte, n)))
+			p.messageSent(p1, msg)
+		}
+
+		// the peer is denied while in debt of its rate quota
+		require.True(t, p.allowRequest(p1, c))
+		sent(150)
+		require.False(t, p.allowRequest(p1, c))
+		require.True(t, p.allowRequest(p2, c))
+		now = now.Add(time.Second)
+		require.True(t, p.allowRequest(p1, c))
+
+		// then of its daily quota, until the next day
+		sent(100)
+		now = now.Add(time.Minute)
+		require.False(t, p.allowRequest(p1, c))
+		st := p.PeerStat(p1)
+		require.Equal(t, uint64(250), st.ServedToday)
+		require.Equal(t, uint64(2), st.DeniedToday)
+		require.Equal(t, uint64(250), st.DailyQuota)
+		require.Equal(t, uint64(100), st.BytesPerSecond)
+
+		now = now.Add(24 * time.Hour)
+		require.True(t, p.allowRequest(p1, c))
+		require.Zero(t, p.PeerStat(p1).ServedToday)
+	})
+}
+
+func TestPinnedIndex(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	dserv := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	dspin, err := dspinner.New(ctx, ds, dserv)
+	require.NoError(t, err)
+	fetch := walker.LinksFetcherFromBlockstore(bs)
+
+	daggen := mdutils.NewDAGGenerator()
+	dagRoot := func() (cid.Cid, cid.Cid) {
+		root, _, err := daggen.MakeDagNode(dserv.Add, 2, 2)
+		require.NoError(t, err)
+		nd, err := dserv.Get(ctx, root)
+		require.NoError(t, err)
+		return root, nd.Links()[0].Cid
+	}
+	pinned, pinnedChild := dagRoot()
+	direct, directChild := dagRoot()
+	unpinned, _ := dagRoot()
+	require.NoError(t, dspin.PinWithMode(ctx, pinned, pin.Recursive, ""))
+	require.NoError(t, dspin.PinWithMode(ctx, direct, pin.Direct, ""))
+
+	x, err := newPinnedIndex(ctx, ds, fetch)
+	require.NoError(t, err)
+	pinner := x.wrap(dspin)
+
+	// pins made before the index are walked by a rebuild
+	require.False(t, x.Has(ctx, pinned))
+	require.True(t, x.Has(ctx, direct))
+	require.NoError(t, x.rebuild(ctx))
+	require.True(t, x.Has(ctx, pinned))
+	require.True(t, x.Has(ctx, pinnedChild))
+	require.False(t, x.Has(ctx, directChild))
+	require.False(t, x.Has(ctx, unpinned))
+
+	// new recursive pins are indexed right away, even below direct pins
+	require.NoError(t, pinner.PinWithMode(ctx, direct, pin.Recursive, ""))
+	require.True(t, x.Has(ctx, directChild))
+
+	// and removed ones right away
+	require.NoError(t, pinner.Update(ctx, pinned, unpinned, true))
+	require.False(t, x.Has(ctx, pinned))
+	require.False(t, x.Has(ctx, pinnedChild))
+	require.True(t, x.Has(ctx, unpinned))
+	require.NoError(t, pinner.Unpin(ctx, direct, true))
+	require.False(t, x.Has(ctx, directChild))
+	require.False(t, x.Has(ctx, direct))
+
+	// the index is in sync with the pins after a restart
+	x, err = newPinnedIndex(ctx, ds, fetch)
+	require.NoError(t, err)
+	require.True(t, x.ready)
+	x.wrap(dspin)
+	require.NoError(t, x.rebuild(ctx))
+	require.True(t, x.Has(ctx, unpinned))
+	require.False(t, x.Has(ctx, pinned))
+
+	// lookups do not wait for a pin being indexed
+	slow, _ := dagRoot()
+	walking, release := make(chan struct{}), make(chan struct{})
+	x, err = newPinnedIndex(ctx, ds, func(ctx context.Context, c cid.Cid) ([]cid.Cid, error) {
+		if c == slow {
+			close(walking)
+			<-release
+		}
+		return fetch(ctx, c)
+	})
+	require.NoError(t, err)
+	pinner = x.wrap(dspin)
+	require.NoError(t, dspin.PinWithMode(ctx, direct, pin.Direct, ""))
+	pinning := make(chan error, 1)
+	go func() { pinning <- pinner.PinWithMode(ctx, slow, pin.Recursive, "") }()
+	<-walking
+	looked := make(chan struct{})
+	go func() {
+		defer close(looked)
+		require.True(t, x.Has(ctx, direct))
+		require.False(t, x.Has(ctx, pinned))
+	}()
+	select {
+	case <-looked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Has waited for the pin being indexed")
+	}
+	close(release)
+	require.NoError(t, <-pinning)
+	require.True(t, x.Has(ctx, slow))
+}
@@ -26,6 +26,7 @@ import (
 	"go.uber.org/fx"
 
 	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/coremfs"
 	"github.com/ipfs/kubo/core/node/helpers"
 	"github.com/ipfs/kubo/core/shutdown"
 	"github.com/ipfs/kubo/repo"
@@ -89,6 +90,7 @@ func Pinning(strategy string) func(lc fx.Lifecycle, bstore blockstore.Blockstore
 		// pinned content (roots + children), while "roots" is just the root CIDs.
 		// We prioritize "pinned" if both are somehow set (though this shouldn't happen
 		// with proper strategy parsing).
+		prov = ProvideSource(prov, ProvideSourcePin)
 		if pinned {
 			opts = append(opts, dspinner.WithPinnedProvider(prov))
 		} else if roots {
@@ -202,9 +204,25 @@ func Dag(bs blockservice.BlockService) format.DAGService {
 	return merkledag.NewDAGService(bs)
 }
 
-// Files loads persisted MFS root
-func Files(strategy string) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, bs blockstore.Blockstore, prov DHTProvider) (*mfs.Root, error) {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, bs blockstore.Blockstore, prov DHTProvider) (*mfs.Root, error) {
+// FilesJournal opens the journal of unflushed MFS changes
+func FilesJournal(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*coremfs.Journal, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	return coremfs.OpenJournal(helpers.LifecycleCtx(mctx, lc), repo.Datastore(), cfg.MFS.Journal.WithDefault(config.DefaultMFSJournal))
+}
+
+// FilesRootFlushes notifies the flushes of the MFS root
+func FilesRootFlushes() *coremfs.RootFlushes {
+	return &coremfs.RootFlushes{}
+}
+
+// Files loads persisted MFS root, and replays the changes recorded in the
+// journal that did not make it into it.
+func Files(strategy string) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, bs blockstore.Blockstore, prov DHTProvider, journal *coremfs.Journal, flushes *coremfs.RootFlushes) (*mfs.Root, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, bs blockstore.Blockstore, prov DHTProvider, journal *coremfs.Journal, flushes *coremfs.RootFlushes) (*mfs.Root, error) {
+		var root *mfs.Root
 		pf := func(ctx context.Context, c cid.Cid) error {
 			rootDS := repo.Datastore()
 			if err := rootDS.Sync(ctx, blockstore.BlockPrefix); err != nil {
@@ -217,7 +235,14 @@ func Files(strategy string) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo
 			if err := rootDS.Put(ctx, FilesRootDatastoreKey, c.Bytes()); err != nil {
 				return err
 			}
-			return rootDS.Sync(ctx, FilesRootDatastoreKey)
+			if err := rootDS.Sync(ctx, FilesRootDatastoreKey); err != nil {
+				return err
+			}
+			if err := journal.Prune(ctx, root, c); err != nil {
+				logger.Errorf("failed to prune MFS journal: %s", err)
+			}
+			flushes.Notify(c)
+			return nil
 		}
 
 		var nd *merkledag.ProtoNode
@@ -262,6 +287,8 @@ func Files(strategy string) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo
 		strategyFlag := config.MustParseProvideStrategy(strategy)
 		if strategyFlag&config.ProvideStrategyMFS == 0 {
 			prov = nil
+		} else {
+			prov = ProvideSource(prov, ProvideSourceMFS)
 		}
 
 		// Get configured settings from Import config
@@ -284,12 +311,19 @@ func Files(strategy string) func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo
 		// (ipfs/kubo#10842) is fixed on the GC side instead: MFS mutations hold
 		// the pin lock and GC snapshots the MFS root under the GC lock, so live
 		// MFS blocks are never collected out from under an in-flight write.
-		root, err := mfs.NewRoot(ctx, dag, nd, pf, prov, mfsOpts...)
+		root, err = mfs.NewRoot(ctx, dag, nd, pf, prov, mfsOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize MFS root from %s stored at %s: %w. "+
 				"If corrupted, use 'ipfs files chroot' to reset (see --help)", nd.Cid(), FilesRootDatastoreKey, err)
 		}
 
+		// Journaled changes were stored locally when recorded, do not look
+		// for them on the network.
+		offlineDag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+		if _, err := journal.Replay(ctx, root, offlineDag); err != nil {
+			return nil, fmt.Errorf("failed to replay MFS journal: %w", err)
+		}
+
 		lc.Append(fx.Hook{
 			OnStop: func(ctx context.Context) error {
 				return shutdown.CloseWithCtx(ctx, "mfs-root", root.Close)
@@ -6,14 +6,13 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"time"
 
 	blockstore "github.com/ipfs/boxo/blockstore"
 	offline "github.com/ipfs/boxo/exchange/offline"
 	uio "github.com/ipfs/boxo/ipld/unixfs/io"
-	util "github.com/ipfs/boxo/util"
 	"github.com/ipfs/go-log/v2"
 	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/coreipns"
 	"github.com/ipfs/kubo/core/node/libp2p"
 	"github.com/ipfs/kubo/p2p"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -28,6 +27,7 @@ var logger = log.Logger("core:constructor")
 var BaseLibP2P = fx.Options(
 	fx.Provide(libp2p.PNet),
 	fx.Provide(libp2p.ConnectionManager),
+	fx.Provide(DelegatedPublishQueue),
 	fx.Provide(libp2p.Host),
 	fx.Provide(libp2p.MultiaddrResolver),
 
@@ -323,28 +323,9 @@ func Online(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 
 	// Republisher params
 
-	var repubPeriod, recordLifetime time.Duration
-
-	if cfg.Ipns.RepublishPeriod != "" {
-		d, err := time.ParseDuration(cfg.Ipns.RepublishPeriod)
-		if err != nil {
-			return fx.Error(fmt.Errorf("failure to parse config setting IPNS.RepublishPeriod: %s", err))
-		}
-
-		if !util.Debug && (d < time.Minute || d > (time.Hour*24)) {
-			return fx.Error(fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", d))
-		}
-
-		repubPeriod = d
-	}
-
-	if cfg.Ipns.RecordLifetime != "" {
-		d, err := time.ParseDuration(cfg.Ipns.RecordLifetime)
-		if err != nil {
-			return fx.Error(fmt.Errorf("failure to parse config setting IPNS.RecordLifetime: %s", err))
-		}
-
-		recordLifetime = d
+	repubSettings, err := coreipns.RepublishSettingsFromConfig(&cfg.Ipns)
+	if err != nil {
+		return fx.Error(err)
 	}
 
 	isBitswapLibp2pEnabled := cfg.Bitswap.Libp2pEnabled.WithDefault(config.DefaultBitswapLibp2pEnabled)
@@ -359,14 +340,19 @@ func Online(bcfg *BuildCfg, cfg *config.Config, userResourceOverrides rcmgr.Part
 
 	return fx.Options(
 		fx.Provide(BitswapOptions(cfg)),
+		fx.Provide(NewRetrievalTracer),
+		fx.Provide(NewBitswapLedgers),
+		maybeProvide(BitswapServer(cfg.Bitswap.Server), isBitswapServerEnabled),
+		maybeProvide(BitswapServerStrategy(cfg), isBitswapServerEnabled),
+		maybeInvoke(BitswapServerPinnedIndex, isBitswapServerEnabled),
 		fx.Provide(Bitswap(isBitswapServerEnabled, isBitswapLibp2pEnabled, isHTTPRetrievalEnabled)),
 		fx.Provide(OnlineExchange(isBitswapLibp2pEnabled)),
 		fx.Provide(DNSResolver),
-		fx.Provide(Namesys(ipnsCacheSize, cfg.Ipns.MaxCacheTTL.WithDefault(config.DefaultIpnsMaxCacheTTL))),
+		fx.Provide(Namesys(ipnsCacheSize, cfg.Ipns.MaxCacheTTL.WithDefault(config.DefaultIpnsMaxCacheTTL), int(cfg.Ipns.ArchiveKeep.WithDefault(config.DefaultIpnsArchiveKeep)))),
 		fx.Provide(Peering),
 		PeerWith(cfg.Peering.Peers...),
 
-		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
+		fx.Provide(IpnsRepublisher(repubSettings)),
 		fx.Invoke(PurgeStaleDHTValueRecords),
 
 		fx.Provide(p2p.New),
@@ -381,7 +367,7 @@ func Offline(cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(offline.Exchange),
 		fx.Provide(DNSResolver),
-		fx.Provide(Namesys(0, 0)),
+		fx.Provide(Namesys(0, 0, int(cfg.Ipns.ArchiveKeep.WithDefault(config.DefaultIpnsArchiveKeep)))),
 		fx.Provide(libp2p.Routing),
 		fx.Provide(libp2p.ContentRouting),
 		fx.Provide(libp2p.OfflineRouting),
@@ -455,6 +441,8 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 	uio.HAMTSizeEstimation = cfg.Import.HAMTSizeEstimationMode()
 
 	providerStrategy := cfg.Provide.Strategy.WithDefault(config.DefaultProvideStrategy)
+	serveOnlyPinned := cfg.Bitswap.ServerEnabled.WithDefault(config.DefaultBitswapServerEnabled) &&
+		cfg.Bitswap.Server.ServeOnlyPinned.WithDefault(config.DefaultBitswapServerServeOnlyPinned)
 
 	return fx.Options(
 		bcfgOpts,
@@ -465,6 +453,10 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 		Networked(bcfg, cfg, userResourceOverrides),
 		fx.Provide(BlockService(cfg)),
 		fx.Provide(Pinning(providerStrategy)),
+		fx.Provide(BitswapPinnedIndex(serveOnlyPinned)),
+		fx.Decorate(BitswapPinning),
+		fx.Provide(FilesJournal),
+		fx.Provide(FilesRootFlushes),
 		fx.Provide(Files(providerStrategy)),
 		Core,
 	)
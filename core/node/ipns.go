@@ -1,18 +1,17 @@
 package node
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/ipfs/boxo/ipns"
-	util "github.com/ipfs/boxo/util"
 	record "github.com/libp2p/go-libp2p-record"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	madns "github.com/multiformats/go-multiaddr-dns"
 
 	"github.com/ipfs/boxo/namesys"
-	"github.com/ipfs/boxo/namesys/republisher"
+	"github.com/ipfs/kubo/core/coreipns"
 	"github.com/ipfs/kubo/repo"
 	irouting "github.com/ipfs/kubo/routing"
 )
@@ -28,7 +27,7 @@ func RecordValidator(ps peerstore.Peerstore) record.Validator {
 }
 
 // Namesys creates new name system
-func Namesys(cacheSize int, cacheMaxTTL time.Duration) func(rt irouting.ProvideManyRouter, rslv *madns.Resolver, repo repo.Repo) (namesys.NameSystem, error) {
+func Namesys(cacheSize int, cacheMaxTTL time.Duration, archiveKeep int) func(rt irouting.ProvideManyRouter, rslv *madns.Resolver, repo repo.Repo) (namesys.NameSystem, error) {
 	return func(rt irouting.ProvideManyRouter, rslv *madns.Resolver, repo repo.Repo) (namesys.NameSystem, error) {
 		opts := []namesys.Option{
 			namesys.WithDatastore(repo.Datastore()),
@@ -40,32 +39,38 @@ func Namesys(cacheSize int, cacheMaxTTL time.Duration) func(rt irouting.ProvideM
 			opts = append(opts, namesys.WithCache(cacheSize))
 		}
 
-		return namesys.NewNameSystem(rt, opts...)
+		ns, err := namesys.NewNameSystem(coreipns.NamesysValueStore(rt), opts...)
+		if err != nil {
+			return nil, err
+		}
+		return coreipns.ArchivingNameSystem(ns, repo.Datastore(), archiveKeep), nil
 	}
 }
 
 // IpnsRepublisher runs new IPNS republisher service
-func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcStartStop, namesys.NameSystem, repo.Repo, crypto.PrivKey) error {
-	return func(lc lcStartStop, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) error {
-		repub := republisher.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore())
-
-		if repubPeriod != 0 {
-			if !util.Debug && (repubPeriod < time.Minute || repubPeriod > (time.Hour*24)) {
-				return fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
-			}
-
-			repub.Interval = repubPeriod
-		}
-
-		if recordLifetime != 0 {
-			repub.RecordLifetime = recordLifetime
-		}
-
-		if repub.RecordLifetime < repub.Interval {
-			return fmt.Errorf("config setting IPNS.RecordLifetime (%s) must be >= IPNS.RepublishPeriod (%s), otherwise records expire before they are republished", repub.RecordLifetime, repub.Interval)
-		}
-
+func IpnsRepublisher(settings coreipns.RepublishSettings) func(lcStartStop, namesys.NameSystem, repo.Repo, crypto.PrivKey) *coreipns.Republisher {
+	return func(lc lcStartStop, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) *coreipns.Republisher {
+		repub := coreipns.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore(), settings)
 		lc.Append(repub.Run)
-		return nil
+		return repub
 	}
 }
+
+// DelegatedPublishQueue runs the queue retrying the IPNS records delegated
+// publishers failed to accept
+func DelegatedPublishQueue(lc lcStartStop, repo repo.Repo) *irouting.PublishQueue {
+	queue := irouting.NewPublishQueue(repo.Datastore())
+	lc.Append(func() func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			queue.Run(ctx)
+		}()
+		return func() {
+			cancel()
+			<-done
+		}
+	})
+	return queue
+}
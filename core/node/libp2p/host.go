@@ -15,6 +15,7 @@ import (
 	"github.com/ipfs/kubo/core/node/helpers"
 	"github.com/ipfs/kubo/core/shutdown"
 	"github.com/ipfs/kubo/repo"
+	irouting "github.com/ipfs/kubo/routing"
 
 	"go.uber.org/fx"
 )
@@ -28,6 +29,7 @@ type P2PHostIn struct {
 	RoutingOption RoutingOption
 	ID            peer.ID
 	Peerstore     peerstore.Peerstore
+	PublishQueue  *irouting.PublishQueue
 
 	Opts [][]libp2p.Option `group:"libp2p"`
 }
@@ -74,6 +76,7 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 		OptimisticProvide:             optimisticProvide,
 		OptimisticProvideJobsPoolSize: cfg.Experimental.OptimisticProvideJobsPoolSize,
 		LoopbackAddressesOnLanDHT:     cfg.Routing.LoopbackAddressesOnLanDHT.WithDefault(config.DefaultLoopbackAddressesOnLanDHT),
+		PublishQueue:                  params.PublishQueue,
 	}
 	opts = append(opts, libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
 		args := routingOptArgs
@@ -47,9 +47,10 @@ type processInitialRoutingIn struct {
 	Router routing.Routing `name:"initialrouting"`
 
 	// For setting up experimental DHT client
-	Host      host.Host
-	Repo      repo.Repo
-	Validator record.Validator
+	Host         host.Host
+	Repo         repo.Repo
+	Validator    record.Validator
+	PublishQueue *irouting.PublishQueue
 }
 
 type processInitialRoutingOut struct {
@@ -124,7 +125,7 @@ func BaseRouting(cfg *config.Config) any {
 			// we want to also use the default HTTP routers, so wrap the FullRT client
 			// in a parallel router that calls them in parallel
 			addrFunc := httpRouterAddrFunc(in.Host, cfg.Addresses)
-			httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc)
+			httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc, in.PublishQueue)
 			if err != nil {
 				return out, err
 			}
@@ -189,8 +190,9 @@ func ContentDiscovery(in irouting.ProvideManyRouter) routing.ContentDiscovery {
 type p2pOnlineRoutingIn struct {
 	fx.In
 
-	Routers   []Router `group:"routers"`
-	Validator record.Validator
+	Routers      []Router `group:"routers"`
+	Validator    record.Validator
+	PublishQueue *irouting.PublishQueue `optional:"true"`
 }
 
 // Routing will get all routers obtained from different methods (delegated
@@ -211,7 +213,12 @@ func Routing(in p2pOnlineRoutingIn) irouting.ProvideManyRouter {
 		})
 	}
 
-	return routinghelpers.NewComposableParallel(cRouters)
+	router := routinghelpers.NewComposableParallel(cRouters)
+	if in.PublishQueue != nil {
+		// failed delegated publishes are retried until the record expires
+		return in.PublishQueue.Wrap(router)
+	}
+	return router
 }
 
 // OfflineRouting provides a special Router to the routers list when we are
@@ -30,6 +30,7 @@ type RoutingOptionArgs struct {
 	OptimisticProvide             bool
 	OptimisticProvideJobsPoolSize int
 	LoopbackAddressesOnLanDHT     bool
+	PublishQueue                  *irouting.PublishQueue
 }
 
 type RoutingOption func(args RoutingOptionArgs) (routing.Routing, error)
@@ -106,7 +107,7 @@ func collectAllEndpoints(cfg *config.Config) []EndpointSource {
 	return endpoints
 }
 
-func constructDefaultHTTPRouters(cfg *config.Config, addrFunc func() []ma.Multiaddr) ([]*routinghelpers.ParallelRouter, error) {
+func constructDefaultHTTPRouters(cfg *config.Config, addrFunc func() []ma.Multiaddr, queue *irouting.PublishQueue) ([]*routinghelpers.ParallelRouter, error) {
 	var routers []*routinghelpers.ParallelRouter
 	httpRetrievalEnabled := cfg.HTTPRetrieval.Enabled.WithDefault(config.DefaultHTTPRetrievalEnabled)
 
@@ -131,7 +132,7 @@ func constructDefaultHTTPRouters(cfg *config.Config, addrFunc func() []ma.Multia
 	// Create single HTTP router and composer per origin
 	for baseURL, capabilities := range originCapabilities {
 		// Construct HTTP router using base URL (without path)
-		httpRouter, err := irouting.ConstructHTTPRouter(baseURL, cfg.Identity.PeerID, addrFunc, cfg.Identity.PrivKey, httpRetrievalEnabled)
+		httpRouter, err := irouting.ConstructHTTPRouter(baseURL, cfg.Identity.PeerID, addrFunc, cfg.Identity.PrivKey, httpRetrievalEnabled, queue)
 		if err != nil {
 			return nil, err
 		}
@@ -193,7 +194,7 @@ func ConstructDelegatedOnlyRouting(cfg *config.Config) RoutingOption {
 
 		// Add HTTP delegated routers (includes both router and publisher capabilities)
 		addrFunc := httpRouterAddrFunc(args.Host, cfg.Addresses)
-		httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc)
+		httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc, args.PublishQueue)
 		if err != nil {
 			return nil, err
 		}
@@ -228,7 +229,7 @@ func ConstructDefaultRouting(cfg *config.Config, routingOpt RoutingOption) Routi
 		})
 
 		addrFunc := httpRouterAddrFunc(args.Host, cfg.Addresses)
-		httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc)
+		httpRouters, err := constructDefaultHTTPRouters(cfg, addrFunc, args.PublishQueue)
 		if err != nil {
 			return nil, err
 		}
@@ -302,6 +303,7 @@ func ConstructDelegatedRouting(routers config.Routers, methods config.Methods, p
 				AddrFunc:      addrFunc,
 				PrivKeyB64:    privKey,
 				HTTPRetrieval: httpRetrieval,
+				PublishQueue:  args.PublishQueue,
 			},
 		)
 	}
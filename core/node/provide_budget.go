@@ -0,0 +1,276 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p-kad-dht/amino"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
+)
+
+// providerRecordSizeEstimate is the assumed size of a provider record
+// message, a multihash and the addresses of the node, until messages are
+// sent and measured.
+const providerRecordSizeEstimate = 256
+
+// provideValidityMargin is kept between a stretched reprovide interval and
+// the validity of provider records, so a reprovide cycle running late does
+// not let the records expire.
+const provideValidityMargin = 6 * time.Hour
+
+// ProvideBudget limits the rate of the messages the sweeping provider sends
+// to DHT servers, and restricts them to a daily window of local time.
+// Messages wait for the budget, so reprovides stretch over a longer time.
+type ProvideBudget struct {
+	msgs        *rate.Limiter // nil when unlimited
+	bytes       *rate.Limiter // nil when unlimited
+	activeHours string
+	start, end  time.Duration // active window, from midnight
+	window      bool
+	interval    time.Duration
+	now         func() time.Time
+
+	sent      atomic.Int64
+	sentBytes atomic.Int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ProvideBudgetStat describes the rate budget of the provider, as reported
+// by 'ipfs provide stat'.
+type ProvideBudgetStat struct {
+	MessagesPerSecond int64  `json:",omitempty"`
+	BytesPerSecond    uint64 `json:",omitempty"`
+	ActiveHours       string `json:",omitempty"`
+	// CycleDuration estimates how long reproviding all scheduled keys takes
+	// within the budget. It is zero when messages are not rate limited.
+	CycleDuration time.Duration
+	// Interval is the configured Provide.DHT.Interval.
+	Interval time.Duration
+}
+
+// newProvideBudget returns the budget set by the Provide.DHT config, or nil
+// when it sets none.
+func newProvideBudget(cfg config.ProvideDHT, interval time.Duration) (*ProvideBudget, error) {
+	msgsPerSec := cfg.MaxMessagesPerSecond.WithDefault(config.DefaultProvideDHTMaxMessagesPerSecond)
+	bytesPerSec := cfg.MaxBytesPerSecond.WithDefault(config.DefaultProvideDHTMaxBytesPerSecond)
+	activeHours := cfg.ActiveHours.WithDefault(config.DefaultProvideDHTActiveHours)
+	start, end, window, err := config.ParseActiveHours(activeHours)
+	if err != nil {
+		return nil, err
+	}
+	if msgsPerSec == 0 && bytesPerSec == 0 && !window {
+		return nil, nil
+	}
+
+	b := &ProvideBudget{
+		activeHours: activeHours,
+		start:       start,
+		end:         end,
+		window:      window,
+		interval:    interval,
+		now:         time.Now,
+	}
+	if msgsPerSec > 0 {
+		b.msgs = rate.NewLimiter(rate.Limit(msgsPerSec), int(msgsPerSec))
+	}
+	if bytesPerSec > 0 {
+		// allow bursts of a second, or of one message for tiny budgets
+		b.bytes = rate.NewLimiter(rate.Limit(bytesPerSec), int(max(bytesPerSec, 4<<10)))
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	return b, nil
+}
+
+// MessageSender wraps the message sender used by the sweeping provider so
+// its messages wait for the budget.
+func (b *ProvideBudget) MessageSender(ms dht_pb.MessageSender) dht_pb.MessageSender {
+	return &budgetSender{MessageSender: ms, budget: b}
+}
+
+type budgetSender struct {
+	dht_pb.MessageSender
+	budget *ProvideBudget
+}
+
+func (s *budgetSender) SendRequest(ctx context.Context, p peer.ID, pmes *dht_pb.Message) (*dht_pb.Message, error) {
+	ctx, cancel, err := s.budget.wait(ctx, pmes)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return s.MessageSender.SendRequest(ctx, p, pmes)
+}
+
+func (s *budgetSender) SendMessage(ctx context.Context, p peer.ID, pmes *dht_pb.Message) error {
+	ctx, cancel, err := s.budget.wait(ctx, pmes)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	return s.MessageSender.SendMessage(ctx, p, pmes)
+}
+
+// wait blocks until pmes fits in the budget, and returns the context to send
+// it with.
+//
+// The provider bounds each send with a timeout, which must not include the
+// time waiting for the budget: when the send had to wait, it gets a fresh
+// timeout of the same length. Only the deadline is extended, waiting and
+// sending still stop when ctx is canceled or the budget is closed.
+func (b *ProvideBudget) wait(ctx context.Context, pmes *dht_pb.Message) (context.Context, context.CancelFunc, error) {
+	size := proto.Size(pmes)
+	begin := time.Now()
+
+	waitCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stopBudget := context.AfterFunc(b.ctx, func() { cancel(b.ctx.Err()) })
+	stopParent := context.AfterFunc(ctx, func() {
+		if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			cancel(context.Cause(ctx))
+		}
+	})
+	release := func() {
+		stopBudget()
+		stopParent()
+		cancel(context.Canceled)
+	}
+	fail := func(err error) (context.Context, context.CancelFunc, error) {
+		if cause := context.Cause(waitCtx); cause != nil {
+			err = cause
+		}
+		release()
+		return nil, nil, err
+	}
+
+	if b.window {
+		for d := b.untilActive(b.now()); d > 0; d = b.untilActive(b.now()) {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-waitCtx.Done():
+				t.Stop()
+				return fail(waitCtx.Err())
+			}
+		}
+	}
+	if b.msgs != nil {
+		if err := b.msgs.Wait(waitCtx); err != nil {
+			return fail(err)
+		}
+	}
+	if b.bytes != nil {
+		if err := b.bytes.WaitN(waitCtx, min(size, b.bytes.Burst())); err != nil {
+			return fail(err)
+		}
+	}
+	b.sent.Add(1)
+	b.sentBytes.Add(int64(size))
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Since(begin) < time.Millisecond {
+		release()
+		return ctx, func() {}, nil
+	}
+	sendCtx, cancelSend := context.WithTimeout(waitCtx, deadline.Sub(begin))
+	return sendCtx, func() { cancelSend(); release() }, nil
+}
+
+// untilActive returns how long until the active window opens, or zero if
+// it is open at t.
+func (b *ProvideBudget) untilActive(t time.Time) time.Duration {
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	var active bool
+	if b.start < b.end {
+		active = offset >= b.start && offset < b.end
+	} else {
+		active = offset >= b.start || offset < b.end
+	}
+	if active {
+		return 0
+	}
+	until := b.start - offset
+	if until < 0 {
+		until += 24 * time.Hour
+	}
+	return until
+}
+
+// activeFraction returns the fraction of the day in the active window.
+func (b *ProvideBudget) activeFraction() float64 {
+	if !b.window {
+		return 1
+	}
+	length := b.end - b.start
+	if length < 0 {
+		length += 24 * time.Hour
+	}
+	return float64(length) / float64(24*time.Hour)
+}
+
+// CycleDuration estimates how long sending provider records for keys to
+// replication DHT servers each takes within the budget. It is zero when
+// messages are not rate limited.
+func (b *ProvideBudget) CycleDuration(keys, replication int) time.Duration {
+	perSec := math.Inf(1)
+	if b.msgs != nil {
+		perSec = float64(b.msgs.Limit())
+	}
+	if b.bytes != nil {
+		msgSize := float64(providerRecordSizeEstimate)
+		if sent := b.sent.Load(); sent > 0 {
+			msgSize = float64(b.sentBytes.Load()) / float64(sent)
+		}
+		perSec = min(perSec, float64(b.bytes.Limit())/msgSize)
+	}
+	if math.IsInf(perSec, 1) || keys <= 0 {
+		return 0
+	}
+	seconds := float64(keys) * float64(replication) / perSec / b.activeFraction()
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// stretchInterval returns the reprovide interval to use when a reprovide
+// cycle takes need within the budget: interval, or need when it is longer,
+// capped provideValidityMargin below the validity of provider records. It
+// reports whether need fits in the returned interval.
+func stretchInterval(interval, need time.Duration) (time.Duration, bool) {
+	if need <= interval {
+		return interval, true
+	}
+	limit := max(interval, amino.DefaultProvideValidity-provideValidityMargin)
+	return min(need.Round(time.Minute), limit), need <= limit
+}
+
+// Stat describes the budget, estimating the cycle duration for keys
+// replicated on replication DHT servers.
+func (b *ProvideBudget) Stat(keys, replication int) ProvideBudgetStat {
+	st := ProvideBudgetStat{
+		ActiveHours:   b.activeHours,
+		CycleDuration: b.CycleDuration(keys, replication),
+		Interval:      b.interval,
+	}
+	if b.msgs != nil {
+		st.MessagesPerSecond = int64(b.msgs.Limit())
+	}
+	if b.bytes != nil {
+		st.BytesPerSecond = uint64(b.bytes.Limit())
+	}
+	return st
+}
+
+// Close stops messages from waiting for the budget. Waiting messages fail.
+func (b *ProvideBudget) Close() error {
+	if b != nil {
+		b.cancel()
+	}
+	return nil
+}
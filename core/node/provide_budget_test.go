@@ -0,0 +1,143 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p-kad-dht/amino"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// ctxSender fails messages sent with a done context.
+type ctxSender struct{ fakeSender }
+
+func (s *ctxSender) SendMessage(ctx context.Context, p peer.ID, pmes *dht_pb.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.fakeSender.SendMessage(ctx, p, pmes)
+}
+
+func TestProvideBudget(t *testing.T) {
+	t.Run("nil without limits", func(t *testing.T) {
+		b, err := newProvideBudget(config.ProvideDHT{}, time.Hour)
+		require.NoError(t, err)
+		require.Nil(t, b)
+		require.NoError(t, b.Close())
+	})
+
+	t.Run("rejects invalid active hours", func(t *testing.T) {
+		_, err := newProvideBudget(config.ProvideDHT{ActiveHours: config.NewOptionalString("25:00-01:00")}, time.Hour)
+		require.Error(t, err)
+	})
+
+	t.Run("active hours", func(t *testing.T) {
+		b, err := newProvideBudget(config.ProvideDHT{ActiveHours: config.NewOptionalString("22:00-06:00")}, time.Hour)
+		require.NoError(t, err)
+		defer b.Close()
+
+		at := func(hour, minute int) time.Time {
+			return time.Date(2026, 1, 1, hour, minute, 0, 0, time.UTC)
+		}
+		require.Zero(t, b.untilActive(at(23, 0)))
+		require.Zero(t, b.untilActive(at(5, 59)))
+		require.Equal(t, 30*time.Minute, b.untilActive(at(21, 30)))
+		require.Equal(t, 16*time.Hour, b.untilActive(at(6, 0)))
+		require.InDelta(t, 8.0/24, b.activeFraction(), 1e-9)
+	})
+
+	t.Run("cycle duration", func(t *testing.T) {
+		b, err := newProvideBudget(config.ProvideDHT{
+			MaxMessagesPerSecond: config.NewOptionalInteger(10),
+			ActiveHours:          config.NewOptionalString("00:00-12:00"),
+		}, time.Hour)
+		require.NoError(t, err)
+		defer b.Close()
+
+		// 1000 keys on 20 peers at 10 messages per second, half of the day
+		require.Equal(t, 4000*time.Second, b.CycleDuration(1000, 20))
+		require.Zero(t, b.CycleDuration(0, 20))
+
+		st := b.Stat(1000, 20)
+		require.Equal(t, int64(10), st.MessagesPerSecond)
+		require.Equal(t, "00:00-12:00", st.ActiveHours)
+		require.Equal(t, time.Hour, st.Interval)
+	})
+
+	t.Run("stretched interval", func(t *testing.T) {
+		limit := amino.DefaultProvideValidity - provideValidityMargin
+
+		interval, fits := stretchInterval(22*time.Hour, time.Hour)
+		require.Equal(t, 22*time.Hour, interval)
+		require.True(t, fits)
+
+		interval, fits = stretchInterval(22*time.Hour, 30*time.Hour+20*time.Second)
+		require.Equal(t, 30*time.Hour, interval)
+		require.True(t, fits)
+
+		// the interval stays below the validity of provider records
+		interval, fits = stretchInterval(22*time.Hour, 72*time.Hour)
+		require.Equal(t, limit, interval)
+		require.False(t, fits)
+
+		// but a longer configured interval is kept
+		interval, fits = stretchInterval(60*time.Hour, 72*time.Hour)
+		require.Equal(t, 60*time.Hour, interval)
+		require.False(t, fits)
+	})
+
+	t.Run("messages wait for the budget", func(t *testing.T) {
+		ctx := t.Context()
+		b, err := newProvideBudget(config.ProvideDHT{MaxMessagesPerSecond: config.NewOptionalInteger(20)}, time.Hour)
+		require.NoError(t, err)
+		defer b.Close()
+
+		h, err := mh.Sum([]byte("provide budget"), mh.SHA2_256, -1)
+		require.NoError(t, err)
+		pmes := dht_pb.NewMessage(dht_pb.Message_ADD_PROVIDER, h, 0)
+		sender := b.MessageSender(&ctxSender{})
+		p := test.RandPeerIDFatal(t)
+
+		// the burst of a second goes through, the next messages wait
+		begin := time.Now()
+		for range 25 {
+			require.NoError(t, sender.SendMessage(ctx, p, pmes))
+		}
+		require.GreaterOrEqual(t, time.Since(begin), 200*time.Millisecond)
+		require.Equal(t, int64(25), b.sent.Load())
+
+		// a send timeout does not include the wait for the budget
+		sendCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		require.NoError(t, sender.SendMessage(sendCtx, p, pmes))
+
+		// canceling the send stops waiting for the budget
+		cancelCtx, cancelSend := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancelSend)
+		require.ErrorIs(t, sender.SendMessage(cancelCtx, p, pmes), context.Canceled)
+
+		// and cancels the extended send context
+		waitedCtx, cancelWaited := context.WithTimeout(ctx, time.Second)
+		defer cancelWaited()
+		b.msgs.ReserveN(time.Now(), 2) // the next message waits
+		extended, release, err := b.wait(waitedCtx, pmes)
+		require.NoError(t, err)
+		defer release()
+		deadline, _ := extended.Deadline()
+		parentDeadline, _ := waitedCtx.Deadline()
+		require.True(t, deadline.After(parentDeadline))
+		cancelWaited()
+		<-extended.Done()
+		require.ErrorIs(t, extended.Err(), context.Canceled)
+
+		// waiting messages fail once the budget is closed
+		b.Close()
+		require.ErrorIs(t, sender.SendMessage(ctx, p, pmes), context.Canceled)
+	})
+}
@@ -0,0 +1,374 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/datastore/dshelp"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/buffered"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/keystore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// Sources of the keys in the provide queue, as shown by
+// 'ipfs provide queue ls'.
+const (
+	ProvideSourceBlockstore  = "blockstore"
+	ProvideSourcePin         = "pin"
+	ProvideSourceMFS         = "mfs"
+	ProvideSourceFastProvide = "fast-provide"
+	ProvideSourceRouting     = "routing-provide"
+	ProvideSourceProvideOnce = "provide-once"
+	// ProvideSourceOther is the source of keys queued by callers that do
+	// not set one.
+	ProvideSourceOther = "other"
+)
+
+// provideQueueDroppingKey is the namespace, under the provider one, of the
+// scheduled keys being dropped from the provide queue. They are recorded
+// before the provider removes them from the keystore with the queue, and
+// put back into it on the next start if that could not be done.
+var provideQueueDroppingKey = datastore.NewKey("queue-dropping")
+
+// provideQueueMaxTracked bounds the number of queued keys whose age and
+// source are tracked. Keys queued beyond it are only counted.
+const provideQueueMaxTracked = 1 << 16
+
+// ProvideQueueEntry is a key waiting in the provide queue.
+type ProvideQueueEntry struct {
+	Key    mh.Multihash
+	Queued time.Time
+	Source string
+}
+
+// ProvideQueue wraps the sweeping provider to track the keys waiting in its
+// provide queue, and lets them be handed to its burst workers right away or
+// dropped from it. A key is tracked from the moment it is handed to the
+// provider until the first provider record is sent for it.
+type ProvideQueue struct {
+	DHTProvider
+
+	ds       datastore.Batching
+	ks       keystore.Keystore
+	interval time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]ProvideQueueEntry // by multihash
+	overflow int
+}
+
+func newProvideQueue(ds datastore.Batching, ks keystore.Keystore, interval time.Duration) *ProvideQueue {
+	return &ProvideQueue{
+		ds:       namespace.Wrap(ds, provideQueueDroppingKey),
+		ks:       ks,
+		interval: interval,
+		entries:  make(map[string]ProvideQueueEntry),
+	}
+}
+
+// ProvideSource returns a provider that tags the keys it queues with source,
+// when prov tracks its queue. Otherwise it returns prov.
+func ProvideSource(prov DHTProvider, source string) DHTProvider {
+	if q, ok := prov.(*ProvideQueue); ok {
+		return &sourcedProvider{ProvideQueue: q, source: source}
+	}
+	return prov
+}
+
+type sourcedProvider struct {
+	*ProvideQueue
+	source string
+}
+
+func (s *sourcedProvider) StartProviding(force bool, keys ...mh.Multihash) error {
+	return s.startProviding(s.source, force, keys)
+}
+
+func (s *sourcedProvider) ProvideOnce(keys ...mh.Multihash) error {
+	return s.provideOnce(s.source, keys)
+}
+
+func (q *ProvideQueue) StartProviding(force bool, keys ...mh.Multihash) error {
+	return q.startProviding(ProvideSourceOther, force, keys)
+}
+
+func (q *ProvideQueue) ProvideOnce(keys ...mh.Multihash) error {
+	return q.provideOnce(ProvideSourceOther, keys)
+}
+
+func (q *ProvideQueue) startProviding(source string, force bool, keys []mh.Multihash) error {
+	q.track(source, keys)
+	return q.DHTProvider.StartProviding(force, keys...)
+}
+
+func (q *ProvideQueue) provideOnce(source string, keys []mh.Multihash) error {
+	q.track(source, keys)
+	return q.DHTProvider.ProvideOnce(keys...)
+}
+
+// track records keys as queued. It runs for every block written, so it does
+// not look keys up in the keystore: keys the provider skips because they are
+// already scheduled are untracked by the buffer worker, see wrapSweeper.
+func (q *ProvideQueue) track(source string, keys []mh.Multihash) {
+	now := time.Now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, h := range keys {
+		if _, tracked := q.entries[string(h)]; tracked {
+			continue
+		}
+		if len(q.entries) >= provideQueueMaxTracked {
+			q.overflow++
+			continue
+		}
+		q.entries[string(h)] = ProvideQueueEntry{Key: h, Queued: now, Source: source}
+	}
+}
+
+// sweepProvider is the provider the buffer in front of the provide queue
+// hands keys to.
+type sweepProvider interface {
+	StartProviding(force bool, keys ...mh.Multihash) error
+	StopProviding(keys ...mh.Multihash) error
+	ProvideOnce(keys ...mh.Multihash) error
+	Clear() int
+	RefreshSchedule() error
+	Close() error
+}
+
+// wrapSweeper wraps the sweeping provider behind the buffer of the provide
+// queue, so that keys it skips because they are already scheduled stop being
+// tracked as queued.
+func (q *ProvideQueue) wrapSweeper(prov sweepProvider) sweepProvider {
+	return &queueSweeper{sweepProvider: prov, queue: q}
+}
+
+type queueSweeper struct {
+	sweepProvider
+	queue *ProvideQueue
+}
+
+func (p *queueSweeper) StartProviding(force bool, keys ...mh.Multihash) error {
+	if !force {
+		p.queue.untrackScheduled(keys)
+	}
+	return p.sweepProvider.StartProviding(force, keys...)
+}
+
+// untrackScheduled stops tracking the keys already in the keystore, which the
+// provider does not queue again. It runs in the buffer worker, away from
+// block writes, and only looks up the keys that are tracked.
+func (q *ProvideQueue) untrackScheduled(keys []mh.Multihash) {
+	if q.ks == nil {
+		return
+	}
+	q.mu.Lock()
+	tracked := slices.DeleteFunc(slices.Clone(keys), func(h mh.Multihash) bool {
+		_, ok := q.entries[string(h)]
+		return !ok
+	})
+	q.mu.Unlock()
+
+	ctx := context.Background()
+	for _, h := range tracked {
+		has, err := keystoreHas(ctx, q.ks, h)
+		if err != nil {
+			providerLog.Debugw("cannot look up queued key in the keystore", "err", err)
+			return
+		}
+		if has {
+			q.untrack(h)
+		}
+	}
+}
+
+func (q *ProvideQueue) untrack(keys ...mh.Multihash) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int
+	for _, h := range keys {
+		if _, ok := q.entries[string(h)]; ok {
+			delete(q.entries, string(h))
+			n++
+		}
+	}
+	if len(q.entries) == 0 {
+		q.overflow = 0
+	}
+	return n
+}
+
+// Clear clears all the keys from the provide queue and returns the number
+// of keys that were cleared.
+func (q *ProvideQueue) Clear() int {
+	n := q.DHTProvider.Clear()
+	q.mu.Lock()
+	clear(q.entries)
+	q.overflow = 0
+	q.mu.Unlock()
+	return n
+}
+
+// MessageSender wraps the message sender used by the sweeping provider so
+// keys stop being tracked once a provider record is sent for them.
+func (q *ProvideQueue) MessageSender(ms dht_pb.MessageSender) dht_pb.MessageSender {
+	return &queueSender{MessageSender: ms, queue: q}
+}
+
+type queueSender struct {
+	dht_pb.MessageSender
+	queue *ProvideQueue
+}
+
+func (s *queueSender) SendMessage(ctx context.Context, p peer.ID, pmes *dht_pb.Message) error {
+	if pmes.GetType() == dht_pb.Message_ADD_PROVIDER {
+		s.queue.untrack(pmes.GetKey())
+	}
+	return s.MessageSender.SendMessage(ctx, p, pmes)
+}
+
+// Entries returns the tracked keys of the provide queue, oldest first, and
+// the number of keys queued while the tracking limit was reached.
+//
+// Keys tracked for longer than the reprovide interval are forgotten: by then
+// they were reprovided with their region, or the provider dropped them, for
+// instance while offline.
+func (q *ProvideQueue) Entries() ([]ProvideQueueEntry, int) {
+	q.mu.Lock()
+	if q.interval > 0 {
+		expired := time.Now().Add(-q.interval)
+		maps.DeleteFunc(q.entries, func(_ string, e ProvideQueueEntry) bool {
+			return e.Queued.Before(expired)
+		})
+	}
+	entries := slices.Collect(maps.Values(q.entries))
+	overflow := q.overflow
+	q.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b ProvideQueueEntry) int {
+		return a.Queued.Compare(b.Queued)
+	})
+	return entries, overflow
+}
+
+// sweeper returns the sweeping provider behind the buffer that queues the
+// keys handed to q.
+func (q *ProvideQueue) sweeper() (*buffered.SweepingProvider, error) {
+	b, ok := q.DHTProvider.(*buffered.SweepingProvider)
+	if !ok {
+		return nil, errors.New("provide queue cannot manage keys of this provider")
+	}
+	return b, nil
+}
+
+// Drop removes keys from the provide queue and returns how many of them
+// were tracked. Keys scheduled to be reprovided stay scheduled.
+//
+// Keys still buffered on their way to the provide queue are not affected.
+func (q *ProvideQueue) Drop(ctx context.Context, keys ...mh.Multihash) (int, error) {
+	b, err := q.sweeper()
+	if err != nil {
+		return 0, err
+	}
+	// removing keys from the queue also removes them from the keystore, so
+	// record the scheduled ones to put them back, even after a failure
+	var scheduled []mh.Multihash
+	if q.ks != nil {
+		for _, h := range keys {
+			has, err := keystoreHas(ctx, q.ks, h)
+			if err != nil {
+				return 0, err
+			}
+			if has {
+				scheduled = append(scheduled, h)
+			}
+		}
+	}
+	if err := q.recordDropping(ctx, scheduled); err != nil {
+		return 0, err
+	}
+	if err := b.Provider.StopProviding(keys...); err != nil {
+		return 0, errors.Join(err, q.RestoreDropped(ctx))
+	}
+	if err := q.RestoreDropped(ctx); err != nil {
+		return 0, err
+	}
+	return q.untrack(keys...), nil
+}
+
+func (q *ProvideQueue) recordDropping(ctx context.Context, keys []mh.Multihash) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	batch, err := q.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, h := range keys {
+		if err := batch.Put(ctx, dshelp.MultihashToDsKey(h), nil); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+// RestoreDropped puts back into the keystore the scheduled keys whose drop
+// from the provide queue did not complete.
+func (q *ProvideQueue) RestoreDropped(ctx context.Context) error {
+	results, err := q.ds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	keys := make([]mh.Multihash, 0, len(entries))
+	for _, e := range entries {
+		h, err := dshelp.DsKeyToMultihash(datastore.RawKey(e.Key))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, h)
+	}
+	if q.ks != nil {
+		if _, err := q.ks.Put(ctx, keys...); err != nil {
+			return err
+		}
+	}
+	batch, err := q.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := batch.Delete(ctx, datastore.RawKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+// Prioritize hands keys to the sweeping provider right away, skipping the
+// buffer in front of its provide queue, so they are announced by the
+// workers reserved for bursts (Provide.DHT.DedicatedBurstWorkers). Keys
+// join the provide queue with the other keys of their keyspace region.
+func (q *ProvideQueue) Prioritize(keys ...mh.Multihash) error {
+	b, err := q.sweeper()
+	if err != nil {
+		return err
+	}
+	return b.Provider.ProvideOnce(keys...)
+}
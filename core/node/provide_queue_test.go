@@ -0,0 +1,157 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/buffered"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/keystore"
+	"github.com/libp2p/go-libp2p/core/test"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSweeper stands in for the sweeping provider, adding started keys to
+// the keystore and removing stopped ones like it does.
+type fakeSweeper struct {
+	ks       keystore.Keystore
+	stopped  []mh.Multihash
+	provided []mh.Multihash
+	// failStop fails StopProviding after removing the keys from the
+	// keystore.
+	failStop bool
+
+	mu     sync.Mutex // StartProviding is called by the buffer worker
+	forced []mh.Multihash
+}
+
+func (p *fakeSweeper) Clear() int             { return 0 }
+func (p *fakeSweeper) RefreshSchedule() error { return nil }
+func (p *fakeSweeper) Close() error           { return nil }
+
+func (p *fakeSweeper) StartProviding(force bool, keys ...mh.Multihash) error {
+	if force {
+		p.mu.Lock()
+		p.forced = append(p.forced, keys...)
+		p.mu.Unlock()
+	}
+	_, err := p.ks.Put(context.Background(), keys...)
+	return err
+}
+
+func (p *fakeSweeper) StopProviding(keys ...mh.Multihash) error {
+	p.stopped = append(p.stopped, keys...)
+	if err := p.ks.Delete(context.Background(), keys...); err != nil {
+		return err
+	}
+	if p.failStop {
+		return errors.New("provider closed")
+	}
+	return nil
+}
+
+func (p *fakeSweeper) ProvideOnce(keys ...mh.Multihash) error {
+	p.provided = append(p.provided, keys...)
+	return nil
+}
+
+func TestProvideQueue(t *testing.T) {
+	ctx := t.Context()
+	ks, err := keystore.NewKeystore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	defer ks.Close()
+
+	sum := func(s string) mh.Multihash {
+		h, err := mh.Sum([]byte(s), mh.SHA2_256, -1)
+		require.NoError(t, err)
+		return h
+	}
+	scheduled, added, pinned := sum("scheduled"), sum("added"), sum("pinned")
+	_, err = ks.Put(ctx, scheduled)
+	require.NoError(t, err)
+
+	sweeper := &fakeSweeper{ks: ks}
+	q := newProvideQueue(dssync.MutexWrap(datastore.NewMapDatastore()), ks, 0)
+	q.DHTProvider = buffered.New(q.wrapSweeper(sweeper), dssync.MutexWrap(datastore.NewMapDatastore()))
+	defer q.Close()
+
+	// keys are tracked with their source, until the provider skips the ones
+	// already scheduled
+	sources := func() map[string]string {
+		entries, overflow := q.Entries()
+		require.Zero(t, overflow)
+		m := make(map[string]string)
+		for _, e := range entries {
+			m[string(e.Key)] = e.Source
+		}
+		return m
+	}
+	require.NoError(t, q.StartProviding(false, scheduled, added))
+	require.NoError(t, ProvideSource(q, ProvideSourcePin).StartProviding(false, pinned))
+	require.Contains(t, sources(), string(added))
+	require.Eventually(t, func() bool {
+		return len(sources()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, map[string]string{
+		string(added):  ProvideSourceOther,
+		string(pinned): ProvideSourcePin,
+	}, sources())
+
+	// forced keys are queued even when scheduled
+	require.NoError(t, q.StartProviding(true, scheduled))
+	require.Eventually(t, func() bool {
+		sweeper.mu.Lock()
+		defer sweeper.mu.Unlock()
+		return len(sweeper.forced) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, sources(), 3)
+
+	// keys leave the queue once a provider record is sent
+	sender := q.MessageSender(&fakeSender{})
+	require.NoError(t, sender.SendMessage(ctx, test.RandPeerIDFatal(t), dht_pb.NewMessage(dht_pb.Message_ADD_PROVIDER, added, 0)))
+	require.Len(t, sources(), 2)
+
+	// dropped keys stay scheduled, and the others are not scheduled
+	require.NoError(t, ks.Delete(ctx, pinned))
+	dropped, err := q.Drop(ctx, scheduled, pinned)
+	require.NoError(t, err)
+	require.Equal(t, 2, dropped)
+	require.ElementsMatch(t, []mh.Multihash{scheduled, pinned}, sweeper.stopped)
+	has, err := keystoreHas(ctx, ks, scheduled)
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = keystoreHas(ctx, ks, pinned)
+	require.NoError(t, err)
+	require.False(t, has)
+	require.Empty(t, sources())
+
+	// scheduled keys whose drop was interrupted are put back on restart
+	sweeper.failStop = true
+	_, err = ks.Put(ctx, pinned)
+	require.NoError(t, err)
+	require.NoError(t, q.recordDropping(ctx, []mh.Multihash{pinned}))
+	require.NoError(t, ks.Delete(ctx, pinned))
+	require.NoError(t, q.RestoreDropped(ctx))
+	has, err = keystoreHas(ctx, ks, pinned)
+	require.NoError(t, err)
+	require.True(t, has)
+	_, err = q.Drop(ctx, pinned)
+	require.Error(t, err)
+	has, err = keystoreHas(ctx, ks, pinned)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// prioritized keys are handed to the sweeping provider directly
+	require.NoError(t, q.Prioritize(added))
+	require.Equal(t, []mh.Multihash{added}, sweeper.provided)
+
+	// other providers are left alone
+	noop := &NoopProvider{}
+	require.Same(t, noop, ProvideSource(noop, ProvideSourcePin))
+}
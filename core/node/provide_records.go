@@ -0,0 +1,385 @@
+package node
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/datastore/dshelp"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-libdht/kad/key"
+	"github.com/ipfs/go-libdht/kad/key/bit256"
+	"github.com/ipfs/go-libdht/kad/key/bitstr"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/keystore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	// ProvideRecordsWAN and ProvideRecordsLAN name the DHTs whose provide
+	// outcomes are tracked. A node without a dual DHT only uses WAN.
+	ProvideRecordsWAN = "wan"
+	ProvideRecordsLAN = "lan"
+
+	// provideRecordsQuiet is how long a key must go without a new provider
+	// record being sent before its outcome is written to the datastore.
+	provideRecordsQuiet = 30 * time.Second
+	// provideRecordsRound is the gap after which records sent for a key
+	// start a new round, replacing the peers of the previous one.
+	provideRecordsRound = 5 * time.Minute
+	// provideRecordsMaxPending bounds the number of keys held in memory
+	// before all of them are written, even if not quiet yet.
+	provideRecordsMaxPending = 1 << 16
+)
+
+// provideRecordsDatastoreKey is the namespace, under the provider one, of
+// the tracked provide outcomes.
+var provideRecordsDatastoreKey = datastore.NewKey("records")
+
+// ProvideRecord is the outcome of the last provider records sent for a key
+// by the sweeping provider.
+type ProvideRecord struct {
+	// LastAttempt is when a provider record was last sent for the key.
+	LastAttempt time.Time
+	// LastProvide is when a provider record was last stored on a peer.
+	LastProvide time.Time
+	// Peers are the peers that accepted the record in the last round
+	// where at least one did.
+	Peers []peer.ID
+	// LastError is the last error sending a record, with its time.
+	LastError     string `json:",omitempty"`
+	LastErrorTime time.Time
+}
+
+// ProvideKeyStatus is the provide status of a key.
+type ProvideKeyStatus struct {
+	ProvideRecord
+	// Scheduled tells whether the key is in the keystore, and so will be
+	// reprovided.
+	Scheduled bool
+	// NextReprovide estimates when the key is reprovided next, one
+	// Provide.DHT.Interval after its last provide. It is zero when unknown.
+	NextReprovide time.Time
+}
+
+// ProvideRecords tracks per-key provide outcomes of the sweeping provider,
+// by watching the provider records it sends to DHT servers. Outcomes are
+// kept in memory while records for a key are being sent, then written to
+// the datastore in batches. Outcomes of keys removed from the keystore are
+// pruned once they were not provided for a whole interval.
+type ProvideRecords struct {
+	ds       datastore.Batching
+	ks       keystore.Keystore
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingRecord // by DHT name and multihash
+
+	flushNow  chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+type pendingRecord struct {
+	dht   string
+	key   mh.Multihash
+	start time.Time
+	last  time.Time
+	ProvideRecord
+}
+
+func newProvideRecords(ds datastore.Batching, ks keystore.Keystore, interval time.Duration) *ProvideRecords {
+	r := &ProvideRecords{
+		ds:       namespace.Wrap(ds, provideRecordsDatastoreKey),
+		ks:       ks,
+		interval: interval,
+		pending:  make(map[string]*pendingRecord),
+		flushNow: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// MessageSender wraps the message sender used by the provider of the given
+// DHT so the provider records it sends are tracked.
+func (r *ProvideRecords) MessageSender(dht string, ms dht_pb.MessageSender) dht_pb.MessageSender {
+	return &recordingSender{MessageSender: ms, records: r, dht: dht}
+}
+
+type recordingSender struct {
+	dht_pb.MessageSender
+	records *ProvideRecords
+	dht     string
+}
+
+func (s *recordingSender) SendMessage(ctx context.Context, p peer.ID, pmes *dht_pb.Message) error {
+	err := s.MessageSender.SendMessage(ctx, p, pmes)
+	if pmes.GetType() == dht_pb.Message_ADD_PROVIDER {
+		s.records.record(s.dht, pmes.GetKey(), p, err, time.Now())
+	}
+	return err
+}
+
+func (r *ProvideRecords) record(dht string, k []byte, p peer.ID, err error, now time.Time) {
+	id := dht + "/" + string(k)
+
+	r.mu.Lock()
+	pr, ok := r.pending[id]
+	if !ok {
+		pr = &pendingRecord{dht: dht, key: slices.Clone(k), start: now}
+		r.pending[id] = pr
+	}
+	pr.last = now
+	pr.LastAttempt = now
+	if err != nil {
+		pr.LastError = err.Error()
+		pr.LastErrorTime = now
+	} else {
+		pr.LastProvide = now
+		if !slices.Contains(pr.Peers, p) {
+			pr.Peers = append(pr.Peers, p)
+		}
+	}
+	full := len(r.pending) >= provideRecordsMaxPending
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.flushNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *ProvideRecords) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(provideRecordsQuiet / 3)
+	defer ticker.Stop()
+	var pruneC <-chan time.Time
+	if r.ks != nil && r.interval > 0 {
+		pruneTicker := time.NewTicker(r.interval)
+		defer pruneTicker.Stop()
+		pruneC = pruneTicker.C
+	}
+	for {
+		select {
+		case <-ticker.C:
+			r.flush(time.Now().Add(-provideRecordsQuiet))
+		case now := <-pruneC:
+			if err := r.prune(context.Background(), now); err != nil {
+				providerLog.Debugw("provide records: cannot prune outcomes", "err", err)
+			}
+		case <-r.flushNow:
+			r.flush(time.Time{})
+		case <-r.closed:
+			r.flush(time.Time{})
+			return
+		}
+	}
+}
+
+// flush writes the pending outcomes of the keys without records sent
+// after before, or all of them when before is zero.
+func (r *ProvideRecords) flush(before time.Time) {
+	r.mu.Lock()
+	var out []*pendingRecord
+	for id, pr := range r.pending {
+		if before.IsZero() || pr.last.Before(before) {
+			out = append(out, pr)
+			delete(r.pending, id)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(out) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	batch, err := r.ds.Batch(ctx)
+	if err != nil {
+		providerLog.Debugw("provide records: cannot store outcomes", "err", err)
+		return
+	}
+	for _, pr := range out {
+		if err := r.write(ctx, batch, pr); err != nil {
+			providerLog.Debugw("provide records: cannot store outcome", "key", pr.key, "err", err)
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		providerLog.Debugw("provide records: cannot store outcomes", "err", err)
+	}
+}
+
+func (r *ProvideRecords) write(ctx context.Context, w datastore.Write, pr *pendingRecord) error {
+	dsKey := recordKey(pr.dht, pr.key)
+	stored, _, err := r.load(ctx, dsKey)
+	if err != nil {
+		return err
+	}
+
+	rec := stored
+	rec.LastAttempt = pr.LastAttempt
+	if pr.LastError != "" {
+		rec.LastError = pr.LastError
+		rec.LastErrorTime = pr.LastErrorTime
+	}
+	if len(pr.Peers) > 0 {
+		if pr.start.Sub(stored.LastAttempt) < provideRecordsRound {
+			// same round, written in several parts
+			for _, p := range pr.Peers {
+				if !slices.Contains(rec.Peers, p) {
+					rec.Peers = append(rec.Peers, p)
+				}
+			}
+		} else {
+			rec.Peers = pr.Peers
+		}
+		rec.LastProvide = pr.LastProvide
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return w.Put(ctx, dsKey, b)
+}
+
+// prune deletes the outcomes of keys that are no longer in the keystore and
+// were not provided for a whole interval before now.
+func (r *ProvideRecords) prune(ctx context.Context, now time.Time) error {
+	results, err := r.ds.Query(ctx, query.Query{})
+	if err != nil {
+		return err
+	}
+	var stale []datastore.Key
+	for res := range results.Next() {
+		if res.Error != nil {
+			results.Close()
+			return res.Error
+		}
+		var rec ProvideRecord
+		if json.Unmarshal(res.Value, &rec) == nil && now.Sub(rec.LastAttempt) < r.interval {
+			continue
+		}
+		dsKey := datastore.RawKey(res.Key)
+		if h, err := dshelp.DsKeyToMultihash(datastore.NewKey(dsKey.BaseNamespace())); err == nil {
+			has, err := keystoreHas(ctx, r.ks, h)
+			if err != nil {
+				results.Close()
+				return err
+			}
+			if has {
+				continue
+			}
+		}
+		stale = append(stale, dsKey)
+	}
+	if err := results.Close(); err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	batch, err := r.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := batch.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+func (r *ProvideRecords) load(ctx context.Context, dsKey datastore.Key) (ProvideRecord, bool, error) {
+	var rec ProvideRecord
+	b, err := r.ds.Get(ctx, dsKey)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return rec, false, nil
+	}
+	if err != nil {
+		return rec, false, err
+	}
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return rec, false, err
+	}
+	return rec, true, nil
+}
+
+// Status returns the provide status of h on the given DHT. found is false
+// when no provider record was ever sent for h.
+func (r *ProvideRecords) Status(ctx context.Context, dht string, h mh.Multihash) (status ProvideKeyStatus, found bool, err error) {
+	rec, found, err := r.load(ctx, recordKey(dht, h))
+	if err != nil {
+		return status, false, err
+	}
+
+	r.mu.Lock()
+	if pr, ok := r.pending[dht+"/"+string(h)]; ok {
+		found = true
+		newRound := pr.start.Sub(rec.LastAttempt) >= provideRecordsRound
+		rec.LastAttempt = pr.LastAttempt
+		if pr.LastError != "" {
+			rec.LastError, rec.LastErrorTime = pr.LastError, pr.LastErrorTime
+		}
+		if len(pr.Peers) > 0 {
+			if newRound {
+				rec.Peers = nil
+			}
+			rec.Peers = append(slices.Clone(rec.Peers), pr.Peers...)
+			slices.Sort(rec.Peers)
+			rec.Peers = slices.Compact(rec.Peers)
+			rec.LastProvide = pr.LastProvide
+		}
+	}
+	r.mu.Unlock()
+
+	status.ProvideRecord = rec
+	if r.ks != nil {
+		status.Scheduled, err = keystoreHas(ctx, r.ks, h)
+		if err != nil {
+			return status, found, err
+		}
+	}
+	if status.Scheduled && r.interval > 0 && !rec.LastProvide.IsZero() {
+		status.NextReprovide = rec.LastProvide.Add(r.interval)
+	}
+	return status, found, nil
+}
+
+// Close writes the pending outcomes and stops tracking.
+func (r *ProvideRecords) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	<-r.done
+	return nil
+}
+
+// keystoreHas tells whether h is in the keystore, and so scheduled to be
+// reprovided.
+func keystoreHas(ctx context.Context, ks keystore.Keystore, h mh.Multihash) (bool, error) {
+	// look up a prefix of the kademlia key rather than all of it, which the
+	// keystore does not match, and find h among the few results
+	kadKey := key.BitString(bit256.NewKeyFromArray(sha256.Sum256(h)))
+	keys, err := ks.Get(ctx, bitstr.Key(kadKey[:64]))
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(keys, func(k mh.Multihash) bool { return string(k) == string(h) }), nil
+}
+
+func recordKey(dht string, h mh.Multihash) datastore.Key {
+	return datastore.NewKey(dht).Child(dshelp.MultihashToDsKey(h))
+}
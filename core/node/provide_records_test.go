@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dht_pb "github.com/libp2p/go-libp2p-kad-dht/pb"
+	"github.com/libp2p/go-libp2p-kad-dht/provider/keystore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	failing map[peer.ID]bool
+}
+
+func (s *fakeSender) SendRequest(context.Context, peer.ID, *dht_pb.Message) (*dht_pb.Message, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeSender) SendMessage(_ context.Context, p peer.ID, _ *dht_pb.Message) error {
+	if s.failing[p] {
+		return errors.New("stream reset")
+	}
+	return nil
+}
+
+func TestProvideRecords(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	ks, err := keystore.NewKeystore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	defer ks.Close()
+
+	h, err := mh.Sum([]byte("provide records"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	_, err = ks.Put(ctx, h)
+	require.NoError(t, err)
+
+	p1, p2, p3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	interval := 22 * time.Hour
+	records := newProvideRecords(ds, ks, interval)
+	sender := records.MessageSender(ProvideRecordsWAN, &fakeSender{failing: map[peer.ID]bool{p3: true}})
+
+	pmes := dht_pb.NewMessage(dht_pb.Message_ADD_PROVIDER, h, 0)
+	for _, p := range []peer.ID{p1, p2, p3} {
+		_ = sender.SendMessage(ctx, p, pmes)
+	}
+	// other messages are not tracked
+	other, err := mh.Sum([]byte("not a provide"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	require.NoError(t, sender.SendMessage(ctx, p1, dht_pb.NewMessage(dht_pb.Message_PUT_VALUE, other, 0)))
+
+	status, found, err := records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.ElementsMatch(t, []peer.ID{p1, p2}, status.Peers)
+	require.Equal(t, "stream reset", status.LastError)
+	require.True(t, status.Scheduled)
+	require.Equal(t, status.LastProvide.Add(interval), status.NextReprovide)
+
+	_, found, err = records.Status(ctx, ProvideRecordsWAN, other)
+	require.NoError(t, err)
+	require.False(t, found)
+	_, found, err = records.Status(ctx, ProvideRecordsLAN, h)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// outcomes are written on close and read back
+	require.NoError(t, records.Close())
+	records = newProvideRecords(ds, ks, interval)
+	defer records.Close()
+	persisted, found, err := records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.ElementsMatch(t, status.Peers, persisted.Peers)
+	require.True(t, status.LastProvide.Equal(persisted.LastProvide))
+
+	// a later round replaces the peers
+	records.record(ProvideRecordsWAN, h, p3, nil, time.Now().Add(provideRecordsRound+time.Minute))
+	records.flush(time.Time{})
+	status, _, err = records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.Equal(t, []peer.ID{p3}, status.Peers)
+
+	// keys no longer in the keystore are not scheduled
+	require.NoError(t, ks.Delete(ctx, h))
+	status, _, err = records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.False(t, status.Scheduled)
+	require.True(t, status.NextReprovide.IsZero())
+
+	// and their outcomes are pruned once not provided for an interval,
+	// while those of keys in the keystore are kept
+	kept, err := mh.Sum([]byte("kept"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	_, err = ks.Put(ctx, kept)
+	require.NoError(t, err)
+	records.record(ProvideRecordsWAN, kept, p1, nil, time.Now())
+	records.flush(time.Time{})
+	require.NoError(t, records.prune(ctx, time.Now()))
+	_, found, err = records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NoError(t, records.prune(ctx, time.Now().Add(2*interval)))
+	_, found, err = records.Status(ctx, ProvideRecordsWAN, h)
+	require.NoError(t, err)
+	require.False(t, found)
+	_, found, err = records.Status(ctx, ProvideRecordsWAN, kept)
+	require.NoError(t, err)
+	require.True(t, found)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/ipfs/go-datastore/query"
 	log "github.com/ipfs/go-log/v2"
 	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/corepin"
 	"github.com/ipfs/kubo/core/shutdown"
 	"github.com/ipfs/kubo/repo"
 	"github.com/ipfs/kubo/repo/fsrepo"
@@ -611,14 +612,14 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 		Repo repo.Repo
 		Lc   fx.Lifecycle
 	}
-	sweepingReprovider := fx.Provide(func(in providerInput) (DHTProvider, *keystore.ResettableKeystore, error) {
+	sweepingReprovider := fx.Provide(func(in providerInput) (DHTProvider, *keystore.ResettableKeystore, *ProvideRecords, *ProvideBudget, error) {
 		ds := namespace.Wrap(in.Repo.Datastore(), providerDatastoreKey)
 
 		// Get repo path and config to determine datastore type
 		repoPath := in.Repo.Path()
 		repoCfg, err := in.Repo.Config()
 		if err != nil {
-			return nil, nil, fmt.Errorf("getting repo config: %w", err)
+			return nil, nil, nil, nil, fmt.Errorf("getting repo config: %w", err)
 		}
 
 		// Find the root datastore type (levelds, pebbleds, etc.)
@@ -717,8 +718,51 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 			),
 		)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, nil, err
+		}
+		budget, err := newProvideBudget(cfg.Provide.DHT, reprovideInterval)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		interval := reprovideInterval
+		if budget != nil && !noScheduleMode {
+			// stretch the schedule when the budget cannot reprovide all keys
+			// within the interval, staying below the validity of provider
+			// records
+			keys, err := ks.Size(context.Background())
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			need := budget.CycleDuration(keys, amino.DefaultBucketSize)
+			stretched, fits := stretchInterval(interval, need)
+			switch {
+			case !fits:
+				providerLog.Errorw("provide rate budget cannot reprovide all CIDs before their provider records expire, some CIDs will not be discoverable through the DHT between reprovides; raise the budget or provide fewer CIDs",
+					"cids", keys, "interval", reprovideInterval, "needed", need, "stretched", stretched, "validity", amino.DefaultProvideValidity)
+			case stretched > interval:
+				providerLog.Warnw("provide rate budget cannot reprovide all CIDs within Provide.DHT.Interval, stretching the reprovide interval",
+					"cids", keys, "interval", reprovideInterval, "needed", need, "stretched", stretched)
+			}
+			interval = stretched
+		}
+		records := newProvideRecords(ds, ks, interval)
+		burstWorkers := int(cfg.Provide.DHT.DedicatedBurstWorkers.WithDefault(config.DefaultProvideDHTDedicatedBurstWorkers))
+		queue := newProvideQueue(ds, ks, interval)
+		if err := queue.RestoreDropped(context.Background()); err != nil {
+			providerLog.Warnw("cannot restore keys dropped from the provide queue to the reprovide schedule", "err", err)
 		}
+		// messages wait for the budget before being recorded as sent
+		sender := func(ms dht_pb.MessageSender) dht_pb.MessageSender {
+			if budget != nil {
+				ms = budget.MessageSender(ms)
+			}
+			return queue.MessageSender(ms)
+		}
+		in.Lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error {
+				return records.Close()
+			},
+		})
 		// Constants for buffered provider configuration
 		// These values match the upstream defaults from go-libp2p-kad-dht and have been battle-tested
 		const (
@@ -762,7 +806,7 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 					ddhtprovider.WithDatastore(ds),
 					ddhtprovider.WithResumeCycle(cfg.Provide.DHT.ResumeEnabled.WithDefault(config.DefaultProvideDHTResumeEnabled)),
 
-					ddhtprovider.WithReprovideInterval(reprovideInterval),
+					ddhtprovider.WithReprovideInterval(interval),
 					ddhtprovider.WithMaxReprovideDelay(time.Hour),
 					ddhtprovider.WithOfflineDelay(cfg.Provide.DHT.OfflineDelay.WithDefault(config.DefaultProvideDHTOfflineDelay)),
 					ddhtprovider.WithConnectivityCheckOnlineInterval(1*time.Minute),
@@ -770,15 +814,18 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 
 					ddhtprovider.WithMaxWorkers(int(cfg.Provide.DHT.MaxWorkers.WithDefault(config.DefaultProvideDHTMaxWorkers))),
 					ddhtprovider.WithDedicatedPeriodicWorkers(int(cfg.Provide.DHT.DedicatedPeriodicWorkers.WithDefault(config.DefaultProvideDHTDedicatedPeriodicWorkers))),
-					ddhtprovider.WithDedicatedBurstWorkers(int(cfg.Provide.DHT.DedicatedBurstWorkers.WithDefault(config.DefaultProvideDHTDedicatedBurstWorkers))),
+					ddhtprovider.WithDedicatedBurstWorkers(burstWorkers),
 					ddhtprovider.WithMaxProvideConnsPerWorker(int(cfg.Provide.DHT.MaxProvideConnsPerWorker.WithDefault(config.DefaultProvideDHTMaxProvideConnsPerWorker))),
+					ddhtprovider.WithMessageSenderWAN(records.MessageSender(ProvideRecordsWAN, sender(inDht.WAN.MessageSender()))),
+					ddhtprovider.WithMessageSenderLAN(records.MessageSender(ProvideRecordsLAN, sender(inDht.LAN.MessageSender()))),
 
 					ddhtprovider.WithLoggerName(loggerName),
 				)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, nil, nil, err
 				}
-				return buffered.New(prov, ds, bufferedProviderOpts...), ks, nil
+				queue.DHTProvider = buffered.New(queue.wrapSweeper(prov), ds, bufferedProviderOpts...)
+				return queue, ks, records, budget, nil
 			}
 		case *fullrt.FullRT:
 			if inDht != nil {
@@ -786,7 +833,8 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 			}
 		}
 		if impl == nil {
-			return &NoopProvider{}, nil, nil
+			budget.Close()
+			return &NoopProvider{}, nil, nil, nil, nil
 		}
 
 		var selfAddrsFunc func() []ma.Multiaddr
@@ -801,14 +849,14 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 			dhtprovider.WithResumeCycle(cfg.Provide.DHT.ResumeEnabled.WithDefault(config.DefaultProvideDHTResumeEnabled)),
 			dhtprovider.WithHost(impl.Host()),
 			dhtprovider.WithRouter(impl),
-			dhtprovider.WithMessageSender(impl.MessageSender()),
+			dhtprovider.WithMessageSender(records.MessageSender(ProvideRecordsWAN, sender(impl.MessageSender()))),
 			dhtprovider.WithSelfAddrs(selfAddrsFunc),
 			dhtprovider.WithAddLocalRecord(func(h mh.Multihash) error {
 				return impl.Provide(context.Background(), cid.NewCidV1(cid.Raw, h), false)
 			}),
 
 			dhtprovider.WithReplicationFactor(amino.DefaultBucketSize),
-			dhtprovider.WithReprovideInterval(reprovideInterval),
+			dhtprovider.WithReprovideInterval(interval),
 			dhtprovider.WithMaxReprovideDelay(time.Hour),
 			dhtprovider.WithOfflineDelay(cfg.Provide.DHT.OfflineDelay.WithDefault(config.DefaultProvideDHTOfflineDelay)),
 			dhtprovider.WithConnectivityCheckOnlineInterval(1 * time.Minute),
@@ -816,7 +864,7 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 
 			dhtprovider.WithMaxWorkers(int(cfg.Provide.DHT.MaxWorkers.WithDefault(config.DefaultProvideDHTMaxWorkers))),
 			dhtprovider.WithDedicatedPeriodicWorkers(int(cfg.Provide.DHT.DedicatedPeriodicWorkers.WithDefault(config.DefaultProvideDHTDedicatedPeriodicWorkers))),
-			dhtprovider.WithDedicatedBurstWorkers(int(cfg.Provide.DHT.DedicatedBurstWorkers.WithDefault(config.DefaultProvideDHTDedicatedBurstWorkers))),
+			dhtprovider.WithDedicatedBurstWorkers(burstWorkers),
 			dhtprovider.WithMaxProvideConnsPerWorker(int(cfg.Provide.DHT.MaxProvideConnsPerWorker.WithDefault(config.DefaultProvideDHTMaxProvideConnsPerWorker))),
 
 			dhtprovider.WithLoggerName(loggerName),
@@ -824,9 +872,10 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 
 		prov, err := dhtprovider.New(opts...)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, nil, err
 		}
-		return buffered.New(prov, ds, bufferedProviderOpts...), ks, nil
+		queue.DHTProvider = buffered.New(queue.wrapSweeper(prov), ds, bufferedProviderOpts...)
+		return queue, ks, records, budget, nil
 	})
 
 	type keystoreInput struct {
@@ -953,6 +1002,7 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 		fx.In
 		Provider DHTProvider
 		Keystore *keystore.ResettableKeystore
+		Budget   *ProvideBudget `optional:"true"`
 	}
 	ensureProviderClosesBeforeKeystore := fx.Invoke(func(lc fx.Lifecycle, in providerKeystoreShutdownInput) {
 		// Skip for NoopProvider
@@ -967,6 +1017,8 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 				// returns. If ctx fires before provider drains, the
 				// keystore close below sees an expired ctx and returns
 				// immediately; the watchdog is the ultimate backstop.
+				// Workers waiting for the rate budget are released first.
+				in.Budget.Close()
 				if err := shutdown.CloseWithCtx(ctx, "dht-provider", in.Provider.Close); err != nil {
 					providerLog.Errorw("error closing provider during shutdown", "error", err)
 				}
@@ -988,6 +1040,8 @@ func SweepingProviderOpt(cfg *config.Config) fx.Option {
 		case *buffered.SweepingProvider:
 			// Recursively extract from the inner provider
 			return extractSweepingProvider(p.Provider)
+		case *ProvideQueue:
+			return extractSweepingProvider(p.DHTProvider)
 		default:
 			return nil
 		}
@@ -1134,7 +1188,7 @@ func hasDHTRouting(cfg *config.Config) bool {
 }
 
 // routerIncludesDHT recursively checks if a router configuration includes DHT.
-// Handles parallel and sequential composite routers by checking their children.
+// Handles parallel, sequential and caching composite routers by checking their children.
 func routerIncludesDHT(rp config.RouterParser, cfg *config.Config) bool {
 	switch rp.Type {
 	case config.RouterTypeDHT:
@@ -1149,6 +1203,12 @@ func routerIncludesDHT(rp config.RouterParser, cfg *config.Config) bool {
 				}
 			}
 		}
+	case config.RouterTypeCaching:
+		if params, ok := rp.Parameters.(*config.CachingRouterParams); ok {
+			if childRouter, exists := cfg.Routing.Routers[params.RouterName]; exists {
+				return routerIncludesDHT(childRouter, cfg)
+			}
+		}
 	}
 	return false
 }
@@ -1308,10 +1368,40 @@ func mfsWalkProvider(mfsRoot *mfs.Root, bs blockstore.Blockstore, tracker walker
 	}
 }
 
-// createKeyProvider creates the appropriate KeyChanFunc based on strategy.
-// fpRate is the bloom filter target false-positive rate (1/N) used by
-// +unique and +entities cycles. Ignored by other strategies.
+// createKeyProvider creates the appropriate KeyChanFunc based on strategy,
+// extended with the pins whose provide policy, set with
+// 'ipfs pin add --provide', overrides it. With the "all" strategy every
+// block is provided and policies have no effect.
 func createKeyProvider(strategyFlag config.ProvideStrategy, fpRate uint, in provStrategyIn) provider.KeyChanFunc {
+	if strategyFlag == config.ProvideStrategyAll {
+		return createStrategyKeyProvider(strategyFlag, fpRate, in)
+	}
+
+	ds := in.Repo.Datastore()
+	pinner := in.Pinner
+	withPolicy := func(policy corepin.ProvidePolicy) pin.Pinner {
+		return corepin.PinsWithPolicy(pinner, ds, func(p corepin.ProvidePolicy) bool { return p == policy })
+	}
+
+	// the strategy only sees the pins that follow it
+	in.Pinner = withPolicy(corepin.ProvideDefault)
+	base := createStrategyKeyProvider(strategyFlag, fpRate, in)
+	roots := provider.NewBufferedProvider(dspinner.NewPinnedProvider(true, withPolicy(corepin.ProvideRoots), in.OfflineIPLDFetcher))
+	all := provider.NewBufferedProvider(dspinner.NewPinnedProvider(false, withPolicy(corepin.ProvideAll), in.OfflineIPLDFetcher))
+
+	if strategyFlag&config.ProvideStrategyUnique != 0 {
+		// +unique keeps no set of the CIDs emitted; blocks shared
+		// between the pins with a policy and the rest may be provided
+		// twice, which is harmless
+		return provider.NewConcatProvider(base, roots, all)
+	}
+	return provider.NewPrioritizedProvider(base, roots, all)
+}
+
+// createStrategyKeyProvider creates the appropriate KeyChanFunc based on
+// strategy. fpRate is the bloom filter target false-positive rate (1/N) used
+// by +unique and +entities cycles. Ignored by other strategies.
+func createStrategyKeyProvider(strategyFlag config.ProvideStrategy, fpRate uint, in provStrategyIn) provider.KeyChanFunc {
 	// +unique modifier: use bloom filter cross-DAG dedup
 	useUnique := strategyFlag&config.ProvideStrategyUnique != 0
 	if useUnique {
@@ -0,0 +1,471 @@
+package node
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	exchange "github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// retainedRetrievalTraces is the number of finished traces kept for
+	// 'ipfs bitswap trace'.
+	retainedRetrievalTraces = 64
+	// maxTracedBlocks bounds the blocks recorded by a single trace.
+	maxTracedBlocks = 10000
+)
+
+// RetrievalTracer records, for requests that ask for it, which peers and
+// HTTP providers were asked for the blocks fetched from the network and
+// which delivered them.
+//
+// Requests are traced through their context, see Start. The exchange is
+// wrapped to record the blocks wanted by traced requests, and the tracer
+// observes the Bitswap network to attribute them to the messages exchanged
+// with peers, so blocks wanted by several requests at once are attributed to
+// each of them.
+type RetrievalTracer struct {
+	running atomic.Int32 // fast path for untraced requests
+
+	mu       sync.Mutex
+	active   map[*RetrievalTrace]struct{}
+	byID     map[string]*RetrievalTrace
+	finished []*RetrievalTrace // oldest first
+}
+
+// RetrievalTrace is the trace of a single request.
+type RetrievalTrace struct {
+	tracer *RetrievalTracer
+	id     string
+	start  time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	blocks    map[cid.Cid]*tracedBlock
+	order     []cid.Cid
+	truncated bool
+}
+
+type tracedBlock struct {
+	requested  time.Time
+	received   time.Time
+	from       peer.ID // empty when not received from the network
+	size       int
+	asked      []peer.ID
+	duplicates []peer.ID
+}
+
+// RetrievalTraceStat is a trace as reported by 'ipfs bitswap trace' and in
+// the X-Ipfs-Retrieval-Trace header of gateway responses.
+type RetrievalTraceStat struct {
+	ID      string
+	Started time.Time
+	// Running is true until the request is complete.
+	Running  bool
+	Duration time.Duration
+	// TimeToFirstBlock is the time from the start of the request until the
+	// first block was received, 0 if none was.
+	TimeToFirstBlock time.Duration
+	// Requested is the number of blocks not found locally.
+	Requested int
+	// Received is the number of those blocks received, and Bytes their size.
+	Received int
+	Bytes    uint64
+	// Duplicates is the number of blocks received more than once.
+	Duplicates     int
+	DuplicateBytes uint64
+	// Truncated is true when the request fetched more blocks than a trace
+	// records.
+	Truncated bool `json:",omitempty"`
+	Peers     []RetrievalTracePeer
+	Blocks    []RetrievalTraceBlock
+}
+
+// RetrievalTracePeer is what a traced request asked of a peer.
+type RetrievalTracePeer struct {
+	Peer peer.ID
+	// Asked is the number of blocks the peer was asked for.
+	Asked int
+	// Delivered is the number of blocks received first from the peer, and
+	// Bytes their size.
+	Delivered int
+	Bytes     uint64
+	// Duplicates is the number of blocks received from the peer after they
+	// were received from another.
+	Duplicates int
+}
+
+// RetrievalTraceBlock is how a block of a traced request was fetched.
+type RetrievalTraceBlock struct {
+	Cid cid.Cid
+	// From is the peer the block was received from first, empty if the
+	// block was not received or came from another request.
+	From  peer.ID `json:",omitempty"`
+	Size  int
+	Asked []peer.ID
+	// Latency is the time from the request of the block until it was
+	// received, 0 if it was not.
+	Latency    time.Duration
+	Duplicates []peer.ID `json:",omitempty"`
+}
+
+// NewRetrievalTracer creates the tracer of the node's retrievals.
+func NewRetrievalTracer() *RetrievalTracer {
+	return &RetrievalTracer{
+		active: make(map[*RetrievalTrace]struct{}),
+		byID:   make(map[string]*RetrievalTrace),
+	}
+}
+
+type retrievalTraceKey struct{}
+
+// Start starts tracing the blocks fetched with the returned context under
+// the request ID id. The trace must be finished with Finish.
+func (rt *RetrievalTracer) Start(ctx context.Context, id string) (context.Context, *RetrievalTrace, error) {
+	if id == "" {
+		return nil, nil, fmt.Errorf("empty retrieval trace ID")
+	}
+	t := &RetrievalTrace{
+		tracer: rt,
+		id:     id,
+		start:  time.Now(),
+		blocks: make(map[cid.Cid]*tracedBlock),
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if prev, ok := rt.byID[id]; ok {
+		if _, running := rt.active[prev]; running {
+			return nil, nil, fmt.Errorf("retrieval trace %q is already running", id)
+		}
+		rt.finished = slices.DeleteFunc(rt.finished, func(f *RetrievalTrace) bool { return f == prev })
+	}
+	rt.byID[id] = t
+	rt.active[t] = struct{}{}
+	rt.running.Add(1)
+	return context.WithValue(ctx, retrievalTraceKey{}, t), t, nil
+}
+
+// Trace returns the trace recorded under the request ID id.
+func (rt *RetrievalTracer) Trace(id string) (RetrievalTraceStat, bool) {
+	rt.mu.Lock()
+	t, ok := rt.byID[id]
+	rt.mu.Unlock()
+	if !ok {
+		return RetrievalTraceStat{}, false
+	}
+	return t.Stat(), true
+}
+
+// Finish stops recording the trace. It is kept for 'ipfs bitswap trace'
+// until it is one of the oldest of the finished traces retained.
+func (t *RetrievalTrace) Finish() {
+	t.mu.Lock()
+	if !t.end.IsZero() {
+		t.mu.Unlock()
+		return
+	}
+	t.end = time.Now()
+	t.mu.Unlock()
+
+	rt := t.tracer
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.active, t)
+	rt.running.Add(-1)
+	rt.finished = append(rt.finished, t)
+	if len(rt.finished) > retainedRetrievalTraces {
+		oldest := rt.finished[0]
+		rt.finished = rt.finished[1:]
+		if rt.byID[oldest.id] == oldest {
+			delete(rt.byID, oldest.id)
+		}
+	}
+}
+
+// ID returns the request ID of the trace.
+func (t *RetrievalTrace) ID() string {
+	return t.id
+}
+
+// Stat returns what the trace recorded so far.
+func (t *RetrievalTrace) Stat() RetrievalTraceStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := RetrievalTraceStat{
+		ID:        t.id,
+		Started:   t.start,
+		Running:   t.end.IsZero(),
+		Requested: len(t.order),
+		Truncated: t.truncated,
+		Blocks:    make([]RetrievalTraceBlock, 0, len(t.order)),
+	}
+	if s.Running {
+		s.Duration = time.Since(t.start)
+	} else {
+		s.Duration = t.end.Sub(t.start)
+	}
+
+	peers := make(map[peer.ID]*RetrievalTracePeer)
+	peerStat := func(p peer.ID) *RetrievalTracePeer {
+		ps, ok := peers[p]
+		if !ok {
+			ps = &RetrievalTracePeer{Peer: p}
+			peers[p] = ps
+		}
+		return ps
+	}
+	var first time.Time
+	for _, c := range t.order {
+		b := t.blocks[c]
+		bs := RetrievalTraceBlock{
+			Cid:        c,
+			From:       b.from,
+			Size:       b.size,
+			Asked:      slices.Clone(b.asked),
+			Duplicates: slices.Clone(b.duplicates),
+		}
+		for _, p := range b.asked {
+			peerStat(p).Asked++
+		}
+		if !b.received.IsZero() {
+			bs.Latency = b.received.Sub(b.requested)
+			s.Received++
+			s.Bytes += uint64(b.size)
+			if first.IsZero() || b.received.Before(first) {
+				first = b.received
+			}
+		}
+		if b.from != "" {
+			ps := peerStat(b.from)
+			ps.Delivered++
+			ps.Bytes += uint64(b.size)
+		}
+		if len(b.duplicates) > 0 {
+			s.Duplicates++
+			s.DuplicateBytes += uint64(b.size * len(b.duplicates))
+			for _, p := range b.duplicates {
+				peerStat(p).Duplicates++
+			}
+		}
+		s.Blocks = append(s.Blocks, bs)
+	}
+	if !first.IsZero() {
+		s.TimeToFirstBlock = first.Sub(t.start)
+	}
+
+	s.Peers = make([]RetrievalTracePeer, 0, len(peers))
+	for _, ps := range peers {
+		s.Peers = append(s.Peers, *ps)
+	}
+	slices.SortFunc(s.Peers, func(a, b RetrievalTracePeer) int {
+		if c := cmp.Compare(b.Delivered, a.Delivered); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Asked, a.Asked); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Peer, b.Peer)
+	})
+	return s
+}
+
+func (t *RetrievalTrace) want(c cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.end.IsZero() {
+		return
+	}
+	if _, ok := t.blocks[c]; ok {
+		return
+	}
+	if len(t.order) >= maxTracedBlocks {
+		t.truncated = true
+		return
+	}
+	t.blocks[c] = &tracedBlock{requested: time.Now()}
+	t.order = append(t.order, c)
+}
+
+func (t *RetrievalTrace) asked(p peer.ID, c cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.blocks[c]; ok && t.end.IsZero() && !slices.Contains(b.asked, p) {
+		b.asked = append(b.asked, p)
+	}
+}
+
+func (t *RetrievalTrace) delivered(p peer.ID, blk blocks.Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.blocks[blk.Cid()]
+	if !ok || !t.end.IsZero() {
+		return
+	}
+	if !b.received.IsZero() {
+		b.duplicates = append(b.duplicates, p)
+		return
+	}
+	b.received = time.Now()
+	b.from = p
+	b.size = len(blk.RawData())
+}
+
+// fetched records blocks returned by the exchange without being received
+// from a peer for this trace, e.g. blocks received for another request.
+func (t *RetrievalTrace) fetched(blk blocks.Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.blocks[blk.Cid()]; ok && b.received.IsZero() && t.end.IsZero() {
+		b.received = time.Now()
+		b.size = len(blk.RawData())
+	}
+}
+
+// RetrievalTraceFromContext returns the trace started with Start for ctx,
+// or nil.
+func RetrievalTraceFromContext(ctx context.Context) *RetrievalTrace {
+	t, _ := ctx.Value(retrievalTraceKey{}).(*RetrievalTrace)
+	return t
+}
+
+// forActive calls fn for every running trace.
+func (rt *RetrievalTracer) forActive(fn func(*RetrievalTrace)) {
+	if rt.running.Load() == 0 {
+		return
+	}
+	rt.mu.Lock()
+	active := make([]*RetrievalTrace, 0, len(rt.active))
+	for t := range rt.active {
+		active = append(active, t)
+	}
+	rt.mu.Unlock()
+	for _, t := range active {
+		fn(t)
+	}
+}
+
+func (rt *RetrievalTracer) messageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	rt.forActive(func(t *RetrievalTrace) {
+		for _, e := range msg.Wantlist() {
+			if !e.Cancel {
+				t.asked(p, e.Cid)
+			}
+		}
+	})
+}
+
+func (rt *RetrievalTracer) messageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	rt.forActive(func(t *RetrievalTrace) {
+		for _, b := range msg.Blocks() {
+			t.delivered(p, b)
+		}
+	})
+}
+
+// Exchange wraps ex to record the blocks wanted by traced requests.
+func (rt *RetrievalTracer) Exchange(ex exchange.Interface) exchange.Interface {
+	return &tracingExchange{Interface: ex, tracer: rt}
+}
+
+type tracingExchange struct {
+	exchange.Interface
+	tracer *RetrievalTracer
+}
+
+var _ exchange.SessionExchange = (*tracingExchange)(nil)
+
+func (e *tracingExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return tracedGetBlock(ctx, e.Interface, c)
+}
+
+func (e *tracingExchange) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return tracedGetBlocks(ctx, e.Interface, cids)
+}
+
+func (e *tracingExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	if sx, ok := e.Interface.(exchange.SessionExchange); ok {
+		return &tracingFetcher{sx.NewSession(ctx)}
+	}
+	return &tracingFetcher{e.Interface}
+}
+
+type tracingFetcher struct {
+	exchange.Fetcher
+}
+
+func (f *tracingFetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return tracedGetBlock(ctx, f.Fetcher, c)
+}
+
+func (f *tracingFetcher) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return tracedGetBlocks(ctx, f.Fetcher, cids)
+}
+
+type exchangeFetchesKey struct{}
+
+// CountExchangeFetches returns a context with which the blocks requested
+// from the exchange wrapped by RetrievalTracer.Exchange, i.e. the blocks not
+// found locally, are counted by the returned counter.
+func CountExchangeFetches(ctx context.Context) (context.Context, *atomic.Int64) {
+	n := new(atomic.Int64)
+	return context.WithValue(ctx, exchangeFetchesKey{}, n), n
+}
+
+func countExchangeFetches(ctx context.Context, n int) {
+	if count, ok := ctx.Value(exchangeFetchesKey{}).(*atomic.Int64); ok {
+		count.Add(int64(n))
+	}
+}
+
+func tracedGetBlock(ctx context.Context, f exchange.Fetcher, c cid.Cid) (blocks.Block, error) {
+	countExchangeFetches(ctx, 1)
+	t := RetrievalTraceFromContext(ctx)
+	if t == nil {
+		return f.GetBlock(ctx, c)
+	}
+	t.want(c)
+	b, err := f.GetBlock(ctx, c)
+	if err == nil {
+		t.fetched(b)
+	}
+	return b, err
+}
+
+func tracedGetBlocks(ctx context.Context, f exchange.Fetcher, cids []cid.Cid) (<-chan blocks.Block, error) {
+	countExchangeFetches(ctx, len(cids))
+	t := RetrievalTraceFromContext(ctx)
+	if t == nil {
+		return f.GetBlocks(ctx, cids)
+	}
+	for _, c := range cids {
+		t.want(c)
+	}
+	in, err := f.GetBlocks(ctx, cids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		for b := range in {
+			t.fetched(b)
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
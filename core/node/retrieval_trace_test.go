@@ -0,0 +1,105 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	bsmsg "github.com/ipfs/boxo/bitswap/message"
+	pb "github.com/ipfs/boxo/bitswap/message/pb"
+	exchange "github.com/ipfs/boxo/exchange"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+	"github.com/stretchr/testify/require"
+)
+
+// peersExchange fetches blocks by asking every peer and receiving them from
+// all of them, through the tracer.
+type peersExchange struct {
+	exchange.Interface
+	tracer *RetrievalTracer
+	peers  []peer.ID
+	blocks map[cid.Cid]blocks.Block
+}
+
+func (e *peersExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	b, ok := e.blocks[c]
+	if !ok {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+	want := bsmsg.New(false)
+	want.AddEntry(c, 1, pb.Message_Wantlist_Block, false)
+	have := bsmsg.New(false)
+	have.AddBlock(b)
+	for _, p := range e.peers {
+		e.tracer.messageSent(p, want)
+	}
+	for _, p := range e.peers {
+		e.tracer.messageReceived(p, have)
+	}
+	return b, nil
+}
+
+func TestRetrievalTracer(t *testing.T) {
+	ctx := t.Context()
+	rt := NewRetrievalTracer()
+	p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	b1, b2 := blocks.NewBlock([]byte("traced 1")), blocks.NewBlock([]byte("traced 2"))
+	ex := rt.Exchange(&peersExchange{
+		tracer: rt,
+		peers:  []peer.ID{p1, p2},
+		blocks: map[cid.Cid]blocks.Block{b1.Cid(): b1, b2.Cid(): b2},
+	})
+
+	// untraced requests are not recorded, only counted when asked
+	cctx, fetches := CountExchangeFetches(ctx)
+	_, err := ex.GetBlock(cctx, b1.Cid())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, fetches.Load())
+
+	tctx, trace, err := rt.Start(ctx, "req")
+	require.NoError(t, err)
+	_, _, err = rt.Start(ctx, "req")
+	require.Error(t, err)
+
+	_, err = ex.GetBlock(tctx, b1.Cid())
+	require.NoError(t, err)
+	ses := ex.(exchange.SessionExchange).NewSession(ctx)
+	_, err = ses.GetBlock(tctx, b2.Cid())
+	require.NoError(t, err)
+	trace.Finish()
+
+	// blocks fetched after the trace is finished are not recorded either
+	_, err = ex.GetBlock(tctx, blocks.NewBlock([]byte("late")).Cid())
+	require.Error(t, err)
+
+	st, ok := rt.Trace("req")
+	require.True(t, ok)
+	require.False(t, st.Running)
+	require.Equal(t, 2, st.Requested)
+	require.Equal(t, 2, st.Received)
+	require.Equal(t, uint64(16), st.Bytes)
+	require.Equal(t, 2, st.Duplicates)
+	require.Positive(t, st.TimeToFirstBlock)
+	require.Equal(t, []RetrievalTracePeer{
+		{Peer: p1, Asked: 2, Delivered: 2, Bytes: 16},
+		{Peer: p2, Asked: 2, Duplicates: 2},
+	}, st.Peers)
+	require.Equal(t, b1.Cid(), st.Blocks[0].Cid)
+	require.Equal(t, p1, st.Blocks[0].From)
+	require.Equal(t, []peer.ID{p2}, st.Blocks[0].Duplicates)
+
+	// only the most recent traces are kept
+	for i := range retainedRetrievalTraces {
+		_, trace, err := rt.Start(ctx, fmt.Sprint(i))
+		require.NoError(t, err)
+		trace.Finish()
+	}
+	_, ok = rt.Trace("req")
+	require.False(t, ok)
+	_, ok = rt.Trace("0")
+	require.True(t, ok)
+}
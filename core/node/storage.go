@@ -52,7 +52,7 @@ func BaseBlockstoreCtor(
 		// This avoids spawning unbounded goroutines for concurrent block additions.
 		strategyFlag := config.MustParseProvideStrategy(providingStrategy)
 		if strategyFlag&config.ProvideStrategyAll != 0 {
-			opts = append(opts, blockstore.Provider(prov))
+			opts = append(opts, blockstore.Provider(ProvideSource(prov, ProvideSourceBlockstore)))
 		}
 
 		// hash security
@@ -95,7 +95,7 @@ func FilestoreBlockstoreCtor(
 		var fstoreProv provider.MultihashProvider
 		strategyFlag := config.MustParseProvideStrategy(providingStrategy)
 		if strategyFlag&config.ProvideStrategyAll != 0 {
-			fstoreProv = prov
+			fstoreProv = ProvideSource(prov, ProvideSourceBlockstore)
 		}
 
 		fstore = filestore.NewFilestore(bb, repo.FileManager(), fstoreProv)
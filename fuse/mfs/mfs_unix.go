@@ -26,5 +26,8 @@ func NewFileSystem(ipfs *core.IpfsNode, mounts config.Mounts, imp config.Import)
 		// Long-lived write descriptors bind to the node context so their
 		// writes are cancelled on shutdown instead of blocking forever.
 		MountCtx: ipfs.Context(),
+		// Writes buffered in open files are journaled so a crash does not
+		// lose them; see coremfs.Journal.
+		Journal: ipfs.FilesJournal,
 	})
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/ipfs/boxo/mfs"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipfs/kubo/core/coremfs"
 	fusemnt "github.com/ipfs/kubo/fuse/mount"
 )
 
@@ -62,6 +63,11 @@ type Config struct {
 	// instead of the per-operation context, which the kernel cancels once the
 	// operation returns. nil falls back to context.Background (e.g. tests).
 	MountCtx context.Context
+
+	// Journal, when set, records writes buffered in open files so they can
+	// be replayed if the daemon stops before they are flushed. Only the
+	// /mfs mount, which writes the node's FilesRoot, sets it.
+	Journal *coremfs.Journal
 }
 
 // openContext returns the context to bind a long-lived file descriptor's
@@ -535,6 +541,9 @@ func (fi *FileInode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.Set
 			// ftruncate(fd, size): use the existing write descriptor.
 			f.mu.Lock()
 			err := f.fd.Truncate(int64(sz))
+			if err == nil {
+				err = f.journal(ctx, &coremfs.JournalEntry{Op: coremfs.JournalOpTruncate, Size: int64(sz)})
+			}
 			f.mu.Unlock()
 			if err != nil {
 				return fs.ToErrno(err)
@@ -622,6 +631,38 @@ type FileHandle struct {
 	cfg        *Config // for the pin lock on commit (Flush/Fsync/Release)
 	mu         sync.Mutex
 	appendMode bool // O_APPEND: writes always go to end of file
+
+	// releaseJournal releases the hold on cfg.Journal taken by the first
+	// journaled write, once the writes reach the MFS tree.
+	releaseJournal func()
+}
+
+// journal records a change buffered in fh in cfg.Journal, and holds the
+// journal until the change is flushed to the MFS tree. It must be called
+// with mu held.
+func (fh *FileHandle) journal(ctx context.Context, e *coremfs.JournalEntry) error {
+	j := fh.cfg.Journal
+	if !j.Enabled() || fh.inode == nil {
+		return nil
+	}
+	if fh.releaseJournal == nil {
+		fh.releaseJournal = j.Hold()
+	}
+	e.Path = "/" + fh.inode.Path(nil)
+	if err := j.Append(ctx, e); err != nil {
+		log.Errorf("recording write to %s in MFS journal: %s", e.Path, err)
+		return syscall.EIO
+	}
+	return nil
+}
+
+// flushedJournal releases the journal hold after a successful flush. It must
+// be called with mu held.
+func (fh *FileHandle) flushedJournal() {
+	if fh.releaseJournal != nil {
+		fh.releaseJournal()
+		fh.releaseJournal = nil
+	}
 }
 
 func (fh *FileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
@@ -648,24 +689,29 @@ func (fh *FileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.Re
 	return fuse.ReadResultData(dest[:got]), 0
 }
 
-func (fh *FileHandle) Write(_ context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+func (fh *FileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
 	fh.mu.Lock()
 	defer fh.mu.Unlock()
 
+	var (
+		n   int
+		err error
+	)
 	if fh.appendMode {
 		// O_APPEND: the kernel may send offset 0, but POSIX says
 		// writes must go to the end of the file.
-		if _, err := fh.fd.Seek(0, io.SeekEnd); err != nil {
+		if off, err = fh.fd.Seek(0, io.SeekEnd); err != nil {
 			return 0, fs.ToErrno(err)
 		}
-		n, err := fh.fd.Write(data)
-		if err != nil {
-			return 0, fs.ToErrno(err)
-		}
-		return uint32(n), 0
+		n, err = fh.fd.Write(data)
+	} else {
+		n, err = fh.fd.WriteAt(data, off)
+	}
+	if err != nil {
+		return 0, fs.ToErrno(err)
 	}
 
-	n, err := fh.fd.WriteAt(data, off)
+	err = fh.journal(ctx, &coremfs.JournalEntry{Op: coremfs.JournalOpWrite, Offset: off, Data: data[:n]})
 	if err != nil {
 		return 0, fs.ToErrno(err)
 	}
@@ -690,6 +736,9 @@ func (fh *FileHandle) Flush(ctx context.Context) syscall.Errno {
 	defer fh.mu.Unlock()
 
 	err := fh.fd.Flush()
+	if err == nil {
+		fh.flushedJournal()
+	}
 	if fh.inode != nil {
 		_ = fh.inode.NotifyContent(0, 0)
 	}
@@ -706,6 +755,9 @@ func (fh *FileHandle) Release(ctx context.Context) syscall.Errno {
 	defer fh.mu.Unlock()
 
 	err := fh.fd.Close()
+	// The descriptor is gone even if closing failed: stop holding the
+	// journal so it can be pruned.
+	fh.flushedJournal()
 	if fh.inode != nil {
 		_ = fh.inode.NotifyContent(0, 0)
 	}
@@ -724,6 +776,9 @@ func (fh *FileHandle) Fsync(ctx context.Context, _ uint32) syscall.Errno {
 	defer fh.mu.Unlock()
 
 	err := fh.fd.Flush()
+	if err == nil {
+		fh.flushedJournal()
+	}
 	if fh.inode != nil {
 		_ = fh.inode.NotifyContent(0, 0)
 	}
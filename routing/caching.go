@@ -0,0 +1,350 @@
+package routing
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/kubo/config"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CachingRouterPrefix is the datastore prefix under which caching routers
+// with the datastore store keep their results, by router name.
+var CachingRouterPrefix = datastore.NewKey("/local/routing-cache")
+
+var (
+	_ routing.Routing                  = &CachingRouter{}
+	_ routinghelpers.ProvideManyRouter = &CachingRouter{}
+)
+
+var cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ipfs",
+	Subsystem: "routing_cache",
+	Name:      "lookups_total",
+	Help:      "Provider and peer lookups of caching routers, by result: hit, negative_hit (cached empty result) or miss.",
+}, []string{"router", "lookup", "result"})
+
+func init() {
+	if err := prometheus.Register(cacheLookups); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			cacheLookups = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			log.Errorf("failed to register routing cache metrics: %s", err)
+		}
+	}
+}
+
+// CachingRouterStats counts the lookups of a caching router.
+type CachingRouterStats struct {
+	ProviderHits         uint64
+	ProviderNegativeHits uint64
+	ProviderMisses       uint64
+	PeerHits             uint64
+	PeerNegativeHits     uint64
+	PeerMisses           uint64
+}
+
+// CachingRouter forwards every method to a router, and answers provider and
+// peer lookups from the results of previous ones while they are fresh.
+// Lookups that found nothing are remembered too, for a shorter time.
+type CachingRouter struct {
+	routing.Routing
+
+	name         string
+	cache        resultCache
+	providersTTL time.Duration
+	peersTTL     time.Duration
+	negativeTTL  time.Duration
+
+	providerHits         atomic.Uint64
+	providerNegativeHits atomic.Uint64
+	providerMisses       atomic.Uint64
+	peerHits             atomic.Uint64
+	peerNegativeHits     atomic.Uint64
+	peerMisses           atomic.Uint64
+}
+
+// NewCachingRouter returns a router named name caching the results of r as
+// params set. ds is required by the datastore store.
+func NewCachingRouter(name string, r routing.Routing, params *config.CachingRouterParams, ds datastore.Datastore) (*CachingRouter, error) {
+	cr := &CachingRouter{
+		Routing:      r,
+		name:         name,
+		providersTTL: params.ProvidersTTL.WithDefault(config.DefaultCachingRouterProvidersTTL),
+		peersTTL:     params.PeersTTL.WithDefault(config.DefaultCachingRouterPeersTTL),
+		negativeTTL:  params.NegativeTTL.WithDefault(config.DefaultCachingRouterNegativeTTL),
+	}
+	if cr.providersTTL < 0 || cr.peersTTL < 0 || cr.negativeTTL < 0 {
+		return nil, errors.New("caching router TTLs must not be negative")
+	}
+
+	switch store := cmpOr(params.Store, config.DefaultCachingRouterStore); store {
+	case config.CachingRouterStoreMemory:
+		size := params.MaxEntries.WithDefault(config.DefaultCachingRouterMaxEntries)
+		if size <= 0 {
+			return nil, fmt.Errorf("caching router MaxEntries must be positive, got %d", size)
+		}
+		cache, err := lru.New[string, *cacheEntry](int(size))
+		if err != nil {
+			return nil, err
+		}
+		cr.cache = &memoryCache{cache}
+	case config.CachingRouterStoreDatastore:
+		if ds == nil {
+			return nil, fmt.Errorf("caching router: Store %q needs the repo datastore, which is not available here; use Store %q instead", config.CachingRouterStoreDatastore, config.CachingRouterStoreMemory)
+		}
+		cr.cache = &datastoreCache{ds: ds, prefix: CachingRouterPrefix.ChildString(name)}
+	default:
+		return nil, fmt.Errorf("unknown caching router store %q", store)
+	}
+	return cr, nil
+}
+
+func cmpOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Stats returns the number of lookups answered from the cache, with a
+// cached result or a cached absence of result, and forwarded.
+func (cr *CachingRouter) Stats() CachingRouterStats {
+	return CachingRouterStats{
+		ProviderHits:         cr.providerHits.Load(),
+		ProviderNegativeHits: cr.providerNegativeHits.Load(),
+		ProviderMisses:       cr.providerMisses.Load(),
+		PeerHits:             cr.peerHits.Load(),
+		PeerNegativeHits:     cr.peerNegativeHits.Load(),
+		PeerMisses:           cr.peerMisses.Load(),
+	}
+}
+
+func (cr *CachingRouter) count(lookup string, counter *atomic.Uint64, result string) {
+	counter.Add(1)
+	cacheLookups.WithLabelValues(cr.name, lookup, result).Inc()
+}
+
+func (cr *CachingRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	key := "providers/" + c.Hash().B58String()
+	if e, ok := cr.cache.get(ctx, key); ok && (!e.Partial || (count > 0 && count <= len(e.Peers))) {
+		if len(e.Peers) == 0 {
+			cr.count("providers", &cr.providerNegativeHits, "negative_hit")
+		} else {
+			cr.count("providers", &cr.providerHits, "hit")
+		}
+		peers := e.Peers
+		if count > 0 && count < len(peers) {
+			peers = peers[:count]
+		}
+		out := make(chan peer.AddrInfo, len(peers))
+		for _, p := range peers {
+			out <- p
+		}
+		close(out)
+		return out
+	}
+	cr.count("providers", &cr.providerMisses, "miss")
+
+	in := cr.Routing.FindProvidersAsync(ctx, c, count)
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		var found []peer.AddrInfo
+		for p := range in {
+			found = append(found, p)
+			select {
+			case out <- p:
+			case <-ctx.Done():
+			}
+		}
+
+		// a lookup cut short by the caller is only cached for callers
+		// asking for no more results than it found
+		complete := ctx.Err() == nil
+		switch {
+		case len(found) > 0:
+			cr.cache.put(ctx, key, &cacheEntry{
+				Expires: time.Now().Add(cr.providersTTL),
+				Peers:   found,
+				Partial: !complete || (count > 0 && len(found) >= count),
+			})
+		case complete && cr.negativeTTL > 0:
+			cr.cache.put(ctx, key, &cacheEntry{Expires: time.Now().Add(cr.negativeTTL)})
+		}
+	}()
+	return out
+}
+
+func (cr *CachingRouter) FindPeer(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
+	key := "peers/" + id.String()
+	if e, ok := cr.cache.get(ctx, key); ok {
+		if len(e.Peers) == 0 {
+			cr.count("peers", &cr.peerNegativeHits, "negative_hit")
+			return peer.AddrInfo{}, routing.ErrNotFound
+		}
+		cr.count("peers", &cr.peerHits, "hit")
+		return e.Peers[0], nil
+	}
+	cr.count("peers", &cr.peerMisses, "miss")
+
+	info, err := cr.Routing.FindPeer(ctx, id)
+	switch {
+	case err == nil:
+		cr.cache.put(ctx, key, &cacheEntry{
+			Expires: time.Now().Add(cr.peersTTL),
+			Peers:   []peer.AddrInfo{info},
+		})
+	case errors.Is(err, routing.ErrNotFound) && cr.negativeTTL > 0:
+		cr.cache.put(ctx, key, &cacheEntry{Expires: time.Now().Add(cr.negativeTTL)})
+	}
+	return info, err
+}
+
+func (cr *CachingRouter) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	pmr, ok := cr.Routing.(routinghelpers.ProvideManyRouter)
+	if !ok {
+		return provideEach(ctx, cr.Routing, keys)
+	}
+	return pmr.ProvideMany(ctx, keys)
+}
+
+// provideEach provides keys one by one with r, for routers that cannot
+// provide many keys at once.
+func provideEach(ctx context.Context, r routing.ContentRouting, keys []multihash.Multihash) error {
+	var errs []error
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.Provide(ctx, cid.NewCidV1(cid.Raw, key), true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (cr *CachingRouter) Ready() bool {
+	rr, ok := cr.Routing.(routinghelpers.ReadyAbleRouter)
+	if !ok {
+		return true
+	}
+	return rr.Ready()
+}
+
+// cacheEntry is a cached lookup result.
+type cacheEntry struct {
+	Expires time.Time
+	// Peers found; none for a lookup that found nothing.
+	Peers []peer.AddrInfo `json:",omitempty"`
+	// Partial is set when the lookup stopped before it was exhausted.
+	Partial bool `json:",omitempty"`
+}
+
+type resultCache interface {
+	// get returns the entry of key, unless missing or expired.
+	get(ctx context.Context, key string) (*cacheEntry, bool)
+	put(ctx context.Context, key string, e *cacheEntry)
+}
+
+type memoryCache struct {
+	entries *lru.Cache[string, *cacheEntry]
+}
+
+func (c *memoryCache) get(_ context.Context, key string) (*cacheEntry, bool) {
+	e, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.Expires) {
+		c.entries.Remove(key)
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *memoryCache) put(_ context.Context, key string, e *cacheEntry) {
+	c.entries.Add(key, e)
+}
+
+// sweepInterval is the number of entries added to a datastore cache between
+// two removals of its expired entries.
+const sweepInterval = 1000
+
+type datastoreCache struct {
+	ds     datastore.Datastore
+	prefix datastore.Key
+	puts   atomic.Uint64
+}
+
+var cacheKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (c *datastoreCache) key(key string) datastore.Key {
+	return c.prefix.ChildString(cacheKeyEncoding.EncodeToString([]byte(key)))
+}
+
+func (c *datastoreCache) get(ctx context.Context, key string) (*cacheEntry, bool) {
+	data, err := c.ds.Get(ctx, c.key(key))
+	if err != nil {
+		if !errors.Is(err, datastore.ErrNotFound) {
+			log.Errorf("routing cache: failed to read %s: %s", key, err)
+		}
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || !time.Now().Before(e.Expires) {
+		_ = c.ds.Delete(ctx, c.key(key))
+		return nil, false
+	}
+	return &e, true
+}
+
+func (c *datastoreCache) put(ctx context.Context, key string, e *cacheEntry) {
+	ctx = context.WithoutCancel(ctx)
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = c.ds.Put(ctx, c.key(key), data)
+	}
+	if err != nil {
+		log.Errorf("routing cache: failed to store %s: %s", key, err)
+		return
+	}
+	if c.puts.Add(1)%sweepInterval == 0 {
+		go c.sweep(ctx)
+	}
+}
+
+// sweep removes the expired entries of the cache.
+func (c *datastoreCache) sweep(ctx context.Context) {
+	results, err := c.ds.Query(ctx, query.Query{Prefix: c.prefix.String()})
+	if err != nil {
+		log.Errorf("routing cache: failed to list entries: %s", err)
+		return
+	}
+	defer results.Close()
+
+	now := time.Now()
+	for r := range results.Next() {
+		if r.Error != nil {
+			log.Errorf("routing cache: failed to list entries: %s", r.Error)
+			return
+		}
+		var e cacheEntry
+		if json.Unmarshal(r.Value, &e) != nil || !now.Before(e.Expires) {
+			_ = c.ds.Delete(ctx, datastore.NewKey(r.Key))
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package routing
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/config"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRouter answers lookups from fixed results and counts them.
+type countingRouter struct {
+	routinghelpers.Null
+
+	providers map[cid.Cid][]peer.AddrInfo
+	peers     map[peer.ID]peer.AddrInfo
+
+	providerLookups atomic.Int32
+	peerLookups     atomic.Int32
+}
+
+func (r *countingRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	r.providerLookups.Add(1)
+	out := make(chan peer.AddrInfo, len(r.providers[c]))
+	for i, p := range r.providers[c] {
+		if count > 0 && i == count {
+			break
+		}
+		out <- p
+	}
+	close(out)
+	return out
+}
+
+func (r *countingRouter) FindPeer(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
+	r.peerLookups.Add(1)
+	info, ok := r.peers[id]
+	if !ok {
+		return peer.AddrInfo{}, routing.ErrNotFound
+	}
+	return info, nil
+}
+
+func testCID(t *testing.T, data string) cid.Cid {
+	mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+func testPeerID(t *testing.T) peer.ID {
+	pid, _, err := generatePeerID()
+	require.NoError(t, err)
+	id, err := peer.Decode(pid)
+	require.NoError(t, err)
+	return id
+}
+
+func collect(ch <-chan peer.AddrInfo) []peer.AddrInfo {
+	var out []peer.AddrInfo
+	for p := range ch {
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestCachingRouter(t *testing.T) {
+	for _, store := range []string{config.CachingRouterStoreMemory, config.CachingRouterStoreDatastore} {
+		t.Run(store, func(t *testing.T) {
+			ctx := t.Context()
+			provided, missing := testCID(t, "provided"), testCID(t, "missing")
+			addrs := []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/4001")}
+			p1 := peer.AddrInfo{ID: testPeerID(t), Addrs: addrs}
+			p2 := peer.AddrInfo{ID: testPeerID(t), Addrs: addrs}
+			child := &countingRouter{
+				providers: map[cid.Cid][]peer.AddrInfo{provided: {p1, p2}},
+				peers:     map[peer.ID]peer.AddrInfo{p1.ID: p1},
+			}
+
+			cr, err := NewCachingRouter("cache", child, &config.CachingRouterParams{Store: store}, dssync.MutexWrap(datastore.NewMapDatastore()))
+			require.NoError(t, err)
+
+			// a lookup limited to one provider does not answer larger ones
+			require.Len(t, collect(cr.FindProvidersAsync(ctx, provided, 1)), 1)
+			require.Len(t, collect(cr.FindProvidersAsync(ctx, provided, 1)), 1)
+			require.Equal(t, []peer.AddrInfo{p1, p2}, collect(cr.FindProvidersAsync(ctx, provided, 0)))
+			require.Equal(t, []peer.AddrInfo{p1, p2}, collect(cr.FindProvidersAsync(ctx, provided, 0)))
+			require.EqualValues(t, 2, child.providerLookups.Load())
+
+			require.Empty(t, collect(cr.FindProvidersAsync(ctx, missing, 0)))
+			require.Empty(t, collect(cr.FindProvidersAsync(ctx, missing, 0)))
+			require.EqualValues(t, 3, child.providerLookups.Load())
+
+			for range 2 {
+				info, err := cr.FindPeer(ctx, p1.ID)
+				require.NoError(t, err)
+				require.Equal(t, p1, info)
+				_, err = cr.FindPeer(ctx, p2.ID)
+				require.ErrorIs(t, err, routing.ErrNotFound)
+			}
+			require.EqualValues(t, 2, child.peerLookups.Load())
+
+			require.Equal(t, CachingRouterStats{
+				ProviderHits:         2,
+				ProviderNegativeHits: 1,
+				ProviderMisses:       3,
+				PeerHits:             1,
+				PeerNegativeHits:     1,
+				PeerMisses:           2,
+			}, cr.Stats())
+		})
+	}
+}
+
+func TestCachingRouterExpiry(t *testing.T) {
+	ctx := t.Context()
+	p1, p2 := peer.AddrInfo{ID: testPeerID(t)}, testPeerID(t)
+	child := &countingRouter{peers: map[peer.ID]peer.AddrInfo{p1.ID: p1}}
+	ttl := config.NewOptionalDuration(0)
+	cr, err := NewCachingRouter("cache", child, &config.CachingRouterParams{PeersTTL: ttl, NegativeTTL: ttl}, nil)
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err := cr.FindPeer(ctx, p1.ID)
+		require.NoError(t, err)
+		_, err = cr.FindPeer(ctx, p2)
+		require.ErrorIs(t, err, routing.ErrNotFound)
+	}
+	require.EqualValues(t, 4, child.peerLookups.Load())
+}
+
+func TestCachingRouterParams(t *testing.T) {
+	_, err := NewCachingRouter("cache", routinghelpers.Null{}, &config.CachingRouterParams{Store: "disk"}, nil)
+	require.ErrorContains(t, err, `unknown caching router store "disk"`)
+
+	_, err = NewCachingRouter("cache", routinghelpers.Null{}, &config.CachingRouterParams{Store: config.CachingRouterStoreDatastore}, nil)
+	require.Error(t, err)
+}
+
+// provideRouter records the keys it is asked to provide, one at a time.
+type provideRouter struct {
+	routinghelpers.Null
+
+	provided []cid.Cid
+}
+
+func (r *provideRouter) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	r.provided = append(r.provided, c)
+	return nil
+}
+
+func TestCachingRouterProvideMany(t *testing.T) {
+	child := &provideRouter{}
+	cr, err := NewCachingRouter("cache", child, &config.CachingRouterParams{}, nil)
+	require.NoError(t, err)
+
+	keys := []multihash.Multihash{testCID(t, "a").Hash(), testCID(t, "b").Hash()}
+	require.NoError(t, cr.ProvideMany(t.Context(), keys))
+	require.Equal(t, []cid.Cid{testCID(t, "a"), testCID(t, "b")}, child.provided)
+}
@@ -160,6 +160,21 @@ func parse(visited map[string]bool,
 		}
 
 		router = routinghelpers.NewComposableSequential(sr)
+	case config.RouterTypeCaching:
+		crp := cfg.Parameters.(*config.CachingRouterParams)
+		child, err := parse(visited, createdRouters, crp.RouterName, routersCfg, extraDHT, extraHTTP)
+		if err != nil {
+			return nil, err
+		}
+
+		var ds datastore.Datastore
+		if extraDHT != nil {
+			ds = extraDHT.Datastore
+		}
+		router, err = NewCachingRouter(routerName, child, crp, ds)
+		if err != nil {
+			return nil, fmt.Errorf("router %q: %w", routerName, err)
+		}
 	default:
 		return nil, fmt.Errorf("unknown router type %q", cfg.Type)
 	}
@@ -168,6 +183,7 @@ func parse(visited map[string]bool,
 		return nil, err
 	}
 
+	router = NewInstrumentedRouter(routerName, cfg.Type, router)
 	createdRouters[routerName] = router
 
 	log.Info("created router ", routerName, " with params ", cfg.Parameters)
@@ -180,9 +196,11 @@ type ExtraHTTPParams struct {
 	AddrFunc      func() []ma.Multiaddr // dynamic address resolver for provider records
 	PrivKeyB64    string
 	HTTPRetrieval bool
+	// PublishQueue, when set, queues the values the router fails to put.
+	PublishQueue *PublishQueue
 }
 
-func ConstructHTTPRouter(endpoint string, peerID string, addrFunc func() []ma.Multiaddr, privKey string, httpRetrieval bool) (routing.Routing, error) {
+func ConstructHTTPRouter(endpoint string, peerID string, addrFunc func() []ma.Multiaddr, privKey string, httpRetrieval bool, queue *PublishQueue) (routing.Routing, error) {
 	return httpRoutingFromConfig(
 		config.Router{
 			Type: "http",
@@ -195,6 +213,7 @@ func ConstructHTTPRouter(endpoint string, peerID string, addrFunc func() []ma.Mu
 			AddrFunc:      addrFunc,
 			PrivKeyB64:    privKey,
 			HTTPRetrieval: httpRetrieval,
+			PublishQueue:  queue,
 		},
 	)
 }
@@ -285,11 +304,18 @@ func httpRoutingFromConfig(conf config.Router, extraHTTP *ExtraHTTPParams) (rout
 		return nil, fmt.Errorf("registering HTTP delegated routing views: %w", err)
 	}
 
+	var vs routing.ValueStore = cr
+	if extraHTTP.PublishQueue != nil {
+		// failed publishes are retried until the record expires
+		vs = extraHTTP.PublishQueue.Publisher(params.Endpoint, cr)
+	}
+
 	return &httpRoutingWrapper{
 		ContentRouting:    cr,
 		PeerRouting:       cr,
-		ValueStore:        cr,
+		ValueStore:        vs,
 		ProvideManyRouter: cr,
+		endpoint:          params.Endpoint,
 	}, nil
 }
 
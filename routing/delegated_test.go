@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"testing"
 
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipfs/kubo/config"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -154,6 +156,69 @@ func TestParserRecursive(t *testing.T) {
 
 	_, ok := router.(*Composer)
 	require.True(ok)
+
+	var names []string
+	for _, src := range ValueSources(router) {
+		names = append(names, src.Name)
+	}
+	require.Equal([]string{"http http://testEndpoint1", "http http://testEndpoint2", "http http://testEndpoint3"}, names)
+}
+
+func TestParserCaching(t *testing.T) {
+	require := require.New(t)
+
+	pid, sk, err := generatePeerID()
+	require.NoError(err)
+
+	routers := config.Routers{
+		"http": config.RouterParser{
+			Router: config.Router{
+				Type: config.RouterTypeHTTP,
+				Parameters: &config.HTTPRouterParams{
+					Endpoint: "http://testEndpoint",
+				},
+			},
+		},
+		"cache": config.RouterParser{
+			Router: config.Router{
+				Type: config.RouterTypeCaching,
+				Parameters: &config.CachingRouterParams{
+					RouterName: "http",
+					Store:      config.CachingRouterStoreDatastore,
+				},
+			},
+		},
+	}
+	methods := config.Methods{
+		config.MethodNameFindPeers:     config.Method{RouterName: "cache"},
+		config.MethodNameFindProviders: config.Method{RouterName: "cache"},
+		config.MethodNameGetIPNS:       config.Method{RouterName: "cache"},
+		config.MethodNamePutIPNS:       config.Method{RouterName: "http"},
+		config.MethodNameProvide:       config.Method{RouterName: "http"},
+	}
+	extraHTTP := &ExtraHTTPParams{
+		PeerID:     pid,
+		PrivKeyB64: sk,
+	}
+
+	router, err := Parse(routers, methods, &ExtraDHTParams{Datastore: dssync.MutexWrap(datastore.NewMapDatastore())}, extraHTTP)
+	require.NoError(err)
+
+	comp, ok := router.(*Composer)
+	require.True(ok)
+	require.IsType(&CachingRouter{}, comp.FindProvidersRouter.(*InstrumentedRouter).Routing)
+
+	var names []string
+	for _, src := range ValueSources(router) {
+		names = append(names, src.Name)
+	}
+	require.Equal([]string{"http http://testEndpoint"}, names)
+
+	// the datastore store needs a datastore
+	_, err = Parse(routers, methods, &ExtraDHTParams{}, extraHTTP)
+	require.ErrorContains(err, `router "cache"`)
+	_, err = Parse(routers, methods, nil, extraHTTP)
+	require.ErrorContains(err, `use Store "memory"`)
 }
 
 func TestParserRecursiveLoop(t *testing.T) {
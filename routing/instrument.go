@@ -0,0 +1,363 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ routing.Routing                  = &InstrumentedRouter{}
+	_ routinghelpers.ProvideManyRouter = &InstrumentedRouter{}
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms of
+// instrumented routers.
+var LatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// Results of router requests.
+const (
+	resultSuccess  = "success"
+	resultNotFound = "not_found"
+	resultError    = "error"
+)
+
+var routerRequests = func() *prometheus.HistogramVec {
+	buckets := make([]float64, len(LatencyBuckets))
+	for i, b := range LatencyBuckets {
+		buckets[i] = b.Seconds()
+	}
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ipfs",
+		Subsystem: "routing",
+		Name:      "router_request_duration_seconds",
+		Help:      "Duration of the requests of the routers of Routing.Routers, by method and result: success, not_found or error.",
+		Buckets:   buckets,
+	}, []string{"router", "method", "result"})
+}()
+
+func init() {
+	if err := prometheus.Register(routerRequests); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			routerRequests = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			log.Errorf("failed to register router metrics: %s", err)
+		}
+	}
+}
+
+// RouterMethodStats counts the requests of a method of a router.
+type RouterMethodStats struct {
+	Method   config.MethodName
+	Requests uint64
+	// NotFound counts the requests that completed without result.
+	NotFound uint64
+	Errors   uint64
+	// Latency[i] counts the requests that took at most LatencyBuckets[i],
+	// and its last element those that took longer than all of them.
+	Latency       []uint64
+	TotalLatency  time.Duration
+	LastError     string    `json:",omitempty"`
+	LastErrorTime time.Time `json:",omitzero"`
+}
+
+// Quantile returns the upper bound of the latency bucket holding the
+// requests of quantile q, math.MaxInt64 when they took longer than the last
+// bucket, and zero without requests.
+func (s *RouterMethodStats) Quantile(q float64) time.Duration {
+	rank := uint64(math.Ceil(q * float64(s.Requests)))
+	var seen uint64
+	for i, n := range s.Latency {
+		seen += n
+		if seen >= max(rank, 1) {
+			if i == len(LatencyBuckets) {
+				return math.MaxInt64
+			}
+			return LatencyBuckets[i]
+		}
+	}
+	return 0
+}
+
+// RouterStats are the statistics of a router of Routing.Routers.
+type RouterStats struct {
+	Name    string
+	Type    config.RouterType
+	Methods []RouterMethodStats
+	// Cache is set on caching routers.
+	Cache *CachingRouterStats `json:",omitempty"`
+}
+
+type methodStats struct {
+	mu            sync.Mutex
+	requests      uint64
+	notFound      uint64
+	errors        uint64
+	latency       []uint64
+	totalLatency  time.Duration
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// InstrumentedRouter forwards every method to a router, and records the
+// number, outcome and latency of the requests by method.
+type InstrumentedRouter struct {
+	routing.Routing
+
+	name    string
+	typ     config.RouterType
+	methods map[config.MethodName]*methodStats
+}
+
+// NewInstrumentedRouter returns r instrumented under name.
+func NewInstrumentedRouter(name string, typ config.RouterType, r routing.Routing) *InstrumentedRouter {
+	ir := &InstrumentedRouter{
+		Routing: r,
+		name:    name,
+		typ:     typ,
+		methods: make(map[config.MethodName]*methodStats, len(config.MethodNameList)),
+	}
+	for _, m := range config.MethodNameList {
+		ir.methods[m] = &methodStats{latency: make([]uint64, len(LatencyBuckets)+1)}
+	}
+	return ir
+}
+
+// Name returns the name of the router in Routing.Routers.
+func (ir *InstrumentedRouter) Name() string {
+	return ir.name
+}
+
+// Stats returns the statistics of the router, methods in the order of
+// config.MethodNameList.
+func (ir *InstrumentedRouter) Stats() RouterStats {
+	out := RouterStats{Name: ir.name, Type: ir.typ}
+	for _, m := range config.MethodNameList {
+		s := ir.methods[m]
+		s.mu.Lock()
+		out.Methods = append(out.Methods, RouterMethodStats{
+			Method:        m,
+			Requests:      s.requests,
+			NotFound:      s.notFound,
+			Errors:        s.errors,
+			Latency:       slices.Clone(s.latency),
+			TotalLatency:  s.totalLatency,
+			LastError:     s.lastError,
+			LastErrorTime: s.lastErrorTime,
+		})
+		s.mu.Unlock()
+	}
+	if cr, ok := ir.Routing.(*CachingRouter); ok {
+		stats := cr.Stats()
+		out.Cache = &stats
+	}
+	return out
+}
+
+func (ir *InstrumentedRouter) observe(method config.MethodName, start time.Time, result string, err error) {
+	d := time.Since(start)
+	routerRequests.WithLabelValues(ir.name, string(method), result).Observe(d.Seconds())
+
+	s := ir.methods[method]
+	bucket, _ := slices.BinarySearch(LatencyBuckets, d)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.latency[bucket]++
+	s.totalLatency += d
+	switch result {
+	case resultNotFound:
+		s.notFound++
+	case resultError:
+		s.errors++
+		s.lastError = err.Error()
+		s.lastErrorTime = time.Now()
+	}
+}
+
+// resultOf classifies the outcome of a request that returned err.
+func resultOf(err error) string {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, routing.ErrNotFound):
+		return resultNotFound
+	default:
+		return resultError
+	}
+}
+
+// streamResult classifies the outcome of a request that streamed n results
+// until ctx was done or the router had no more.
+func streamResult(ctx context.Context, n int) (string, error) {
+	switch {
+	case n > 0:
+		return resultSuccess, nil
+	case ctx.Err() != nil:
+		return resultError, ctx.Err()
+	default:
+		return resultNotFound, nil
+	}
+}
+
+func (ir *InstrumentedRouter) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	start := time.Now()
+	err := ir.Routing.Provide(ctx, c, announce)
+	ir.observe(config.MethodNameProvide, start, resultOf(err), err)
+	return err
+}
+
+func (ir *InstrumentedRouter) ProvideMany(ctx context.Context, keys []multihash.Multihash) error {
+	pmr, ok := ir.Routing.(routinghelpers.ProvideManyRouter)
+	if !ok {
+		// each Provide is observed
+		return provideEach(ctx, ir, keys)
+	}
+	start := time.Now()
+	err := pmr.ProvideMany(ctx, keys)
+	ir.observe(config.MethodNameProvide, start, resultOf(err), err)
+	return err
+}
+
+func (ir *InstrumentedRouter) Ready() bool {
+	rr, ok := ir.Routing.(routinghelpers.ReadyAbleRouter)
+	if !ok {
+		return true
+	}
+	return rr.Ready()
+}
+
+func (ir *InstrumentedRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	start := time.Now()
+	in := ir.Routing.FindProvidersAsync(ctx, c, count)
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		var n int
+		for p := range in {
+			n++
+			select {
+			case out <- p:
+			case <-ctx.Done():
+			}
+		}
+		result, err := streamResult(ctx, n)
+		ir.observe(config.MethodNameFindProviders, start, result, err)
+	}()
+	return out
+}
+
+func (ir *InstrumentedRouter) FindPeer(ctx context.Context, id peer.ID) (peer.AddrInfo, error) {
+	start := time.Now()
+	info, err := ir.Routing.FindPeer(ctx, id)
+	ir.observe(config.MethodNameFindPeers, start, resultOf(err), err)
+	return info, err
+}
+
+func (ir *InstrumentedRouter) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	start := time.Now()
+	err := ir.Routing.PutValue(ctx, key, value, opts...)
+	ir.observe(config.MethodNamePutIPNS, start, resultOf(err), err)
+	return err
+}
+
+func (ir *InstrumentedRouter) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	start := time.Now()
+	value, err := ir.Routing.GetValue(ctx, key, opts...)
+	ir.observe(config.MethodNameGetIPNS, start, resultOf(err), err)
+	return value, err
+}
+
+func (ir *InstrumentedRouter) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	start := time.Now()
+	in, err := ir.Routing.SearchValue(ctx, key, opts...)
+	if err != nil || in == nil {
+		ir.observe(config.MethodNameGetIPNS, start, resultOf(err), err)
+		return in, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		var n int
+		for v := range in {
+			n++
+			select {
+			case out <- v:
+			case <-ctx.Done():
+			}
+		}
+		result, err := streamResult(ctx, n)
+		ir.observe(config.MethodNameGetIPNS, start, result, err)
+	}()
+	return out, nil
+}
+
+// InstrumentedRouters returns the instrumented routers r is composed of,
+// sorted by name.
+func InstrumentedRouters(r routing.Routing) []*InstrumentedRouter {
+	var out []*InstrumentedRouter
+	seen := make(map[*InstrumentedRouter]bool)
+	var walk func(r any)
+	walk = func(r any) {
+		switch r := r.(type) {
+		case *InstrumentedRouter:
+			if !seen[r] {
+				seen[r] = true
+				out = append(out, r)
+				walk(r.Routing)
+			}
+		case *Composer:
+			walk(r.GetValueRouter)
+			walk(r.PutValueRouter)
+			walk(r.FindPeersRouter)
+			walk(r.FindProvidersRouter)
+			walk(r.ProvideRouter)
+		case *CachingRouter:
+			walk(r.Routing)
+		case *queuedRouter:
+			walk(r.ProvideManyRouter)
+		case routinghelpers.ComposableRouter:
+			for _, c := range r.Routers() {
+				walk(c)
+			}
+		case routinghelpers.Parallel:
+			for _, c := range r.Routers {
+				walk(c)
+			}
+		case routinghelpers.Tiered:
+			for _, c := range r.Routers {
+				walk(c)
+			}
+		}
+	}
+	walk(r)
+	slices.SortFunc(out, func(a, b *InstrumentedRouter) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return out
+}
@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/config"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+type failingPublisher struct {
+	routinghelpers.Null
+}
+
+func (failingPublisher) PutValue(context.Context, string, []byte, ...routing.Option) error {
+	return errors.New("endpoint is down")
+}
+
+func TestInstrumentedRouter(t *testing.T) {
+	ctx := t.Context()
+	provided, missing := testCID(t, "provided"), testCID(t, "missing")
+	p1 := peer.AddrInfo{ID: testPeerID(t)}
+	child := &countingRouter{
+		providers: map[cid.Cid][]peer.AddrInfo{provided: {p1}},
+		peers:     map[peer.ID]peer.AddrInfo{p1.ID: p1},
+	}
+	ir := NewInstrumentedRouter("child", config.RouterTypeHTTP, child)
+
+	require.Len(t, collect(ir.FindProvidersAsync(ctx, provided, 0)), 1)
+	require.Empty(t, collect(ir.FindProvidersAsync(ctx, missing, 0)))
+	_, err := ir.FindPeer(ctx, p1.ID)
+	require.NoError(t, err)
+
+	failing := NewInstrumentedRouter("failing", config.RouterTypeHTTP, failingPublisher{})
+	require.Error(t, failing.PutValue(ctx, "/ipns/key", []byte("value")))
+
+	stats := ir.Stats()
+	require.Equal(t, "child", stats.Name)
+	require.Len(t, stats.Methods, len(config.MethodNameList))
+	for _, m := range stats.Methods {
+		switch m.Method {
+		case config.MethodNameFindProviders:
+			require.EqualValues(t, 2, m.Requests)
+			require.EqualValues(t, 1, m.NotFound)
+			require.EqualValues(t, 0, m.Errors)
+			require.Equal(t, LatencyBuckets[0], m.Quantile(0.5))
+		case config.MethodNameFindPeers:
+			require.EqualValues(t, 1, m.Requests)
+		default:
+			require.Zero(t, m.Requests)
+			require.Zero(t, m.Quantile(0.5))
+		}
+	}
+
+	for _, m := range failing.Stats().Methods {
+		if m.Method == config.MethodNamePutIPNS {
+			require.EqualValues(t, 1, m.Errors)
+			require.Equal(t, "endpoint is down", m.LastError)
+		}
+	}
+
+	composed := &Composer{
+		GetValueRouter:      failing,
+		PutValueRouter:      failing,
+		FindPeersRouter:     routinghelpers.NewComposableParallel([]*routinghelpers.ParallelRouter{{Router: ir}}),
+		FindProvidersRouter: ir,
+		ProvideRouter:       failing,
+	}
+	routers := InstrumentedRouters(composed)
+	require.Len(t, routers, 2)
+	require.Equal(t, "child", routers[0].Name())
+	require.Equal(t, "failing", routers[1].Name())
+}
+
+func TestInstrumentedRouterProvideMany(t *testing.T) {
+	child := &provideRouter{}
+	ir := NewInstrumentedRouter("child", config.RouterTypeHTTP, child)
+	parallel := routinghelpers.NewComposableParallel([]*routinghelpers.ParallelRouter{{Router: ir}})
+
+	keys := []multihash.Multihash{testCID(t, "a").Hash(), testCID(t, "b").Hash()}
+	require.NoError(t, parallel.ProvideMany(t.Context(), keys))
+	require.Equal(t, []cid.Cid{testCID(t, "a"), testCID(t, "b")}, child.provided)
+
+	for _, m := range ir.Stats().Methods {
+		if m.Method == config.MethodNameProvide {
+			require.EqualValues(t, 2, m.Requests)
+			require.EqualValues(t, 0, m.Errors)
+		}
+	}
+}
+
+func TestRouterMethodStatsQuantile(t *testing.T) {
+	s := RouterMethodStats{Requests: 10, Latency: make([]uint64, len(LatencyBuckets)+1)}
+	s.Latency[0] = 5
+	s.Latency[3] = 4
+	s.Latency[len(LatencyBuckets)] = 1
+
+	require.Equal(t, LatencyBuckets[0], s.Quantile(0.5))
+	require.Equal(t, LatencyBuckets[3], s.Quantile(0.9))
+	require.Equal(t, time.Duration(math.MaxInt64), s.Quantile(0.99))
+}
@@ -0,0 +1,349 @@
+package routing
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// PublishQueuePrefix is the datastore prefix under which records that could
+// not be delivered to a delegated publisher wait to be sent again.
+var PublishQueuePrefix = datastore.NewKey("/local/delegated-publish-queue")
+
+const (
+	// PublishRetryMinBackoff is the time before the first retry of a failed
+	// delivery; it doubles with each failed attempt.
+	PublishRetryMinBackoff = time.Minute
+	// PublishRetryMaxBackoff caps the time between two retries.
+	PublishRetryMaxBackoff = time.Hour
+)
+
+// PendingPublish is a record waiting to be delivered to a delegated
+// publisher.
+type PendingPublish struct {
+	Endpoint string
+	// Key is the routing key of the record, e.g. /ipns/<name>.
+	Key         []byte
+	Record      []byte
+	Queued      time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+var keyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func pendingKey(endpoint, key string) datastore.Key {
+	return PublishQueuePrefix.
+		ChildString(keyEncoding.EncodeToString([]byte(endpoint))).
+		ChildString(keyEncoding.EncodeToString([]byte(key)))
+}
+
+// PendingPublishes returns the records waiting to be delivered to delegated
+// publishers, by endpoint, oldest first.
+func PendingPublishes(ctx context.Context, ds datastore.Datastore) ([]PendingPublish, error) {
+	results, err := ds.Query(ctx, query.Query{Prefix: PublishQueuePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var out []PendingPublish
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var p PendingPublish
+		if err := json.Unmarshal(r.Value, &p); err != nil {
+			log.Errorf("ignoring undecodable pending publish %s: %s", r.Key, err)
+			continue
+		}
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b PendingPublish) int {
+		return cmp.Or(strings.Compare(a.Endpoint, b.Endpoint), a.Queued.Compare(b.Queued))
+	})
+	return out, nil
+}
+
+// PublishQueue keeps the records delegated publishers failed to accept in
+// the datastore, and delivers them again with exponential backoff until they
+// are accepted, replaced by a newer record, or expire.
+type PublishQueue struct {
+	ds         datastore.Datastore
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	routers map[string]routing.ValueStore
+	wake    chan struct{}
+}
+
+func NewPublishQueue(ds datastore.Datastore) *PublishQueue {
+	return &PublishQueue{
+		ds:         ds,
+		minBackoff: PublishRetryMinBackoff,
+		maxBackoff: PublishRetryMaxBackoff,
+		routers:    make(map[string]routing.ValueStore),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Wrap returns a router that uses r, the router composed of all the
+// routers of the node, and queues the values the delegated publishers
+// within it failed to accept. Delegated publishers are the value stores
+// returned by Publisher; their failures are queued even when r ignores them.
+func (q *PublishQueue) Wrap(r ProvideManyRouter) ProvideManyRouter {
+	return &queuedRouter{ProvideManyRouter: r, queue: q}
+}
+
+// Publisher returns a value store that puts values with vs, the value store
+// of the delegated publisher at endpoint, and reports the outcome to the
+// router returned by Wrap. Queued values are delivered again with vs.
+func (q *PublishQueue) Publisher(endpoint string, vs routing.ValueStore) routing.ValueStore {
+	q.mu.Lock()
+	q.routers[endpoint] = vs
+	q.mu.Unlock()
+	return &publisherValueStore{ValueStore: vs, endpoint: endpoint}
+}
+
+type putOutcomesKey struct{}
+
+// putOutcomes collects the outcome of a put at each delegated publisher.
+type putOutcomes struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+type publisherValueStore struct {
+	routing.ValueStore
+	endpoint string
+}
+
+func (vs *publisherValueStore) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	err := vs.ValueStore.PutValue(ctx, key, value, opts...)
+	if o, ok := ctx.Value(putOutcomesKey{}).(*putOutcomes); ok {
+		o.mu.Lock()
+		o.errs[vs.endpoint] = err
+		o.mu.Unlock()
+	}
+	return err
+}
+
+type queuedRouter struct {
+	ProvideManyRouter
+	queue *PublishQueue
+}
+
+func (r *queuedRouter) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	outcomes := &putOutcomes{errs: make(map[string]error)}
+	err := r.ProvideManyRouter.PutValue(context.WithValue(ctx, putOutcomesKey{}, outcomes), key, value, opts...)
+
+	ctx = context.WithoutCancel(ctx)
+	outcomes.mu.Lock()
+	defer outcomes.mu.Unlock()
+	var queued bool
+	for endpoint, perr := range outcomes.errs {
+		if perr == nil {
+			// whatever was pending for key is superseded by value
+			r.queue.remove(ctx, endpoint, key, nil)
+			continue
+		}
+		now := time.Now()
+		r.queue.store(ctx, &PendingPublish{
+			Endpoint:    endpoint,
+			Key:         []byte(key),
+			Record:      value,
+			Queued:      now,
+			Attempts:    1,
+			NextAttempt: now.Add(r.queue.backoff(1)),
+			LastError:   perr.Error(),
+		}, false)
+		log.Infof("publish of %s to %s failed, will retry: %s", displayKey([]byte(key)), endpoint, perr)
+		queued = true
+	}
+	if queued {
+		select {
+		case r.queue.wake <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+// store saves p. With ifUnchanged, p is only saved if the queue still holds
+// the same record for its key.
+func (q *PublishQueue) store(ctx context.Context, p *PendingPublish, ifUnchanged bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := pendingKey(p.Endpoint, string(p.Key))
+	if ifUnchanged && !q.holds(ctx, key, p.Record) {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err == nil {
+		err = q.ds.Put(ctx, key, data)
+	}
+	if err != nil {
+		log.Errorf("failed to queue publish of %s to %s: %s", displayKey(p.Key), p.Endpoint, err)
+	}
+}
+
+// remove drops the pending publish of key to endpoint. When record is set,
+// it is only dropped if it still holds record.
+func (q *PublishQueue) remove(ctx context.Context, endpoint, key string, record []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dsKey := pendingKey(endpoint, key)
+	if record != nil && !q.holds(ctx, dsKey, record) {
+		return
+	}
+	if err := q.ds.Delete(ctx, dsKey); err != nil {
+		log.Errorf("failed to remove pending publish of %s to %s: %s", displayKey([]byte(key)), endpoint, err)
+	}
+}
+
+func (q *PublishQueue) holds(ctx context.Context, key datastore.Key, record []byte) bool {
+	data, err := q.ds.Get(ctx, key)
+	if err != nil {
+		return false
+	}
+	var p PendingPublish
+	return json.Unmarshal(data, &p) == nil && bytes.Equal(p.Record, record)
+}
+
+func (q *PublishQueue) backoff(attempts int) time.Duration {
+	d := q.minBackoff
+	for i := 1; i < attempts && d < q.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, q.maxBackoff)
+}
+
+// Run delivers queued records when their retry is due, until ctx is done.
+func (q *PublishQueue) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-q.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			return
+		}
+		timer.Reset(q.retryDue(ctx))
+	}
+}
+
+// RetryNow delivers every queued record right away, whether or not its
+// retry is due, and returns the deliveries still pending.
+func (q *PublishQueue) RetryNow(ctx context.Context) ([]PendingPublish, error) {
+	pending, err := PendingPublishes(ctx, q.ds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		q.retry(ctx, &pending[i])
+	}
+	return PendingPublishes(ctx, q.ds)
+}
+
+// retryDue retries the deliveries that are due, and returns the time until
+// the next one is.
+func (q *PublishQueue) retryDue(ctx context.Context) time.Duration {
+	pending, err := PendingPublishes(ctx, q.ds)
+	if err != nil {
+		log.Errorf("failed to list pending publishes: %s", err)
+		return q.minBackoff
+	}
+
+	next := q.maxBackoff
+	for i := range pending {
+		p := &pending[i]
+		if time.Now().Before(p.NextAttempt) {
+			next = min(next, time.Until(p.NextAttempt))
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if q.retry(ctx, p) {
+			next = min(next, time.Until(p.NextAttempt))
+		}
+	}
+	return max(next, 10*time.Millisecond)
+}
+
+// retry delivers p once, and reports whether it is still pending.
+func (q *PublishQueue) retry(ctx context.Context, p *PendingPublish) bool {
+	if expired(p) {
+		log.Infof("dropping pending publish of %s to %s: the record expired", displayKey(p.Key), p.Endpoint)
+		q.remove(ctx, p.Endpoint, string(p.Key), p.Record)
+		return false
+	}
+
+	q.mu.Lock()
+	vs, ok := q.routers[p.Endpoint]
+	q.mu.Unlock()
+	if !ok {
+		// the endpoint is no longer configured; keep the record until it
+		// expires, in case it is configured again after a restart
+		p.NextAttempt = time.Now().Add(q.maxBackoff)
+		q.store(ctx, p, true)
+		return true
+	}
+
+	err := vs.PutValue(ctx, string(p.Key), p.Record)
+	if err == nil {
+		log.Infof("delivered pending publish of %s to %s after %d attempts", displayKey(p.Key), p.Endpoint, p.Attempts+1)
+		q.remove(ctx, p.Endpoint, string(p.Key), p.Record)
+		return false
+	}
+	if ctx.Err() != nil {
+		return true
+	}
+	p.Attempts++
+	p.NextAttempt = time.Now().Add(q.backoff(p.Attempts))
+	p.LastError = err.Error()
+	q.store(ctx, p, true)
+	return true
+}
+
+// expired reports whether p holds an IPNS record that is no longer valid.
+func expired(p *PendingPublish) bool {
+	if !bytes.HasPrefix(p.Key, []byte("/ipns/")) {
+		return false
+	}
+	rec, err := ipns.UnmarshalRecord(p.Record)
+	if err != nil {
+		return true
+	}
+	eol, err := rec.Validity()
+	return err == nil && time.Now().After(eol)
+}
+
+// displayKey renders the routing key of IPNS records as the IPNS path of
+// the name, other keys as they are.
+func displayKey(key []byte) string {
+	if name, err := ipns.NameFromRoutingKey(key); err == nil {
+		return name.AsPath().String()
+	}
+	return string(key)
+}
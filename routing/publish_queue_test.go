@@ -0,0 +1,143 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/ipns"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyPublisher fails to put values while down.
+type flakyPublisher struct {
+	routinghelpers.Null
+
+	mu     sync.Mutex
+	down   bool
+	values map[string][]byte
+}
+
+func (p *flakyPublisher) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("endpoint is down")
+	}
+	p.values[key] = value
+	return nil
+}
+
+func (p *flakyPublisher) setDown(down bool) {
+	p.mu.Lock()
+	p.down = down
+	p.mu.Unlock()
+}
+
+func (p *flakyPublisher) get(key string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.values[key]
+}
+
+// composedRouter composes pub with another router the way the node does, so
+// that the failures of pub are ignored by the composed router.
+func composedRouter(q *PublishQueue, pub *flakyPublisher) ProvideManyRouter {
+	return q.Wrap(routinghelpers.NewComposableParallel([]*routinghelpers.ParallelRouter{
+		{Router: routinghelpers.Null{}, IgnoreError: true},
+		{Router: &routinghelpers.Compose{ValueStore: q.Publisher("https://publisher.example", pub)}, IgnoreError: true},
+	}))
+}
+
+func TestPublishQueue(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	q := NewPublishQueue(ds)
+	q.minBackoff, q.maxBackoff = 10*time.Millisecond, 40*time.Millisecond
+
+	pub := &flakyPublisher{down: true, values: make(map[string][]byte)}
+	r := composedRouter(q, pub)
+
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(sk)
+	require.NoError(t, err)
+	name := ipns.NameFromPeer(id)
+	key := string(name.RoutingKey())
+	record := func(seq uint64, eol time.Time) []byte {
+		rec, err := ipns.NewRecord(sk, path.FromCid(name.Cid()), seq, eol, time.Minute)
+		require.NoError(t, err)
+		data, err := ipns.MarshalRecord(rec)
+		require.NoError(t, err)
+		return data
+	}
+
+	// a failed put is queued, a newer failed put replaces it
+	require.NoError(t, r.PutValue(ctx, key, record(1, time.Now().Add(time.Hour))))
+	latest := record(2, time.Now().Add(time.Hour))
+	require.NoError(t, r.PutValue(ctx, key, latest))
+	pending, err := PendingPublishes(ctx, ds)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "https://publisher.example", pending[0].Endpoint)
+	assert.Equal(t, latest, pending[0].Record)
+	assert.Equal(t, "endpoint is down", pending[0].LastError)
+
+	// retries back off while the endpoint is down
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(runCtx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	require.Eventually(t, func() bool {
+		pending, err := PendingPublishes(ctx, ds)
+		return err == nil && len(pending) == 1 && pending[0].Attempts >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// and stop once it is back
+	pub.setDown(false)
+	require.Eventually(t, func() bool {
+		pending, err := PendingPublishes(ctx, ds)
+		return err == nil && len(pending) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, latest, pub.get(key))
+
+	// expired records are dropped
+	pub.setDown(true)
+	require.NoError(t, r.PutValue(ctx, key, record(3, time.Now().Add(50*time.Millisecond))))
+	require.Eventually(t, func() bool {
+		pending, err := PendingPublishes(ctx, ds)
+		return err == nil && len(pending) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, latest, pub.get(key))
+}
+
+func TestPublishQueueSuperseded(t *testing.T) {
+	ctx := t.Context()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	q := NewPublishQueue(ds)
+	pub := &flakyPublisher{down: true, values: make(map[string][]byte)}
+	r := composedRouter(q, pub)
+
+	require.NoError(t, r.PutValue(ctx, "/ipns/key", []byte("old")))
+	pub.setDown(false)
+	require.NoError(t, r.PutValue(ctx, "/ipns/key", []byte("new")))
+	pending, err := PendingPublishes(ctx, ds)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
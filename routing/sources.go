@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"fmt"
+	"reflect"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/dual"
+	"github.com/libp2p/go-libp2p-kad-dht/fullrt"
+	psrouter "github.com/libp2p/go-libp2p-pubsub-router"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	"github.com/libp2p/go-libp2p/core/routing"
+)
+
+// ValueSource is one of the routers a composed router asks for values, named
+// after what it queries.
+type ValueSource struct {
+	Name string
+	routing.ValueStore
+}
+
+// ValueSources returns the routers r is composed of that answer value
+// lookups themselves, in the order they are composed. Routers that never
+// return values, such as those disabled for IPNS, are left out.
+func ValueSources(r routing.ValueStore) []ValueSource {
+	var out []ValueSource
+	seen := make(map[routing.ValueStore]bool)
+	var walk func(r routing.ValueStore)
+	walk = func(r routing.ValueStore) {
+		if r == nil {
+			return
+		}
+		switch r := r.(type) {
+		case routinghelpers.ComposableRouter:
+			for _, c := range r.Routers() {
+				walk(c)
+			}
+			return
+		case routinghelpers.Parallel:
+			for _, c := range r.Routers {
+				walk(c)
+			}
+			return
+		case routinghelpers.Tiered:
+			for _, c := range r.Routers {
+				walk(c)
+			}
+			return
+		case *routinghelpers.Compose:
+			walk(r.ValueStore)
+			return
+		case *routinghelpers.LimitedValueStore:
+			walk(r.ValueStore)
+			return
+		case *Composer:
+			walk(r.GetValueRouter)
+			return
+		case *CachingRouter:
+			walk(r.Routing)
+			return
+		case *InstrumentedRouter:
+			walk(r.Routing)
+			return
+		case *queuedRouter:
+			walk(r.ProvideManyRouter)
+			return
+		case routinghelpers.Null, *routinghelpers.Null:
+			return
+		}
+		if reflect.TypeOf(r).Comparable() {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+		}
+		out = append(out, ValueSource{Name: sourceName(r), ValueStore: r})
+	}
+	walk(r)
+	return out
+}
+
+func sourceName(r routing.ValueStore) string {
+	switch r := r.(type) {
+	case *dual.DHT, *dht.IpfsDHT:
+		return "dht"
+	case *fullrt.FullRT:
+		return "dht (accelerated)"
+	case *psrouter.PubsubValueStore:
+		return "pubsub"
+	case *httpRoutingWrapper:
+		return "http " + r.endpoint
+	}
+	t := reflect.TypeOf(r)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "github.com/ipfs/boxo/routing/offline" {
+		return "local datastore"
+	}
+	return fmt.Sprintf("%T", r)
+}
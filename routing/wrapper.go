@@ -24,6 +24,8 @@ type httpRoutingWrapper struct {
 	routing.PeerRouting
 	routing.ValueStore
 	routinghelpers.ProvideManyRouter
+
+	endpoint string
 }
 
 func (c *httpRoutingWrapper) Bootstrap(ctx context.Context) error {
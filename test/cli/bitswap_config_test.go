@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/test/cli/harness"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBitswapConfig(t *testing.T) {
@@ -184,3 +186,77 @@ func TestBitswapConfig(t *testing.T) {
 		assert.Equal(t, 1, res.ExitCode())
 	})
 }
+
+func TestBitswapServerConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("denylist keeps peers from being served", func(t *testing.T) {
+		t.Parallel()
+		h := harness.NewT(t)
+		requester := h.NewNode().Init().StartDaemon()
+		defer requester.StopDaemon()
+
+		provider := h.NewNode().Init()
+		provider.UpdateConfig(func(cfg *config.Config) {
+			cfg.Bitswap.Server.Denylist = []string{requester.PeerID().String()}
+		})
+		provider.StartDaemon()
+		defer provider.StopDaemon()
+
+		hash := provider.IPFSAddStr(string(random.Bytes(100)))
+		requester.Connect(provider)
+
+		res := requester.RunIPFS("block", "get", "--timeout=3s", hash)
+		assert.Error(t, res.Err)
+
+		ledger := provider.IPFS("bitswap", "ledger", requester.PeerID().String()).Stdout.String()
+		assert.Contains(t, ledger, "Allowed:\tfalse\n")
+		assert.NotContains(t, ledger, "Denied today:\t0\n")
+	})
+
+	t.Run("serves only pinned blocks", func(t *testing.T) {
+		t.Parallel()
+		h := harness.NewT(t)
+		provider := h.NewNode().Init()
+		provider.SetIPFSConfig("Bitswap.Server.ServeOnlyPinned", true)
+		pinnedData := random.Bytes(100)
+		pinned := provider.IPFSAddStr(string(pinnedData))
+		unpinned := provider.IPFSAddStr(string(random.Bytes(100)), "--pin=false")
+		provider.StartDaemon()
+		defer provider.StopDaemon()
+
+		requester := h.NewNode().Init().StartDaemon()
+		defer requester.StopDaemon()
+		requester.Connect(provider)
+
+		res := requester.IPFS("cat", pinned)
+		assert.Equal(t, pinnedData, res.Stdout.Bytes())
+		res = requester.RunIPFS("block", "get", "--timeout=3s", unpinned)
+		assert.Error(t, res.Err)
+
+		// content pinned while the daemon runs is served right away
+		freshData := random.Bytes(100)
+		fresh := provider.IPFSAddStr(string(freshData))
+		res = requester.RunIPFS("cat", "--timeout=10s", fresh)
+		require.NoError(t, res.Err)
+		assert.Equal(t, freshData, res.Stdout.Bytes())
+
+		ledger := provider.IPFS("bitswap", "ledger", requester.PeerID().String()).Stdout.String()
+		assert.Contains(t, ledger, "Allowed:\ttrue\n")
+		// blocks served today match the bytes sent by the server
+		sent := regexp.MustCompile(`Bytes sent:\t([1-9]\d*)\n`).FindStringSubmatch(ledger)
+		require.Len(t, sent, 2)
+		assert.Contains(t, ledger, "Served today:\t"+sent[1]+"\n")
+		assert.NotContains(t, ledger, "Denied today:\t0\n")
+	})
+
+	t.Run("rejects invalid peer IDs", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Bitswap.Server.Allowlist = []string{"not-a-peer-id"}
+		})
+		res := node.RunIPFS("daemon")
+		assert.Equal(t, 1, res.ExitCode())
+	})
+}
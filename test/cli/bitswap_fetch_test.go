@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-test/random"
+	"github.com/ipfs/kubo/core/commands"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitswapFetch(t *testing.T) {
+	t.Parallel()
+
+	// setup returns a provider with a DAG of 5 blocks, and a requester
+	// connected to it.
+	setup := func(t *testing.T, configure func(*harness.Node)) (*harness.Node, *harness.Node, string) {
+		h := harness.NewT(t)
+		provider := h.NewNode().Init().StartDaemon()
+		t.Cleanup(func() { provider.StopDaemon() })
+		requester := h.NewNode().Init()
+		if configure != nil {
+			configure(requester)
+		}
+		requester.StartDaemon("--enable-gc")
+		t.Cleanup(func() { requester.StopDaemon() })
+
+		hash := provider.IPFSAdd(strings.NewReader(string(random.Bytes(1024*1024))), "--chunker=size-262144")
+		requester.Connect(provider)
+		return provider, requester, hash
+	}
+	fetch := func(t *testing.T, node *harness.Node, args ...string) commands.BitswapFetchOutput {
+		res := node.IPFS(append([]string{"bitswap", "fetch", "--enc=json"}, args...)...)
+		var out commands.BitswapFetchOutput
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		return out
+	}
+	hasLocally := func(node *harness.Node, hash string) bool {
+		return node.RunIPFS("cat", "--offline", hash).Err == nil
+	}
+
+	t.Run("fetches DAGs up to a depth", func(t *testing.T) {
+		t.Parallel()
+		_, requester, hash := setup(t, nil)
+
+		out := fetch(t, requester, "--max-depth=0", hash)
+		assert.Equal(t, int64(1), out.Blocks)
+		assert.Equal(t, []string{hash}, out.Roots)
+		assert.False(t, hasLocally(requester, hash))
+
+		out = fetch(t, requester, hash)
+		assert.Equal(t, int64(5), out.Blocks)
+		assert.Zero(t, out.Failed)
+		assert.True(t, hasLocally(requester, hash))
+
+		res := requester.IPFS("refs", "-r", "--prefetch", hash)
+		assert.Len(t, res.Stdout.Lines(), 4)
+	})
+
+	t.Run("pins fetched DAGs", func(t *testing.T) {
+		t.Parallel()
+		_, requester, hash := setup(t, nil)
+
+		res := requester.RunIPFS("bitswap", "fetch", "--pin", "--max-depth=1", hash)
+		assert.Error(t, res.Err)
+
+		fetch(t, requester, "--pin", "--pin-name=prefetched", hash)
+		res = requester.IPFS("pin", "ls", "--names", "--type=recursive", hash)
+		assert.Contains(t, res.Stdout.String(), "prefetched")
+	})
+
+	t.Run("protects fetched DAGs until repo gc", func(t *testing.T) {
+		t.Parallel()
+		provider, requester, protected := setup(t, func(node *harness.Node) {
+			node.SetIPFSConfig("Datastore.StorageMax", "1B")
+			node.SetIPFSConfig("Datastore.GCPeriod", "1s")
+		})
+		unprotected := provider.IPFSAddStr(string(random.Bytes(100)))
+
+		fetch(t, requester, "--protect", protected)
+		fetch(t, requester, unprotected)
+
+		// automatic garbage collection keeps protected blocks only
+		assert.Eventually(t, func() bool { return !hasLocally(requester, unprotected) }, 10*time.Second, 100*time.Millisecond)
+		assert.True(t, hasLocally(requester, protected))
+
+		// an explicit run releases them
+		requester.IPFS("repo", "gc")
+		assert.False(t, hasLocally(requester, protected))
+	})
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/go-test/random"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitswapLedgers(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ledgers persist across restarts until reset", func(t *testing.T) {
+		t.Parallel()
+		h := harness.NewT(t)
+		provider := h.NewNode().Init().StartDaemon()
+		defer provider.StopDaemon()
+		requester := h.NewNode().Init().StartDaemon()
+
+		hash := provider.IPFSAddStr(string(random.Bytes(100)))
+		requester.Connect(provider)
+		requester.IPFS("cat", hash)
+
+		// the requester received the block; the provider sent it
+		ledger := provider.IPFS("bitswap", "ledger", requester.PeerID().String()).Stdout.String()
+		assert.Contains(t, ledger, "Total bytes sent:\t")
+		assert.NotContains(t, ledger, "Total bytes sent:\t0\n")
+
+		requester.StopDaemon()
+		requester.StartDaemon()
+		defer requester.StopDaemon()
+
+		var list struct {
+			Ledgers []struct {
+				Peer           string
+				BytesReceived  uint64
+				BlocksReceived uint64
+			}
+		}
+		res := requester.IPFS("bitswap", "ledger", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		require.Len(t, list.Ledgers, 1)
+		assert.Equal(t, provider.PeerID().String(), list.Ledgers[0].Peer)
+		assert.Equal(t, uint64(1), list.Ledgers[0].BlocksReceived)
+		assert.Positive(t, list.Ledgers[0].BytesReceived)
+
+		ledger = requester.IPFS("bitswap", "ledger", provider.PeerID().String()).Stdout.String()
+		assert.Contains(t, ledger, "Total bytes received:\t")
+		assert.Contains(t, ledger, "Reciprocity:\t")
+
+		res = requester.RunIPFS("bitswap", "ledger", "reset")
+		assert.Error(t, res.Err)
+		requester.IPFS("bitswap", "ledger", "reset", provider.PeerID().String())
+		res = requester.IPFS("bitswap", "ledger", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		assert.Empty(t, list.Ledgers)
+	})
+
+	t.Run("reciprocity strategy serves peers", func(t *testing.T) {
+		t.Parallel()
+		h := harness.NewT(t)
+		requester := h.NewNode().Init().StartDaemon()
+		defer requester.StopDaemon()
+		provider := h.NewNode().Init()
+		provider.UpdateConfig(func(cfg *config.Config) {
+			cfg.Bitswap.Server.Strategy = config.NewOptionalString(config.BitswapStrategyReciprocity)
+		})
+		provider.StartDaemon()
+		defer provider.StopDaemon()
+
+		data := random.Bytes(1024 * 1024)
+		hash := provider.IPFSAddStr(string(data), "--chunker=size-65536")
+		requester.Connect(provider)
+		res := requester.IPFS("cat", hash)
+		assert.Equal(t, data, res.Stdout.Bytes())
+	})
+
+	t.Run("rejects invalid strategies", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.SetIPFSConfig("Bitswap.Server.Strategy", "tit-for-tat")
+		res := node.RunIPFS("daemon")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "invalid Bitswap.Server.Strategy")
+	})
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-test/random"
+	"github.com/ipfs/kubo/core/corehttp"
+	"github.com/ipfs/kubo/core/node"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitswapTrace(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T, configure ...func(*harness.Node)) (*harness.Node, *harness.Node) {
+		h := harness.NewT(t)
+		provider := h.NewNode().Init().StartDaemon()
+		t.Cleanup(func() { provider.StopDaemon() })
+		requester := h.NewNode().Init()
+		for _, c := range configure {
+			c(requester)
+		}
+		requester.StartDaemon()
+		t.Cleanup(func() { requester.StopDaemon() })
+		requester.Connect(provider)
+		return provider, requester
+	}
+	trace := func(t *testing.T, n *harness.Node, id string) node.RetrievalTraceStat {
+		res := n.IPFS("bitswap", "trace", "--enc=json", id)
+		var st node.RetrievalTraceStat
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &st))
+		return st
+	}
+
+	t.Run("cat --trace records the peers that served blocks", func(t *testing.T) {
+		t.Parallel()
+		provider, requester := setup(t)
+		data := random.Bytes(1024 * 1024)
+		hash := provider.IPFSAdd(strings.NewReader(string(data)), "--chunker=size-262144")
+
+		res := requester.IPFS("cat", "--trace=slow-cat", hash)
+		assert.Equal(t, data, res.Stdout.Bytes())
+
+		st := trace(t, requester, "slow-cat")
+		assert.False(t, st.Running)
+		assert.Equal(t, 5, st.Requested)
+		assert.Equal(t, 5, st.Received)
+		assert.Positive(t, st.TimeToFirstBlock)
+		require.NotEmpty(t, st.Peers)
+		assert.Equal(t, provider.PeerID(), st.Peers[0].Peer)
+		assert.Equal(t, 5, st.Peers[0].Delivered)
+
+		out := requester.IPFS("bitswap", "trace", "--blocks", "slow-cat").Stdout.String()
+		assert.Contains(t, out, "Blocks received: 5 (")
+		assert.Contains(t, out, provider.PeerID().String())
+		assert.Contains(t, out, hash)
+
+		// blocks found locally are not traced
+		requester.IPFS("cat", "--trace=local-cat", hash)
+		assert.Zero(t, trace(t, requester, "local-cat").Requested)
+
+		res = requester.RunIPFS("bitswap", "trace", "unknown")
+		assert.Error(t, res.Err)
+	})
+
+	t.Run("gateway requests with the trace header", func(t *testing.T) {
+		t.Parallel()
+		provider, requester := setup(t, func(n *harness.Node) {
+			n.SetIPFSConfig("Gateway.RetrievalTrace", true)
+		})
+		hash := provider.IPFSAddStr(string(random.Bytes(100)))
+
+		client := requester.GatewayClient()
+		resp := client.Get("/ipfs/"+hash, client.WithHeader(corehttp.RetrievalTraceHeader, "slow-gw"))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		summary := resp.Headers.Get(corehttp.RetrievalTraceHeader)
+		assert.Contains(t, summary, "id=slow-gw; requested=1; received=1;")
+		assert.Contains(t, summary, "peers="+provider.PeerID().String())
+
+		st := trace(t, requester, "slow-gw")
+		assert.Equal(t, 1, st.Received)
+
+		// untraced requests don't get the header
+		resp = client.Get("/ipfs/" + hash)
+		assert.Empty(t, resp.Headers.Get(corehttp.RetrievalTraceHeader))
+	})
+
+	t.Run("gateway ignores the trace header unless enabled", func(t *testing.T) {
+		t.Parallel()
+		provider, requester := setup(t)
+		hash := provider.IPFSAddStr(string(random.Bytes(100)))
+
+		client := requester.GatewayClient()
+		resp := client.Get("/ipfs/"+hash, client.WithHeader(corehttp.RetrievalTraceHeader, "slow-gw"))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Headers.Get(corehttp.RetrievalTraceHeader))
+		res := requester.RunIPFS("bitswap", "trace", "slow-gw")
+		assert.Error(t, res.Err)
+	})
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesBatch(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init().StartDaemon()
+	defer node.StopDaemon()
+
+	cid := node.IPFSAddStr("hello", "--pin=false")
+	node.IPFS("files", "mkdir", "/old")
+	before := node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed()
+
+	// a failing op leaves MFS as it was
+	res := node.RunPipeToIPFS(strings.NewReader(`{"op": "mkdir", "path": "/site"}
+{"op": "rm", "path": "/nope"}
+`), "files", "batch")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "op 2 (rm)")
+	assert.Equal(t, before, node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed())
+
+	ops := `{"op": "mkdir", "path": "/site/css", "parents": true}
+{"op": "cp", "src": "/ipfs/` + cid + `", "dst": "/site/index.html"}
+{"op": "write", "path": "/site/VERSION", "data": "1.0"}
+{"op": "rm", "path": "/old", "recursive": true}
+`
+	dry := node.PipeStrToIPFS(ops, "files", "batch", "--dry-run").Stdout.Trimmed()
+	assert.Equal(t, before, node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed())
+
+	root := node.PipeStrToIPFS(ops, "files", "batch").Stdout.Trimmed()
+	assert.Equal(t, dry, root)
+	assert.Equal(t, root, node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed())
+	assert.Equal(t, []string{"site"}, node.IPFS("files", "ls", "/").Stdout.Lines())
+	assert.Equal(t, "hello", node.IPFS("files", "read", "/site/index.html").Stdout.String())
+	assert.Equal(t, "1.0", node.IPFS("files", "read", "/site/VERSION").Stdout.String())
+}
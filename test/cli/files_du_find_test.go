@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesDu(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init().StartDaemon()
+	defer node.StopDaemon()
+
+	node.IPFS("files", "mkdir", "-p", "/a/b/c")
+	node.PipeStrToIPFS(strings.Repeat("x", 5000), "files", "write", "--create", "/a/b/c/big")
+	node.PipeStrToIPFS("small", "files", "write", "--create", "/a/small")
+
+	du := func(args ...string) map[string]uint64 {
+		res := node.IPFS(append([]string{"files", "du"}, args...)...)
+		sizes := map[string]uint64{}
+		for _, line := range res.Stdout.Lines() {
+			size, p, ok := strings.Cut(line, "\t")
+			require.True(t, ok, line)
+			n, err := strconv.ParseUint(size, 10, 64)
+			require.NoError(t, err)
+			sizes[p] = n
+		}
+		return sizes
+	}
+
+	sizes := du()
+	assert.Len(t, sizes, 4)
+	assert.Greater(t, sizes["/a/b/c"], uint64(5000))
+	assert.Greater(t, sizes["/a"], sizes["/a/b"])
+	assert.Greater(t, sizes["/a/b"], sizes["/a/b/c"])
+	assert.Equal(t, node.IPFS("files", "stat", "--size", "/").Stdout.Trimmed(), strconv.FormatUint(sizes["/"], 10))
+
+	shallow := du("-d", "1", "/")
+	assert.Equal(t, map[string]uint64{"/": sizes["/"], "/a": sizes["/a"]}, shallow)
+
+	// everything is local, so --offline reports the same totals
+	assert.Equal(t, sizes, du("--offline"))
+
+	lines := node.IPFS("files", "du", "/a/b").Stdout.Lines()
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], "\t/a/b/c"))
+	assert.True(t, strings.HasSuffix(lines[1], "\t/a/b"))
+
+	// with --offline, blocks missing locally are not counted nor fetched
+	big := node.IPFS("files", "stat", "--hash", "/a/b/c/big").Stdout.Trimmed()
+	node.IPFS("block", "rm", big)
+	offline := du("--offline", "/a/b")
+	assert.Less(t, offline["/a/b/c"]+5000, sizes["/a/b/c"])
+	assert.Less(t, offline["/a/b"]+5000, sizes["/a/b"])
+}
+
+func TestFilesFind(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init().StartDaemon()
+	defer node.StopDaemon()
+
+	node.IPFS("files", "mkdir", "-p", "/media/videos")
+	node.IPFS("files", "mkdir", "-p", "/docs/notes.d")
+	node.PipeStrToIPFS(strings.Repeat("v", 2048), "files", "write", "--create", "/media/videos/talk.mp4")
+	node.PipeStrToIPFS("v", "files", "write", "--create", "/media/videos/clip.mp4")
+	node.PipeStrToIPFS("n", "files", "write", "--create", "/docs/notes.txt")
+
+	find := func(args ...string) []string {
+		return node.IPFS(append([]string{"files", "find"}, args...)...).Stdout.Lines()
+	}
+
+	assert.ElementsMatch(t, []string{"/media/videos/talk.mp4", "/media/videos/clip.mp4"}, find("/", "--name", "*.mp4"))
+	assert.Equal(t, []string{"/media/videos/talk.mp4"}, find("/", "--name", "*.mp4", "--min-size", "1024"))
+	assert.ElementsMatch(t, []string{"/docs/notes.d", "/docs/notes.txt"}, find("/docs", "--name", "notes.*"))
+	assert.Equal(t, []string{"/docs/notes.d"}, find("/docs", "--name", "notes.*", "--type", "d"))
+	assert.ElementsMatch(t, []string{"/", "/media", "/media/videos", "/docs", "/docs/notes.d"}, find("/", "--type", "d"))
+
+	res := node.IPFS("files", "find", "/media", "--type", "f", "--min-size", "1024", "--enc=json")
+	var out struct {
+		Path string
+		Type string
+		Size uint64
+		Hash string
+	}
+	require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+	assert.Equal(t, "/media/videos/talk.mp4", out.Path)
+	assert.Equal(t, "file", out.Type)
+	assert.Equal(t, uint64(2048), out.Size)
+	assert.Equal(t, node.IPFS("files", "stat", "--hash", "/media/videos/talk.mp4").Stdout.Trimmed(), out.Hash)
+
+	res = node.RunIPFS("files", "find", "/", "--type", "x")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "must be 'f' or 'd'")
+}
+
+func TestFilesFindSharded(t *testing.T) {
+	t.Parallel()
+
+	// a tiny threshold forces HAMT sharding of /big
+	node := harness.NewT(t).NewNode().Init()
+	node.IPFS("config", "--json", "Import.UnixFSHAMTDirectorySizeThreshold", `"1B"`)
+	node.StartDaemon()
+	defer node.StopDaemon()
+
+	cid := node.IPFSAddDeterministic("64KiB", "seed")
+	node.IPFS("files", "mkdir", "/big")
+	for i := range 20 {
+		node.IPFS("files", "cp", "/ipfs/"+cid, "/big/file-"+strconv.Itoa(i))
+	}
+
+	found := node.IPFS("files", "find", "/big", "--type", "f").Stdout.Lines()
+	assert.Len(t, found, 20)
+
+	lines := node.IPFS("files", "du", "/big").Stdout.Lines()
+	require.Len(t, lines, 1)
+	assert.Equal(t, node.IPFS("files", "stat", "--size", "/big").Stdout.Trimmed()+"\t/big", lines[0])
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crash kills the daemon without letting it flush MFS.
+func crash(t *testing.T, node *harness.Node) {
+	t.Helper()
+	require.NoError(t, node.Daemon.Cmd.Process.Kill())
+	_, _ = node.Daemon.Cmd.Process.Wait()
+	node.Daemon = nil
+}
+
+func TestFilesJournal(t *testing.T) {
+	t.Parallel()
+
+	newNode := func(t *testing.T) *harness.Node {
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.MFS.Journal = config.True
+		})
+		return node.StartDaemon()
+	}
+
+	t.Run("unflushed writes survive a crash", func(t *testing.T) {
+		t.Parallel()
+		node := newNode(t)
+
+		node.IPFS("files", "mkdir", "--flush=false", "/docs")
+		node.PipeStrToIPFS("draft", "files", "write", "--create", "--flush=false", "/docs/a.txt")
+		node.IPFS("files", "cp", "--flush=false", "/docs/a.txt", "/docs/b.txt")
+		node.IPFS("files", "mv", "--flush=false", "/docs/b.txt", "/c.txt")
+		want := node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed()
+		assert.Empty(t, node.IPFS("files", "stat", "/").Stderr.String())
+		crash(t, node)
+
+		node.StartDaemon()
+		defer node.StopDaemon()
+		assert.Equal(t, want, node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed())
+		assert.Equal(t, "draft", node.IPFS("files", "read", "/docs/a.txt").Stdout.String())
+		assert.Equal(t, "draft", node.IPFS("files", "read", "/c.txt").Stdout.String())
+
+		stat := node.IPFS("files", "stat", "/").Stdout.String()
+		assert.Contains(t, stat, "Recovered: 5 unflushed changes")
+		var out struct{ Recovered struct{ Entries int } }
+		require.NoError(t, json.Unmarshal(node.IPFS("files", "stat", "--enc=json", "/").Stdout.Bytes(), &out))
+		assert.Equal(t, 5, out.Recovered.Entries)
+		assert.NotContains(t, node.IPFS("files", "stat", "/docs").Stdout.String(), "Recovered")
+	})
+
+	t.Run("flushed changes are not replayed", func(t *testing.T) {
+		t.Parallel()
+		node := newNode(t)
+
+		node.PipeStrToIPFS("draft", "files", "write", "--create", "--flush=false", "/a.txt")
+		node.IPFS("files", "flush", "/")
+		node.IPFS("files", "rm", "/a.txt")
+		node.IPFS("files", "flush", "/")
+		crash(t, node)
+
+		node.StartDaemon()
+		defer node.StopDaemon()
+		assert.Empty(t, node.IPFS("files", "ls", "/").Stdout.Trimmed())
+		assert.NotContains(t, node.IPFS("files", "stat", "/").Stdout.String(), "Recovered")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+
+		node.PipeStrToIPFS("draft", "files", "write", "--create", "--flush=false", "/a.txt")
+		crash(t, node)
+
+		node.StartDaemon()
+		defer node.StopDaemon()
+		assert.Empty(t, node.IPFS("files", "ls", "/").Stdout.Trimmed())
+	})
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("create, restore and remove a named snapshot", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		cid := node.IPFSAddStr("release notes", "--pin=false")
+		node.IPFS("files", "mkdir", "/docs")
+		node.IPFS("files", "cp", "/ipfs/"+cid, "/docs/notes.txt")
+		rootBefore := node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed()
+
+		res := node.IPFS("files", "snapshot", "create", "good", "-m", "known good")
+		assert.Contains(t, res.Stdout.String(), rootBefore)
+
+		// duplicate names are refused
+		res = node.RunIPFS("files", "snapshot", "create", "good")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "snapshot already exists")
+
+		node.IPFS("files", "rm", "-r", "/docs")
+
+		// snapshot content survives GC although nothing else references it
+		node.IPFS("repo", "gc")
+		node.IPFS("files", "snapshot", "restore", "good")
+		assert.Equal(t, rootBefore, node.IPFS("files", "stat", "--hash", "/").Stdout.Trimmed())
+		assert.Equal(t, "release notes", node.IPFS("files", "read", "/docs/notes.txt").Stdout.String())
+
+		var list struct {
+			Snapshots []struct {
+				Name    string
+				Cid     string
+				Message string
+			}
+		}
+		res = node.IPFS("files", "snapshot", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		require.Len(t, list.Snapshots, 1)
+		assert.Equal(t, "good", list.Snapshots[0].Name)
+		assert.Equal(t, rootBefore, list.Snapshots[0].Cid)
+		assert.Equal(t, "known good", list.Snapshots[0].Message)
+
+		node.IPFS("files", "snapshot", "rm", "good")
+		assert.Empty(t, node.IPFS("files", "snapshot", "ls").Stdout.Trimmed())
+
+		res = node.RunIPFS("files", "snapshot", "restore", "good")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "snapshot not found")
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+
+		res := node.RunIPFS("files", "snapshot", "create", "a/b")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "snapshot name must be")
+	})
+
+	t.Run("MFS.AutoSnapshot records state before files rm -r", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.MFS.AutoSnapshot = config.True
+			cfg.MFS.AutoSnapshotKeep = config.NewOptionalInteger(2)
+		})
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		for _, dir := range []string{"/a", "/b", "/c"} {
+			node.IPFS("files", "mkdir", dir)
+		}
+		node.IPFS("files", "rm", "-r", "/a")
+		node.IPFS("files", "rm", "-r", "/b")
+		node.IPFS("files", "rm", "-r", "/c")
+
+		var list struct {
+			Snapshots []struct {
+				Name    string
+				Message string
+				Auto    bool
+			}
+		}
+		res := node.IPFS("files", "snapshot", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		require.Len(t, list.Snapshots, 2, "only AutoSnapshotKeep automatic snapshots are kept")
+		for _, s := range list.Snapshots {
+			assert.True(t, s.Auto)
+		}
+		last := list.Snapshots[1]
+		assert.Contains(t, last.Message, "files rm -r /c")
+
+		node.IPFS("files", "snapshot", "restore", last.Name)
+		assert.Equal(t, "c", node.IPFS("files", "ls", "/").Stdout.Trimmed())
+	})
+
+	t.Run("MFS.AutoSnapshot records state before files rm --force of a directory", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.MFS.AutoSnapshot = config.True
+		})
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		node.IPFS("files", "mkdir", "/d")
+		node.PipeStrToIPFS("hello", "files", "write", "--create", "/f")
+		node.IPFS("files", "rm", "--force", "/f")
+		res := node.IPFS("files", "snapshot", "ls")
+		assert.Empty(t, res.Stdout.Trimmed(), "removing a file takes no snapshot")
+
+		node.IPFS("files", "rm", "--force", "/d")
+		var list struct {
+			Snapshots []struct {
+				Name    string
+				Message string
+			}
+		}
+		res = node.IPFS("files", "snapshot", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		require.Len(t, list.Snapshots, 1)
+		assert.Contains(t, list.Snapshots[0].Message, "files rm --force /d")
+	})
+
+	t.Run("MFS.AutoSnapshot records state before files chroot", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.MFS.AutoSnapshot = config.True
+		})
+		node.StartDaemon()
+		node.IPFS("files", "mkdir", "/keep")
+		node.StopDaemon()
+
+		res := node.IPFS("files", "chroot", "--confirm")
+		assert.Contains(t, res.Stdout.String(), "saved as snapshot auto-")
+
+		node.StartDaemon()
+		defer node.StopDaemon()
+		assert.Empty(t, node.IPFS("files", "ls", "/").Stdout.Trimmed())
+
+		var list struct {
+			Snapshots []struct{ Name string }
+		}
+		res = node.IPFS("files", "snapshot", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		require.Len(t, list.Snapshots, 1)
+		node.IPFS("files", "snapshot", "restore", list.Snapshots[0].Name)
+		assert.Equal(t, "keep", node.IPFS("files", "ls", "/").Stdout.Trimmed())
+	})
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSyncTree(t *testing.T, root string, tree map[string]string) {
+	t.Helper()
+	for name, content := range tree {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func TestFilesSync(t *testing.T) {
+	t.Parallel()
+
+	t.Run("local to MFS", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		src := t.TempDir()
+		writeSyncTree(t, src, map[string]string{
+			"index.html":   "hello",
+			"css/main.css": "body {}",
+			".hidden":      "secret",
+			"build.log":    "noise",
+		})
+
+		res := node.IPFS("files", "sync", "--ignore=*.log", src, "/www/site")
+		assert.ElementsMatch(t, []string{"add index.html", "add css/", "add css/main.css"}, res.Stdout.Lines())
+		assert.Equal(t, "hello", node.IPFS("files", "read", "/www/site/index.html").Stdout.String())
+		assert.Equal(t, "body {}", node.IPFS("files", "read", "/www/site/css/main.css").Stdout.String())
+		assert.ElementsMatch(t, []string{"css", "index.html"}, node.IPFS("files", "ls", "/www/site").Stdout.Lines())
+
+		// nothing changed, nothing to do
+		assert.Empty(t, node.IPFS("files", "sync", "--ignore=*.log", src, "/www/site").Stdout.Trimmed())
+
+		writeSyncTree(t, src, map[string]string{"index.html": "hello again"})
+		require.NoError(t, os.RemoveAll(filepath.Join(src, "css")))
+		node.PipeStrToIPFS("log", "files", "write", "--create", "/www/site/keep.log")
+
+		res = node.IPFS("files", "sync", "--delete", "--dry-run", "--ignore=*.log", src, "/www/site")
+		assert.ElementsMatch(t, []string{"update index.html", "delete css/"}, res.Stdout.Lines())
+		assert.Equal(t, "hello", node.IPFS("files", "read", "/www/site/index.html").Stdout.String())
+
+		node.IPFS("files", "sync", "--delete", "--ignore=*.log", src, "/www/site")
+		assert.Equal(t, "hello again", node.IPFS("files", "read", "/www/site/index.html").Stdout.String())
+		// ignored entries are not deleted from the destination
+		assert.ElementsMatch(t, []string{"index.html", "keep.log"}, node.IPFS("files", "ls", "/www/site").Stdout.Lines())
+	})
+
+	t.Run("ignore rules file applies to both sides", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		src := t.TempDir()
+		writeSyncTree(t, src, map[string]string{"a.txt": "a", "b.tmp": "b"})
+		rules := filepath.Join(t.TempDir(), "ignore")
+		require.NoError(t, os.WriteFile(rules, []byte("# temp files\n*.tmp\n"), 0o644))
+
+		node.IPFS("files", "mkdir", "/dst")
+		node.PipeStrToIPFS("tmp", "files", "write", "--create", "/dst/old.tmp")
+		res := node.IPFS("files", "sync", "--delete", "--ignore-rules-path", rules, src, "/dst")
+		assert.Equal(t, []string{"add a.txt"}, res.Stdout.Lines())
+		assert.ElementsMatch(t, []string{"a.txt", "old.tmp"}, node.IPFS("files", "ls", "/dst").Stdout.Lines())
+	})
+
+	t.Run("ignore rules match paths", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		src := t.TempDir()
+		writeSyncTree(t, src, map[string]string{
+			"docs/a.md":       "a",
+			"docs/draft/b.md": "b",
+			"draft/c.md":      "c",
+		})
+
+		node.IPFS("files", "mkdir", "-p", "/dst/docs/draft")
+		node.PipeStrToIPFS("old", "files", "write", "--create", "/dst/docs/draft/old.md")
+		res := node.IPFS("files", "sync", "--delete", "--ignore=docs/draft/", src, "/dst")
+		assert.ElementsMatch(t, []string{"add docs/a.md", "add draft/", "add draft/c.md"}, res.Stdout.Lines())
+		assert.Equal(t, []string{"old.md"}, node.IPFS("files", "ls", "/dst/docs/draft").Stdout.Lines())
+	})
+
+	t.Run("MFS to local with --reverse", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		node.IPFS("files", "mkdir", "-p", "/data/sub")
+		node.IPFS("files", "cp", "/ipfs/"+node.IPFSAddStr("one", "--pin=false"), "/data/one.txt")
+		node.IPFS("files", "cp", "/ipfs/"+node.IPFSAddStr("two", "--pin=false"), "/data/sub/two.txt")
+
+		dst := t.TempDir()
+		writeSyncTree(t, dst, map[string]string{
+			"one.txt":   "one",
+			"stale.txt": "stale",
+			".git/HEAD": "ref",
+		})
+
+		res := node.IPFS("files", "sync", "--reverse", "--delete", "--dry-run", dst, "/data")
+		assert.ElementsMatch(t, []string{"add sub/", "add sub/two.txt", "delete stale.txt"}, res.Stdout.Lines())
+		assert.NoDirExists(t, filepath.Join(dst, "sub"))
+
+		res = node.IPFS("files", "sync", "--reverse", "--delete", dst, "/data")
+		assert.ElementsMatch(t, []string{"add sub/", "add sub/two.txt", "delete stale.txt"}, res.Stdout.Lines())
+
+		two, err := os.ReadFile(filepath.Join(dst, "sub", "two.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "two", string(two))
+		assert.NoFileExists(t, filepath.Join(dst, "stale.txt"))
+		assert.FileExists(t, filepath.Join(dst, ".git", "HEAD"), "hidden entries are left alone")
+
+		node.PipeStrToIPFS("uno", "files", "write", "--truncate", "/data/one.txt")
+		res = node.IPFS("files", "sync", "--reverse", dst, "/data")
+		assert.Equal(t, []string{"update one.txt"}, res.Stdout.Lines())
+	})
+
+	t.Run("rejects a file as source", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+
+		f := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(f, []byte("x"), 0o644))
+		res := node.RunIPFS("files", "sync", f, "/dst")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "is not a directory")
+	})
+}
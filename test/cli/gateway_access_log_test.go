@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayAccessLog(t *testing.T) {
+	t.Parallel()
+
+	h := harness.NewT(t)
+	provider := h.NewNode().Init().StartDaemon()
+	defer provider.StopDaemon()
+	n := h.NewNode().Init()
+	n.UpdateConfig(func(cfg *config.Config) {
+		cfg.Gateway.AccessLog.Path = config.NewOptionalString("gateway-access.log")
+	})
+	n.StartDaemon()
+	defer n.StopDaemon()
+	n.Connect(provider)
+
+	local := n.IPFSAddStr("local content")
+	remote := provider.IPFSAddStr("remote content")
+
+	client := n.GatewayClient()
+	assert.Equal(t, http.StatusOK, client.Get("/ipfs/"+local).StatusCode)
+	assert.Equal(t, http.StatusOK, client.Get("/ipfs/"+remote+"?format=raw").StatusCode)
+
+	b, err := os.ReadFile(filepath.Join(n.Dir, "gateway-access.log"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+
+	var entries [2]struct {
+		Client, Path, Cid, Cache, Format string
+		Status                           int
+		Bytes                            uint64
+	}
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+	}
+	assert.Equal(t, "127.0.0.1", entries[0].Client)
+	assert.Equal(t, "/ipfs/"+local, entries[0].Path)
+	assert.Equal(t, local, entries[0].Cid)
+	assert.Equal(t, http.StatusOK, entries[0].Status)
+	assert.Equal(t, uint64(len("local content")), entries[0].Bytes)
+	assert.Equal(t, "hit", entries[0].Cache)
+
+	assert.Equal(t, remote, entries[1].Cid)
+	assert.Equal(t, "miss", entries[1].Cache)
+	assert.Equal(t, "application/vnd.ipld.raw", entries[1].Format)
+}
@@ -172,4 +172,90 @@ func TestGatewayLimits(t *testing.T) {
 		resp = client.Get("/ipfs/" + normalCID + "?after-limit-cleared=true")
 		assert.Equal(t, http.StatusOK, resp.StatusCode, "Request must succeed after slot is freed")
 	})
+
+	t.Run("ClientLimits", func(t *testing.T) {
+		t.Parallel()
+
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Gateway.ClientLimits.RequestsPerSecond = config.NewOptionalInteger(1)
+		})
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		cid := node.IPFSAddStr("test content for client limits")
+		client := node.GatewayClient()
+
+		// the first request uses the burst, the next one is over the limit
+		resp := client.Get("/ipfs/" + cid)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = client.Get("/ipfs/" + cid)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "1", resp.Headers.Get("Retry-After"))
+		assert.Equal(t, "no-store", resp.Headers.Get("Cache-Control"))
+		assert.Contains(t, resp.Body, "client over RequestsPerSecond limit")
+
+		metrics := node.APIClient().Get("/debug/metrics/prometheus").Body
+		assert.Contains(t, metrics, `ipfs_http_gw_limited_requests_total{limit="RequestsPerSecond",scope="client"} 1`)
+
+		time.Sleep(time.Second)
+		resp = client.Get("/ipfs/" + cid)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("ClientLimits behind a trusted proxy", func(t *testing.T) {
+		t.Parallel()
+
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Gateway.ClientLimits.RequestsPerSecond = config.NewOptionalInteger(1)
+			cfg.Gateway.TrustedProxies = []string{"127.0.0.1"}
+		})
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		cid := node.IPFSAddStr("test content for trusted proxies")
+		client := node.GatewayClient()
+		forwardedFor := func(ip string) func(*http.Request) {
+			return func(r *http.Request) { r.Header.Set("X-Forwarded-For", ip) }
+		}
+
+		// clients forwarded by the proxy have their own quota
+		resp := client.Get("/ipfs/"+cid, forwardedFor("192.0.2.1"))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = client.Get("/ipfs/"+cid, forwardedFor("192.0.2.2"))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = client.Get("/ipfs/"+cid, forwardedFor("192.0.2.1"))
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	})
+
+	t.Run("PublicGateways Limits", func(t *testing.T) {
+		t.Parallel()
+
+		node := harness.NewT(t).NewNode().Init()
+		node.UpdateConfig(func(cfg *config.Config) {
+			cfg.Gateway.PublicGateways = map[string]*config.GatewaySpec{
+				"example.com": {
+					Paths:  []string{"/ipfs"},
+					Limits: config.GatewayLimits{MaxDailyBytes: config.NewOptionalBytes("10B")},
+				},
+			}
+		})
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		cid := node.IPFSAddStr("test content for hostname limits")
+		client := node.GatewayClient()
+
+		resp := client.Get("/ipfs/"+cid, func(r *http.Request) { r.Host = "example.com" })
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = client.Get("/ipfs/"+cid, func(r *http.Request) { r.Host = "example.com" })
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Headers.Get("Retry-After"))
+		assert.Contains(t, resp.Body, "example.com over MaxDailyBytes limit")
+
+		// other hostnames are not limited
+		resp = client.Get("/ipfs/" + cid)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
 }
@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -85,3 +90,126 @@ func TestGetPunctuationPaths(t *testing.T) {
 		retrieveEach(t, node)
 	})
 }
+
+func TestGetUnixFSMetadata(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	// addTree imports a directory holding an executable script with mode and
+	// mtime preserved, and returns its CID.
+	addTree := func(t *testing.T, node *harness.Node) string {
+		srcDir := filepath.Join(t.TempDir(), "release")
+		require.NoError(t, os.Mkdir(srcDir, 0o750))
+		script := filepath.Join(srcDir, "run.sh")
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755))
+		require.NoError(t, os.Chmod(script, 0o755))
+		require.NoError(t, os.Chtimes(script, mtime, mtime))
+		require.NoError(t, os.Chtimes(srcDir, mtime, mtime))
+		return node.IPFS("add", "-r", "-Q", "--preserve-mode", "--preserve-mtime", srcDir).Stdout.Trimmed()
+	}
+
+	t.Run("restores mode and mtime on extracted files", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		cid := addTree(t, node)
+
+		out := filepath.Join(t.TempDir(), "out")
+		node.IPFS("get", "-o", out, cid)
+
+		fi, err := os.Stat(filepath.Join(out, "run.sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+		assert.True(t, mtime.Equal(fi.ModTime()), "file mtime should be restored, got %s", fi.ModTime())
+
+		di, err := os.Stat(out)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o750), di.Mode().Perm())
+		assert.True(t, mtime.Equal(di.ModTime()), "directory mtime should be restored, got %s", di.ModTime())
+	})
+
+	t.Run("writes mode and mtime to TAR headers", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		cid := addTree(t, node)
+
+		out := filepath.Join(t.TempDir(), "out.tar")
+		node.IPFS("get", "-a", "-o", out, cid)
+
+		f, err := os.Open(out)
+		require.NoError(t, err)
+		defer f.Close()
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			if hdr.Typeflag == tar.TypeReg {
+				assert.Equal(t, int64(0o755), hdr.Mode)
+			} else {
+				assert.Equal(t, int64(0o750), hdr.Mode)
+			}
+			assert.True(t, mtime.Equal(hdr.ModTime), "%s: unexpected mtime %s", hdr.Name, hdr.ModTime)
+		}
+	})
+
+	t.Run("preserve-metadata=false ignores stored metadata", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		cid := addTree(t, node)
+
+		out := filepath.Join(t.TempDir(), "out")
+		node.IPFS("get", "--preserve-metadata=false", "-o", out, cid)
+
+		fi, err := os.Stat(filepath.Join(out, "run.sh"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+		assert.False(t, mtime.Equal(fi.ModTime()), "file mtime should not be restored")
+	})
+}
+
+func TestGetZipFormat(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init()
+
+	srcDir := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "index.html"), []byte("hello"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "run.sh"), []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, os.Chmod(filepath.Join(srcDir, "sub", "run.sh"), 0o755))
+	cid := node.IPFS("add", "-r", "-Q", "--preserve-mode", srcDir).Stdout.Trimmed()
+
+	out := filepath.Join(t.TempDir(), "site")
+	res := node.IPFS("get", "--format=zip", "-o", out, cid)
+	assert.Contains(t, res.Stdout.String(), "Saving archive to "+out+".zip")
+
+	zr, err := zip.OpenReader(out + ".zip")
+	require.NoError(t, err)
+	defer zr.Close()
+
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	require.Contains(t, entries, cid+"/")
+	require.Contains(t, entries, cid+"/index.html")
+	require.Contains(t, entries, cid+"/sub/run.sh")
+	assert.True(t, entries[cid+"/"].Mode().IsDir())
+	assert.Equal(t, os.FileMode(0o755), entries[cid+"/sub/run.sh"].Mode().Perm())
+
+	rc, err := entries[cid+"/index.html"].Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	t.Run("rejects unknown format", func(t *testing.T) {
+		res := node.RunIPFS("get", "--format=rar", cid)
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "archive format must be 'tar' or 'zip'")
+	})
+}
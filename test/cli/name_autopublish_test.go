@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameAutopublish(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init()
+	node.IPFS("key", "gen", "site")
+	node.UpdateConfig(func(cfg *config.Config) {
+		cfg.MFS.AutoPublish = []config.MFSAutoPublishRule{{
+			Path:     "/www/site",
+			Key:      "site",
+			Debounce: config.NewOptionalDuration(time.Second),
+		}}
+	})
+	node.StartDaemon("--offline")
+	defer node.StopDaemon()
+
+	list := func() name.AutopublishEntry {
+		var out name.AutopublishList
+		res := node.IPFS("name", "autopublish", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		require.Len(t, out.Rules, 1)
+		return out.Rules[0]
+	}
+
+	entry := list()
+	assert.Equal(t, "/www/site", entry.Path)
+	assert.NotEmpty(t, entry.Name)
+	assert.Empty(t, entry.Cid)
+
+	node.IPFS("files", "mkdir", "-p", "/www/site")
+	node.PipeStrToIPFS("hello", "files", "write", "--create", "/www/site/index.html")
+	node.IPFS("files", "flush", "/")
+	want := node.IPFS("files", "stat", "--hash", "/www/site").Stdout.Trimmed()
+
+	assert.Eventually(t, func() bool {
+		return list().Cid == want
+	}, 20*time.Second, 200*time.Millisecond)
+
+	entry = list()
+	assert.Empty(t, entry.Pending)
+	assert.Empty(t, entry.Error)
+	assert.False(t, entry.Published.IsZero())
+	res := node.IPFS("name", "resolve", "/ipns/"+entry.Name)
+	assert.Equal(t, "/ipfs/"+want, res.Stdout.Trimmed())
+}
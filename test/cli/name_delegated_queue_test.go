@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamePublishDelegatedQueue(t *testing.T) {
+	t.Parallel()
+
+	var puts atomic.Int32
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts.Add(1)
+		}
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(publisher.Close)
+
+	node := harness.NewT(t).NewNode().Init("--profile=test")
+	node.UpdateConfig(func(cfg *config.Config) {
+		cfg.AutoConf.Enabled = config.False
+		cfg.Bootstrap = []string{}
+		cfg.Routing.Type = config.NewOptionalString("delegated")
+		cfg.Routing.DelegatedRouters = []string{}
+		cfg.Ipns.DelegatedPublishers = []string{publisher.URL + "/routing/v1/ipns"}
+		cfg.Provide.Enabled = config.False
+	})
+	node.StartDaemon()
+	defer node.StopDaemon()
+
+	res := node.IPFS("name", "pending")
+	assert.Equal(t, "No pending deliveries to delegated publishers", res.Stdout.Trimmed())
+
+	cid := node.IPFSAddStr("queued")
+	res = node.IPFS("name", "publish", "--allow-delegated", "/ipfs/"+cid)
+	assert.Contains(t, res.Stdout.String(), "Published to ")
+	assert.Contains(t, res.Stdout.String(), "Delivery to "+publisher.URL+" failed, retrying at ")
+	assert.Positive(t, puts.Load())
+
+	var list name.PendingList
+	res = node.IPFS("name", "pending", "--enc=json")
+	require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+	require.Len(t, list.Pending, 1)
+	pending := list.Pending[0]
+	assert.Equal(t, publisher.URL, pending.Endpoint)
+	assert.Equal(t, "/ipfs/"+cid, pending.Value)
+	assert.Equal(t, 1, pending.Attempts)
+	assert.NotEmpty(t, pending.LastError)
+
+	// the queue survives a restart
+	node.StopDaemon()
+	node.StartDaemon()
+	res = node.IPFS("name", "publish", "--status")
+	assert.Contains(t, res.Stdout.String(), publisher.URL)
+	assert.Contains(t, res.Stdout.String(), pending.Name)
+	assert.Equal(t, res.Stdout.String(), node.IPFS("name", "pending").Stdout.String())
+
+	var entry name.IpnsEntry
+	res = node.IPFS("name", "publish", "--status", "--enc=json")
+	require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &entry))
+	assert.Equal(t, list.Pending, entry.Pending)
+
+	// --retry delivers right away
+	putsBefore := puts.Load()
+	list = name.PendingList{}
+	res = node.IPFS("name", "pending", "--retry", "--enc=json")
+	require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+	require.Len(t, list.Pending, 1)
+	assert.Greater(t, list.Pending[0].Attempts, pending.Attempts)
+	assert.Greater(t, puts.Load(), putsBefore)
+
+	// the path argument of publish is required without --status
+	res = node.RunIPFS("name", "publish")
+	assert.Error(t, res.Err)
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTXTServer serves the TXT records of txt over DNS over HTTPS (POST).
+func newTXTServer(t *testing.T, mu *sync.Mutex, txt map[string][]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req dns.Msg
+		if err := req.Unpack(data); err != nil || len(req.Question) == 0 {
+			http.Error(w, "invalid DNS message", http.StatusBadRequest)
+			return
+		}
+		var msg dns.Msg
+		msg.SetReply(&req)
+		qname := req.Question[0].Name
+		mu.Lock()
+		for _, v := range txt[strings.TrimSuffix(qname, ".")] {
+			msg.Answer = append(msg.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+				Txt: []string{v},
+			})
+		}
+		mu.Unlock()
+		if len(msg.Answer) == 0 {
+			msg.Rcode = dns.RcodeNameError
+		}
+		out, err := msg.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNameDNSLinkCheck(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	node := harness.NewT(t).NewNode().Init()
+	cid := node.IPFSAddStr("dnslink target")
+	srv := newTXTServer(t, &mu, map[string][]string{
+		"_dnslink.ok.example":     {"dnslink=/ipfs/" + cid},
+		"_dnslink.broken.example": {"dnslink=/ipfs/" + cid, "dnslink=/ipfs/notacid"},
+		"_dnslink.twice.example":  {"dnslink=/ipfs/" + cid, "dnslink=/ipns/ok.example"},
+	})
+	node.UpdateConfig(func(cfg *config.Config) {
+		cfg.DNS.Resolvers = map[string]string{"example.": srv.URL + "/dns-query"}
+	})
+
+	check := func(domain string) name.DNSLinkCheckOutput {
+		var out name.DNSLinkCheckOutput
+		res := node.IPFS("name", "dnslink", "check", "--enc=json", domain)
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		return out
+	}
+
+	t.Run("valid record", func(t *testing.T) {
+		out := check("ok.example")
+		assert.Equal(t, "_dnslink.ok.example", out.Lookup)
+		assert.Equal(t, srv.URL+"/dns-query", out.Resolver)
+		assert.Equal(t, "/ipfs/"+cid, out.Value)
+		assert.Empty(t, out.Error)
+		assert.NotZero(t, out.TTL)
+		require.NotNil(t, out.Target)
+		assert.True(t, out.Target.Local)
+		assert.Equal(t, -1, out.Target.Providers)
+
+		res := node.IPFS("name", "dnslink", "check", "ok.example")
+		assert.Contains(t, res.Stdout.String(), "Value:     /ipfs/"+cid)
+		assert.Contains(t, res.Stdout.String(), "Local:     yes")
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		out := check("broken.example")
+		assert.Equal(t, "/ipfs/"+cid, out.Value)
+		require.Len(t, out.Records, 2)
+		assert.Empty(t, out.Records[0].Error)
+		assert.Contains(t, out.Records[1].Error, "invalid value")
+	})
+
+	t.Run("multiple records", func(t *testing.T) {
+		out := check("twice.example")
+		assert.Empty(t, out.Value)
+		assert.Contains(t, out.Error, "more than one")
+		assert.Nil(t, out.Target)
+	})
+
+	t.Run("missing record", func(t *testing.T) {
+		out := check("missing.example")
+		assert.Empty(t, out.Records)
+		assert.NotEmpty(t, out.Error)
+	})
+}
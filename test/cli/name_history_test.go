@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameHistory(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init()
+	node.IPFS("key", "gen", "site")
+	first := "/ipfs/" + node.IPFSAddStr("first")
+	second := "/ipfs/" + node.IPFSAddStr("second")
+	node.IPFS("name", "publish", "--allow-offline", "--key=site", first)
+	node.IPFS("name", "publish", "--allow-offline", "--key=site", second)
+
+	history := func() name.HistoryList {
+		var list name.HistoryList
+		res := node.IPFS("name", "history", "--enc=json", "site")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &list))
+		return list
+	}
+
+	list := history()
+	require.Len(t, list.Records, 2)
+	assert.Equal(t, first, list.Records[0].Value)
+	assert.Equal(t, second, list.Records[1].Value)
+	assert.False(t, list.Records[0].Current)
+	assert.True(t, list.Records[1].Current)
+	assert.Equal(t, "publish", list.Records[0].Origin)
+
+	res := node.IPFS("name", "rollback", "--allow-offline", "site", "0")
+	assert.Equal(t, "Rolled back "+list.Name+" to "+first+" (sequence 2)", res.Stdout.Trimmed())
+
+	list = history()
+	require.Len(t, list.Records, 3)
+	assert.Equal(t, uint64(2), list.Records[2].Sequence)
+	assert.Equal(t, first, list.Records[2].Value)
+	assert.True(t, list.Records[2].Current)
+
+	res = node.IPFS("name", "resolve", "--offline", "/ipns/"+list.Name)
+	assert.Equal(t, first, res.Stdout.Trimmed())
+
+	res = node.RunIPFS("name", "rollback", "--allow-offline", "site", "9")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "no archived record with this sequence number: 9")
+}
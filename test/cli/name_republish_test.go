@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameRepublish(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init()
+	node.IPFS("key", "gen", "site")
+	node.UpdateConfig(func(cfg *config.Config) {
+		cfg.Routing.Type = config.NewOptionalString("none")
+		cfg.Ipns.Keys = map[string]config.IpnsKey{
+			"site": {RepublishPeriod: config.NewOptionalDuration(30 * time.Minute)},
+		}
+	})
+
+	list := func() map[string]name.RepublishKey {
+		var out name.RepublishList
+		res := node.IPFS("name", "republish", "ls", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		keys := make(map[string]name.RepublishKey)
+		for _, k := range out.Keys {
+			keys[k.Key] = k
+		}
+		return keys
+	}
+
+	cid := node.IPFSAddStr("hello")
+	node.IPFS("name", "publish", "--allow-offline", "--key=site", "/ipfs/"+cid)
+
+	keys := list()
+	require.Len(t, keys, 2)
+	assert.Equal(t, "30m0s", keys["site"].Interval)
+	assert.Equal(t, "48h0m0s", keys["site"].RecordLifetime)
+	assert.Equal(t, "/ipfs/"+cid, keys["site"].Value)
+	assert.Empty(t, keys["self"].Value)
+
+	node.IPFS("name", "republish", "pause", "site")
+	assert.True(t, list()["site"].Paused)
+	assert.Contains(t, node.IPFS("name", "republish", "ls").Stdout.String(), "paused")
+	res := node.RunIPFS("name", "republish", "pause", "missing")
+	assert.Error(t, res.Err)
+
+	res = node.RunIPFS("name", "republish", "now", "site")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "requires a running daemon")
+
+	node.StartDaemon()
+	defer node.StopDaemon()
+
+	// paused keys can still be republished on demand
+	node.IPFS("name", "republish", "now", "site")
+	site := list()["site"]
+	assert.True(t, site.Paused)
+	assert.False(t, site.LastRepublished.IsZero())
+	assert.Empty(t, site.Error)
+
+	node.IPFS("name", "republish", "resume", "site")
+	site = list()["site"]
+	assert.False(t, site.Paused)
+	assert.WithinDuration(t, site.LastRepublished.Add(30*time.Minute), site.Next, time.Second)
+
+	res = node.RunIPFS("name", "republish", "now", "self")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "no IPNS record has been published")
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/kubo/core/commands/name"
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameResolveTrace(t *testing.T) {
+	t.Parallel()
+
+	node := harness.NewT(t).NewNode().Init()
+	cid := node.IPFSAddStr("hello")
+	node.IPFS("name", "publish", "--allow-offline", "/ipfs/"+cid)
+	self := node.PeerID().String()
+
+	t.Run("text", func(t *testing.T) {
+		res := node.IPFS("name", "resolve", "--trace", self)
+		lines := strings.Split(res.Stdout.Trimmed(), "\n")
+		assert.True(t, strings.HasPrefix(lines[0], "lookup cache ("))
+		assert.True(t, strings.HasSuffix(lines[0], "): not cached"))
+		assert.Contains(t, res.Stdout.String(), "lookup local datastore (")
+		assert.Contains(t, res.Stdout.String(), "/ipfs/"+cid+" seq=0 valid until ")
+		assert.Contains(t, res.Stdout.String(), ": local datastore, only valid record returned")
+		assert.Equal(t, "/ipfs/"+cid, lines[len(lines)-1])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		res := node.IPFS("name", "resolve", "--trace", "--nocache", "--enc=json", self)
+		dec := json.NewDecoder(bytes.NewReader(res.Stdout.Bytes()))
+		var events []name.ResolvedPath
+		for dec.More() {
+			var ev name.ResolvedPath
+			require.NoError(t, dec.Decode(&ev))
+			events = append(events, ev)
+		}
+		require.Len(t, events, 3)
+
+		lookup := events[0].Trace
+		require.NotNil(t, lookup)
+		assert.Equal(t, "local datastore", lookup.Source)
+		require.Len(t, lookup.Records, 1)
+		assert.Equal(t, "/ipfs/"+cid, lookup.Records[0].Value)
+		assert.False(t, lookup.Records[0].Validity.IsZero())
+
+		result := events[1].Trace
+		require.NotNil(t, result)
+		assert.Equal(t, "result", string(result.Type))
+		assert.Equal(t, "local datastore", result.Source)
+
+		assert.Nil(t, events[2].Trace)
+		assert.Equal(t, "/ipfs/"+cid, events[2].Path)
+	})
+}
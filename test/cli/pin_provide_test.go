@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinProvidePolicy(t *testing.T) {
+	t.Parallel()
+
+	pinLsProvide := func(t *testing.T, node *harness.Node, args ...string) map[string]string {
+		t.Helper()
+		var out struct {
+			Keys map[string]struct {
+				Type    string
+				Provide string
+			}
+		}
+		res := node.IPFS(append([]string{"pin", "ls", "--enc=json"}, args...)...)
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		policies := make(map[string]string, len(out.Keys))
+		for c, k := range out.Keys {
+			policies[c] = k.Provide
+		}
+		return policies
+	}
+
+	t.Run("pin add stores the policy and pin ls shows it", func(t *testing.T) {
+		t.Parallel()
+		node := setupTestNode(t)
+
+		cidA := node.IPFSAddStr("provide policy A", "--pin=false")
+		cidB := node.IPFSAddStr("provide policy B", "--pin=false")
+		node.IPFS("pin", "add", "--provide=roots", cidA)
+		node.IPFS("pin", "add", cidB)
+
+		policies := pinLsProvide(t, node, "--type=recursive")
+		assert.Equal(t, "roots", policies[cidA])
+		assert.Equal(t, "", policies[cidB])
+
+		text := node.IPFS("pin", "ls", "--type=recursive").Stdout.String()
+		assert.Contains(t, text, cidA+" recursive provide=roots\n")
+		assert.Contains(t, text, cidB+" recursive\n")
+
+		// pinning again without --provide keeps the policy
+		node.IPFS("pin", "add", cidA)
+		assert.Equal(t, "roots", pinLsProvide(t, node, cidA)[cidA])
+
+		// unpinning forgets it
+		node.IPFS("pin", "rm", cidA)
+		node.IPFS("pin", "add", cidA)
+		assert.Equal(t, "", pinLsProvide(t, node, cidA)[cidA])
+	})
+
+	t.Run("pin update carries the policy over", func(t *testing.T) {
+		t.Parallel()
+		node := setupTestNode(t)
+
+		from := node.IPFSAddStr("provide policy from", "--provide=none")
+		to := node.IPFSAddStr("provide policy to", "--pin=false")
+		node.IPFS("pin", "update", from, to)
+
+		policies := pinLsProvide(t, node, "--type=recursive")
+		assert.Equal(t, "none", policies[to])
+		_, stillPinned := policies[from]
+		assert.False(t, stillPinned)
+	})
+
+	t.Run("dag import sets the policy of the pinned roots", func(t *testing.T) {
+		t.Parallel()
+		node := setupTestNode(t)
+
+		cid := node.IPFSAddStr("provide policy car")
+		car := node.IPFS("dag", "export", cid).Stdout.Bytes()
+		node.IPFS("pin", "rm", cid)
+		node.PipeToIPFS(bytes.NewReader(car), "dag", "import", "--provide=all")
+
+		assert.Equal(t, "all", pinLsProvide(t, node, cid)[cid])
+	})
+
+	t.Run("invalid uses are rejected", func(t *testing.T) {
+		t.Parallel()
+		node := setupTestNode(t)
+
+		cid := node.IPFSAddStr("provide policy errors", "--pin=false")
+
+		res := node.RunIPFS("pin", "add", "--provide=pinned", cid)
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "invalid provide policy")
+
+		res = node.RunPipeToIPFS(strings.NewReader("provide policy unpinned"), "add", "--pin=false", "--provide=roots", "-q")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "provide option requires pin to be set")
+	})
+
+	t.Run("policies other than all need a selective strategy", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init()
+		node.SetIPFSConfig("Provide.Strategy", "all")
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		cid := node.IPFSAddStr("provide policy strategy all", "--pin=false")
+		res := node.RunIPFS("pin", "add", "--provide=roots", cid)
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), `has no effect with Provide.Strategy "all"`)
+
+		node.IPFS("pin", "add", "--provide=all", cid)
+	})
+}
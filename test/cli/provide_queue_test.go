@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type provideQueueKey struct {
+	Key    string
+	Source string
+}
+
+func provideQueueKeys(t *testing.T, node *harness.Node) []provideQueueKey {
+	t.Helper()
+	var out struct{ Keys []provideQueueKey }
+	res := node.IPFS("provide", "queue", "ls", "--enc=json")
+	require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+	return out.Keys
+}
+
+func TestProvideQueue(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lists and drops queued keys", func(t *testing.T) {
+		t.Parallel()
+
+		// without peers, nothing leaves the queue
+		h := harness.NewT(t)
+		node := h.NewNode().Init()
+		node.SetIPFSConfig("Provide.DHT.SweepEnabled", true)
+		node.SetIPFSConfig("Provide.Enabled", true)
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		// with Provide.Strategy "all", blocks are queued as they are written
+		cid := node.IPFSAddStr("provide queue", "--pin=false", "--fast-provide-root=false")
+
+		keys := provideQueueKeys(t, node)
+		require.Contains(t, keys, provideQueueKey{Key: cid, Source: "blockstore"})
+		assert.Regexp(t, cid+` \S+ blockstore`, node.IPFS("provide", "queue", "ls").Stdout.String())
+
+		res := node.RunIPFS("provide", "queue", "drop")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "no keys given")
+
+		res = node.IPFS("provide", "queue", "drop", cid)
+		assert.Equal(t, "removed 1 items from provide queue\n", res.Stdout.String())
+		assert.NotContains(t, provideQueueKeys(t, node), provideQueueKey{Key: cid, Source: "blockstore"})
+	})
+
+	t.Run("keys leave the queue once provided", func(t *testing.T) {
+		t.Parallel()
+
+		h := harness.NewT(t)
+		nodes := h.NewNodes(3).Init()
+		nodes.ForEachPar(func(n *harness.Node) {
+			n.SetIPFSConfig("Provide.DHT.SweepEnabled", true)
+			n.SetIPFSConfig("Provide.Enabled", true)
+		})
+		h.BootstrapWithStubDHT(nodes)
+		nodes = nodes.StartDaemons().Connect()
+		defer nodes.StopDaemons()
+		node := nodes[0]
+
+		cid := node.IPFSAddStr("provide queue, provided", "--pin=false", "--fast-provide-root=false")
+		node.IPFS("provide", "once", cid)
+		require.Eventually(t, func() bool {
+			return len(provideQueueKeys(t, node)) == 0
+		}, provideStatEventuallyTimeout, provideStatEventuallyTick)
+
+		cid = node.IPFSAddStr("provide queue, prioritized", "--pin=false", "--fast-provide-root=false")
+		res := node.IPFS("provide", "queue", "prioritize", cid)
+		assert.Equal(t, "prioritized "+cid+"\n", res.Stdout.String())
+		require.Eventually(t, func() bool {
+			return !slices.Contains(provideQueueKeys(t, node), provideQueueKey{Key: cid, Source: "blockstore"})
+		}, provideStatEventuallyTimeout, provideStatEventuallyTick)
+
+		res = nodes[1].IPFS("routing", "findprovs", "-n=1", cid)
+		assert.Equal(t, node.PeerID().String(), res.Stdout.Trimmed())
+	})
+
+	t.Run("rejects legacy provider", func(t *testing.T) {
+		t.Parallel()
+
+		h := harness.NewT(t)
+		node := h.NewNode().Init()
+		node.SetIPFSConfig("Provide.DHT.SweepEnabled", false)
+		node.SetIPFSConfig("Provide.Enabled", true)
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		res := node.RunIPFS("provide", "queue", "ls")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "only tracked by the sweep provider")
+	})
+}
@@ -337,6 +337,29 @@ func TestProvideStatFlags(t *testing.T) {
 		assert.Contains(t, output, "Avg record holders:")
 		assert.Contains(t, output, "Ongoing provides:")
 	})
+
+	t.Run("--schedule shows the rate budget", func(t *testing.T) {
+		t.Parallel()
+
+		h := harness.NewT(t)
+		node := h.NewNode().Init()
+		node.SetIPFSConfig("Provide.DHT.SweepEnabled", true)
+		node.SetIPFSConfig("Provide.Enabled", true)
+		node.SetIPFSConfig("Provide.DHT.MaxMessagesPerSecond", 1)
+		node.SetIPFSConfig("Provide.DHT.ActiveHours", "03:00-03:01")
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		node.IPFSAddStr("provide stat rate budget")
+
+		// a minute a day at one message per second cannot keep up
+		require.Eventually(t, func() bool {
+			return strings.Contains(node.IPFS("provide", "stat", "--schedule").Stdout.String(), "Budget cycle:")
+		}, provideStatEventuallyTimeout, provideStatEventuallyTick)
+		output := node.IPFS("provide", "stat", "--schedule").Stdout.String()
+		assert.Regexp(t, `Rate budget:\s+1 msgs/s, active 03:00-03:01`, output)
+		assert.Contains(t, output, "WARNING: exceeds Provide.DHT.Interval of 22h0m0s")
+	})
 }
 
 // TestProvideStatLegacyProvider tests Legacy provider specific behavior
@@ -375,6 +398,78 @@ func TestProvideStatLegacyProvider(t *testing.T) {
 		assert.Error(t, res.Err)
 		assert.Contains(t, res.Stderr.String(), "LAN stats only available for Sweep provider with Dual DHT")
 	})
+
+	t.Run("rejects per-CID status with legacy provider", func(t *testing.T) {
+		cid := node.IPFSAddStr("legacy per-CID status")
+		res := node.RunIPFS("provide", "stat", cid)
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "only tracked by the sweep provider")
+	})
+}
+
+// TestProvideStatPerCID tests the provide status of single CIDs and pins.
+func TestProvideStatPerCID(t *testing.T) {
+	t.Parallel()
+
+	h := harness.NewT(t)
+	nodes := h.NewNodes(3).Init()
+	nodes.ForEachPar(func(n *harness.Node) {
+		n.SetIPFSConfig("Provide.DHT.SweepEnabled", true)
+		n.SetIPFSConfig("Provide.Enabled", true)
+	})
+	h.BootstrapWithStubDHT(nodes)
+	nodes = nodes.StartDaemons().Connect()
+	defer nodes.StopDaemons()
+	node := nodes[0]
+
+	type keyStat struct {
+		Cid           string
+		PinName       string
+		Tracked       bool
+		Scheduled     bool
+		LastProvide   time.Time
+		NextReprovide time.Time
+		Peers         []string
+	}
+	keyStats := func(t *testing.T, args ...string) []keyStat {
+		t.Helper()
+		var out struct{ Keys []keyStat }
+		res := node.IPFS(append([]string{"provide", "stat", "--enc=json"}, args...)...)
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		return out.Keys
+	}
+
+	cid := node.IPFSAddStr("per-CID provide status", "--pin-name=dataset")
+	require.Eventually(t, func() bool {
+		keys := keyStats(t, cid)
+		return len(keys) == 1 && keys[0].Tracked && len(keys[0].Peers) > 0
+	}, provideStatEventuallyTimeout, provideStatEventuallyTick)
+
+	keys := keyStats(t, "--pin-name=dataset")
+	require.Len(t, keys, 1)
+	assert.Equal(t, cid, keys[0].Cid)
+	assert.Equal(t, "dataset", keys[0].PinName)
+	assert.True(t, keys[0].Scheduled)
+	assert.False(t, keys[0].LastProvide.IsZero())
+	assert.True(t, keys[0].NextReprovide.After(keys[0].LastProvide))
+
+	text := node.IPFS("provide", "stat", cid).Stdout.String()
+	assert.Contains(t, text, cid+":")
+	assert.Contains(t, text, "Scheduled:")
+	assert.Regexp(t, `Stored on:\s+[1-9][0-9]* peers`, text)
+
+	unpinned := node.IPFSAddStr("per-CID provide status, unpinned", "--pin=false", "--fast-provide-root=false")
+	keys = keyStats(t, unpinned)
+	require.Len(t, keys, 1)
+	assert.Equal(t, unpinned, keys[0].Cid)
+
+	res := node.RunIPFS("provide", "stat", "--pin-name=missing")
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), `no pin named "missing"`)
+
+	res = node.RunIPFS("provide", "stat", "--all", cid)
+	assert.Error(t, res.Err)
+	assert.Contains(t, res.Stderr.String(), "cannot use section flags with per-CID provide status")
 }
 
 // TestProvideStatOutputFormats tests different output formats
@@ -976,6 +976,36 @@ func runProviderSuite(t *testing.T, sweep bool, apply cfgApplier, awaitReprovide
 				[]string{cidChild}) // child of pin, not a root
 		})
 
+		t.Run("Reprovides pins according to their provide policy", func(t *testing.T) {
+			t.Parallel()
+
+			foo := random.Bytes(1000)
+			bar := random.Bytes(1000)
+			baz := random.Bytes(1000)
+
+			nodes := initNodesWithoutStart(t, 2, func(n *harness.Node) {
+				n.SetIPFSConfig("Provide.Strategy", "pinned")
+			})
+			publisher := nodes[0]
+			if sweep {
+				publisher.SetIPFSConfig("Provide.DHT.Interval", "30s")
+			}
+
+			cidFooChild := publisher.IPFSAdd(bytes.NewReader(foo), "-Q", "--only-hash")
+			cidFooDir := publisher.IPFSAdd(bytes.NewReader(foo), "-Q", "-w", "--provide=roots")
+			cidBar := publisher.IPFSAdd(bytes.NewReader(bar), "-Q", "--provide=none")
+			cidBazChild := publisher.IPFSAdd(bytes.NewReader(baz), "-Q", "--only-hash")
+			cidBazDir := publisher.IPFSAdd(bytes.NewReader(baz), "-Q", "-w")
+
+			nodes = nodes.StartDaemons().Connect()
+			defer nodes.StopDaemons()
+			peers := nodes[1:]
+
+			verifyReprovide(t, publisher, peers, 3, // cidFooDir + cidBazDir + cidBazChild
+				[]string{cidFooDir, cidBazDir, cidBazChild},
+				[]string{cidFooChild, cidBar}) // root-only pin child, and the pin with policy none
+		})
+
 		t.Run("Reprovides with 'mfs' strategy", func(t *testing.T) {
 			t.Parallel()
 
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/kubo/test/cli/harness"
+	. "github.com/ipfs/kubo/test/cli/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingStat(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requires custom routing", func(t *testing.T) {
+		t.Parallel()
+		node := harness.NewT(t).NewNode().Init().StartDaemon()
+		defer node.StopDaemon()
+
+		res := node.RunIPFS("routing", "stat")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), "Routing.Type=custom")
+	})
+
+	t.Run("counts requests per router and method", func(t *testing.T) {
+		t.Parallel()
+		prov := "12D3KooWAobjw92XDcnQ1rRmRJDA3zAQpdPYUpZKrJxH6yccSpje"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(ToJSONStr(JSONObj{
+				"Providers": []JSONObj{{
+					"Schema":    "peer",
+					"Protocols": []string{"transport-bitswap"},
+					"ID":        prov,
+					"Addrs":     []string{"/ip4/0.0.0.0/tcp/4001"},
+				}},
+			})))
+		}))
+		t.Cleanup(server.Close)
+
+		node := harness.NewT(t).NewNode().Init()
+		node.IPFS("config", "Routing.Type", "custom")
+		node.IPFS("config", "Routing.Routers", "--json", ToJSONStr(JSONObj{
+			"Delegated": JSONObj{
+				"Type":       "http",
+				"Parameters": JSONObj{"Endpoint": server.URL},
+			},
+			"Cache": JSONObj{
+				"Type":       "caching",
+				"Parameters": JSONObj{"RouterName": "Delegated"},
+			},
+		}))
+		node.IPFS("config", "Routing.Methods", "--json", ToJSONStr(JSONObj{
+			"find-peers":     JSONObj{"RouterName": "Cache"},
+			"find-providers": JSONObj{"RouterName": "Cache"},
+			"get-ipns":       JSONObj{"RouterName": "Delegated"},
+			"provide":        JSONObj{"RouterName": "Delegated"},
+			"put-ipns":       JSONObj{"RouterName": "Delegated"},
+		}))
+		node.StartDaemon()
+		defer node.StopDaemon()
+
+		cid := "bafkreigh2akiscaildcqabsyg3dfr6chu3fgpregiymsck7e7aqa4s52zy"
+		for range 2 {
+			res := node.IPFS("routing", "findprovs", cid)
+			assert.Equal(t, prov, res.Stdout.Trimmed())
+		}
+
+		var out struct {
+			Routers []struct {
+				Name    string
+				Type    string
+				Methods []struct {
+					Method   string
+					Requests uint64
+					Errors   uint64
+				}
+				Cache *struct {
+					ProviderHits   uint64
+					ProviderMisses uint64
+				}
+			}
+		}
+		res := node.IPFS("routing", "stat", "--enc=json")
+		require.NoError(t, json.Unmarshal(res.Stdout.Bytes(), &out))
+		require.Len(t, out.Routers, 2)
+
+		requests := func(i int, method string) uint64 {
+			for _, m := range out.Routers[i].Methods {
+				if m.Method == method {
+					return m.Requests
+				}
+			}
+			return 0
+		}
+		assert.Equal(t, "Cache", out.Routers[0].Name)
+		assert.Equal(t, "caching", out.Routers[0].Type)
+		assert.EqualValues(t, 2, requests(0, "find-providers"))
+		require.NotNil(t, out.Routers[0].Cache)
+		assert.EqualValues(t, 1, out.Routers[0].Cache.ProviderHits)
+		assert.EqualValues(t, 1, out.Routers[0].Cache.ProviderMisses)
+		assert.Equal(t, "Delegated", out.Routers[1].Name)
+		assert.EqualValues(t, 1, requests(1, "find-providers"))
+		assert.Nil(t, out.Routers[1].Cache)
+
+		text := node.IPFS("routing", "stat", "Delegated").Stdout.String()
+		assert.Contains(t, text, "ROUTER")
+		assert.Regexp(t, `Delegated\s+http\s+find-providers\s+1\s+0\s+0`, text)
+		assert.NotContains(t, text, "Cache")
+
+		res = node.RunIPFS("routing", "stat", "missing")
+		assert.Error(t, res.Err)
+		assert.Contains(t, res.Stderr.String(), `router "missing" not found`)
+
+		resp := node.APIClient().Get("/debug/metrics/prometheus")
+		assert.Contains(t, resp.Body, `ipfs_routing_router_request_duration_seconds_count{method="find-providers",result="success",router="Delegated"} 1`)
+		assert.Contains(t, resp.Body, `ipfs_routing_cache_lookups_total{lookup="providers",result="hit",router="Cache"} 1`)
+	})
+}
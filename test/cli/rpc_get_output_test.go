@@ -17,6 +17,7 @@ import (
 // - --archive:          tar archive           -> application/x-tar
 // - --compress:         gzip                  -> application/gzip
 // - --archive --compress: tar.gz              -> application/gzip
+// - --format=zip:       zip archive           -> application/zip
 //
 // Fixes: https://github.com/ipfs/kubo/issues/2376
 func TestRPCGetContentType(t *testing.T) {
@@ -53,6 +54,11 @@ func TestRPCGetContentType(t *testing.T) {
 			query:               "?arg=" + cid + "&archive=true&compress=true",
 			expectedContentType: "application/gzip",
 		},
+		{
+			name:                "format=zip returns application/zip",
+			query:               "?arg=" + cid + "&format=zip",
+			expectedContentType: "application/zip",
+		},
 	}
 
 	for _, tt := range tests {